@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+)
+
+const (
+	authModeHeader = "header"
+	authModeAPIKey = "apikey"
+	authModeJWT    = "jwt"
+)
+
+func newAuthenticator(conf AuthConf) (auth.Authenticator, error) {
+	switch conf.Mode {
+	case authModeHeader:
+		a := auth.NewTrustedHeader(conf.Header)
+		a.SetTenantHeader(conf.TenantHeader)
+		return a, nil
+	case authModeAPIKey:
+		if len(conf.APIKeys) == 0 {
+			return nil, fmt.Errorf("no api keys configured")
+		}
+		return auth.NewAPIKeys(conf.APIKeys), nil
+	case authModeJWT:
+		keys, err := auth.LoadJWKS(conf.JWT.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("load jwks: %w", err)
+		}
+		return auth.NewJWT(keys, conf.JWT.Issuer, conf.JWT.Audience), nil
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", conf.Mode)
+	}
+}
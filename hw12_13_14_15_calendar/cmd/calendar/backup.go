@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/backup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var (
+	errNotEmpty      = errors.New("storage is not empty, use -force to replace its data")
+	errNotPersistent = errors.New("the memory storage keeps no data between runs to back up or restore")
+)
+
+// SnapshotStorage copies all the data, e.g. for backups.
+type SnapshotStorage interface {
+	Snapshot(ctx context.Context) (storage.Snapshot, error)
+	Restore(ctx context.Context, snap storage.Snapshot) error
+}
+
+// runStorageCommand runs backup or restore with the configured storage.
+func runStorageCommand(conf StorageConf, command string, args []string) (err error) {
+	if conf.Type == storageMemory {
+		return errNotPersistent
+	}
+	ctx := context.Background()
+	s, err := newStorage(conf)
+	if err != nil {
+		return err
+	}
+	if err := s.Connect(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := s.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if command == "backup" {
+		return runBackup(ctx, s, args, os.Stdout)
+	}
+	return runRestore(ctx, s, args, os.Stdin, os.Stdout)
+}
+
+// runBackup handles "calendar backup -out file", the storage must not be used by a running server.
+func runBackup(ctx context.Context, s SnapshotStorage, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", "", "Archive file, stdout if empty")
+	_ = fs.Parse(args)
+
+	snap, err := s.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := backup.Write(stdout, snap, time.Now())
+		return err
+	}
+
+	// The archive keeps webhook secrets, so it is readable by the owner only.
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Write(f, snap, time.Now())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	printManifest(stdout, manifest)
+	return nil
+}
+
+// runRestore handles "calendar restore -in file [-dry-run] [-force]".
+func runRestore(ctx context.Context, s SnapshotStorage, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("in", "", "Archive file, stdin if empty")
+	dryRun := fs.Bool("dry-run", false, "Verify the archive without changing the storage")
+	force := fs.Bool("force", false, "Replace the data of a non-empty storage")
+	_ = fs.Parse(args)
+
+	r := stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	snap, manifest, err := backup.Read(r)
+	if err != nil {
+		return err
+	}
+	printManifest(stdout, manifest)
+	if *dryRun {
+		fmt.Fprintln(stdout, "dry run, the storage is not changed")
+		return nil
+	}
+
+	if !*force {
+		current, err := s.Snapshot(ctx)
+		if err != nil {
+			return err
+		}
+		if len(current.Calendars) > 0 || len(current.Events) > 0 {
+			return errNotEmpty
+		}
+	}
+	if err := s.Restore(ctx, snap); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "restored")
+	return nil
+}
+
+func printManifest(w io.Writer, m backup.Manifest) {
+	fmt.Fprintf(w, "backup version %d created at %s\n", m.Version, m.CreatedAt.Format(time.RFC3339))
+	for _, s := range m.Sections {
+		fmt.Fprintf(w, "  %-20s %8d  sha256:%s\n", s.Name, s.Records, s.SHA256)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	filestorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/file"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	source := StorageConf{Type: storageFile, File: FileStorageConf{Dir: t.TempDir()}}
+	target := StorageConf{Type: storageFile, File: FileStorageConf{Dir: t.TempDir()}}
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	s := filestorage.New(source.File.Dir, 0)
+	require.NoError(t, s.Connect(ctx))
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "alice", Name: "Work"}))
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.CreateEvent(ctx, "alice", storage.Event{
+		ID: "1", CalendarID: "work", OwnerID: "alice", Title: "standup", StartAt: start, EndAt: start.Add(time.Hour),
+	}))
+	want, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.Close(ctx))
+
+	require.NoError(t, runStorageCommand(source, "backup", []string{"-out", archive}))
+
+	snapshot := func(conf StorageConf) storage.Snapshot {
+		s := filestorage.New(conf.File.Dir, 0)
+		require.NoError(t, s.Connect(ctx))
+		defer s.Close(ctx)
+		snap, err := s.Snapshot(ctx)
+		require.NoError(t, err)
+		return snap
+	}
+
+	require.NoError(t, runStorageCommand(target, "restore", []string{"-in", archive, "-dry-run"}))
+	require.Empty(t, snapshot(target).Events)
+
+	require.NoError(t, runStorageCommand(target, "restore", []string{"-in", archive}))
+	require.Equal(t, want, snapshot(target))
+
+	err = runStorageCommand(target, "restore", []string{"-in", archive})
+	require.True(t, errors.Is(err, errNotEmpty))
+	require.NoError(t, runStorageCommand(target, "restore", []string{"-in", archive, "-force"}))
+
+	require.NoError(t, ioutil.WriteFile(archive, []byte("garbage"), 0o600))
+	require.Error(t, runStorageCommand(target, "restore", []string{"-in", archive, "-dry-run"}))
+
+	memory := StorageConf{Type: storageMemory}
+	require.True(t, errors.Is(runStorageCommand(memory, "backup", []string{"-out", archive}), errNotPersistent))
+	require.True(t, errors.Is(runStorageCommand(memory, "restore", []string{"-in", archive}), errNotPersistent))
+}
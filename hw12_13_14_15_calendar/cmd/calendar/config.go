@@ -1,10 +1,31 @@
 package main
 
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/notify"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
 // При желании конфигурацию можно вынести в internal/config.
 // Организация конфига в main принуждает нас сужать API компонентов, использовать
 // при их конструировании только необходимые параметры, а также уменьшает вероятность циклической зависимости.
 type Config struct {
-	Logger LoggerConf
+	Logger        LoggerConf
+	HTTP          HTTPConf
+	GRPC          GRPCConf
+	Auth          AuthConf
+	Tracing       TracingConf
+	Storage       StorageConf
+	Webhooks      WebhooksConf
+	Trash         TrashConf
+	Scheduler     SchedulerConf
+	Notifications NotificationsConf
+	Attachments   AttachmentsConf
+	Shutdown      ShutdownConf
+	Quotas        QuotasConf
 	// TODO
 }
 
@@ -13,8 +34,200 @@ type LoggerConf struct {
 	// TODO
 }
 
-func NewConfig() Config {
-	return Config{}
+type HTTPConf struct {
+	Host string
+	Port string
+}
+
+type GRPCConf struct {
+	Host string
+	Port string
+}
+
+type AuthConf struct {
+	// Mode is one of "header", "apikey" or "jwt".
+	Mode string
+	// Header is a name of the trusted header with the user ID for the "header" mode.
+	Header string
+	// TenantHeader is a name of the trusted header with the tenant ID for the "header" mode.
+	TenantHeader string `toml:"tenant_header"`
+	// APIKeys maps a static API key to the user ID for the "apikey" mode.
+	APIKeys map[string]string `toml:"api_keys"`
+	JWT     JWTConf
+}
+
+type JWTConf struct {
+	JWKSFile string `toml:"jwks_file"`
+	Issuer   string
+	Audience string
+}
+
+type TracingConf struct {
+	// Exporter is one of "none", "stdout" or "otlp".
+	Exporter string
+	// Endpoint is host:port of the OTLP/HTTP collector.
+	Endpoint string
+}
+
+type StorageConf struct {
+	// Type is one of "memory", "file" or "sql".
+	Type string
+	File FileStorageConf
+	SQL  SQLStorageConf
+}
+
+type FileStorageConf struct {
+	Dir             string
+	CompactInterval duration `toml:"compact_interval"`
+}
+
+type SQLStorageConf struct {
+	// DSN is the PostgreSQL connection string, a URL or key=value pairs.
+	DSN string
+}
+
+type WebhooksConf struct {
+	Workers     int
+	MaxAttempts int      `toml:"max_attempts"`
+	Backoff     duration // before the second attempt, doubles for every next one
+	MaxBackoff  duration `toml:"max_backoff"`
+	// RetryInterval is how often failed deliveries due for another attempt are retried.
+	RetryInterval duration `toml:"retry_interval"`
+	// MaxFailures is the number of failed deliveries in a row which disables a webhook.
+	MaxFailures int `toml:"max_failures"`
+	Timeout     duration
+	// AllowedHosts are host names, IPs and CIDRs of internal receivers, deliveries to
+	// loopback, link-local and private addresses are refused otherwise.
+	AllowedHosts []string `toml:"allowed_hosts"`
+}
+
+type TrashConf struct {
+	// Retention is how long deleted events can be restored.
+	Retention     duration
+	PurgeInterval duration `toml:"purge_interval"`
 }
 
-// TODO
+type SchedulerConf struct {
+	// ID identifies the replica in the leader election, the hostname and the PID by default.
+	ID string
+	// Replicas is the number of replicas sharing the storage, more than one needs a storage
+	// which is not local to the process.
+	Replicas int
+	// Lease is how long the leader runs the jobs without renewing its lease, a failed leader
+	// is replaced within 4/3 of it.
+	Lease duration
+}
+
+type NotificationsConf struct {
+	// TemplatesDir overrides and extends the built-in templates, see the notify package.
+	TemplatesDir string `toml:"templates_dir"`
+	// DefaultLocale is used for users with an unsupported locale.
+	DefaultLocale string `toml:"default_locale"`
+	// SendInterval is how often due notifications are sent.
+	SendInterval duration `toml:"send_interval"`
+	// MaxAttempts is how many times a notification is tried before it is dead.
+	MaxAttempts int `toml:"max_attempts"`
+}
+
+type AttachmentsConf struct {
+	// Store is one of "none", "fs" or "s3", attachments are disabled with "none".
+	Store string
+	// MaxSize is the maximum size of a file in bytes.
+	MaxSize int64 `toml:"max_size"`
+	// ContentTypes are the allowed media types, e.g. "image/*", anything is allowed if it is empty.
+	ContentTypes []string `toml:"content_types"`
+	FS           FSBlobConf
+	S3           S3BlobConf
+}
+
+type FSBlobConf struct {
+	Dir string
+}
+
+type S3BlobConf struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	Timeout   duration
+}
+
+type ShutdownConf struct {
+	// DrainDelay is how long the server keeps serving while reported as not ready, so that
+	// load balancers notice it before new requests are rejected.
+	DrainDelay duration `toml:"drain_delay"`
+	// Timeout is how long in-flight requests and background jobs have to finish.
+	Timeout duration
+}
+
+type QuotasConf struct {
+	// MaxEvents is the maximum number of events of a tenant, zero means no limit.
+	MaxEvents int `toml:"max_events"`
+	// TenantMaxEvents overrides MaxEvents for the tenants.
+	TenantMaxEvents map[string]int `toml:"tenant_max_events"`
+}
+
+// duration is time.Duration written in the config as a string, e.g. "5m".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func NewConfig(path string) (Config, error) {
+	config := Config{
+		Logger: LoggerConf{Level: "INFO"},
+		HTTP:   HTTPConf{Host: "0.0.0.0", Port: "8080"},
+		GRPC:   GRPCConf{Host: "0.0.0.0", Port: "50051"},
+		Auth:   AuthConf{Mode: authModeHeader},
+		Tracing: TracingConf{
+			Exporter: tracing.ExporterNone,
+			Endpoint: "localhost:4318",
+		},
+		Storage: StorageConf{
+			Type: storageMemory,
+			File: FileStorageConf{
+				Dir:             "/var/lib/calendar",
+				CompactInterval: duration{5 * time.Minute},
+			},
+		},
+		Webhooks: WebhooksConf{
+			Workers:       4,
+			MaxAttempts:   5,
+			Backoff:       duration{time.Second},
+			MaxBackoff:    duration{time.Minute},
+			RetryInterval: duration{10 * time.Second},
+			MaxFailures:   10,
+			Timeout:       duration{10 * time.Second},
+		},
+		Trash: TrashConf{
+			Retention:     duration{30 * 24 * time.Hour},
+			PurgeInterval: duration{time.Hour},
+		},
+		Scheduler: SchedulerConf{Replicas: 1, Lease: duration{15 * time.Second}},
+		Notifications: NotificationsConf{
+			DefaultLocale: notify.DefaultLocale,
+			SendInterval:  duration{time.Minute},
+			MaxAttempts:   5,
+		},
+		Attachments: AttachmentsConf{
+			Store:   blobStoreFS,
+			MaxSize: app.DefaultMaxAttachmentSize,
+			FS:      FSBlobConf{Dir: "/var/lib/calendar/attachments"},
+			S3:      S3BlobConf{Region: "us-east-1", Timeout: duration{30 * time.Second}},
+		},
+		Shutdown: ShutdownConf{
+			DrainDelay: duration{5 * time.Second},
+			Timeout:    duration{15 * time.Second},
+		},
+	}
+	if _, err := toml.DecodeFile(path, &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
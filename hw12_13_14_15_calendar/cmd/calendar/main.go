@@ -3,15 +3,25 @@ package main
 import (
 	"context"
 	"flag"
+	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/delivery"
 	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/notify"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	internalgrpc "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc"
 	internalhttp "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/http"
-	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/webhook"
 )
 
 var configFile string
@@ -28,42 +38,239 @@ func main() {
 		return
 	}
 
-	config := NewConfig()
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Fatalf("failed to read config: %v", err)
+	}
 	logg := logger.New(config.Logger.Level)
 
-	storage := memorystorage.New()
-	calendar := app.New(logg, storage)
+	if command := flag.Arg(0); command == "backup" || command == "restore" {
+		if err := runStorageCommand(config.Storage, command, flag.Args()[1:]); err != nil {
+			log.Fatalf("%s failed: %v", command, err)
+		}
+		return
+	}
 
-	server := internalhttp.NewServer(calendar)
+	authenticator, err := newAuthenticator(config.Auth)
+	if err != nil {
+		log.Fatalf("failed to create authenticator: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "calendar", config.Tracing.Exporter, config.Tracing.Endpoint)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logg.Error("failed to flush traces: " + err.Error())
+		}
+	}()
+
+	storage, err := newStorage(config.Storage)
+	if err != nil {
+		log.Fatalf("failed to create storage: %v", err)
+	}
+	if err := storage.Connect(context.Background()); err != nil {
+		log.Fatalf("failed to connect to storage: %v", err)
+	}
+	defer func() {
+		if err := storage.Close(context.Background()); err != nil {
+			logg.Error("failed to close storage: " + err.Error())
+		}
+	}()
+
+	dispatcher := webhook.New(storage, logg, webhookConfig(config.Webhooks))
+	calendar := app.New(logg, storage, dispatcher)
+	calendar.SetQuotas(app.Quotas{
+		MaxEvents:       config.Quotas.MaxEvents,
+		TenantMaxEvents: config.Quotas.TenantMaxEvents,
+	})
+	blobs, err := newBlobStore(config.Attachments)
+	if err != nil {
+		log.Fatalf("failed to create attachment store: %v", err)
+	}
+	if blobs != nil {
+		calendar.SetBlobStore(blobs, app.AttachmentLimits{
+			MaxSize:      config.Attachments.MaxSize,
+			ContentTypes: config.Attachments.ContentTypes,
+		})
+	}
+
+	renderer, err := notify.NewRenderer(config.Notifications.TemplatesDir, config.Notifications.DefaultLocale)
+	if err != nil {
+		log.Fatalf("failed to load notification templates: %v", err)
+	}
+
+	messages := delivery.NewOutboxChanQueue(outboxQueueSize)
+	statuses := delivery.NewChanQueue(statusQueueSize)
+	sinks := notificationSinks(logg)
+	calendar.SetChannels(sinkChannels(sinks)...)
+	sender := delivery.NewSender(renderer, storage, statuses, config.Notifications.MaxAttempts, sinks)
+
+	server := internalhttp.NewServer(calendar, authenticator, net.JoinHostPort(config.HTTP.Host, config.HTTP.Port))
+	server.SetLogger(logg)
+	server.SetRenderer(renderer)
+	grpcServer := internalgrpc.NewServer(logg, calendar, authenticator, net.JoinHostPort(config.GRPC.Host, config.GRPC.Port))
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	workers := sync.WaitGroup{}
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		if err := sender.Run(ctx, messages); err != nil {
+			logg.Error("failed to send notifications: " + err.Error())
+		}
+	}()
+	go func() {
+		defer workers.Done()
+		if err := delivery.NewRecorder(storage, logg).Run(ctx, statuses); err != nil {
+			logg.Error("failed to record delivery statuses: " + err.Error())
+		}
+	}()
+	if config.Scheduler.Lease.Duration <= 0 {
+		log.Fatalf("scheduler lease must be positive")
+	}
+	if err := checkReplicas(config.Storage, config.Scheduler); err != nil {
+		log.Fatalf("failed to start the scheduler: %v", err)
+	}
+	elector := scheduler.NewElector(storage, logg, "scheduler", replicaID(config.Scheduler), config.Scheduler.Lease.Duration)
+	server.AddHealthCheck("scheduler", func() interface{} {
+		lease, leader := elector.Leader()
+		return map[string]interface{}{"leader": lease.Holder, "is_leader": leader, "lease_expires_at": lease.ExpiresAt}
+	})
+	jobs := scheduler.New(logg,
+		scheduler.PurgeTrash(storage, blobs, logg, config.Trash.Retention.Duration, config.Trash.PurgeInterval.Duration),
+		delivery.NewRelay(storage, messages).Job(config.Notifications.SendInterval.Duration),
+		dispatcher.RetryJob(config.Webhooks.RetryInterval.Duration),
+	)
+	calendar.SetScheduler(jobs)
 	go func() {
+		defer workers.Done()
+		elector.Run(ctx, jobs.Run)
+	}()
+
+	stopped := make(chan struct{})
+	go func(config Config) {
+		defer close(stopped)
+
 		signals := make(chan os.Signal, 1)
-		signal.Notify(signals, syscall.SIGINT, syscall.SIGHUP)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-		select {
-		case <-ctx.Done():
-			return
-		case <-signals:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGHUP {
+					config = reloadConfig(live{logger: logg, scheduler: jobs, dispatcher: dispatcher, sender: sender}, config)
+					continue
+				}
+			}
+			break
 		}
 
 		signal.Stop(signals)
-		cancel()
+		shutdown(logg, config.Shutdown, server, grpcServer, cancel, &workers)
+	}(config)
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-		defer cancel()
+	logg.Info("calendar is running...")
 
-		if err := server.Stop(ctx); err != nil {
-			logg.Error("failed to stop http server: " + err.Error())
+	go func() {
+		if err := grpcServer.Start(ctx); err != nil {
+			logg.Error("failed to start grpc server: " + err.Error())
+			cancel()
+			os.Exit(1)
 		}
 	}()
 
-	logg.Info("calendar is running...")
-
 	if err := server.Start(ctx); err != nil {
 		logg.Error("failed to start http server: " + err.Error())
 		cancel()
 		os.Exit(1) //nolint:gocritic
 	}
+	<-stopped
+}
+
+// shutdown reports the server as not ready for the drain delay, then stops it and the
+// background workers, waiting for them until the timeout.
+func shutdown(logg *logger.Logger, conf ShutdownConf, server *internalhttp.Server, grpcServer *internalgrpc.Server,
+	stopWorkers context.CancelFunc, workers *sync.WaitGroup) {
+	logg.Info("calendar is shutting down...")
+	server.Drain()
+	time.Sleep(conf.DrainDelay.Duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout.Duration)
+	defer cancel()
+
+	if err := server.Stop(ctx); err != nil {
+		logg.Error("failed to stop http server: " + err.Error())
+	}
+	if err := grpcServer.Stop(ctx); err != nil {
+		logg.Error("failed to stop grpc server: " + err.Error())
+	}
+	stopWorkers()
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logg.Info("calendar is stopped")
+	case <-ctx.Done():
+		logg.Error("background jobs have not finished before the shutdown timeout")
+	}
+}
+
+func webhookConfig(conf WebhooksConf) webhook.Config {
+	return webhook.Config{
+		Workers:      conf.Workers,
+		MaxAttempts:  conf.MaxAttempts,
+		Backoff:      conf.Backoff.Duration,
+		MaxBackoff:   conf.MaxBackoff.Duration,
+		MaxFailures:  conf.MaxFailures,
+		Timeout:      conf.Timeout.Duration,
+		AllowedHosts: conf.AllowedHosts,
+	}
+}
+
+const (
+	// outboxQueueSize is how many notifications wait to be sent before the relay blocks.
+	outboxQueueSize = 100
+	// statusQueueSize is how many delivery statuses wait to be recorded before the sender blocks.
+	statusQueueSize = 100
+)
+
+// notificationSinks returns the sinks of the channels notifications are sent through, only the
+// log channel has one. Reminders of other channels are refused.
+func notificationSinks(logg *logger.Logger) map[storage.Channel]delivery.Sink {
+	return map[storage.Channel]delivery.Sink{
+		storage.ChannelLog: delivery.NewLogSink(logg),
+	}
+}
+
+func sinkChannels(sinks map[storage.Channel]delivery.Sink) []storage.Channel {
+	channels := make([]storage.Channel, 0, len(sinks))
+	for channel := range sinks {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// replicaID returns the configured scheduler ID or the hostname and the PID.
+func replicaID(conf SchedulerConf) string {
+	if conf.ID != "" {
+		return conf.ID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "calendar"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
 }
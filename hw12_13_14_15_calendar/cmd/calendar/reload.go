@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/delivery"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/webhook"
+)
+
+// live are the running components the reloaded config is applied to.
+type live struct {
+	logger     *logger.Logger
+	scheduler  *scheduler.Scheduler
+	dispatcher *webhook.Dispatcher
+	sender     *delivery.Sender
+}
+
+// reloadConfig re-reads the config file and applies the fields which can be changed live.
+// It returns the config the service runs with now.
+func reloadConfig(l live, current Config) Config {
+	config, err := NewConfig(configFile)
+	if err != nil {
+		l.logger.Error("failed to reload config: " + err.Error())
+		return current
+	}
+
+	var applied, restart []string
+	webhooks := false
+	for _, field := range changedFields(current, config) {
+		switch field {
+		case "logger.level":
+			if err := l.logger.SetLevel(config.Logger.Level); err != nil {
+				l.logger.Error("failed to apply logger.level: " + err.Error())
+				continue
+			}
+			current.Logger.Level = config.Logger.Level
+		case "trash.purge_interval":
+			l.scheduler.SetInterval(scheduler.PurgeTrashJob, config.Trash.PurgeInterval.Duration)
+			current.Trash.PurgeInterval = config.Trash.PurgeInterval
+		case "notifications.send_interval":
+			l.scheduler.SetInterval(delivery.SendJob, config.Notifications.SendInterval.Duration)
+			current.Notifications.SendInterval = config.Notifications.SendInterval
+		case "webhooks.retry_interval":
+			l.scheduler.SetInterval(webhook.RetryJob, config.Webhooks.RetryInterval.Duration)
+			current.Webhooks.RetryInterval = config.Webhooks.RetryInterval
+		case "notifications.max_attempts":
+			l.sender.SetMaxAttempts(config.Notifications.MaxAttempts)
+			current.Notifications.MaxAttempts = config.Notifications.MaxAttempts
+		case "webhooks.max_attempts", "webhooks.backoff", "webhooks.max_backoff", "webhooks.max_failures",
+			"webhooks.timeout", "webhooks.allowed_hosts":
+			webhooks = true
+		default:
+			restart = append(restart, field)
+			continue
+		}
+		applied = append(applied, field)
+	}
+	if webhooks {
+		workers := current.Webhooks.Workers
+		current.Webhooks = config.Webhooks
+		current.Webhooks.Workers = workers
+		l.dispatcher.SetConfig(webhookConfig(current.Webhooks))
+	}
+
+	l.logger.Info("config reloaded, applied: [" + strings.Join(applied, ", ") + "]")
+	if len(restart) > 0 {
+		l.logger.Warn("config fields require restart to apply: [" + strings.Join(restart, ", ") + "]")
+	}
+	return current
+}
+
+// changedFields returns dotted names of the config fields, as in the file, which differ.
+func changedFields(old, updated Config) []string {
+	return diff("", reflect.ValueOf(old), reflect.ValueOf(updated))
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func diff(prefix string, old, updated reflect.Value) []string {
+	if old.Kind() != reflect.Struct || reflect.PtrTo(old.Type()).Implements(textUnmarshalerType) {
+		if reflect.DeepEqual(old.Interface(), updated.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var fields []string
+	for i := 0; i < old.NumField(); i++ {
+		f := old.Type().Field(i)
+		name := f.Tag.Get("toml")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fields = append(fields, diff(name, old.Field(i), updated.Field(i))...)
+	}
+	return fields
+}
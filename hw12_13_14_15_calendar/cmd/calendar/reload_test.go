@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFields(t *testing.T) {
+	old := Config{
+		Logger: LoggerConf{Level: "INFO"},
+		HTTP:   HTTPConf{Host: "0.0.0.0", Port: "8080"},
+		Auth:   AuthConf{Mode: authModeAPIKey, APIKeys: map[string]string{"key": "user"}},
+	}
+	require.Empty(t, changedFields(old, old))
+
+	changed := old
+	changed.Logger.Level = "DEBUG"
+	changed.HTTP.Port = "8081"
+	changed.Auth.APIKeys = map[string]string{"key": "other"}
+	changed.Storage.File.CompactInterval = duration{time.Minute}
+	require.Equal(t, []string{
+		"logger.level",
+		"http.port",
+		"auth.api_keys",
+		"storage.file.compact_interval",
+	}, changedFields(old, changed))
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer func(path string) { configFile = path }(configFile)
+	configFile = filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+[trash]
+purge_interval = "1ms"
+
+[webhooks]
+workers = 16
+max_attempts = 2
+retry_interval = "1m"
+`), 0o600))
+
+	var purges int32
+	logg := logger.New("ERROR")
+	jobs := scheduler.New(logg, scheduler.Job{
+		Name:     scheduler.PurgeTrashJob,
+		Interval: time.Hour,
+		Run: func(context.Context) error {
+			atomic.AddInt32(&purges, 1)
+			return nil
+		},
+	}, scheduler.Job{
+		Name: webhook.RetryJob,
+		Run:  func(context.Context) error { return nil },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&purges) == 1 }, time.Second, time.Millisecond)
+
+	current, err := NewConfig(configFile)
+	require.NoError(t, err)
+	current.Trash.PurgeInterval = duration{time.Hour}
+	current.Webhooks.Workers = 4
+	current.Webhooks.MaxAttempts = 5
+	current.Webhooks.RetryInterval = duration{10 * time.Second}
+
+	l := live{logger: logg, scheduler: jobs, dispatcher: webhook.New(nil, logg, webhookConfig(current.Webhooks))}
+	updated := reloadConfig(l, current)
+	require.Equal(t, time.Millisecond, updated.Trash.PurgeInterval.Duration)
+	require.Equal(t, 2, updated.Webhooks.MaxAttempts)
+	require.Equal(t, 4, updated.Webhooks.Workers)
+	require.Equal(t, time.Millisecond, jobs.Interval(scheduler.PurgeTrashJob))
+	require.Equal(t, time.Minute, jobs.Interval(webhook.RetryJob))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&purges) >= 3 }, time.Second, time.Millisecond)
+}
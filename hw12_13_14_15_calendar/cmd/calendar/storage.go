@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/blob"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/delivery"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	filestorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/file"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/webhook"
+)
+
+const (
+	storageMemory = "memory"
+	storageFile   = "file"
+	storageSQL    = "sql"
+)
+
+type Storage interface {
+	app.Storage
+	webhook.Storage
+	scheduler.TrashStorage
+	scheduler.LeaseStorage
+	delivery.Storage
+	delivery.Outbox
+	SnapshotStorage
+	Connect(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+type memoryStorage struct {
+	*memorystorage.Storage
+}
+
+func (memoryStorage) Connect(context.Context) error { return nil }
+
+func (memoryStorage) Close(context.Context) error { return nil }
+
+func newStorage(conf StorageConf) (Storage, error) {
+	switch conf.Type {
+	case storageMemory:
+		return memoryStorage{memorystorage.New()}, nil
+	case storageFile:
+		if conf.File.Dir == "" {
+			return nil, fmt.Errorf("no directory for file storage")
+		}
+		return filestorage.New(conf.File.Dir, conf.File.CompactInterval.Duration), nil
+	case storageSQL:
+		if conf.SQL.DSN == "" {
+			return nil, fmt.Errorf("no DSN for sql storage")
+		}
+		return sqlstorage.New(conf.SQL.DSN), nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", conf.Type)
+	}
+}
+
+// checkReplicas refuses several replicas with a storage local to the process: every replica
+// would hold the lease in its own storage and run the jobs as the leader. Replicas sharing
+// the sql storage share the lease too.
+func checkReplicas(storage StorageConf, scheduler SchedulerConf) error {
+	switch storage.Type {
+	case storageMemory, storageFile:
+		if scheduler.Replicas > 1 {
+			return fmt.Errorf("%d replicas can't elect a leader with the %s storage, it is not shared",
+				scheduler.Replicas, storage.Type)
+		}
+	}
+	return nil
+}
+
+const (
+	blobStoreNone = "none"
+	blobStoreFS   = "fs"
+	blobStoreS3   = "s3"
+)
+
+// newBlobStore returns the store of attachment files, nil if attachments are disabled.
+func newBlobStore(conf AttachmentsConf) (app.BlobStore, error) {
+	switch conf.Store {
+	case blobStoreNone:
+		return nil, nil
+	case blobStoreFS:
+		if conf.FS.Dir == "" {
+			return nil, fmt.Errorf("no directory for attachments")
+		}
+		return blob.NewFS(conf.FS.Dir), nil
+	case blobStoreS3:
+		if conf.S3.Endpoint == "" || conf.S3.Bucket == "" {
+			return nil, fmt.Errorf("no endpoint or bucket for attachments")
+		}
+		return blob.NewS3(blob.S3Config{
+			Endpoint:  conf.S3.Endpoint,
+			Region:    conf.S3.Region,
+			Bucket:    conf.S3.Bucket,
+			AccessKey: conf.S3.AccessKey,
+			SecretKey: conf.S3.SecretKey,
+		}, &http.Client{Timeout: conf.S3.Timeout.Duration}), nil
+	default:
+		return nil, fmt.Errorf("unknown attachment store %q", conf.Store)
+	}
+}
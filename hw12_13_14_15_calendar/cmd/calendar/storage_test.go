@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReplicas(t *testing.T) {
+	for _, storageType := range []string{storageMemory, storageFile} {
+		storage := StorageConf{Type: storageType}
+		require.NoError(t, checkReplicas(storage, SchedulerConf{Replicas: 1}))
+		require.Error(t, checkReplicas(storage, SchedulerConf{Replicas: 2}))
+	}
+	require.NoError(t, checkReplicas(StorageConf{Type: storageSQL}, SchedulerConf{Replicas: 3}))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// client talks to the calendar gRPC API on behalf of a user.
+type client struct {
+	conn   *grpc.ClientConn
+	events pb.EventServiceClient
+	admin  pb.AdminServiceClient
+	// md are the credentials sent with every call, in the same headers as to the HTTP API.
+	md metadata.MD
+}
+
+type credentialsConf struct {
+	user   string
+	apiKey string
+	token  string
+}
+
+func dial(addr string, useTLS bool, creds credentialsConf) (*client, error) {
+	transport := grpc.WithInsecure()
+	if useTLS {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	conn, err := grpc.Dial(addr, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	md := metadata.MD{}
+	switch {
+	case creds.token != "":
+		md.Set("authorization", "Bearer "+creds.token)
+	case creds.apiKey != "":
+		md.Set(auth.APIKeyHeader, creds.apiKey)
+	case creds.user != "":
+		md.Set(auth.DefaultUserIDHeader, creds.user)
+	}
+	return &client{
+		conn:   conn,
+		events: pb.NewEventServiceClient(conn),
+		admin:  pb.NewAdminServiceClient(conn),
+		md:     md,
+	}, nil
+}
+
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *client) context(ctx context.Context) context.Context {
+	return metadata.NewOutgoingContext(ctx, c.md)
+}
+
+type event struct {
+	ID          string     `json:"id"`
+	CalendarID  string     `json:"calendar_id"`
+	OwnerID     string     `json:"owner_id,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	StartAt     time.Time  `json:"start_at"`
+	EndAt       time.Time  `json:"end_at"`
+	Description string     `json:"description,omitempty"`
+	Reminders   []reminder `json:"reminders,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+}
+
+type reminder struct {
+	ID      string `json:"id,omitempty"`
+	Before  string `json:"before"`
+	Channel string `json:"channel"`
+}
+
+type calendar struct {
+	ID      string `json:"id"`
+	OwnerID string `json:"owner_id"`
+	Name    string `json:"name"`
+}
+
+type deadLetter struct {
+	ID        string    `json:"id"`
+	WebhookID string    `json:"webhook_id"`
+	Change    string    `json:"change"`
+	EventID   string    `json:"event_id"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	FailedAt  time.Time `json:"failed_at"`
+	Payload   string    `json:"payload,omitempty"`
+}
+
+func eventFromPB(e *pb.Event) event {
+	out := event{
+		ID:          e.Id,
+		CalendarID:  e.CalendarId,
+		OwnerID:     e.OwnerId,
+		Title:       e.Title,
+		StartAt:     e.StartAt.AsTime(),
+		EndAt:       e.EndAt.AsTime(),
+		Description: e.Description,
+		Tags:        e.Tags,
+	}
+	for _, r := range e.Reminders {
+		out.Reminders = append(out.Reminders, reminder{ID: r.Id, Before: r.Before.AsDuration().String(), Channel: r.Channel})
+	}
+	return out
+}
+
+func eventToPB(e event) (*pb.Event, error) {
+	out := &pb.Event{
+		Id:          e.ID,
+		CalendarId:  e.CalendarID,
+		OwnerId:     e.OwnerID,
+		Title:       e.Title,
+		StartAt:     timestamppb.New(e.StartAt),
+		EndAt:       timestamppb.New(e.EndAt),
+		Description: e.Description,
+		Tags:        e.Tags,
+	}
+	for _, r := range e.Reminders {
+		before, err := time.ParseDuration(r.Before)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder %q: %w", r.Before, err)
+		}
+		out.Reminders = append(out.Reminders, &pb.Reminder{Id: r.ID, Before: durationpb.New(before), Channel: r.Channel})
+	}
+	return out, nil
+}
+
+func (c *client) listCalendars(ctx context.Context) ([]calendar, error) {
+	resp, err := c.events.ListCalendars(c.context(ctx), &pb.ListCalendarsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	calendars := make([]calendar, 0, len(resp.Calendars))
+	for _, cal := range resp.Calendars {
+		calendars = append(calendars, calendar{ID: cal.Id, OwnerID: cal.OwnerId, Name: cal.Name})
+	}
+	return calendars, nil
+}
+
+func (c *client) listEvents(ctx context.Context, period string, date time.Time, tags []string) ([]event, error) {
+	p, ok := pb.Period_value["PERIOD_"+strings.ToUpper(period)]
+	if !ok {
+		return nil, fmt.Errorf("unknown period %q", period)
+	}
+	resp, err := c.events.ListEvents(c.context(ctx), &pb.ListEventsRequest{
+		Period: pb.Period(p),
+		Date:   timestamppb.New(date),
+		Tags:   tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]event, 0, len(resp.Events))
+	for _, e := range resp.Events {
+		events = append(events, eventFromPB(e))
+	}
+	return events, nil
+}
+
+func (c *client) getEvent(ctx context.Context, id string) (event, error) {
+	e, err := c.events.GetEvent(c.context(ctx), &pb.GetEventRequest{Id: id})
+	if err != nil {
+		return event{}, err
+	}
+	return eventFromPB(e), nil
+}
+
+func (c *client) createEvent(ctx context.Context, e event) (event, error) {
+	pbEvent, err := eventToPB(e)
+	if err != nil {
+		return event{}, err
+	}
+	created, err := c.events.CreateEvent(c.context(ctx), &pb.CreateEventRequest{Event: pbEvent})
+	if err != nil {
+		return event{}, err
+	}
+	return eventFromPB(created), nil
+}
+
+func (c *client) updateEvent(ctx context.Context, e event) (event, error) {
+	pbEvent, err := eventToPB(e)
+	if err != nil {
+		return event{}, err
+	}
+	updated, err := c.events.UpdateEvent(c.context(ctx), &pb.UpdateEventRequest{Event: pbEvent})
+	if err != nil {
+		return event{}, err
+	}
+	return eventFromPB(updated), nil
+}
+
+func (c *client) deleteEvent(ctx context.Context, id string) error {
+	_, err := c.events.DeleteEvent(c.context(ctx), &pb.DeleteEventRequest{Id: id})
+	return err
+}
+
+func (c *client) runJob(ctx context.Context, name string) error {
+	_, err := c.admin.RunJob(c.context(ctx), &pb.RunJobRequest{Name: name})
+	return err
+}
+
+func (c *client) listDeadLetters(ctx context.Context, webhookID string) ([]deadLetter, error) {
+	resp, err := c.admin.ListDeadLetters(c.context(ctx), &pb.ListDeadLettersRequest{WebhookId: webhookID})
+	if err != nil {
+		return nil, err
+	}
+	dead := make([]deadLetter, 0, len(resp.DeadLetters))
+	for _, d := range resp.DeadLetters {
+		dead = append(dead, deadLetter{
+			ID:        d.Id,
+			WebhookID: d.WebhookId,
+			Change:    d.Change,
+			EventID:   d.EventId,
+			Attempts:  int(d.Attempts),
+			Error:     d.Error,
+			FailedAt:  d.FailedAt.AsTime(),
+			Payload:   d.Payload,
+		})
+	}
+	return dead, nil
+}
+
+func (c *client) redriveDeadLetters(ctx context.Context, webhookID string, ids []string) (int, error) {
+	resp, err := c.admin.RedriveDeadLetters(c.context(ctx), &pb.RedriveDeadLettersRequest{WebhookId: webhookID, Ids: ids})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Redriven), nil
+}
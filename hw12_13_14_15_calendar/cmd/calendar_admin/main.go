@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: calendar_admin [flags] <command> [command flags]
+
+Commands:
+  calendars list
+  events list   -period day|week|month -date 2006-01-02
+  events create -calendar ID -title TITLE -start RFC3339 -end RFC3339 [-description TEXT] [-remind 15m:email,1h:log]
+  events move   -id ID [-calendar ID] [-start RFC3339]
+  events delete -id ID
+  jobs run      -name "trash purge"|"notification delivery"|"webhook retry"
+  dead-letters list    [-webhook ID]
+  dead-letters redrive [-webhook ID] [-ids ID,ID]
+
+Flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+var (
+	addr    string
+	useTLS  bool
+	user    string
+	apiKey  string
+	token   string
+	output  string
+	timeout time.Duration
+)
+
+func init() {
+	flag.StringVar(&addr, "addr", "localhost:50051", "Calendar gRPC API address")
+	flag.BoolVar(&useTLS, "tls", false, "Connect with TLS")
+	flag.StringVar(&user, "user", "", "User to act as, sent in the trusted X-User-Id header")
+	flag.StringVar(&apiKey, "api-key", "", "API key of the user")
+	flag.StringVar(&token, "token", "", "JWT bearer token of the user")
+	flag.StringVar(&output, "output", outputTable, "Output format: table or json")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "Command timeout")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	if output != outputTable && output != outputJSON {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := dial(addr, useTLS, credentialsConf{user: user, apiKey: apiKey, token: token})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err = run(ctx, c, flag.Args())
+	cancel()
+	c.Close()
+	if err != nil {
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	switch args[0] + " " + args[1] {
+	case "calendars list":
+		calendars, err := c.listCalendars(ctx)
+		if err != nil {
+			return err
+		}
+		return printCalendars(os.Stdout, output, calendars)
+	case "events list":
+		return listEvents(ctx, c, args[2:])
+	case "events create":
+		return createEvent(ctx, c, args[2:])
+	case "events move":
+		return moveEvent(ctx, c, args[2:])
+	case "events delete":
+		fs := flag.NewFlagSet("events delete", flag.ExitOnError)
+		id := fs.String("id", "", "Event ID")
+		_ = fs.Parse(args[2:])
+		if *id == "" {
+			return errUsage
+		}
+		return c.deleteEvent(ctx, *id)
+	case "jobs run":
+		fs := flag.NewFlagSet("jobs run", flag.ExitOnError)
+		name := fs.String("name", "", "Job name")
+		_ = fs.Parse(args[2:])
+		if *name == "" {
+			return errUsage
+		}
+		return c.runJob(ctx, *name)
+	case "dead-letters list":
+		fs := flag.NewFlagSet("dead-letters list", flag.ExitOnError)
+		webhookID := fs.String("webhook", "", "Webhook ID, all webhooks if empty")
+		_ = fs.Parse(args[2:])
+		dead, err := c.listDeadLetters(ctx, *webhookID)
+		if err != nil {
+			return err
+		}
+		return printDeadLetters(os.Stdout, output, dead)
+	case "dead-letters redrive":
+		fs := flag.NewFlagSet("dead-letters redrive", flag.ExitOnError)
+		webhookID := fs.String("webhook", "", "Webhook ID, all webhooks if empty")
+		ids := fs.String("ids", "", "Comma-separated dead letter IDs, all of them if empty")
+		_ = fs.Parse(args[2:])
+		redriven, err := c.redriveDeadLetters(ctx, *webhookID, splitList(*ids))
+		if err != nil {
+			return err
+		}
+		return printRedriven(os.Stdout, output, redriven)
+	default:
+		return errUsage
+	}
+}
+
+func listEvents(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("events list", flag.ExitOnError)
+	period := fs.String("period", "day", "Listing period: day, week or month")
+	date := fs.String("date", time.Now().Format("2006-01-02"), "First day of the period")
+	tags := fs.String("tag", "", "Comma-separated tags, events having any of them are listed")
+	_ = fs.Parse(args)
+
+	start, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		return fmt.Errorf("invalid date: %w", err)
+	}
+	events, err := c.listEvents(ctx, *period, start, splitList(*tags))
+	if err != nil {
+		return err
+	}
+	return printEvents(os.Stdout, output, events)
+}
+
+func createEvent(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("events create", flag.ExitOnError)
+	calendarID := fs.String("calendar", "", "Calendar ID")
+	title := fs.String("title", "", "Event title")
+	start := fs.String("start", "", "Start time, RFC3339")
+	end := fs.String("end", "", "End time, RFC3339")
+	description := fs.String("description", "", "Event description")
+	remind := fs.String("remind", "", "Comma-separated reminders as before:channel, e.g. 15m:email,1h:log")
+	tags := fs.String("tags", "", "Comma-separated tags")
+	_ = fs.Parse(args)
+
+	startAt, err := time.Parse(time.RFC3339, *start)
+	if err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	endAt, err := time.Parse(time.RFC3339, *end)
+	if err != nil {
+		return fmt.Errorf("invalid end: %w", err)
+	}
+	reminders, err := parseReminders(*remind)
+	if err != nil {
+		return err
+	}
+
+	e, err := c.createEvent(ctx, event{
+		CalendarID:  *calendarID,
+		Title:       *title,
+		StartAt:     startAt,
+		EndAt:       endAt,
+		Description: *description,
+		Reminders:   reminders,
+		Tags:        splitList(*tags),
+	})
+	if err != nil {
+		return err
+	}
+	return printEvents(os.Stdout, output, []event{e})
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func parseReminders(s string) ([]reminder, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var reminders []reminder
+	for _, r := range strings.Split(s, ",") {
+		parts := strings.SplitN(r, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid reminder %q, want before:channel", r)
+		}
+		reminders = append(reminders, reminder{Before: parts[0], Channel: parts[1]})
+	}
+	return reminders, nil
+}
+
+// moveEvent moves the event to another calendar and/or start time keeping its duration.
+func moveEvent(ctx context.Context, c *client, args []string) error {
+	fs := flag.NewFlagSet("events move", flag.ExitOnError)
+	id := fs.String("id", "", "Event ID")
+	calendarID := fs.String("calendar", "", "Target calendar ID")
+	start := fs.String("start", "", "New start time, RFC3339")
+	_ = fs.Parse(args)
+	if *id == "" || (*calendarID == "" && *start == "") {
+		return errUsage
+	}
+
+	e, err := c.getEvent(ctx, *id)
+	if err != nil {
+		return err
+	}
+	if *calendarID != "" {
+		e.CalendarID = *calendarID
+	}
+	if *start != "" {
+		startAt, err := time.Parse(time.RFC3339, *start)
+		if err != nil {
+			return fmt.Errorf("invalid start: %w", err)
+		}
+		e.EndAt = startAt.Add(e.EndAt.Sub(e.StartAt))
+		e.StartAt = startAt
+	}
+
+	e, err = c.updateEvent(ctx, e)
+	if err != nil {
+		return err
+	}
+	return printEvents(os.Stdout, output, []event{e})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func printEvents(w io.Writer, format string, events []event) error {
+	if format == outputJSON {
+		return printJSON(w, events)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCALENDAR\tSTART\tEND\tTITLE")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			e.ID, e.CalendarID, e.StartAt.Format(time.RFC3339), e.EndAt.Format(time.RFC3339), e.Title)
+	}
+	return tw.Flush()
+}
+
+func printCalendars(w io.Writer, format string, calendars []calendar) error {
+	if format == outputJSON {
+		return printJSON(w, calendars)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tOWNER\tNAME")
+	for _, c := range calendars {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.ID, c.OwnerID, c.Name)
+	}
+	return tw.Flush()
+}
+
+func printDeadLetters(w io.Writer, format string, dead []deadLetter) error {
+	if format == outputJSON {
+		return printJSON(w, dead)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tWEBHOOK\tEVENT\tCHANGE\tATTEMPTS\tFAILED\tERROR")
+	for _, d := range dead {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			d.ID, d.WebhookID, d.EventID, d.Change, d.Attempts, d.FailedAt.Format(time.RFC3339), d.Error)
+	}
+	return tw.Flush()
+}
+
+func printRedriven(w io.Writer, format string, redriven int) error {
+	if format == outputJSON {
+		return printJSON(w, map[string]int{"redriven": redriven})
+	}
+	_, err := fmt.Fprintf(w, "%d dead letters redriven\n", redriven)
+	return err
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
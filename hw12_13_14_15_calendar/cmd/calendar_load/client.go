@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// client sends requests to the calendar HTTP API as a user authenticated by the trusted header.
+type client struct {
+	baseURL string
+	header  string
+	http    *http.Client
+}
+
+type event struct {
+	ID         string    `json:"id,omitempty"`
+	CalendarID string    `json:"calendar_id"`
+	Title      string    `json:"title"`
+	StartAt    time.Time `json:"start_at"`
+	EndAt      time.Time `json:"end_at"`
+}
+
+type calendar struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+func (c *client) do(ctx context.Context, user, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.baseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(c.header, user)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *client) createCalendar(ctx context.Context, user, name string) (calendar, error) {
+	var created calendar
+	return created, c.do(ctx, user, http.MethodPost, "/calendars", calendar{Name: name}, &created)
+}
+
+func (c *client) createEvent(ctx context.Context, user string, e event) (event, error) {
+	var created event
+	return created, c.do(ctx, user, http.MethodPost, "/events", e, &created)
+}
+
+func (c *client) updateEvent(ctx context.Context, user string, e event) error {
+	return c.do(ctx, user, http.MethodPut, "/events/"+url.PathEscape(e.ID), e, nil)
+}
+
+func (c *client) listEvents(ctx context.Context, user, period string, date time.Time) error {
+	query := url.Values{"period": {period}, "date": {date.Format("2006-01-02")}}
+	return c.do(ctx, user, http.MethodGet, "/events?"+query.Encode(), nil, nil)
+}
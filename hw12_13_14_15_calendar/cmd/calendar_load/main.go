@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	addr        string
+	header      string
+	users       int
+	concurrency int
+	duration    time.Duration
+	mixFlag     string
+	timeout     time.Duration
+	seed        int64
+)
+
+func init() {
+	flag.StringVar(&addr, "addr", "http://localhost:8080", "Calendar HTTP API address")
+	flag.StringVar(&header, "header", "X-User-Id", "Trusted header with the user ID, the calendar must run with auth.mode = \"header\"")
+	flag.IntVar(&users, "users", 10, "Number of users, each gets its own calendar")
+	flag.IntVar(&concurrency, "concurrency", 10, "Number of concurrent clients")
+	flag.DurationVar(&duration, "duration", 30*time.Second, "Duration of the test")
+	flag.StringVar(&mixFlag, "mix", "create=2,list=5,update=3", "Weights of the create, list and update operations")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "Request timeout")
+	flag.Int64Var(&seed, "seed", 0, "Seed of the random generator, the current time by default")
+}
+
+func main() {
+	flag.Parse()
+	m, err := parseMix(mixFlag)
+	if err != nil || users <= 0 || concurrency <= 0 || duration <= 0 {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		flag.Usage()
+		os.Exit(2)
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &client{baseURL: addr, header: header, http: &http.Client{Timeout: timeout}}
+	calendars, err := setup(ctx, c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("running %s of %s with %d clients and %d users\n", duration, mixFlag, concurrency, users)
+	s := newStats()
+	elapsed := run(ctx, c, m, calendars, s)
+	if err := s.report(os.Stdout, elapsed); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// setup creates a calendar for every user and returns their IDs by user.
+func setup(ctx context.Context, c *client) (map[string]string, error) {
+	calendars := make(map[string]string, users)
+	for i := 0; i < users; i++ {
+		user := "load-" + strconv.Itoa(i)
+		cal, err := c.createCalendar(ctx, user, "load test")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create calendar: %w", err)
+		}
+		calendars[user] = cal.ID
+	}
+	return calendars, nil
+}
+
+// run sends requests from the concurrent clients until the duration passes and returns the
+// time it took. Requests in flight at the end are completed and counted.
+func run(ctx context.Context, c *client, m mix, calendars map[string]string, s *stats) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		user := "load-" + strconv.Itoa(i%users)
+		w := &worker{
+			client:   c,
+			user:     user,
+			calendar: calendars[user],
+			rnd:      rand.New(rand.NewSource(seed + int64(i))), //nolint:gosec
+			from:     time.Now().Truncate(24 * time.Hour),
+			stats:    s,
+			mix:      m,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				w.step()
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+// worker is a client sending requests of one user, it updates the events it has created.
+type worker struct {
+	client   *client
+	user     string
+	calendar string
+	rnd      *rand.Rand
+	from     time.Time
+	stats    *stats
+	mix      mix
+	events   []event
+}
+
+func (w *worker) step() {
+	ctx := context.Background()
+	op := w.mix.pick(w.rnd)
+	if op == opUpdate && len(w.events) == 0 {
+		op = opCreate
+	}
+
+	start := time.Now()
+	var err error
+	switch op {
+	case opCreate:
+		var e event
+		e, err = w.client.createEvent(ctx, w.user, w.randomEvent(event{CalendarID: w.calendar}))
+		if err == nil {
+			w.events = append(w.events, e)
+		}
+	case opUpdate:
+		i := w.rnd.Intn(len(w.events))
+		w.events[i] = w.randomEvent(w.events[i])
+		err = w.client.updateEvent(ctx, w.user, w.events[i])
+	case opList:
+		periods := []string{"day", "week", "month"}
+		err = w.client.listEvents(ctx, w.user, periods[w.rnd.Intn(len(periods))], w.randomTime())
+	}
+	w.stats.add(op, time.Since(start), err)
+}
+
+// randomEvent moves the event to a random time within 90 days.
+func (w *worker) randomEvent(e event) event {
+	e.Title = "load " + strconv.Itoa(w.rnd.Int())
+	e.StartAt = w.randomTime()
+	e.EndAt = e.StartAt.Add(time.Duration(1+w.rnd.Intn(8)) * 15 * time.Minute)
+	return e
+}
+
+func (w *worker) randomTime() time.Time {
+	return w.from.Add(time.Duration(w.rnd.Intn(90*24*4)) * 15 * time.Minute)
+}
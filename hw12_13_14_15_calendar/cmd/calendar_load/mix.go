@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	opCreate = "create"
+	opList   = "list"
+	opUpdate = "update"
+)
+
+// mix is the weighted choice of operations, e.g. "create=2,list=5,update=3".
+type mix struct {
+	ops     []string
+	weights []int
+	total   int
+}
+
+func parseMix(s string) (mix, error) {
+	weights := make(map[string]int)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, "1"
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], part[i+1:]
+		}
+		switch name {
+		case opCreate, opList, opUpdate:
+		default:
+			return mix{}, fmt.Errorf("unknown operation %q", name)
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return mix{}, fmt.Errorf("invalid weight of %s: %q", name, value)
+		}
+		weights[name] += weight
+	}
+
+	m := mix{}
+	for name, weight := range weights {
+		if weight > 0 {
+			m.ops = append(m.ops, name)
+		}
+	}
+	if len(m.ops) == 0 {
+		return mix{}, fmt.Errorf("no operations in %q", s)
+	}
+	sort.Strings(m.ops)
+	for _, name := range m.ops {
+		m.weights = append(m.weights, weights[name])
+		m.total += weights[name]
+	}
+	return m, nil
+}
+
+func (m mix) pick(rnd *rand.Rand) string {
+	n := rnd.Intn(m.total)
+	for i, weight := range m.weights {
+		if n < weight {
+			return m.ops[i]
+		}
+		n -= weight
+	}
+	return m.ops[len(m.ops)-1]
+}
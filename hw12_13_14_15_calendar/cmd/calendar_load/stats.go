@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stats collects latencies of requests by operation.
+type stats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	return &stats{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+func (s *stats) add(op string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors[op]++
+		return
+	}
+	s.latencies[op] = append(s.latencies[op], latency)
+}
+
+// percentile returns the latency which the share p of the sorted latencies does not exceed.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// report writes the throughput and the latency percentiles of every operation and of all of them.
+func (s *stats) report(w io.Writer, elapsed time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops := make([]string, 0, len(s.latencies)+len(s.errors))
+	seen := make(map[string]bool)
+	for _, m := range []map[string]int{s.counts(), s.errors} {
+		for op := range m {
+			if !seen[op] {
+				seen[op] = true
+				ops = append(ops, op)
+			}
+		}
+	}
+	sort.Strings(ops)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\trequests\terrors\trps\tp50\tp90\tp99\tmax\t")
+	all := make([]time.Duration, 0)
+	errors := 0
+	for _, op := range ops {
+		latencies := s.latencies[op]
+		all = append(all, latencies...)
+		errors += s.errors[op]
+		writeRow(tw, op, latencies, s.errors[op], elapsed)
+	}
+	writeRow(tw, "total", all, errors, elapsed)
+	return tw.Flush()
+}
+
+func (s *stats) counts() map[string]int {
+	counts := make(map[string]int, len(s.latencies))
+	for op, latencies := range s.latencies {
+		counts[op] = len(latencies)
+	}
+	return counts
+}
+
+func writeRow(w io.Writer, op string, latencies []time.Duration, errors int, elapsed time.Duration) {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	requests := len(sorted) + errors
+	rps := 0.0
+	if elapsed > 0 {
+		rps = float64(requests) / elapsed.Seconds()
+	}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", op, requests, errors, rps,
+		round(percentile(sorted, 0.5)), round(percentile(sorted, 0.9)),
+		round(percentile(sorted, 0.99)), round(percentile(sorted, 1)))
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMix(t *testing.T) {
+	m, err := parseMix("create=2, list=5,update=0,create")
+	require.NoError(t, err)
+	require.Equal(t, []string{opCreate, opList}, m.ops)
+	require.Equal(t, []int{3, 5}, m.weights)
+
+	counts := make(map[string]int)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 8000; i++ {
+		counts[m.pick(rnd)]++
+	}
+	require.InDelta(t, 3000, counts[opCreate], 300)
+	require.InDelta(t, 5000, counts[opList], 300)
+
+	for _, s := range []string{"", "update=0", "delete=1", "list=x", "list=-1"} {
+		_, err := parseMix(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := newStats()
+	for i := 1; i <= 100; i++ {
+		s.add(opList, time.Duration(i)*time.Millisecond, nil)
+	}
+	s.add(opCreate, time.Millisecond, nil)
+	s.add(opCreate, 0, errors.New("500 Internal Server Error"))
+
+	sorted := s.latencies[opList]
+	require.Equal(t, 50*time.Millisecond, percentile(sorted, 0.5))
+	require.Equal(t, 99*time.Millisecond, percentile(sorted, 0.99))
+	require.Equal(t, 100*time.Millisecond, percentile(sorted, 1))
+	require.Zero(t, percentile(nil, 0.5))
+
+	out := bytes.Buffer{}
+	require.NoError(t, s.report(&out, time.Second))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, []string{"create", "2", "1", "2.0", "1ms", "1ms", "1ms", "1ms"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{"list", "100", "0", "100.0", "50ms", "90ms", "99ms", "100ms"}, strings.Fields(lines[2]))
+	require.Equal(t, "total", strings.Fields(lines[3])[0])
+	require.Equal(t, "102", strings.Fields(lines[3])[1])
+}
@@ -1,3 +1,19 @@
 module github.com/fixme_my_friend/hw12_13_14_15_calendar
 
 go 1.16
+
+require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/envoyproxy/protoc-gen-validate v0.6.2
+	github.com/google/uuid v1.2.0
+	github.com/lib/pq v1.10.9
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.28.0
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.3.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
+	google.golang.org/grpc v1.42.0
+	google.golang.org/protobuf v1.27.1
+)
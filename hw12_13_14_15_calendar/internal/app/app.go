@@ -2,25 +2,572 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidEvent    = errors.New("invalid event")
+	ErrInvalidCalendar = errors.New("invalid calendar")
 )
 
-type App struct { // TODO
+type App struct {
+	logger   Logger
+	storage  Storage
+	notifier Notifier
+
+	blobs            BlobStore
+	attachmentLimits AttachmentLimits
+	quotas           Quotas
+	// channels are the reminder channels notifications are sent through, nil for all of them.
+	channels map[storage.Channel]bool
+	// jobs runs the scheduled jobs on demand, nil if they are not run.
+	jobs Scheduler
 }
 
 type Logger interface { // TODO
 }
 
-type Storage interface { // TODO
+type Storage interface {
+	CreateCalendar(ctx context.Context, cal storage.Calendar) error
+	GetCalendar(ctx context.Context, userID, calendarID string) (storage.Calendar, error)
+	CalendarAccess(ctx context.Context, userID, calendarID string) (storage.Access, error)
+	ListCalendars(ctx context.Context, userID string) ([]storage.Calendar, error)
+	DeleteCalendar(ctx context.Context, userID, calendarID string) error
+	ShareCalendar(ctx context.Context, userID string, grant storage.Grant) error
+	RevokeShare(ctx context.Context, userID, calendarID, granteeID string) error
+	ListShares(ctx context.Context, userID, calendarID string) ([]storage.Grant, error)
+
+	CreateEvent(ctx context.Context, userID string, e storage.Event) error
+	UpdateEvent(ctx context.Context, userID string, e storage.Event) error
+	DeleteEvent(ctx context.Context, userID, eventID string) error
+	GetEvent(ctx context.Context, userID, eventID string) (storage.Event, error)
+	FindEvent(ctx context.Context, userID, calendarID, uid string) (storage.Event, error)
+	ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error)
+	CountEvents(ctx context.Context) (int, error)
+	ApplyEventOps(ctx context.Context, userID string, ops []storage.EventOp) error
+	TrashEvent(ctx context.Context, userID, eventID string, at time.Time) error
+	ListTrash(ctx context.Context, userID string) ([]storage.Event, error)
+	RestoreEvent(ctx context.Context, userID, eventID string) error
+
+	AddAttachment(ctx context.Context, userID, eventID string, att storage.Attachment, max int) (storage.Event, error)
+	RemoveAttachment(ctx context.Context, userID, eventID, attachmentID string) (storage.Event, error)
+
+	AppendAudit(ctx context.Context, entries ...storage.AuditEntry) error
+	ListAudit(ctx context.Context, userID string, filter storage.AuditFilter) ([]storage.AuditEntry, error)
+
+	CreateWebhook(ctx context.Context, w storage.Webhook) error
+	ListWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	EnableWebhook(ctx context.Context, userID, webhookID string) error
+	ListWebhookDeliveries(ctx context.Context, userID, webhookID string) ([]storage.WebhookDelivery, error)
+	ListWebhookDeadLetters(ctx context.Context, userID, webhookID string) ([]storage.WebhookMessage, error)
+	RedriveWebhookDeadLetters(ctx context.Context, userID, webhookID string, messageIDs []string, now time.Time) (int, error)
+
+	PutTag(ctx context.Context, tag storage.Tag) error
+	ListTags(ctx context.Context, userID string) ([]storage.Tag, error)
+	DeleteTag(ctx context.Context, userID, name string) error
+
+	SetWorkingHours(ctx context.Context, w storage.WorkingHours) error
+	GetWorkingHours(ctx context.Context, userID string) (storage.WorkingHours, error)
+
+	ListDeliveries(ctx context.Context, userID string) ([]storage.Delivery, error)
+
+	SetPreferences(ctx context.Context, p storage.Preferences) error
+	GetPreferences(ctx context.Context, userID string) (storage.Preferences, error)
+}
+
+// Notifier is told about every change of events, e.g. to deliver it to webhooks.
+type Notifier interface {
+	EventChanged(ctx context.Context, change storage.Change, e storage.Event)
+}
+
+type nopNotifier struct{}
+
+func (nopNotifier) EventChanged(context.Context, storage.Change, storage.Event) {}
+
+func New(logger Logger, storage Storage, notifier Notifier) *App {
+	if notifier == nil {
+		notifier = nopNotifier{}
+	}
+	return &App{
+		logger:   logger,
+		storage:  &tracedStorage{storage: storage},
+		notifier: notifier,
+	}
+}
+
+// SetChannels limits reminders to the channels notifications are sent through, all channels
+// are accepted until it is called. It must be called before the App is used.
+func (a *App) SetChannels(channels ...storage.Channel) {
+	a.channels = make(map[storage.Channel]bool, len(channels))
+	for _, c := range channels {
+		a.channels[c] = true
+	}
+}
+
+// validChannel reports whether reminders may use the channel.
+func (a *App) validChannel(c storage.Channel) bool {
+	return c.Valid() && (a.channels == nil || a.channels[c])
+}
+
+func userID(ctx context.Context) (string, error) {
+	id, ok := auth.UserID(ctx)
+	if !ok {
+		return "", auth.ErrUnauthenticated
+	}
+	return id, nil
+}
+
+func (a *App) CreateCalendar(ctx context.Context, name string) (_ storage.Calendar, err error) {
+	ctx, span := tracer.Start(ctx, "App.CreateCalendar")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+	if strings.TrimSpace(name) == "" {
+		return storage.Calendar{}, fmt.Errorf("%w: empty name", ErrInvalidCalendar)
+	}
+
+	cal := storage.Calendar{ID: uuid.New().String(), OwnerID: user, Name: name}
+	if err := a.storage.CreateCalendar(ctx, cal); err != nil {
+		return storage.Calendar{}, err
+	}
+	return cal, nil
+}
+
+func (a *App) ListCalendars(ctx context.Context) (_ []storage.Calendar, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListCalendars")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListCalendars(ctx, user)
+}
+
+// DeleteCalendar deletes the calendar which has no events but the ones in the trash,
+// those are purged with it.
+func (a *App) DeleteCalendar(ctx context.Context, calendarID string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.DeleteCalendar")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	trash, err := a.storage.ListTrash(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := a.storage.DeleteCalendar(ctx, user, calendarID); err != nil {
+		return err
+	}
+
+	// The events were notified about when they were moved to the trash.
+	purged := make([]storage.Event, 0)
+	entries := make([]storage.AuditEntry, 0)
+	for _, e := range trash {
+		if e.CalendarID == calendarID {
+			purged = append(purged, e)
+			entries = append(entries, auditEntry(ctx, user, storage.ChangePurged, e, storage.Event{}))
+		}
+	}
+	a.deleteFiles(ctx, purged)
+	if len(entries) == 0 {
+		return nil
+	}
+	return a.storage.AppendAudit(ctx, entries...)
+}
+
+func (a *App) ShareCalendar(ctx context.Context, calendarID, granteeID string, access storage.Access) (err error) {
+	ctx, span := tracer.Start(ctx, "App.ShareCalendar")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	if granteeID == "" {
+		return fmt.Errorf("%w: empty user", storage.ErrInvalidAccess)
+	}
+	return a.storage.ShareCalendar(ctx, user, storage.Grant{CalendarID: calendarID, UserID: granteeID, Access: access})
+}
+
+func (a *App) RevokeShare(ctx context.Context, calendarID, granteeID string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.RevokeShare")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	return a.storage.RevokeShare(ctx, user, calendarID, granteeID)
+}
+
+func (a *App) ListShares(ctx context.Context, calendarID string) (_ []storage.Grant, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListShares")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListShares(ctx, user, calendarID)
+}
+
+func (a *App) validateEvent(e storage.Event) error {
+	switch {
+	case strings.TrimSpace(e.Title) == "":
+		return fmt.Errorf("%w: empty title", ErrInvalidEvent)
+	case e.CalendarID == "":
+		return fmt.Errorf("%w: empty calendar", ErrInvalidEvent)
+	case e.StartAt.IsZero():
+		return fmt.Errorf("%w: empty start time", ErrInvalidEvent)
+	case e.EndAt.Before(e.StartAt):
+		return fmt.Errorf("%w: end time must not be before start time", ErrInvalidEvent)
+	}
+
+	ids := make(map[string]bool, len(e.Reminders))
+	for _, r := range e.Reminders {
+		switch {
+		case r.Before < 0:
+			return fmt.Errorf("%w: negative reminder time", ErrInvalidEvent)
+		case !a.validChannel(r.Channel):
+			return fmt.Errorf("%w: unknown reminder channel %q", ErrInvalidEvent, r.Channel)
+		case r.ID != "" && ids[r.ID]:
+			return fmt.Errorf("%w: duplicate reminder %q", ErrInvalidEvent, r.ID)
+		}
+		ids[r.ID] = true
+	}
+	if err := validateTags(e.Tags); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err) //nolint:errorlint
+	}
+	return nil
+}
+
+// withReminderIDs gives IDs to new reminders, reminders keep their IDs on update
+// so that their delivery state is preserved.
+func withReminderIDs(e storage.Event) storage.Event {
+	reminders := make([]storage.Reminder, 0, len(e.Reminders))
+	for _, r := range e.Reminders {
+		if r.ID == "" {
+			r.ID = uuid.New().String()
+		}
+		reminders = append(reminders, r)
+	}
+	e.Reminders = reminders
+	return e
+}
+
+// CreateEvent creates the event in the calendar, the event belongs to the owner of the calendar.
+func (a *App) CreateEvent(ctx context.Context, e storage.Event) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.CreateEvent")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	e.ID = uuid.New().String()
+	if len(e.Reminders) == 0 {
+		p, err := a.preferences(ctx, user)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		if p.DefaultReminder.Channel != "" {
+			e.Reminders = []storage.Reminder{{Before: p.DefaultReminder.Before, Channel: p.DefaultReminder.Channel}}
+		}
+	}
+	return a.createEvent(ctx, user, e)
+}
+
+func (a *App) createEvent(ctx context.Context, user string, e storage.Event) (storage.Event, error) {
+	if err := a.validateEvent(e); err != nil {
+		return storage.Event{}, err
+	}
+	e.Attachments = nil
+	cal, err := a.storage.GetCalendar(ctx, user, e.CalendarID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	if err := a.checkEventQuota(ctx, 1); err != nil {
+		return storage.Event{}, err
+	}
+	e = withReminderIDs(e)
+	e.OwnerID = cal.OwnerID
+	if err := a.storage.CreateEvent(ctx, user, e); err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.audit(ctx, user, storage.ChangeCreated, storage.Event{}, e); err != nil {
+		return storage.Event{}, err
+	}
+	a.notifier.EventChanged(ctx, storage.ChangeCreated, e)
+	return e, nil
+}
+
+func (a *App) UpdateEvent(ctx context.Context, e storage.Event) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.UpdateEvent")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	before, err := a.storage.GetEvent(ctx, user, e.ID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return a.updateEvent(ctx, user, before, e)
+}
+
+func (a *App) updateEvent(ctx context.Context, user string, before, e storage.Event) (storage.Event, error) {
+	if err := a.validateEvent(e); err != nil {
+		return storage.Event{}, err
+	}
+	cal, err := a.storage.GetCalendar(ctx, user, e.CalendarID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	e = withReminderIDs(e)
+	e.OwnerID = cal.OwnerID
+	e.UID = before.UID
+	e.Attachments = before.Attachments
+	if err := a.storage.UpdateEvent(ctx, user, e); err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.audit(ctx, user, storage.ChangeUpdated, before, e); err != nil {
+		return storage.Event{}, err
+	}
+	a.notifier.EventChanged(ctx, storage.ChangeUpdated, e)
+	return e, nil
 }
 
-func New(logger Logger, storage Storage) *App {
-	return &App{}
+// PutEvent replaces the event with the iCalendar UID in the calendar or creates it, for clients
+// which identify events themselves. An event in the trash is restored and replaced.
+func (a *App) PutEvent(ctx context.Context, e storage.Event) (_ storage.Event, created bool, err error) {
+	ctx, span := tracer.Start(ctx, "App.PutEvent")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Event{}, false, err
+	}
+	if e.UID == "" {
+		return storage.Event{}, false, fmt.Errorf("%w: empty uid", ErrInvalidEvent)
+	}
+
+	before, err := a.storage.FindEvent(ctx, user, e.CalendarID, e.UID)
+	switch {
+	case errors.Is(err, storage.ErrEventNotFound):
+		e.ID = uuid.New().String()
+		e, err = a.createEvent(ctx, user, e)
+		return e, err == nil, err
+	case err != nil:
+		return storage.Event{}, false, err
+	case before.Deleted():
+		if err := a.validateEvent(e); err != nil {
+			return storage.Event{}, false, err
+		}
+		if before, err = a.restoreEvent(ctx, user, before); err != nil {
+			return storage.Event{}, false, err
+		}
+		created = true
+	}
+	e.ID = before.ID
+	e, err = a.updateEvent(ctx, user, before, e)
+	return e, created, err
 }
 
-func (a *App) CreateEvent(ctx context.Context, id, title string) error {
-	// TODO
+// DeleteEvent moves the event to the trash.
+func (a *App) DeleteEvent(ctx context.Context, eventID string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.DeleteEvent")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	e, err := a.storage.GetEvent(ctx, user, eventID)
+	if err != nil {
+		return err
+	}
+	before := e
+	e.DeletedAt = time.Now().UTC()
+	e.DeletedBy = user
+	if err := a.storage.TrashEvent(ctx, user, eventID, e.DeletedAt); err != nil {
+		return err
+	}
+	if err := a.audit(ctx, user, storage.ChangeDeleted, before, e); err != nil {
+		return err
+	}
+	a.notifier.EventChanged(ctx, storage.ChangeDeleted, e)
 	return nil
-	// return a.storage.CreateEvent(storage.Event{ID: id, Title: title})
 }
 
-// TODO
+// ListTrash returns the deleted events the user can restore.
+func (a *App) ListTrash(ctx context.Context) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListTrash")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListTrash(ctx, user)
+}
+
+func (a *App) RestoreEvent(ctx context.Context, eventID string) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.RestoreEvent")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	trash, err := a.storage.ListTrash(ctx, user)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	before := storage.Event{ID: eventID}
+	for _, e := range trash {
+		if e.ID == eventID {
+			before = e
+		}
+	}
+	return a.restoreEvent(ctx, user, before)
+}
+
+func (a *App) restoreEvent(ctx context.Context, user string, before storage.Event) (storage.Event, error) {
+	if err := a.checkEventQuota(ctx, 1); err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.storage.RestoreEvent(ctx, user, before.ID); err != nil {
+		return storage.Event{}, err
+	}
+	e, err := a.storage.GetEvent(ctx, user, before.ID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.audit(ctx, user, storage.ChangeRestored, before, e); err != nil {
+		return storage.Event{}, err
+	}
+	a.notifier.EventChanged(ctx, storage.ChangeRestored, e)
+	return e, nil
+}
+
+func (a *App) GetEvent(ctx context.Context, eventID string) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.GetEvent")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return a.storage.GetEvent(ctx, user, eventID)
+}
+
+// GetEventByUID returns the event of the calendar with the iCalendar UID.
+func (a *App) GetEventByUID(ctx context.Context, calendarID, uid string) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.GetEventByUID")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	e, err := a.storage.FindEvent(ctx, user, calendarID, uid)
+	if err == nil && e.Deleted() {
+		err = storage.ErrEventNotFound
+	}
+	return e, err
+}
+
+// ListCalendarEvents returns events of the calendar intersecting [from, to).
+func (a *App) ListCalendarEvents(ctx context.Context, calendarID string, from, to time.Time) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListCalendarEvents")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.storage.GetCalendar(ctx, user, calendarID); err != nil {
+		return nil, err
+	}
+	events, err := a.storage.ListEvents(ctx, user, from, to)
+	if err != nil {
+		return nil, err
+	}
+	calendarEvents := make([]storage.Event, 0, len(events))
+	for _, e := range events {
+		if e.CalendarID == calendarID {
+			calendarEvents = append(calendarEvents, e)
+		}
+	}
+	return calendarEvents, nil
+}
+
+func (a *App) ListDayEvents(ctx context.Context, date time.Time, tags ...string) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListDayEvents")
+	defer func() { tracing.End(span, err) }()
+
+	from := startOfDay(date)
+	return a.listEvents(ctx, from, from.AddDate(0, 0, 1), tags)
+}
+
+// ListWeekEvents returns the events of the week containing date, weeks begin on the user's
+// preferred day.
+func (a *App) ListWeekEvents(ctx context.Context, date time.Time, tags ...string) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListWeekEvents")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p, err := a.preferences(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	from := startOfWeek(date, p.WeekStart)
+	return a.listEvents(ctx, from, from.AddDate(0, 0, 7), tags)
+}
+
+func (a *App) ListMonthEvents(ctx context.Context, monthStart time.Time, tags ...string) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListMonthEvents")
+	defer func() { tracing.End(span, err) }()
+
+	from := startOfDay(monthStart)
+	return a.listEvents(ctx, from, from.AddDate(0, 1, 0), tags)
+}
+
+// listEvents returns the events between from and to having any of the tags, all of them if there are no tags.
+func (a *App) listEvents(ctx context.Context, from, to time.Time, tags []string) ([]storage.Event, error) {
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := a.storage.ListEvents(ctx, user, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return filterTags(events, tags), nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
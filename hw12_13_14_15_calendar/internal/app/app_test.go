@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteCalendar(t *testing.T) {
+	s := memorystorage.New()
+	a := New(nil, s, nil)
+	ctx := auth.WithUserID(context.Background(), "alice")
+
+	cal, err := a.CreateCalendar(ctx, "Work")
+	require.NoError(t, err)
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	e, err := a.CreateEvent(ctx, storage.Event{CalendarID: cal.ID, Title: "standup", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+
+	require.True(t, errors.Is(a.DeleteCalendar(ctx, cal.ID), storage.ErrCalendarNotEmpty))
+	require.NoError(t, a.DeleteEvent(ctx, e.ID))
+	require.NoError(t, a.DeleteCalendar(ctx, cal.ID))
+
+	snap, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	changes := make([]storage.Change, 0, len(snap.Audit))
+	for _, entry := range snap.Audit {
+		require.Equal(t, e.ID, entry.EventID)
+		changes = append(changes, entry.Change)
+	}
+	require.Equal(t, []storage.Change{storage.ChangeCreated, storage.ChangeDeleted, storage.ChangePurged}, changes)
+}
+
+func TestZeroLengthEvent(t *testing.T) {
+	a := New(nil, memorystorage.New(), nil)
+	ctx := auth.WithUserID(context.Background(), "alice")
+
+	cal, err := a.CreateCalendar(ctx, "Work")
+	require.NoError(t, err)
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	_, err = a.CreateEvent(ctx, storage.Event{CalendarID: cal.ID, Title: "deadline", StartAt: start, EndAt: start})
+	require.NoError(t, err)
+	_, err = a.CreateEvent(ctx, storage.Event{CalendarID: cal.ID, Title: "deadline", StartAt: start, EndAt: start.Add(-time.Minute)})
+	require.True(t, errors.Is(err, ErrInvalidEvent))
+
+	// The event belongs to the day it happens at only.
+	events, err := a.ListDayEvents(ctx, start)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	events, err = a.ListDayEvents(ctx, start.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestChannels(t *testing.T) {
+	a := New(nil, memorystorage.New(), nil)
+	a.SetChannels(storage.ChannelLog)
+	ctx := auth.WithUserID(context.Background(), "alice")
+
+	cal, err := a.CreateCalendar(ctx, "Work")
+	require.NoError(t, err)
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	e := storage.Event{CalendarID: cal.ID, Title: "standup", StartAt: start, EndAt: start.Add(time.Hour),
+		Reminders: []storage.Reminder{{Before: time.Hour, Channel: storage.ChannelLog}}}
+	_, err = a.CreateEvent(ctx, e)
+	require.NoError(t, err)
+
+	// Reminders of channels without a sink would never be sent.
+	e.Reminders = []storage.Reminder{{Before: time.Hour, Channel: storage.ChannelEmail}}
+	_, err = a.CreateEvent(ctx, e)
+	require.True(t, errors.Is(err, ErrInvalidEvent))
+	_, err = a.SetPreferences(ctx, storage.Preferences{TimeZone: "UTC", DefaultReminder: e.Reminders[0]})
+	require.True(t, errors.Is(err, ErrInvalidPreferences))
+}
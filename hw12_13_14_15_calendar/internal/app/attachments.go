@@ -0,0 +1,317 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	MaxAttachmentsPerEvent  = 20
+	MaxAttachmentNameLength = 255
+	// DefaultMaxAttachmentSize is used if AttachmentLimits.MaxSize is not positive.
+	DefaultMaxAttachmentSize = 10 << 20
+)
+
+var (
+	ErrInvalidAttachment      = errors.New("invalid attachment")
+	ErrAttachmentTooLarge     = errors.New("attachment is too large")
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	// ErrAttachmentsDisabled is returned for uploads when there is no blob store.
+	ErrAttachmentsDisabled = errors.New("attachments are disabled")
+)
+
+// BlobStore keeps the files of attachments, see the blob package.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// AttachmentLimits restrict uploaded files.
+type AttachmentLimits struct {
+	MaxSize int64
+	// ContentTypes are the allowed media types, "image/*" allows any image. Everything is allowed if it is empty.
+	ContentTypes []string
+}
+
+// SetBlobStore enables file attachments, it must be called before the App is used.
+func (a *App) SetBlobStore(store BlobStore, limits AttachmentLimits) {
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = DefaultMaxAttachmentSize
+	}
+	a.blobs = store
+	a.attachmentLimits = limits
+}
+
+// AddAttachment uploads the file and attaches it to the event, the content type is detected if it is empty.
+func (a *App) AddAttachment(
+	ctx context.Context, eventID, name, contentType string, r io.Reader,
+) (_ storage.Attachment, err error) {
+	ctx, span := tracer.Start(ctx, "App.AddAttachment")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	if a.blobs == nil {
+		return storage.Attachment{}, ErrAttachmentsDisabled
+	}
+	e, err := a.storage.GetEvent(ctx, user, eventID)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	// The access is checked before the file is stored, the storage checks it again when attaching.
+	access, err := a.storage.CalendarAccess(ctx, user, e.CalendarID)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	if access < storage.AccessReadWrite {
+		return storage.Attachment{}, storage.ErrAccessDenied
+	}
+	if err := validateAttachmentName(name); err != nil {
+		return storage.Attachment{}, err
+	}
+	if strings.ContainsAny(name, "/\\") {
+		return storage.Attachment{}, fmt.Errorf("%w: file name %q has path separators", ErrInvalidAttachment, name)
+	}
+	if len(e.Attachments) >= MaxAttachmentsPerEvent {
+		return storage.Attachment{}, fmt.Errorf("%w: more than %d attachments", ErrInvalidAttachment, MaxAttachmentsPerEvent)
+	}
+
+	// The file is read into memory, the size limit bounds it.
+	limit := a.attachmentLimits.MaxSize
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	if int64(len(data)) > limit {
+		return storage.Attachment{}, fmt.Errorf("%w: more than %d bytes", ErrAttachmentTooLarge, limit)
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if contentType, err = a.checkContentType(contentType); err != nil {
+		return storage.Attachment{}, err
+	}
+
+	att := storage.Attachment{
+		ID:          uuid.New().String(),
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now().UTC(),
+		CreatedBy:   user,
+	}
+	att.Key = e.ID + "/" + att.ID
+	if tenantID := storage.TenantID(ctx); tenantID != storage.DefaultTenant {
+		// Event IDs are unique within the tenant only.
+		att.Key = tenantID + "/" + att.Key
+	}
+	if err := a.blobs.Put(ctx, att.Key, bytes.NewReader(data), att.Size, contentType); err != nil {
+		return storage.Attachment{}, err
+	}
+	if err := a.attach(ctx, user, e.ID, att); err != nil {
+		if err := a.blobs.Delete(ctx, att.Key); err != nil {
+			span.RecordError(err)
+		}
+		return storage.Attachment{}, err
+	}
+	return att, nil
+}
+
+// AddLink attaches a link to an external document, only http and https URLs are allowed.
+func (a *App) AddLink(ctx context.Context, eventID, name, link string) (_ storage.Attachment, err error) {
+	ctx, span := tracer.Start(ctx, "App.AddLink")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	e, err := a.storage.GetEvent(ctx, user, eventID)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return storage.Attachment{}, fmt.Errorf("%w: invalid url %q", ErrInvalidAttachment, link)
+	}
+	if name == "" {
+		name = link
+	}
+	if err := validateAttachmentName(name); err != nil {
+		return storage.Attachment{}, err
+	}
+	if len(e.Attachments) >= MaxAttachmentsPerEvent {
+		return storage.Attachment{}, fmt.Errorf("%w: more than %d attachments", ErrInvalidAttachment, MaxAttachmentsPerEvent)
+	}
+
+	att := storage.Attachment{
+		ID:        uuid.New().String(),
+		Name:      name,
+		URL:       u.String(),
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: user,
+	}
+	if err := a.attach(ctx, user, e.ID, att); err != nil {
+		return storage.Attachment{}, err
+	}
+	return att, nil
+}
+
+// attach adds the attachment to the event, the user must be able to change it.
+func (a *App) attach(ctx context.Context, user, eventID string, att storage.Attachment) error {
+	before, err := a.storage.AddAttachment(ctx, user, eventID, att, MaxAttachmentsPerEvent)
+	if errors.Is(err, storage.ErrTooManyAttachments) {
+		return fmt.Errorf("%w: more than %d attachments", ErrInvalidAttachment, MaxAttachmentsPerEvent)
+	}
+	if err != nil {
+		return err
+	}
+	e := before
+	e.Attachments = append(append([]storage.Attachment(nil), before.Attachments...), att)
+	if err := a.audit(ctx, user, storage.ChangeUpdated, before, e); err != nil {
+		return err
+	}
+	a.notifier.EventChanged(ctx, storage.ChangeUpdated, e)
+	return nil
+}
+
+// OpenAttachment returns the attachment and its file, the caller must close it. Links have no file.
+func (a *App) OpenAttachment(
+	ctx context.Context, eventID, attachmentID string,
+) (_ storage.Attachment, _ io.ReadCloser, err error) {
+	ctx, span := tracer.Start(ctx, "App.OpenAttachment")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Attachment{}, nil, err
+	}
+	e, err := a.storage.GetEvent(ctx, user, eventID)
+	if err != nil {
+		return storage.Attachment{}, nil, err
+	}
+	att, ok := findAttachment(e, attachmentID)
+	if !ok {
+		return storage.Attachment{}, nil, storage.ErrAttachmentNotFound
+	}
+	if att.Link() {
+		return att, nil, nil
+	}
+	if a.blobs == nil {
+		return storage.Attachment{}, nil, ErrAttachmentsDisabled
+	}
+	r, err := a.blobs.Get(ctx, att.Key)
+	if err != nil {
+		return storage.Attachment{}, nil, err
+	}
+	return att, r, nil
+}
+
+// DeleteAttachment removes the attachment from the event and deletes its file.
+func (a *App) DeleteAttachment(ctx context.Context, eventID, attachmentID string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.DeleteAttachment")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	before, err := a.storage.RemoveAttachment(ctx, user, eventID, attachmentID)
+	if err != nil {
+		return err
+	}
+	att, _ := findAttachment(before, attachmentID)
+
+	e := before
+	e.Attachments = make([]storage.Attachment, 0, len(before.Attachments)-1)
+	for _, other := range before.Attachments {
+		if other.ID != attachmentID {
+			e.Attachments = append(e.Attachments, other)
+		}
+	}
+	if err := a.audit(ctx, user, storage.ChangeUpdated, before, e); err != nil {
+		return err
+	}
+	a.notifier.EventChanged(ctx, storage.ChangeUpdated, e)
+
+	if !att.Link() && a.blobs != nil {
+		return a.blobs.Delete(ctx, att.Key)
+	}
+	return nil
+}
+
+// deleteFiles deletes the files of the attachments of the events which are gone, failures are
+// recorded in the trace only as the events can't be brought back anyway.
+func (a *App) deleteFiles(ctx context.Context, events []storage.Event) {
+	if a.blobs == nil {
+		return
+	}
+	for _, e := range events {
+		for _, att := range e.Attachments {
+			if att.Link() {
+				continue
+			}
+			if err := a.blobs.Delete(ctx, att.Key); err != nil {
+				trace.SpanFromContext(ctx).RecordError(err)
+			}
+		}
+	}
+}
+
+func findAttachment(e storage.Event, attachmentID string) (storage.Attachment, bool) {
+	for _, att := range e.Attachments {
+		if att.ID == attachmentID {
+			return att, true
+		}
+	}
+	return storage.Attachment{}, false
+}
+
+func validateAttachmentName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("%w: empty name", ErrInvalidAttachment)
+	case utf8.RuneCountInString(name) > MaxAttachmentNameLength:
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidAttachment, MaxAttachmentNameLength)
+	case strings.ContainsAny(name, "\x00\r\n"):
+		return fmt.Errorf("%w: name %q has control characters", ErrInvalidAttachment, name)
+	}
+	return nil
+}
+
+// checkContentType returns the normalised media type with its parameters if it is allowed.
+func (a *App) checkContentType(contentType string) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedContentType, contentType)
+	}
+	allowed := len(a.attachmentLimits.ContentTypes) == 0
+	for _, pattern := range a.attachmentLimits.ContentTypes {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType || strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedContentType, mediaType)
+	}
+	return mime.FormatMediaType(mediaType, params), nil
+}
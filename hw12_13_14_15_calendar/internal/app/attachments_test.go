@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/blob"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachments(t *testing.T) {
+	a := New(nil, memorystorage.New(), nil)
+	alice := auth.WithUserID(context.Background(), "alice")
+	bob := auth.WithUserID(context.Background(), "bob")
+
+	cal, err := a.CreateCalendar(alice, "work")
+	require.NoError(t, err)
+	require.NoError(t, a.ShareCalendar(alice, cal.ID, "bob", storage.AccessRead))
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	e, err := a.CreateEvent(alice, storage.Event{CalendarID: cal.ID, Title: "review", StartAt: start, EndAt: start.Add(time.Hour)})
+	require.NoError(t, err)
+
+	_, err = a.AddAttachment(alice, e.ID, "agenda.txt", "", strings.NewReader("agenda"))
+	require.True(t, errors.Is(err, ErrAttachmentsDisabled))
+
+	dir := t.TempDir()
+	a.SetBlobStore(blob.NewFS(dir), AttachmentLimits{MaxSize: 10, ContentTypes: []string{"text/plain", "image/*"}})
+
+	att, err := a.AddAttachment(alice, e.ID, "agenda.txt", "", strings.NewReader("agenda"))
+	require.NoError(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", att.ContentType)
+	require.Equal(t, int64(6), att.Size)
+
+	_, err = a.AddAttachment(alice, e.ID, "big.txt", "text/plain", strings.NewReader(strings.Repeat("x", 11)))
+	require.True(t, errors.Is(err, ErrAttachmentTooLarge))
+	_, err = a.AddAttachment(alice, e.ID, "page.html", "text/html", strings.NewReader("<p>"))
+	require.True(t, errors.Is(err, ErrUnsupportedContentType))
+	_, err = a.AddAttachment(alice, e.ID, "../x.png", "image/png", strings.NewReader("x"))
+	require.True(t, errors.Is(err, ErrInvalidAttachment))
+	_, err = a.AddAttachment(bob, e.ID, "x.png", "IMAGE/PNG", strings.NewReader("x"))
+	require.True(t, errors.Is(err, storage.ErrAccessDenied))
+	require.Equal(t, 1, countFiles(t, dir))
+
+	link, err := a.AddLink(alice, e.ID, "", "https://example.com/doc")
+	require.NoError(t, err)
+	require.True(t, link.Link())
+	_, err = a.AddLink(alice, e.ID, "x", "javascript:alert(1)")
+	require.True(t, errors.Is(err, ErrInvalidAttachment))
+
+	// Updates of the event keep its attachments.
+	e.Title = "design review"
+	e, err = a.UpdateEvent(alice, e)
+	require.NoError(t, err)
+	require.Len(t, e.Attachments, 2)
+
+	got, r, err := a.OpenAttachment(bob, e.ID, att.ID)
+	require.NoError(t, err)
+	require.Equal(t, att, got)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "agenda", string(data))
+
+	require.True(t, errors.Is(a.DeleteAttachment(bob, e.ID, att.ID), storage.ErrAccessDenied))
+	require.NoError(t, a.DeleteAttachment(alice, e.ID, att.ID))
+	_, _, err = a.OpenAttachment(alice, e.ID, att.ID)
+	require.True(t, errors.Is(err, storage.ErrAttachmentNotFound))
+	_, err = blob.NewFS(dir).Get(context.Background(), att.Key)
+	require.True(t, errors.Is(err, blob.ErrNotFound))
+
+	e, err = a.GetEvent(alice, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Attachment{link}, e.Attachments)
+
+	// Files are deleted with the calendar of their event.
+	_, err = a.AddAttachment(alice, e.ID, "notes.txt", "", strings.NewReader("notes"))
+	require.NoError(t, err)
+	require.Equal(t, 1, countFiles(t, dir))
+	require.NoError(t, a.DeleteEvent(alice, e.ID))
+	require.NoError(t, a.DeleteCalendar(alice, cal.ID))
+	require.Equal(t, 0, countFiles(t, dir))
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+
+	files := 0
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/google/uuid"
+)
+
+const (
+	TransportHTTP    = "http"
+	TransportGRPC    = "grpc"
+	TransportUnknown = "unknown"
+)
+
+var ErrInvalidAuditFilter = errors.New("audit filter must have an event or a user")
+
+type transportKey struct{}
+
+// WithTransport returns the context of a request received through the transport, e.g. "http".
+// The transport is recorded in the audit log.
+func WithTransport(ctx context.Context, transport string) context.Context {
+	return context.WithValue(ctx, transportKey{}, transport)
+}
+
+func transport(ctx context.Context) string {
+	if t, ok := ctx.Value(transportKey{}).(string); ok {
+		return t
+	}
+	return TransportUnknown
+}
+
+// auditEntry describes the change of the event by the user, the zero event stands for no event.
+func auditEntry(ctx context.Context, user string, change storage.Change, before, after storage.Event) storage.AuditEntry {
+	e := after
+	if e.ID == "" {
+		e = before
+	}
+	return storage.AuditEntry{
+		ID:         uuid.New().String(),
+		EventID:    e.ID,
+		CalendarID: e.CalendarID,
+		ActorID:    user,
+		Transport:  transport(ctx),
+		Change:     change,
+		At:         time.Now().UTC(),
+		Diff:       storage.DiffEvents(before, after),
+	}
+}
+
+func (a *App) audit(ctx context.Context, user string, change storage.Change, before, after storage.Event) error {
+	return a.storage.AppendAudit(ctx, auditEntry(ctx, user, change, before, after))
+}
+
+// ListAudit returns the changes of the event, the changes made by the user or both, newest first.
+// Only changes of the calendars the caller can read are returned.
+func (a *App) ListAudit(ctx context.Context, filter storage.AuditFilter) (_ []storage.AuditEntry, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListAudit")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter.EventID == "" && filter.ActorID == "" {
+		return nil, ErrInvalidAuditFilter
+	}
+	return a.storage.ListAudit(ctx, user, filter)
+}
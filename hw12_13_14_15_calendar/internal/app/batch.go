@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxBatchSize is the maximum number of operations in a batch.
+const MaxBatchSize = 5000
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+	// ErrNotApplied is the result of the operations of an atomic batch failed on another operation.
+	ErrNotApplied = errors.New("not applied")
+)
+
+// BatchResult is the result of an operation of a batch.
+type BatchResult struct {
+	Event storage.Event
+	Err   error
+}
+
+// ApplyEvents creates, updates and deletes events in one call. An atomic batch is applied
+// only if every operation succeeds, otherwise every operation is tried on its own.
+// The results follow the order of the operations.
+func (a *App) ApplyEvents(ctx context.Context, ops []storage.EventOp, atomic bool) (_ []BatchResult, err error) {
+	ctx, span := tracer.Start(ctx, "App.ApplyEvents")
+	span.SetAttributes(attribute.Int("operations", len(ops)), attribute.Bool("atomic", atomic))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no operations", ErrInvalidBatch)
+	}
+	if len(ops) > MaxBatchSize {
+		return nil, fmt.Errorf("%w: more than %d operations", ErrInvalidBatch, MaxBatchSize)
+	}
+
+	results := make([]BatchResult, len(ops))
+	prepared := make([]storage.EventOp, len(ops))
+	before := make([]storage.Event, len(ops))
+	failed := false
+	for i, op := range ops {
+		prepared[i], before[i], results[i].Err = a.prepareOp(ctx, user, op)
+		results[i].Event = prepared[i].Event
+		failed = failed || results[i].Err != nil
+	}
+	exceeded, err := a.checkBatchQuota(ctx, prepared, results)
+	if err != nil {
+		return nil, err
+	}
+	failed = failed || exceeded
+
+	if atomic {
+		if !failed {
+			err := a.storage.ApplyEventOps(ctx, user, prepared)
+			var batchErr *storage.BatchError
+			switch {
+			case errors.As(err, &batchErr):
+				results[batchErr.Index].Err = batchErr.Err
+				failed = true
+			case err != nil:
+				return nil, err
+			}
+		}
+		if failed {
+			for i := range results {
+				if results[i].Err == nil {
+					results[i].Err = ErrNotApplied
+				}
+			}
+			return results, nil
+		}
+	} else {
+		for i, op := range prepared {
+			if results[i].Err == nil {
+				results[i].Err = a.applyOp(ctx, user, op)
+			}
+		}
+	}
+
+	entries := make([]storage.AuditEntry, 0, len(prepared))
+	for i, op := range prepared {
+		if results[i].Err == nil {
+			entries = append(entries, auditEntry(ctx, user, op.Change, before[i], op.Event))
+		}
+	}
+	if len(entries) > 0 {
+		if err := a.storage.AppendAudit(ctx, entries...); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, op := range prepared {
+		if results[i].Err == nil {
+			a.notifier.EventChanged(ctx, op.Change, op.Event)
+		}
+	}
+	return results, nil
+}
+
+// prepareOp validates the operation and fills the event as CreateEvent and UpdateEvent do.
+// The event to delete is moved to the trash. The event before the change is returned for the audit log.
+func (a *App) prepareOp(ctx context.Context, user string, op storage.EventOp) (storage.EventOp, storage.Event, error) {
+	var before storage.Event
+	e := op.Event
+	switch op.Change {
+	case storage.ChangeCreated, storage.ChangeUpdated:
+		if err := a.validateEvent(e); err != nil {
+			return op, before, err
+		}
+		cal, err := a.storage.GetCalendar(ctx, user, e.CalendarID)
+		if err != nil {
+			return op, before, err
+		}
+		if op.Change == storage.ChangeUpdated {
+			if before, err = a.storage.GetEvent(ctx, user, e.ID); err != nil {
+				return op, before, err
+			}
+		} else {
+			e.ID = uuid.New().String()
+		}
+		e.UID = before.UID
+		e.Attachments = before.Attachments
+		e = withReminderIDs(e)
+		e.OwnerID = cal.OwnerID
+	case storage.ChangeDeleted:
+		var err error
+		if before, err = a.storage.GetEvent(ctx, user, e.ID); err != nil {
+			return op, before, err
+		}
+		e = before
+		e.DeletedAt = time.Now().UTC()
+		e.DeletedBy = user
+	default:
+		return op, before, fmt.Errorf("%w: %q", storage.ErrInvalidOperation, op.Change)
+	}
+	return storage.EventOp{Change: op.Change, Event: e}, before, nil
+}
+
+// checkBatchQuota fails the creations of the batch if the tenant can't have all of them,
+// it reports whether they have been failed.
+func (a *App) checkBatchQuota(ctx context.Context, ops []storage.EventOp, results []BatchResult) (bool, error) {
+	created := 0
+	for i, op := range ops {
+		if op.Change == storage.ChangeCreated && results[i].Err == nil {
+			created++
+		}
+	}
+	err := a.checkEventQuota(ctx, created)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		return false, err
+	}
+	for i, op := range ops {
+		if op.Change == storage.ChangeCreated && results[i].Err == nil {
+			results[i].Err = err
+		}
+	}
+	return true, nil
+}
+
+func (a *App) applyOp(ctx context.Context, user string, op storage.EventOp) error {
+	switch op.Change {
+	case storage.ChangeCreated:
+		return a.storage.CreateEvent(ctx, user, op.Event)
+	case storage.ChangeUpdated:
+		return a.storage.UpdateEvent(ctx, user, op.Event)
+	default:
+		return a.storage.TrashEvent(ctx, user, op.Event.ID, op.Event.DeletedAt)
+	}
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+type Scheduler interface {
+	Trigger(name string) error
+}
+
+// SetScheduler enables running the scheduled jobs on demand, it must be called before the App is used.
+func (a *App) SetScheduler(jobs Scheduler) {
+	a.jobs = jobs
+}
+
+// RunJob runs the scheduled job now. The jobs work for every tenant but do only what is due,
+// so any user may run them earlier than scheduled.
+func (a *App) RunJob(ctx context.Context, name string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.RunJob")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := userID(ctx); err != nil {
+		return err
+	}
+	if a.jobs == nil {
+		return scheduler.ErrNotRunning
+	}
+	return a.jobs.Trigger(name)
+}
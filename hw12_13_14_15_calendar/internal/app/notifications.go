@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+var ErrInvalidNotificationFilter = errors.New("invalid notification filter")
+
+// ListNotifications returns the last delivery attempts of the reminders of the user's events,
+// the latest first, only the ones with the status if it isn't empty.
+func (a *App) ListNotifications(ctx context.Context, status storage.DeliveryStatus) (_ []storage.Delivery, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListNotifications")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status != "" && !status.Valid() {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidNotificationFilter, status)
+	}
+	deliveries, err := a.storage.ListDeliveries(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return deliveries, nil
+	}
+	filtered := make([]storage.Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		if d.State() == status {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered, nil
+}
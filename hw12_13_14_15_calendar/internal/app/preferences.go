@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+// DefaultPreferences are used for users who haven't set theirs.
+var DefaultPreferences = storage.Preferences{
+	TimeZone:  "UTC",
+	WeekStart: time.Monday,
+}
+
+// localeRe matches language tags like "en" or "pt-BR".
+var localeRe = regexp.MustCompile(`^[a-zA-Z]{2,8}([-_][a-zA-Z0-9]{1,8})*$`)
+
+// SetPreferences replaces the preferences of the current user.
+func (a *App) SetPreferences(ctx context.Context, p storage.Preferences) (_ storage.Preferences, err error) {
+	ctx, span := tracer.Start(ctx, "App.SetPreferences")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Preferences{}, err
+	}
+	if err := a.validatePreferences(p); err != nil {
+		return storage.Preferences{}, err
+	}
+	p.UserID = user
+	if err := a.storage.SetPreferences(ctx, p); err != nil {
+		return storage.Preferences{}, err
+	}
+	return p, nil
+}
+
+// GetPreferences returns the preferences of the current user.
+func (a *App) GetPreferences(ctx context.Context) (_ storage.Preferences, err error) {
+	ctx, span := tracer.Start(ctx, "App.GetPreferences")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Preferences{}, err
+	}
+	return a.preferences(ctx, user)
+}
+
+func (a *App) preferences(ctx context.Context, user string) (storage.Preferences, error) {
+	p, err := a.storage.GetPreferences(ctx, user)
+	if errors.Is(err, storage.ErrPreferencesNotFound) {
+		p = DefaultPreferences
+		p.UserID = user
+		return p, nil
+	}
+	return p, err
+}
+
+func (a *App) validatePreferences(p storage.Preferences) error {
+	if _, err := p.Location(); err != nil || p.TimeZone == "" {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidPreferences, p.TimeZone)
+	}
+	if p.Locale != "" && !localeRe.MatchString(p.Locale) {
+		return fmt.Errorf("%w: invalid locale %q", ErrInvalidPreferences, p.Locale)
+	}
+	if p.WeekStart < time.Sunday || p.WeekStart > time.Saturday {
+		return fmt.Errorf("%w: invalid week start %d", ErrInvalidPreferences, p.WeekStart)
+	}
+	if r := p.DefaultReminder; r.Channel != "" && (!a.validChannel(r.Channel) || r.Before < 0) {
+		return fmt.Errorf("%w: invalid default reminder", ErrInvalidPreferences)
+	}
+	return nil
+}
+
+// startOfWeek returns the midnight of the first day of the week containing t.
+func startOfWeek(t time.Time, weekStart time.Weekday) time.Time {
+	t = startOfDay(t)
+	return t.AddDate(0, 0, -(int(t.Weekday()-weekStart)+7)%7)
+}
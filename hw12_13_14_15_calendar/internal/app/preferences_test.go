@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreferences(t *testing.T) {
+	a := New(nil, memorystorage.New(), nil)
+	ctx := auth.WithUserID(context.Background(), "alice")
+
+	p, err := a.GetPreferences(ctx)
+	require.NoError(t, err)
+	require.Equal(t, time.Monday, p.WeekStart)
+	require.Equal(t, "UTC", p.TimeZone)
+
+	for _, invalid := range []storage.Preferences{
+		{TimeZone: "Mars/Olympus"},
+		{TimeZone: "UTC", Locale: "en us"},
+		{TimeZone: "UTC", WeekStart: 7},
+		{TimeZone: "UTC", DefaultReminder: storage.Reminder{Before: time.Minute, Channel: "pigeon"}},
+	} {
+		_, err := a.SetPreferences(ctx, invalid)
+		require.True(t, errors.Is(err, ErrInvalidPreferences), invalid)
+	}
+
+	p, err = a.SetPreferences(ctx, storage.Preferences{
+		TimeZone:        "Europe/Moscow",
+		Locale:          "ru-RU",
+		WeekStart:       time.Sunday,
+		DefaultReminder: storage.Reminder{Before: 30 * time.Minute, Channel: storage.ChannelEmail},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "alice", p.UserID)
+
+	// Default working hours follow the preferred time zone.
+	hours, err := a.GetWorkingHours(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Moscow", hours.TimeZone)
+
+	cal, err := a.CreateCalendar(ctx, "work")
+	require.NoError(t, err)
+	sunday := time.Date(2021, 2, 28, 12, 0, 0, 0, time.UTC)
+	e, err := a.CreateEvent(ctx, storage.Event{CalendarID: cal.ID, Title: "a", StartAt: sunday, EndAt: sunday.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, e.Reminders, 1)
+	require.Equal(t, 30*time.Minute, e.Reminders[0].Before)
+
+	monday := sunday.AddDate(0, 0, 1)
+	_, err = a.CreateEvent(ctx, storage.Event{
+		CalendarID: cal.ID, Title: "b", StartAt: monday, EndAt: monday.Add(time.Hour),
+		Reminders: []storage.Reminder{{Before: time.Hour, Channel: storage.ChannelLog}},
+	})
+	require.NoError(t, err)
+
+	// The week starts on Sunday, so Wednesday's week has both events.
+	events, err := a.ListWeekEvents(ctx, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, time.Hour, events[1].Reminders[0].Before)
+
+	_, err = a.SetPreferences(ctx, storage.Preferences{TimeZone: "UTC", WeekStart: time.Monday})
+	require.NoError(t, err)
+	events, err = a.ListWeekEvents(ctx, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "b", events[0].Title)
+}
+
+func TestStartOfWeek(t *testing.T) {
+	wednesday := time.Date(2021, 3, 3, 15, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), startOfWeek(wednesday, time.Monday))
+	require.Equal(t, time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC), startOfWeek(wednesday, time.Sunday))
+	require.Equal(t, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC), startOfWeek(wednesday, time.Wednesday))
+	require.Equal(t, time.Date(2021, 2, 25, 0, 0, 0, 0, time.UTC), startOfWeek(wednesday, time.Thursday))
+}
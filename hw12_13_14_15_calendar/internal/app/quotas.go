@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quotas limit the data of every tenant, zero means no limit.
+type Quotas struct {
+	// MaxEvents is the maximum number of events of a tenant, those in the trash are not counted
+	// and can't be restored while the tenant has MaxEvents.
+	MaxEvents int
+	// TenantMaxEvents overrides MaxEvents for the tenants.
+	TenantMaxEvents map[string]int
+}
+
+func (a *App) SetQuotas(quotas Quotas) {
+	a.quotas = quotas
+}
+
+func (q Quotas) maxEvents(tenantID string) int {
+	if n, ok := q.TenantMaxEvents[tenantID]; ok {
+		return n
+	}
+	return q.MaxEvents
+}
+
+// checkEventQuota fails if the tenant of the context can't have n more events. The events are
+// counted before they are created, so concurrent requests may exceed the quota slightly.
+func (a *App) checkEventQuota(ctx context.Context, n int) error {
+	tenantID := storage.TenantID(ctx)
+	limit := a.quotas.maxEvents(tenantID)
+	if limit <= 0 || n <= 0 {
+		return nil
+	}
+	count, err := a.storage.CountEvents(ctx)
+	if err != nil {
+		return err
+	}
+	if count+n > limit {
+		return fmt.Errorf("%w: the tenant can have at most %d events", ErrQuotaExceeded, limit)
+	}
+	return nil
+}
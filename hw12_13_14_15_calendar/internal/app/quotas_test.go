@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventQuota(t *testing.T) {
+	a := New(nil, memorystorage.New(), nil)
+	a.SetQuotas(Quotas{MaxEvents: 2, TenantMaxEvents: map[string]int{"globex": 0}})
+
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	newEvent := func(calendarID string) storage.Event {
+		return storage.Event{CalendarID: calendarID, Title: "standup", StartAt: start, EndAt: start.Add(time.Hour)}
+	}
+	tenant := func(tenantID string) (context.Context, string) {
+		ctx := storage.WithTenantID(auth.WithUserID(context.Background(), "alice"), tenantID)
+		cal, err := a.CreateCalendar(ctx, "Work")
+		require.NoError(t, err)
+		return ctx, cal.ID
+	}
+
+	acme, acmeCalendar := tenant("acme")
+	_, err := a.CreateEvent(acme, newEvent(acmeCalendar))
+	require.NoError(t, err)
+
+	// The batch would exceed the quota, so none of its events is created.
+	results, err := a.ApplyEvents(acme, []storage.EventOp{
+		{Change: storage.ChangeCreated, Event: newEvent(acmeCalendar)},
+		{Change: storage.ChangeCreated, Event: newEvent(acmeCalendar)},
+	}, false)
+	require.NoError(t, err)
+	for _, r := range results {
+		require.True(t, errors.Is(r.Err, ErrQuotaExceeded))
+	}
+
+	e, err := a.CreateEvent(acme, newEvent(acmeCalendar))
+	require.NoError(t, err)
+	_, err = a.CreateEvent(acme, newEvent(acmeCalendar))
+	require.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	// Events in the trash don't count, but can't be restored over the quota.
+	require.NoError(t, a.DeleteEvent(acme, e.ID))
+	_, err = a.CreateEvent(acme, newEvent(acmeCalendar))
+	require.NoError(t, err)
+	_, err = a.RestoreEvent(acme, e.ID)
+	require.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	// Other tenants have their own quotas.
+	globex, globexCalendar := tenant("globex")
+	for i := 0; i < 3; i++ {
+		_, err = a.CreateEvent(globex, newEvent(globexCalendar))
+		require.NoError(t, err)
+	}
+	initech, initechCalendar := tenant("initech")
+	_, err = a.CreateEvent(initech, newEvent(initechCalendar))
+	require.NoError(t, err)
+}
@@ -0,0 +1,276 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+const (
+	// SlotStep is the granularity of proposed meeting slots.
+	SlotStep         = 15 * time.Minute
+	MaxSlotRange     = 31 * 24 * time.Hour
+	MaxSlotUsers     = 50
+	DefaultSlotLimit = 10
+	MaxSlotLimit     = 100
+)
+
+var (
+	ErrInvalidSlotRequest  = errors.New("invalid slot request")
+	ErrInvalidWorkingHours = errors.New("invalid working hours")
+)
+
+// DefaultWorkingHours are used for users who haven't set theirs, in the time zone of their preferences.
+var DefaultWorkingHours = storage.WorkingHours{
+	TimeZone: "UTC",
+	Start:    9 * time.Hour,
+	End:      18 * time.Hour,
+	Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+}
+
+// SlotRequest asks for free slots of Duration between From and To for the users,
+// the current user is always included.
+type SlotRequest struct {
+	UserIDs  []string
+	Duration time.Duration
+	From     time.Time
+	To       time.Time
+	// Limit is the maximum number of slots, DefaultSlotLimit if zero.
+	Limit int
+}
+
+// Slot is a proposed meeting time. Slots further from the edges of the participants'
+// working days have a higher score: Score is the least margin among them.
+type Slot struct {
+	Start time.Time
+	End   time.Time
+	Score time.Duration
+}
+
+// SetWorkingHours replaces the working hours of the current user.
+func (a *App) SetWorkingHours(ctx context.Context, w storage.WorkingHours) (_ storage.WorkingHours, err error) {
+	ctx, span := tracer.Start(ctx, "App.SetWorkingHours")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.WorkingHours{}, err
+	}
+	if err := validateWorkingHours(w); err != nil {
+		return storage.WorkingHours{}, err
+	}
+	w.UserID = user
+	if err := a.storage.SetWorkingHours(ctx, w); err != nil {
+		return storage.WorkingHours{}, err
+	}
+	return w, nil
+}
+
+// GetWorkingHours returns the working hours of the current user.
+func (a *App) GetWorkingHours(ctx context.Context) (_ storage.WorkingHours, err error) {
+	ctx, span := tracer.Start(ctx, "App.GetWorkingHours")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.WorkingHours{}, err
+	}
+	return a.workingHours(ctx, user)
+}
+
+func (a *App) workingHours(ctx context.Context, user string) (storage.WorkingHours, error) {
+	w, err := a.storage.GetWorkingHours(ctx, user)
+	if errors.Is(err, storage.ErrWorkingHoursNotFound) {
+		p, err := a.preferences(ctx, user)
+		if err != nil {
+			return storage.WorkingHours{}, err
+		}
+		w = DefaultWorkingHours
+		w.Days = append([]time.Weekday(nil), DefaultWorkingHours.Days...)
+		w.UserID = user
+		w.TimeZone = p.TimeZone
+		return w, nil
+	}
+	return w, err
+}
+
+func validateWorkingHours(w storage.WorkingHours) error {
+	if _, err := w.Location(); err != nil || w.TimeZone == "" {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidWorkingHours, w.TimeZone)
+	}
+	if w.Start < 0 || w.End > 24*time.Hour || w.Start >= w.End {
+		return fmt.Errorf("%w: start must be before end within a day", ErrInvalidWorkingHours)
+	}
+	seen := make(map[time.Weekday]bool, len(w.Days))
+	for _, d := range w.Days {
+		if d < time.Sunday || d > time.Saturday || seen[d] {
+			return fmt.Errorf("%w: invalid or repeated day %d", ErrInvalidWorkingHours, d)
+		}
+		seen[d] = true
+	}
+	return nil
+}
+
+// participant is a user's working hours and the time the user is busy with own events.
+type participant struct {
+	hours    storage.WorkingHours
+	location *time.Location
+	busy     []storage.Event
+}
+
+// FindSlots proposes free meeting slots within the working hours of all the users, the best first.
+// Users are busy with the events of the calendars they own, only the slots are disclosed.
+// The other users must have shared all their calendars with the current user, ErrAccessDenied
+// is returned otherwise.
+func (a *App) FindSlots(ctx context.Context, req SlotRequest) (_ []Slot, err error) {
+	ctx, span := tracer.Start(ctx, "App.FindSlots")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSlotRequest(&req); err != nil {
+		return nil, err
+	}
+
+	users := []string{user}
+	seen := map[string]bool{user: true}
+	for _, u := range req.UserIDs {
+		if u != "" && !seen[u] {
+			users = append(users, u)
+			seen[u] = true
+		}
+	}
+	if len(users) > MaxSlotUsers {
+		return nil, fmt.Errorf("%w: at most %d users", ErrInvalidSlotRequest, MaxSlotUsers)
+	}
+
+	for _, u := range users[1:] {
+		if err := a.checkFreeBusy(ctx, user, u); err != nil {
+			return nil, err
+		}
+	}
+	// The events of the others are listed as the user sees them, through free-busy access at least.
+	events, err := a.storage.ListEvents(ctx, user, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	participants := make([]participant, 0, len(users))
+	for _, u := range users {
+		p, err := a.participant(ctx, u, events)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+
+	slots := make([]Slot, 0)
+	for start := req.From.Truncate(SlotStep); !start.Add(req.Duration).After(req.To); start = start.Add(SlotStep) {
+		if start.Before(req.From) {
+			continue
+		}
+		if score, ok := slotScore(participants, start, start.Add(req.Duration)); ok {
+			slots = append(slots, Slot{Start: start, End: start.Add(req.Duration), Score: score})
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Score > slots[j].Score
+	})
+	if len(slots) > req.Limit {
+		slots = slots[:req.Limit]
+	}
+	return slots, nil
+}
+
+func validateSlotRequest(req *SlotRequest) error {
+	switch {
+	case req.Duration <= 0 || req.Duration > 24*time.Hour:
+		return fmt.Errorf("%w: duration must be positive and at most a day", ErrInvalidSlotRequest)
+	case !req.From.Before(req.To):
+		return fmt.Errorf("%w: from must be before to", ErrInvalidSlotRequest)
+	case req.To.Sub(req.From) > MaxSlotRange:
+		return fmt.Errorf("%w: the range is longer than %v", ErrInvalidSlotRequest, MaxSlotRange)
+	case req.Limit < 0 || req.Limit > MaxSlotLimit:
+		return fmt.Errorf("%w: limit must be at most %d", ErrInvalidSlotRequest, MaxSlotLimit)
+	}
+	if req.Limit == 0 {
+		req.Limit = DefaultSlotLimit
+	}
+	return nil
+}
+
+// checkFreeBusy makes sure that the user can see when the other user is busy: the other user
+// must have shared every calendar of theirs with the user, free-busy access is enough.
+func (a *App) checkFreeBusy(ctx context.Context, user, other string) error {
+	calendars, err := a.storage.ListCalendars(ctx, other)
+	if err != nil {
+		return err
+	}
+	owned := 0
+	for _, cal := range calendars {
+		if cal.OwnerID != other {
+			continue
+		}
+		owned++
+		access, err := a.storage.CalendarAccess(ctx, user, cal.ID)
+		if errors.Is(err, storage.ErrCalendarNotFound) || err == nil && access < storage.AccessFreeBusy {
+			return fmt.Errorf("%w: calendar %s of %s is not shared", storage.ErrAccessDenied, cal.ID, other)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if owned == 0 {
+		return fmt.Errorf("%w: %s has no calendars shared", storage.ErrAccessDenied, other)
+	}
+	return nil
+}
+
+// participant returns the working hours of the user and the user's events among the listed ones.
+func (a *App) participant(ctx context.Context, user string, events []storage.Event) (participant, error) {
+	hours, err := a.workingHours(ctx, user)
+	if err != nil {
+		return participant{}, err
+	}
+	loc, err := hours.Location()
+	if err != nil {
+		return participant{}, err
+	}
+	busy := make([]storage.Event, 0, len(events))
+	for _, e := range events {
+		if e.OwnerID == user {
+			busy = append(busy, e.FreeBusy())
+		}
+	}
+	return participant{hours: hours, location: loc, busy: busy}, nil
+}
+
+// slotScore returns the least margin between the slot and the edges of the participants'
+// working days, ok is false if someone is busy or not working.
+func slotScore(participants []participant, start, end time.Time) (score time.Duration, ok bool) {
+	for i, p := range participants {
+		dayStart, dayEnd, working := p.hours.Day(start, p.location)
+		if !working || start.Before(dayStart) || end.After(dayEnd) {
+			return 0, false
+		}
+		for _, e := range p.busy {
+			if e.Overlaps(start, end) {
+				return 0, false
+			}
+		}
+		margin := start.Sub(dayStart)
+		if m := dayEnd.Sub(end); m < margin {
+			margin = m
+		}
+		if i == 0 || margin < score {
+			score = margin
+		}
+	}
+	return score, true
+}
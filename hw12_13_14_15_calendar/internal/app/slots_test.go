@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSlots(t *testing.T) {
+	a := New(nil, memorystorage.New(), nil)
+	alice := auth.WithUserID(context.Background(), "alice")
+	bob := auth.WithUserID(context.Background(), "bob")
+	monday := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Bob works 12:00-20:00 in Moscow, 09:00-17:00 UTC.
+	_, err := a.SetWorkingHours(bob, storage.WorkingHours{
+		TimeZone: "Europe/Moscow",
+		Start:    12 * time.Hour,
+		End:      20 * time.Hour,
+		Days:     []time.Weekday{time.Monday},
+	})
+	require.NoError(t, err)
+
+	cal, err := a.CreateCalendar(bob, "Work")
+	require.NoError(t, err)
+	require.NoError(t, a.ShareCalendar(bob, cal.ID, "alice", storage.AccessFreeBusy))
+	_, err = a.CreateEvent(bob, storage.Event{
+		CalendarID: cal.ID,
+		Title:      "busy",
+		StartAt:    monday.Add(11 * time.Hour),
+		EndAt:      monday.Add(15 * time.Hour),
+	})
+	require.NoError(t, err)
+
+	slots, err := a.FindSlots(alice, SlotRequest{
+		UserIDs:  []string{"bob"},
+		Duration: time.Hour,
+		From:     monday,
+		To:       monday.AddDate(0, 0, 7),
+		Limit:    100,
+	})
+	require.NoError(t, err)
+
+	// Alice works 09:00-18:00 UTC by default, so on Monday both are free at 09:00-11:00 and 15:00-17:00.
+	starts := make([]time.Time, 0, len(slots))
+	for _, s := range slots {
+		require.Equal(t, time.Hour, s.End.Sub(s.Start))
+		starts = append(starts, s.Start)
+	}
+	require.ElementsMatch(t, []time.Time{
+		monday.Add(9 * time.Hour), monday.Add(9*time.Hour + 15*time.Minute),
+		monday.Add(9*time.Hour + 30*time.Minute), monday.Add(9*time.Hour + 45*time.Minute),
+		monday.Add(10 * time.Hour),
+		monday.Add(15 * time.Hour), monday.Add(15*time.Hour + 15*time.Minute),
+		monday.Add(15*time.Hour + 30*time.Minute), monday.Add(15*time.Hour + 45*time.Minute),
+		monday.Add(16 * time.Hour),
+	}, starts)
+
+	// Slots further from the edges of the working days come first, earlier ones on ties.
+	require.Equal(t, monday.Add(10*time.Hour), slots[0].Start)
+	require.Equal(t, monday.Add(15*time.Hour), slots[1].Start)
+	require.Equal(t, 60*time.Minute, slots[0].Score)
+	require.Equal(t, time.Duration(0), slots[len(slots)-1].Score)
+
+	slots, err = a.FindSlots(alice, SlotRequest{UserIDs: []string{"bob"}, Duration: time.Hour, From: monday, To: monday.AddDate(0, 0, 1), Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, slots, 2)
+
+	// Users who haven't shared all their calendars with alice are refused, as well as users without any.
+	carol := auth.WithUserID(context.Background(), "carol")
+	shared, err := a.CreateCalendar(carol, "Work")
+	require.NoError(t, err)
+	require.NoError(t, a.ShareCalendar(carol, shared.ID, "alice", storage.AccessRead))
+	_, err = a.CreateCalendar(carol, "Private")
+	require.NoError(t, err)
+	for _, u := range []string{"carol", "dave"} {
+		_, err = a.FindSlots(alice, SlotRequest{UserIDs: []string{"bob", u}, Duration: time.Hour, From: monday, To: monday.AddDate(0, 0, 1)})
+		require.True(t, errors.Is(err, storage.ErrAccessDenied), u)
+	}
+
+	_, err = a.FindSlots(alice, SlotRequest{Duration: time.Hour, From: monday, To: monday.AddDate(0, 2, 0)})
+	require.True(t, errors.Is(err, ErrInvalidSlotRequest))
+	_, err = a.SetWorkingHours(alice, storage.WorkingHours{TimeZone: "Nowhere/City", Start: time.Hour, End: 2 * time.Hour})
+	require.True(t, errors.Is(err, ErrInvalidWorkingHours))
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+const (
+	MaxTagLength    = 64
+	MaxTagsPerEvent = 20
+)
+
+var (
+	ErrInvalidTag = errors.New("invalid tag")
+
+	colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// PutTag creates the current user's tag or changes its colour.
+func (a *App) PutTag(ctx context.Context, name, color string) (_ storage.Tag, err error) {
+	ctx, span := tracer.Start(ctx, "App.PutTag")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Tag{}, err
+	}
+	if err := validateTag(name); err != nil {
+		return storage.Tag{}, fmt.Errorf("%w: %v", ErrInvalidTag, err) //nolint:errorlint
+	}
+	if !colorPattern.MatchString(color) {
+		return storage.Tag{}, fmt.Errorf("%w: color must be #rrggbb", ErrInvalidTag)
+	}
+
+	tag := storage.Tag{UserID: user, Name: name, Color: strings.ToLower(color)}
+	if err := a.storage.PutTag(ctx, tag); err != nil {
+		return storage.Tag{}, err
+	}
+	return tag, nil
+}
+
+func (a *App) ListTags(ctx context.Context) (_ []storage.Tag, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListTags")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListTags(ctx, user)
+}
+
+// DeleteTag deletes the current user's tag, events keep it as a plain label.
+func (a *App) DeleteTag(ctx context.Context, name string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.DeleteTag")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	return a.storage.DeleteTag(ctx, user, name)
+}
+
+func validateTag(name string) error {
+	switch {
+	case strings.TrimSpace(name) != name || name == "":
+		return errors.New("empty name or surrounding spaces")
+	case len(name) > MaxTagLength:
+		return fmt.Errorf("name is longer than %d bytes", MaxTagLength)
+	case strings.ContainsAny(name, "\r\n"):
+		return errors.New("line breaks in name")
+	}
+	return nil
+}
+
+func validateTags(tags []string) error {
+	if len(tags) > MaxTagsPerEvent {
+		return fmt.Errorf("more than %d tags", MaxTagsPerEvent)
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return fmt.Errorf("tag %q: %w", tag, err)
+		}
+		if seen[strings.ToLower(tag)] {
+			return fmt.Errorf("duplicate tag %q", tag)
+		}
+		seen[strings.ToLower(tag)] = true
+	}
+	return nil
+}
+
+// filterTags returns the events having any of the tags.
+func filterTags(events []storage.Event, tags []string) []storage.Event {
+	if len(tags) == 0 {
+		return events
+	}
+	filtered := make([]storage.Event, 0, len(events))
+	for _, e := range events {
+		if e.HasAnyTag(tags) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
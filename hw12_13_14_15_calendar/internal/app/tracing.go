@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var tracer = otel.Tracer("github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app")
+
+// tracedStorage wraps every storage call into a span.
+type tracedStorage struct {
+	storage Storage
+}
+
+func (s *tracedStorage) CreateCalendar(ctx context.Context, cal storage.Calendar) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.CreateCalendar")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.CreateCalendar(ctx, cal)
+}
+
+func (s *tracedStorage) GetCalendar(ctx context.Context, userID, calendarID string) (_ storage.Calendar, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.GetCalendar")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.GetCalendar(ctx, userID, calendarID)
+}
+
+func (s *tracedStorage) CalendarAccess(ctx context.Context, userID, calendarID string) (_ storage.Access, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.CalendarAccess")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.CalendarAccess(ctx, userID, calendarID)
+}
+
+func (s *tracedStorage) ListCalendars(ctx context.Context, userID string) (_ []storage.Calendar, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListCalendars")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListCalendars(ctx, userID)
+}
+
+func (s *tracedStorage) DeleteCalendar(ctx context.Context, userID, calendarID string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.DeleteCalendar")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.DeleteCalendar(ctx, userID, calendarID)
+}
+
+func (s *tracedStorage) ShareCalendar(ctx context.Context, userID string, grant storage.Grant) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ShareCalendar")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ShareCalendar(ctx, userID, grant)
+}
+
+func (s *tracedStorage) RevokeShare(ctx context.Context, userID, calendarID, granteeID string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.RevokeShare")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.RevokeShare(ctx, userID, calendarID, granteeID)
+}
+
+func (s *tracedStorage) ListShares(ctx context.Context, userID, calendarID string) (_ []storage.Grant, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListShares")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListShares(ctx, userID, calendarID)
+}
+
+func (s *tracedStorage) CreateEvent(ctx context.Context, userID string, e storage.Event) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.CreateEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.CreateEvent(ctx, userID, e)
+}
+
+func (s *tracedStorage) UpdateEvent(ctx context.Context, userID string, e storage.Event) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.UpdateEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UpdateEvent(ctx, userID, e)
+}
+
+func (s *tracedStorage) DeleteEvent(ctx context.Context, userID, eventID string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.DeleteEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.DeleteEvent(ctx, userID, eventID)
+}
+
+func (s *tracedStorage) GetEvent(ctx context.Context, userID, eventID string) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.GetEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.GetEvent(ctx, userID, eventID)
+}
+
+func (s *tracedStorage) FindEvent(ctx context.Context, userID, calendarID, uid string) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.FindEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.FindEvent(ctx, userID, calendarID, uid)
+}
+
+func (s *tracedStorage) ListEvents(ctx context.Context, userID string, from, to time.Time) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListEvents")
+	span.SetAttributes(attribute.String("from", from.Format(time.RFC3339)), attribute.String("to", to.Format(time.RFC3339)))
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListEvents(ctx, userID, from, to)
+}
+
+func (s *tracedStorage) ApplyEventOps(ctx context.Context, userID string, ops []storage.EventOp) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ApplyEventOps")
+	span.SetAttributes(attribute.Int("operations", len(ops)))
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ApplyEventOps(ctx, userID, ops)
+}
+
+func (s *tracedStorage) TrashEvent(ctx context.Context, userID, eventID string, at time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.TrashEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.TrashEvent(ctx, userID, eventID, at)
+}
+
+func (s *tracedStorage) ListTrash(ctx context.Context, userID string) (_ []storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListTrash")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListTrash(ctx, userID)
+}
+
+func (s *tracedStorage) RestoreEvent(ctx context.Context, userID, eventID string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.RestoreEvent")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.RestoreEvent(ctx, userID, eventID)
+}
+
+func (s *tracedStorage) AddAttachment(
+	ctx context.Context, userID, eventID string, att storage.Attachment, max int,
+) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.AddAttachment")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.AddAttachment(ctx, userID, eventID, att, max)
+}
+
+func (s *tracedStorage) RemoveAttachment(ctx context.Context, userID, eventID, attachmentID string) (_ storage.Event, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.RemoveAttachment")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.RemoveAttachment(ctx, userID, eventID, attachmentID)
+}
+
+func (s *tracedStorage) AppendAudit(ctx context.Context, entries ...storage.AuditEntry) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.AppendAudit")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.AppendAudit(ctx, entries...)
+}
+
+func (s *tracedStorage) ListAudit(
+	ctx context.Context, userID string, filter storage.AuditFilter,
+) (_ []storage.AuditEntry, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListAudit")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListAudit(ctx, userID, filter)
+}
+
+func (s *tracedStorage) CreateWebhook(ctx context.Context, w storage.Webhook) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.CreateWebhook")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.CreateWebhook(ctx, w)
+}
+
+func (s *tracedStorage) ListWebhooks(ctx context.Context, userID string) (_ []storage.Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListWebhooks")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListWebhooks(ctx, userID)
+}
+
+func (s *tracedStorage) DeleteWebhook(ctx context.Context, userID, webhookID string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.DeleteWebhook")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.DeleteWebhook(ctx, userID, webhookID)
+}
+
+func (s *tracedStorage) EnableWebhook(ctx context.Context, userID, webhookID string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.EnableWebhook")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.EnableWebhook(ctx, userID, webhookID)
+}
+
+func (s *tracedStorage) ListWebhookDeliveries(
+	ctx context.Context, userID, webhookID string,
+) (_ []storage.WebhookDelivery, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListWebhookDeliveries")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListWebhookDeliveries(ctx, userID, webhookID)
+}
+
+func (s *tracedStorage) ListWebhookDeadLetters(
+	ctx context.Context, userID, webhookID string,
+) (_ []storage.WebhookMessage, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListWebhookDeadLetters")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListWebhookDeadLetters(ctx, userID, webhookID)
+}
+
+func (s *tracedStorage) RedriveWebhookDeadLetters(
+	ctx context.Context, userID, webhookID string, messageIDs []string, now time.Time,
+) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.RedriveWebhookDeadLetters")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.RedriveWebhookDeadLetters(ctx, userID, webhookID, messageIDs, now)
+}
+
+func (s *tracedStorage) SetWorkingHours(ctx context.Context, w storage.WorkingHours) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.SetWorkingHours")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SetWorkingHours(ctx, w)
+}
+
+func (s *tracedStorage) GetWorkingHours(ctx context.Context, userID string) (_ storage.WorkingHours, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.GetWorkingHours")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.GetWorkingHours(ctx, userID)
+}
+
+func (s *tracedStorage) PutTag(ctx context.Context, tag storage.Tag) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.PutTag")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.PutTag(ctx, tag)
+}
+
+func (s *tracedStorage) ListTags(ctx context.Context, userID string) (_ []storage.Tag, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListTags")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListTags(ctx, userID)
+}
+
+func (s *tracedStorage) DeleteTag(ctx context.Context, userID, name string) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.DeleteTag")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.DeleteTag(ctx, userID, name)
+}
+
+func (s *tracedStorage) SetPreferences(ctx context.Context, p storage.Preferences) (err error) {
+	ctx, span := tracer.Start(ctx, "Storage.SetPreferences")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SetPreferences(ctx, p)
+}
+
+func (s *tracedStorage) GetPreferences(ctx context.Context, userID string) (_ storage.Preferences, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.GetPreferences")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.GetPreferences(ctx, userID)
+}
+
+func (s *tracedStorage) ListDeliveries(ctx context.Context, userID string) (_ []storage.Delivery, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.ListDeliveries")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ListDeliveries(ctx, userID)
+}
+
+func (s *tracedStorage) CountEvents(ctx context.Context) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "Storage.CountEvents")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.CountEvents(ctx)
+}
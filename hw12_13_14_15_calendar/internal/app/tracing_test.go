@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	a := New(nil, memorystorage.New(), nil)
+	_, err := a.CreateCalendar(auth.WithUserID(context.Background(), "user1"), "Work")
+	require.NoError(t, err)
+	_, err = a.ListCalendars(context.Background())
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	require.Equal(t, "Storage.CreateCalendar", spans[0].Name())
+	require.Equal(t, "App.CreateCalendar", spans[1].Name())
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+
+	require.Equal(t, "App.ListCalendars", spans[2].Name())
+	require.Len(t, spans[2].Events(), 1) // recorded error
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// CreateWebhook subscribes the user to changes of the events the user can read.
+// The secret for signature verification is returned only here.
+func (a *App) CreateWebhook(ctx context.Context, rawURL string) (_ storage.Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "App.CreateWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return storage.Webhook{}, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return storage.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) url", ErrInvalidWebhook)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return storage.Webhook{}, err
+	}
+	w := storage.Webhook{
+		ID:        uuid.New().String(),
+		UserID:    user,
+		URL:       u.String(),
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.storage.CreateWebhook(ctx, w); err != nil {
+		return storage.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (a *App) ListWebhooks(ctx context.Context) (_ []storage.Webhook, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListWebhooks")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := a.storage.ListWebhooks(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (a *App) DeleteWebhook(ctx context.Context, webhookID string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.DeleteWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	return a.storage.DeleteWebhook(ctx, user, webhookID)
+}
+
+// EnableWebhook enables the webhook disabled after failed deliveries.
+func (a *App) EnableWebhook(ctx context.Context, webhookID string) (err error) {
+	ctx, span := tracer.Start(ctx, "App.EnableWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return err
+	}
+	return a.storage.EnableWebhook(ctx, user, webhookID)
+}
+
+func (a *App) ListWebhookDeliveries(ctx context.Context, webhookID string) (_ []storage.WebhookDelivery, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListWebhookDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListWebhookDeliveries(ctx, user, webhookID)
+}
+
+// ListWebhookDeadLetters returns the changes which could not be delivered to the user's webhooks,
+// or to one of them if webhookID is set, the latest first.
+func (a *App) ListWebhookDeadLetters(ctx context.Context, webhookID string) (_ []storage.WebhookMessage, err error) {
+	ctx, span := tracer.Start(ctx, "App.ListWebhookDeadLetters")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListWebhookDeadLetters(ctx, user, webhookID)
+}
+
+// RedriveWebhookDeadLetters makes the dead letters of the user's webhooks due again with all
+// their attempts, they are delivered on the next run of the retry job. The dead letters are
+// limited to the webhook if webhookID is set and to messageIDs if there are any.
+func (a *App) RedriveWebhookDeadLetters(ctx context.Context, webhookID string, messageIDs []string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "App.RedriveWebhookDeadLetters")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := userID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return a.storage.RedriveWebhookDeadLetters(ctx, user, webhookID, messageIDs, time.Now().UTC())
+}
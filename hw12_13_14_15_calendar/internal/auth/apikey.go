@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+const APIKeyHeader = "X-Api-Key"
+
+// APIKeys authenticates requests by static keys, each key belongs to a single user, given as
+// "<tenant>/<user>" for users of tenants other than the default one.
+// The key is passed in the X-Api-Key header, as "Authorization: ApiKey <key>" or as the password
+// of Basic authentication for clients like CalDAV ones, the username must then be the key's user.
+type APIKeys struct {
+	keys map[string]string
+}
+
+func NewAPIKeys(keys map[string]string) *APIKeys {
+	k := make(map[string]string, len(keys))
+	for key, userID := range keys {
+		k[key] = userID
+	}
+	return &APIKeys{keys: k}
+}
+
+func (a *APIKeys) Authenticate(ctx context.Context, headers Headers) (string, error) {
+	userID, _, err := a.AuthenticateTenant(ctx, headers)
+	return userID, err
+}
+
+func (a *APIKeys) AuthenticateTenant(_ context.Context, headers Headers) (string, string, error) {
+	key := headers.Get(APIKeyHeader)
+	if key == "" {
+		key = authorization(headers, "ApiKey")
+	}
+	username := ""
+	if key == "" {
+		username, key = basicAuth(headers)
+	}
+	if key == "" {
+		return "", "", ErrUnauthenticated
+	}
+
+	userID := ""
+	for k, id := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			userID = id
+		}
+	}
+	tenantID := ""
+	if i := strings.IndexByte(userID, '/'); i >= 0 {
+		tenantID, userID = userID[:i], userID[i+1:]
+	}
+	if userID == "" || username != "" && username != userID {
+		return "", "", ErrUnauthenticated
+	}
+	return userID, tenantID, nil
+}
+
+// basicAuth returns the username and the password of Basic authentication.
+func basicAuth(headers Headers) (string, string) {
+	data, err := base64.StdEncoding.DecodeString(authorization(headers, "Basic"))
+	if err != nil {
+		return "", ""
+	}
+	username, password := "", string(data)
+	if i := strings.IndexByte(password, ':'); i >= 0 {
+		username, password = password[:i], password[i+1:]
+	}
+	return username, password
+}
+
+// authorization returns credentials of the Authorization header with the given scheme.
+func authorization(headers Headers, scheme string) string {
+	value := headers.Get("Authorization")
+	prefix := scheme + " "
+	if len(value) <= len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(value[len(prefix):])
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxTenantIDLength is the maximum length of a tenant ID.
+const maxTenantIDLength = 64
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrInvalidToken    = errors.New("invalid token")
+)
+
+// Headers gives access to request headers independently of transport:
+// http.Header satisfies it, gRPC metadata can be adapted to it.
+type Headers interface {
+	Get(key string) string
+}
+
+// Authenticator resolves the ID of the user who sent a request.
+type Authenticator interface {
+	Authenticate(ctx context.Context, headers Headers) (userID string, err error)
+}
+
+// TenantAuthenticator is implemented by authenticators which also resolve the tenant of the user,
+// the tenant is empty for users of the default tenant.
+type TenantAuthenticator interface {
+	AuthenticateTenant(ctx context.Context, headers Headers) (userID, tenantID string, err error)
+}
+
+// Resolve returns the user who sent the request and their tenant, the tenant is empty if the
+// authenticator does not resolve tenants.
+func Resolve(ctx context.Context, a Authenticator, headers Headers) (userID, tenantID string, err error) {
+	if ta, ok := a.(TenantAuthenticator); ok {
+		userID, tenantID, err = ta.AuthenticateTenant(ctx, headers)
+	} else {
+		userID, err = a.Authenticate(ctx, headers)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if !validUserID(userID) {
+		return "", "", fmt.Errorf("%w: invalid user %q", ErrUnauthenticated, userID)
+	}
+	if !validTenantID(tenantID) {
+		return "", "", fmt.Errorf("%w: invalid tenant %q", ErrUnauthenticated, tenantID)
+	}
+	return userID, tenantID, nil
+}
+
+// validUserID refuses control characters, storages use them to separate IDs in keys.
+func validUserID(userID string) bool {
+	return strings.IndexFunc(userID, unicode.IsControl) < 0
+}
+
+// validTenantID allows latin letters, digits, '-', '_' and '.', but not "." and ".." as tenants
+// name directories, e.g. of attachment files.
+func validTenantID(tenantID string) bool {
+	if len(tenantID) > maxTenantIDLength || tenantID == "." || tenantID == ".." {
+		return false
+	}
+	for _, r := range tenantID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type ctxKey struct{}
+
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, userID)
+}
+
+func UserID(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(ctxKey{}).(string)
+	return userID, ok && userID != ""
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedHeader(t *testing.T) {
+	a := NewTrustedHeader("")
+
+	userID, err := a.Authenticate(context.Background(), http.Header{"X-User-Id": {"user1"}})
+	require.NoError(t, err)
+	require.Equal(t, "user1", userID)
+
+	_, err = a.Authenticate(context.Background(), http.Header{})
+	require.True(t, errors.Is(err, ErrUnauthenticated))
+}
+
+func TestAPIKeys(t *testing.T) {
+	a := NewAPIKeys(map[string]string{"key1": "user1", "key2": "user2"})
+
+	t.Run("x-api-key header", func(t *testing.T) {
+		userID, err := a.Authenticate(context.Background(), http.Header{"X-Api-Key": {"key2"}})
+		require.NoError(t, err)
+		require.Equal(t, "user2", userID)
+	})
+
+	t.Run("authorization header", func(t *testing.T) {
+		userID, err := a.Authenticate(context.Background(), http.Header{"Authorization": {"ApiKey key1"}})
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+	})
+
+	t.Run("basic auth", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("user1", "key1")
+		userID, err := a.Authenticate(context.Background(), r.Header)
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+
+		r.SetBasicAuth("user2", "key1")
+		_, err = a.Authenticate(context.Background(), r.Header)
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := a.Authenticate(context.Background(), http.Header{"X-Api-Key": {"key3"}})
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+
+	t.Run("trusted header is ignored", func(t *testing.T) {
+		_, err := a.Authenticate(context.Background(), http.Header{"X-User-Id": {"user1"}})
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+}
+
+func TestUserID(t *testing.T) {
+	_, ok := UserID(context.Background())
+	require.False(t, ok)
+
+	userID, ok := UserID(WithUserID(context.Background(), "user1"))
+	require.True(t, ok)
+	require.Equal(t, "user1", userID)
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("trusted header", func(t *testing.T) {
+		a := NewTrustedHeader("")
+		userID, tenantID, err := Resolve(ctx, a, http.Header{"X-User-Id": {"user1"}, "X-Tenant-Id": {"acme"}})
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+		require.Equal(t, "acme", tenantID)
+
+		a.SetTenantHeader("X-Org")
+		_, tenantID, err = Resolve(ctx, a, http.Header{"X-User-Id": {"user1"}, "X-Org": {"globex"}})
+		require.NoError(t, err)
+		require.Equal(t, "globex", tenantID)
+
+		_, tenantID, err = Resolve(ctx, a, http.Header{"X-User-Id": {"user1"}})
+		require.NoError(t, err)
+		require.Empty(t, tenantID)
+
+		for _, tenantID := range []string{"acme/../globex", ".", ".."} {
+			_, _, err = Resolve(ctx, a, http.Header{"X-User-Id": {"user1"}, "X-Org": {tenantID}})
+			require.True(t, errors.Is(err, ErrUnauthenticated), tenantID)
+		}
+		_, _, err = Resolve(ctx, a, http.Header{"X-User-Id": {"acme\x00user1"}})
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		a := NewAPIKeys(map[string]string{"key1": "user1", "key2": "acme/user1"})
+		userID, tenantID, err := Resolve(ctx, a, http.Header{"X-Api-Key": {"key1"}})
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+		require.Empty(t, tenantID)
+
+		userID, tenantID, err = Resolve(ctx, a, http.Header{"X-Api-Key": {"key2"}})
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+		require.Equal(t, "acme", tenantID)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("user1", "key2")
+		_, tenantID, err = Resolve(ctx, a, r.Header)
+		require.NoError(t, err)
+		require.Equal(t, "acme", tenantID)
+
+		a = NewAPIKeys(map[string]string{"key3": "user\n1"})
+		_, _, err = Resolve(ctx, a, http.Header{"X-Api-Key": {"key3"}})
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+}
@@ -0,0 +1,46 @@
+package auth
+
+import "context"
+
+const (
+	DefaultUserIDHeader   = "X-User-Id"
+	DefaultTenantIDHeader = "X-Tenant-Id"
+)
+
+// TrustedHeader takes the user ID and the tenant ID from request headers as is.
+// It must be used only behind a proxy which sets the headers itself.
+type TrustedHeader struct {
+	name   string
+	tenant string
+}
+
+func NewTrustedHeader(name string) *TrustedHeader {
+	if name == "" {
+		name = DefaultUserIDHeader
+	}
+	return &TrustedHeader{name: name, tenant: DefaultTenantIDHeader}
+}
+
+// SetTenantHeader changes the name of the header with the tenant ID.
+func (h *TrustedHeader) SetTenantHeader(name string) {
+	if name == "" {
+		name = DefaultTenantIDHeader
+	}
+	h.tenant = name
+}
+
+func (h *TrustedHeader) AuthenticateTenant(ctx context.Context, headers Headers) (string, string, error) {
+	userID, err := h.Authenticate(ctx, headers)
+	if err != nil {
+		return "", "", err
+	}
+	return userID, headers.Get(h.tenant), nil
+}
+
+func (h *TrustedHeader) Authenticate(_ context.Context, headers Headers) (string, error) {
+	userID := headers.Get(h.name)
+	if userID == "" {
+		return "", ErrUnauthenticated
+	}
+	return userID, nil
+}
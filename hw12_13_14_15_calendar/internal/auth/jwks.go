@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// JWKS is a set of keys used to verify tokens: RSA keys for RS256 and symmetric (oct) keys for HS256.
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	id     string
+	alg    string
+	rsa    *rsa.PublicKey
+	secret []byte
+}
+
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("parse jwk %q: %w", k.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+	return &JWKS{keys: keys}, nil
+}
+
+func parseJWK(k jwkJSON) (jwk, error) {
+	switch k.Kty {
+	case "RSA":
+		if k.Alg != "" && k.Alg != algRS256 {
+			return jwk{}, fmt.Errorf("unsupported alg %q for RSA key", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return jwk{}, fmt.Errorf("decode modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return jwk{}, fmt.Errorf("decode exponent: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return jwk{}, errors.New("invalid exponent")
+		}
+		return jwk{
+			id:  k.Kid,
+			alg: algRS256,
+			rsa: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())},
+		}, nil
+	case "oct":
+		if k.Alg != "" && k.Alg != algHS256 {
+			return jwk{}, fmt.Errorf("unsupported alg %q for oct key", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return jwk{}, fmt.Errorf("decode secret: %w", err)
+		}
+		if len(secret) == 0 {
+			return jwk{}, errors.New("empty secret")
+		}
+		return jwk{id: k.Kid, alg: algHS256, secret: secret}, nil
+	default:
+		return jwk{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// find returns the key for the token header: by kid if it is set,
+// otherwise the only key of the algorithm.
+func (s *JWKS) find(kid, alg string) (jwk, error) {
+	var found []jwk
+	for _, k := range s.keys {
+		if k.alg != alg {
+			continue
+		}
+		if kid != "" && k.id == kid {
+			return k, nil
+		}
+		found = append(found, k)
+	}
+	if kid == "" && len(found) == 1 {
+		return found[0], nil
+	}
+	return jwk{}, ErrKeyNotFound
+}
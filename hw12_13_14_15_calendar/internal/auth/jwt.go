@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+
+	clockSkew = time.Minute
+)
+
+// JWT authenticates requests by "Authorization: Bearer <token>" signed with HS256 or RS256.
+// The user ID is taken from the "sub" claim, the tenant ID from the "tenant" one.
+type JWT struct {
+	keys     *JWKS
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewJWT creates JWT authenticator. Empty issuer or audience are not checked.
+func NewJWT(keys *JWKS, issuer, audience string) *JWT {
+	return &JWT{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		now:      time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Tenant    string   `json:"tenant"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// audience is either a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *JWT) Authenticate(ctx context.Context, headers Headers) (string, error) {
+	userID, _, err := j.AuthenticateTenant(ctx, headers)
+	return userID, err
+}
+
+func (j *JWT) AuthenticateTenant(_ context.Context, headers Headers) (string, string, error) {
+	token := authorization(headers, "Bearer")
+	if token == "" {
+		return "", "", ErrUnauthenticated
+	}
+
+	claims, err := j.verify(token)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidToken, err) //nolint:errorlint
+	}
+	return claims.Subject, claims.Tenant, nil
+}
+
+func (j *JWT) verify(token string) (jwtClaims, error) {
+	var claims jwtClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("decode header: %w", err)
+	}
+	key, err := j.keys.find(header.Kid, header.Alg)
+	if err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("decode signature: %w", err)
+	}
+	if err := verifySignature(key, parts[0]+"."+parts[1], signature); err != nil {
+		return claims, err
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("decode claims: %w", err)
+	}
+	return claims, j.validate(claims)
+}
+
+func (j *JWT) validate(claims jwtClaims) error {
+	now := j.now()
+	switch {
+	case claims.Subject == "":
+		return fmt.Errorf("no subject")
+	case claims.ExpiresAt == 0:
+		return fmt.Errorf("no expiration time")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return fmt.Errorf("token is expired")
+	case claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-clockSkew)):
+		return fmt.Errorf("token is not valid yet")
+	case j.issuer != "" && claims.Issuer != j.issuer:
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case j.audience != "" && !claims.Audience.contains(j.audience):
+		return fmt.Errorf("unexpected audience")
+	}
+	return nil
+}
+
+func verifySignature(key jwk, signed string, signature []byte) error {
+	switch key.alg {
+	case algHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	case algRS256:
+		hash := sha256.Sum256([]byte(signed))
+		return rsa.VerifyPKCS1v15(key.rsa, crypto.SHA256, hash[:], signature)
+	default:
+		return fmt.Errorf("unsupported alg %q", key.alg)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
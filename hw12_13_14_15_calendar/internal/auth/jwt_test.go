@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSecret = []byte("very-secret-key")
+	testNow    = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sign(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(h) + "." + b64(c)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		require.NoError(t, err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "use": "sig", "n": %q, "e": %q}
+	]}`, b64(testSecret), b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))
+	keys, err := ParseJWKS([]byte(jwks))
+	require.NoError(t, err)
+
+	a := NewJWT(keys, "issuer", "calendar")
+	a.now = func() time.Time { return testNow }
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "user1",
+			"iss": "issuer",
+			"aud": []string{"calendar", "other"},
+			"exp": testNow.Add(time.Hour).Unix(),
+		}
+	}
+
+	t.Run("HS256", func(t *testing.T) {
+		token := sign(t, map[string]interface{}{"alg": "HS256", "kid": "hs"}, validClaims(), testSecret)
+		userID, err := a.Authenticate(context.Background(), bearer(token))
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+	})
+
+	t.Run("RS256", func(t *testing.T) {
+		token := sign(t, map[string]interface{}{"alg": "RS256", "kid": "rs"}, validClaims(), rsaKey)
+		userID, err := a.Authenticate(context.Background(), bearer(token))
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+	})
+
+	t.Run("tenant", func(t *testing.T) {
+		claims := validClaims()
+		claims["tenant"] = "acme"
+		token := sign(t, map[string]interface{}{"alg": "HS256", "kid": "hs"}, claims, testSecret)
+		userID, tenantID, err := Resolve(context.Background(), a, bearer(token))
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+		require.Equal(t, "acme", tenantID)
+
+		claims["sub"] = "user1\x00globex"
+		token = sign(t, map[string]interface{}{"alg": "HS256", "kid": "hs"}, claims, testSecret)
+		_, _, err = Resolve(context.Background(), a, bearer(token))
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+
+	t.Run("no kid", func(t *testing.T) {
+		token := sign(t, map[string]interface{}{"alg": "RS256"}, validClaims(), rsaKey)
+		userID, err := a.Authenticate(context.Background(), bearer(token))
+		require.NoError(t, err)
+		require.Equal(t, "user1", userID)
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		_, err := a.Authenticate(context.Background(), http.Header{})
+		require.True(t, errors.Is(err, ErrUnauthenticated))
+	})
+
+	invalid := []struct {
+		name   string
+		header map[string]interface{}
+		claims func(map[string]interface{})
+		key    interface{}
+	}{
+		{
+			name:   "wrong secret",
+			header: map[string]interface{}{"alg": "HS256", "kid": "hs"},
+			key:    []byte("other-secret"),
+		},
+		{
+			name:   "alg confusion",
+			header: map[string]interface{}{"alg": "HS256", "kid": "rs"},
+			key:    testSecret,
+		},
+		{
+			name:   "alg none",
+			header: map[string]interface{}{"alg": "none", "kid": "hs"},
+			key:    testSecret,
+		},
+		{
+			name:   "expired",
+			header: map[string]interface{}{"alg": "HS256", "kid": "hs"},
+			claims: func(c map[string]interface{}) { c["exp"] = testNow.Add(-time.Hour).Unix() },
+			key:    testSecret,
+		},
+		{
+			name:   "not valid yet",
+			header: map[string]interface{}{"alg": "HS256", "kid": "hs"},
+			claims: func(c map[string]interface{}) { c["nbf"] = testNow.Add(time.Hour).Unix() },
+			key:    testSecret,
+		},
+		{
+			name:   "wrong issuer",
+			header: map[string]interface{}{"alg": "HS256", "kid": "hs"},
+			claims: func(c map[string]interface{}) { c["iss"] = "other" },
+			key:    testSecret,
+		},
+		{
+			name:   "wrong audience",
+			header: map[string]interface{}{"alg": "HS256", "kid": "hs"},
+			claims: func(c map[string]interface{}) { c["aud"] = "other" },
+			key:    testSecret,
+		},
+		{
+			name:   "no subject",
+			header: map[string]interface{}{"alg": "HS256", "kid": "hs"},
+			claims: func(c map[string]interface{}) { delete(c, "sub") },
+			key:    testSecret,
+		},
+	}
+
+	for _, tc := range invalid {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			claims := validClaims()
+			if tc.claims != nil {
+				tc.claims(claims)
+			}
+			token := sign(t, tc.header, claims, tc.key)
+			_, err := a.Authenticate(context.Background(), bearer(token))
+			require.True(t, errors.Is(err, ErrInvalidToken))
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	_, err := ParseJWKS([]byte(`{"keys": [{"kty": "EC", "kid": "ec"}]}`))
+	require.Error(t, err)
+
+	_, err = ParseJWKS([]byte(`{"keys": [{"kty": "oct", "alg": "RS256", "k": "c2VjcmV0"}]}`))
+	require.Error(t, err)
+
+	keys, err := ParseJWKS([]byte(`{"keys": [{"kty": "oct", "use": "enc", "k": "c2VjcmV0"}]}`))
+	require.NoError(t, err)
+	require.Empty(t, keys.keys)
+}
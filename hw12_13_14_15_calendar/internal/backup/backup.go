@@ -0,0 +1,192 @@
+// Package backup writes storage snapshots to versioned compressed archives and reads them back.
+//
+// An archive is a gzipped tar with a JSON Lines file for every slice of storage.Snapshot,
+// e.g. Events.jsonl, followed by manifest.json with the format version and the number of
+// records and the SHA-256 of every file.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Version is the archive format version, archives of newer versions are rejected.
+const Version = 1
+
+const (
+	manifestName    = "manifest.json"
+	sectionSuffix   = ".jsonl"
+	maxManifestSize = 1 << 20
+)
+
+var ErrInvalid = errors.New("invalid backup")
+
+type Manifest struct {
+	Version   int
+	CreatedAt time.Time
+	Sections  []Section
+}
+
+// Section describes the file with one kind of records, e.g. events.
+type Section struct {
+	Name    string
+	Records int
+	SHA256  string
+}
+
+// Write writes the snapshot to w as a compressed archive.
+func Write(w io.Writer, snap storage.Snapshot, createdAt time.Time) (Manifest, error) {
+	manifest := Manifest{Version: Version, CreatedAt: createdAt.UTC()}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	v := reflect.ValueOf(snap)
+	for i := 0; i < v.NumField(); i++ {
+		name, field := v.Type().Field(i).Name, v.Field(i)
+		if field.Kind() != reflect.Slice {
+			continue
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for j := 0; j < field.Len(); j++ {
+			if err := enc.Encode(field.Index(j).Interface()); err != nil {
+				return Manifest{}, err
+			}
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		manifest.Sections = append(manifest.Sections, Section{
+			Name:    name,
+			Records: field.Len(),
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+		if err := writeFile(tw, name+sectionSuffix, buf.Bytes(), createdAt); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := writeFile(tw, manifestName, data, createdAt); err != nil {
+		return Manifest{}, err
+	}
+	if err := tw.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, gz.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Read reads the archive verifying its version and checksums.
+func Read(r io.Reader) (storage.Snapshot, Manifest, error) {
+	var (
+		snap     storage.Snapshot
+		manifest *Manifest
+		read     = make(map[string]Section)
+	)
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return snap, Manifest{}, fmt.Errorf("%w: %v", ErrInvalid, err) //nolint:errorlint
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return snap, Manifest{}, fmt.Errorf("%w: %v", ErrInvalid, err) //nolint:errorlint
+		}
+
+		switch {
+		case manifest != nil:
+			return snap, Manifest{}, fmt.Errorf("%w: %s after the manifest", ErrInvalid, hdr.Name)
+		case hdr.Name == manifestName:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(io.LimitReader(tr, maxManifestSize)).Decode(manifest); err != nil {
+				return snap, Manifest{}, fmt.Errorf("%w: manifest: %v", ErrInvalid, err) //nolint:errorlint
+			}
+		case strings.HasSuffix(hdr.Name, sectionSuffix):
+			section, err := readSection(&snap, strings.TrimSuffix(hdr.Name, sectionSuffix), tr)
+			if err != nil {
+				return snap, Manifest{}, err
+			}
+			read[section.Name] = section
+		default:
+			return snap, Manifest{}, fmt.Errorf("%w: unexpected file %s", ErrInvalid, hdr.Name)
+		}
+	}
+
+	if manifest == nil {
+		return snap, Manifest{}, fmt.Errorf("%w: no manifest", ErrInvalid)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return snap, Manifest{}, fmt.Errorf("%w: unsupported version %d", ErrInvalid, manifest.Version)
+	}
+	if len(manifest.Sections) != len(read) {
+		return snap, Manifest{}, fmt.Errorf("%w: %d sections in the manifest, %d in the archive",
+			ErrInvalid, len(manifest.Sections), len(read))
+	}
+	for _, want := range manifest.Sections {
+		if got, ok := read[want.Name]; !ok || got != want {
+			return snap, Manifest{}, fmt.Errorf("%w: section %s doesn't match the manifest", ErrInvalid, want.Name)
+		}
+	}
+	return snap, *manifest, nil
+}
+
+// readSection decodes the records into the snapshot field of the same name.
+func readSection(snap *storage.Snapshot, name string, r io.Reader) (Section, error) {
+	field := reflect.ValueOf(snap).Elem().FieldByName(name)
+	if !field.IsValid() || field.Kind() != reflect.Slice {
+		return Section{}, fmt.Errorf("%w: unknown section %s", ErrInvalid, name)
+	}
+
+	hash := sha256.New()
+	dec := json.NewDecoder(io.TeeReader(r, hash))
+	records := reflect.MakeSlice(field.Type(), 0, 0)
+	for {
+		record := reflect.New(field.Type().Elem())
+		err := dec.Decode(record.Interface())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Section{}, fmt.Errorf("%w: section %s: %v", ErrInvalid, name, err) //nolint:errorlint
+		}
+		records = reflect.Append(records, record.Elem())
+	}
+	// The decoder may stop before the trailing newline.
+	if _, err := io.Copy(hash, r); err != nil {
+		return Section{}, err
+	}
+	field.Set(records)
+	return Section{Name: name, Records: records.Len(), SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
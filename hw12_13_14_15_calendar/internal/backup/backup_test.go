@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func snapshot(t *testing.T) storage.Snapshot {
+	t.Helper()
+
+	ctx := context.Background()
+	s := memorystorage.New()
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "alice", Name: "Work"}))
+	require.NoError(t, s.CreateEvent(ctx, "alice", storage.Event{
+		ID:         "1",
+		CalendarID: "work",
+		OwnerID:    "alice",
+		Title:      "standup",
+		StartAt:    now,
+		EndAt:      now.Add(15 * time.Minute),
+		Reminders:  []storage.Reminder{{ID: "r1", Before: time.Minute, Channel: storage.ChannelEmail}},
+		Tags:       []string{"work"},
+	}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "alice", Name: "work", Color: "#ff0000"}))
+	snap, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	return snap
+}
+
+func TestRoundTrip(t *testing.T) {
+	snap := snapshot(t)
+
+	var buf bytes.Buffer
+	written, err := Write(&buf, snap, now)
+	require.NoError(t, err)
+	require.Equal(t, Version, written.Version)
+
+	got, manifest, err := Read(&buf)
+	require.NoError(t, err)
+	require.Equal(t, snap, got)
+	require.Equal(t, written, manifest)
+	for _, s := range manifest.Sections {
+		if s.Name == "Events" {
+			require.Equal(t, 1, s.Records)
+		}
+	}
+}
+
+// rewrite copies the archive changing its files with change.
+func rewrite(t *testing.T, archive []byte, change func(name string, data []byte) []byte) []byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		data = change(hdr.Name, data)
+		hdr.Size = int64(len(data))
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return out.Bytes()
+}
+
+func TestReadInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Write(&buf, snapshot(t), now)
+	require.NoError(t, err)
+	archive := buf.Bytes()
+
+	for name, data := range map[string][]byte{
+		"not gzip": []byte("plain text"),
+		"changed event": rewrite(t, archive, func(name string, data []byte) []byte {
+			if name == "Events.jsonl" {
+				return bytes.Replace(data, []byte("standup"), []byte("retro"), 1)
+			}
+			return data
+		}),
+		"newer version": rewrite(t, archive, func(name string, data []byte) []byte {
+			if name == manifestName {
+				return bytes.Replace(data, []byte(`"Version": 1`), []byte(`"Version": 2`), 1)
+			}
+			return data
+		}),
+		"no manifest": rewrite(t, archive, func(name string, data []byte) []byte {
+			if name == manifestName {
+				return []byte("{}")
+			}
+			return data
+		}),
+		"truncated": archive[:len(archive)/2],
+	} {
+		_, _, err := Read(bytes.NewReader(data))
+		require.True(t, errors.Is(err, ErrInvalid), "%s: %v", name, err)
+	}
+}
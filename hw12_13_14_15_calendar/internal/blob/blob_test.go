@@ -0,0 +1,130 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	data := "agenda: ничего особенного"
+	require.NoError(t, s.Put(ctx, "event 1/a+b", strings.NewReader(data), int64(len(data)), "text/plain"))
+
+	r, err := s.Get(ctx, "event 1/a+b")
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, data, string(got))
+
+	require.NoError(t, s.Delete(ctx, "event 1/a+b"))
+	require.NoError(t, s.Delete(ctx, "event 1/a+b"))
+	_, err = s.Get(ctx, "event 1/a+b")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	for _, key := range []string{"", "/etc/passwd", "../x", "a/../../x", "a//b", "a/"} {
+		require.True(t, errors.Is(s.Put(ctx, key, strings.NewReader(""), 0, ""), ErrInvalidKey), key)
+	}
+}
+
+func TestFS(t *testing.T) {
+	testStore(t, NewFS(t.TempDir()))
+}
+
+// s3Now is the clock of the S3 client in the tests, the fake bucket accepts only the signatures
+// of its requests at that time.
+var s3Now = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeS3 is a local stand-in for an S3 bucket which checks request signatures.
+type fakeS3 struct {
+	mu         sync.Mutex
+	objects    map[string]string
+	signatures map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	want := "AWS4-HMAC-SHA256 Credential=key/20210301/eu-west-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + f.signatures[r.Method+" "+r.URL.EscapedPath()]
+	if r.Header.Get("X-Amz-Date") != s3Now.Format(amzDateLayout) || r.Header.Get("Authorization") != want {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = string(data)
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string]string), signatures: map[string]string{
+		"PUT /bucket/event%201/a%2Bb":    "d6f254169ac3e6970d409428c3406df7719d6205fe3e58272079b81783a18f95",
+		"GET /bucket/event%201/a%2Bb":    "55ad276e046502c468fbfd112415f0605324303d28b94ecc72d5c815b63e9751",
+		"DELETE /bucket/event%201/a%2Bb": "1d59a546150391f19e59ff7603a62b906d8ec65e6753248d7a36c199aed7b399",
+		"PUT /bucket/x":                  "3fc8ed5d55431542938b1d3ebfea4e5cae80bee6fc1076b2ffa5be5079892ad9",
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// The bucket is addressed by a fixed host, so that the signatures do not depend on the port.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+	s := NewS3(S3Config{
+		Endpoint:  "http://s3.test/",
+		Region:    "eu-west-1",
+		Bucket:    "bucket",
+		AccessKey: "key",
+		SecretKey: "secret",
+	}, client)
+	s.now = func() time.Time { return s3Now }
+	testStore(t, s)
+	require.NoError(t, s.Put(context.Background(), "x", strings.NewReader("x"), 1, ""))
+
+	s.conf.SecretKey = "wrong"
+	err := s.Put(context.Background(), "x", strings.NewReader("x"), 1, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SignatureDoesNotMatch")
+}
+
+// TestSignature checks the signer against the get-vanilla case of the AWS Signature Version 4 test suite.
+func TestSignature(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateLayout))
+	emptyPayload := sha256.Sum256(nil)
+
+	signedHeaders, sig := signature(req, hex.EncodeToString(emptyPayload[:]),
+		"wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+	require.Equal(t, "host;x-amz-date", signedHeaders)
+	require.Equal(t, "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", sig)
+}
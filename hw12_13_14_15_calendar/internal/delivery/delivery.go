@@ -0,0 +1,113 @@
+// Package delivery carries notifications from the storage outbox to senders and the outcomes
+// of their deliveries back. A Relay publishes the outbox messages to a Sender, the sender publishes
+// the status of every attempt to a Queue, a Recorder consumes them.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var ErrInvalidStatus = errors.New("invalid delivery status")
+
+// Queue passes delivery statuses in the order they are published.
+type Queue interface {
+	Publish(ctx context.Context, d storage.Delivery) error
+	Consume(ctx context.Context) (<-chan storage.Delivery, error)
+}
+
+type Storage interface {
+	MarkDelivered(ctx context.Context, d storage.Delivery) error
+}
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+// ChanQueue is an in-process Queue with a bounded buffer, Publish blocks while it is full.
+type ChanQueue struct {
+	ch chan storage.Delivery
+}
+
+func NewChanQueue(size int) *ChanQueue {
+	return &ChanQueue{ch: make(chan storage.Delivery, size)}
+}
+
+func (q *ChanQueue) Publish(ctx context.Context, d storage.Delivery) error {
+	select {
+	case q.ch <- d:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume returns the channel of statuses, it is never closed.
+func (q *ChanQueue) Consume(ctx context.Context) (<-chan storage.Delivery, error) {
+	return q.ch, nil
+}
+
+// Recorder writes delivery statuses to the storage.
+type Recorder struct {
+	storage Storage
+	logger  Logger
+}
+
+func NewRecorder(storage Storage, logger Logger) *Recorder {
+	return &Recorder{storage: storage, logger: logger}
+}
+
+// Run records statuses until ctx is done, then records the ones already buffered.
+// Statuses of deleted events and reminders are dropped.
+func (r *Recorder) Run(ctx context.Context, queue Queue) error {
+	statuses, err := queue.Consume(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case d := <-statuses:
+			r.Record(ctx, d)
+		case <-ctx.Done():
+			for {
+				select {
+				case d := <-statuses:
+					r.Record(context.Background(), d)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// Record writes the status in the tenant of the delivery, failures are logged as the sender
+// can't do anything about them.
+func (r *Recorder) Record(ctx context.Context, d storage.Delivery) {
+	err := validate(d)
+	if err == nil {
+		err = r.storage.MarkDelivered(storage.WithTenantID(ctx, d.TenantID), d)
+	}
+	switch {
+	case errors.Is(err, storage.ErrEventNotFound), errors.Is(err, storage.ErrReminderNotFound):
+		r.logger.Info(fmt.Sprintf("delivery status of %s/%s dropped: %v", d.EventID, d.ReminderID, err))
+	case err != nil:
+		r.logger.Error(fmt.Sprintf("failed to record delivery status of %s/%s: %v", d.EventID, d.ReminderID, err))
+	}
+}
+
+func validate(d storage.Delivery) error {
+	switch {
+	case d.EventID == "" || d.ReminderID == "":
+		return fmt.Errorf("%w: no event or reminder", ErrInvalidStatus)
+	case !d.State().Valid():
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, d.Status)
+	case d.State() != storage.DeliverySent && d.Error == "":
+		return fmt.Errorf("%w: %s without an error", ErrInvalidStatus, d.Status)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/notify"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (l *testLogger) Info(string) {}
+
+func (l *testLogger) Error(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "alice"}))
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.CreateEvent(ctx, "alice", storage.Event{
+		ID: "1", CalendarID: "work", OwnerID: "alice", Title: "standup", StartAt: start, EndAt: start.Add(time.Hour),
+		Reminders: []storage.Reminder{{ID: "r1", Before: time.Hour, Channel: storage.ChannelEmail}},
+	}))
+
+	queue := NewChanQueue(10)
+	logger := &testLogger{}
+	failed := storage.Delivery{
+		EventID: "1", ReminderID: "r1", Channel: storage.ChannelEmail, NotifyAt: start.Add(-time.Hour),
+		SentAt: start.Add(-time.Hour), Status: storage.DeliveryFailed, Attempts: 1, Error: "timeout",
+	}
+	sent := failed
+	sent.SentAt = sent.SentAt.Add(time.Minute)
+	sent.Status, sent.Attempts, sent.Error = storage.DeliverySent, 2, ""
+	for _, d := range []storage.Delivery{
+		failed,
+		{EventID: "1", ReminderID: "r1", Status: "lost"},
+		{EventID: "2", ReminderID: "r1", Status: storage.DeliverySent},
+		sent,
+	} {
+		require.NoError(t, queue.Publish(ctx, d))
+	}
+
+	// Statuses buffered before the stop are still recorded.
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+	require.NoError(t, NewRecorder(s, logger).Run(stopped, queue))
+
+	deliveries, err := s.ListDeliveries(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Delivery{sent}, deliveries)
+	require.Len(t, logger.errors, 1)
+	require.Contains(t, logger.errors[0], "lost")
+
+	full := NewChanQueue(0)
+	require.True(t, errors.Is(full.Publish(stopped, sent), context.Canceled))
+}
+
+type failingSink struct{}
+
+func (failingSink) Send(context.Context, storage.Notification, notify.Message) error {
+	return errors.New("connection refused")
+}
+
+// messageSink keeps the messages it sends.
+type messageSink struct {
+	messages []notify.Message
+}
+
+func (s *messageSink) Send(_ context.Context, _ storage.Notification, msg notify.Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestSenderPreferences(t *testing.T) {
+	ctx := storage.WithTenantID(context.Background(), "acme")
+	s := memorystorage.New()
+	require.NoError(t, s.SetPreferences(ctx, storage.Preferences{UserID: "bob", Locale: "ru", TimeZone: "Europe/Moscow"}))
+
+	renderer, err := notify.NewRenderer("", "")
+	require.NoError(t, err)
+	sink := &messageSink{}
+	sender := NewSender(renderer, s, NewChanQueue(10), 1, map[storage.Channel]Sink{storage.ChannelEmail: sink})
+
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	n := storage.Notification{
+		TenantID: "acme", EventID: "1", ReminderID: "r", Channel: storage.ChannelEmail,
+		NotifyAt: start.Add(-time.Hour), Title: "standup", StartAt: start, UserID: "bob",
+	}
+	require.NoError(t, sender.Send(context.Background(), n))
+	// Users without preferences get the default locale and UTC.
+	n.UserID = "alice"
+	require.NoError(t, sender.Send(context.Background(), n))
+
+	require.Len(t, sink.messages, 2)
+	require.Equal(t, "Напоминание: standup через 1 час", sink.messages[0].Subject)
+	require.Contains(t, sink.messages[0].Text, "понедельник, 1 марта 2021, 13:00 MSK")
+	require.Equal(t, "Reminder: standup in 1 hour", sink.messages[1].Subject)
+	require.Contains(t, sink.messages[1].Text, "Monday, March 1, 2021, 10:00 AM UTC")
+}
+
+func TestSender(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "alice"}))
+	start := time.Now().Add(time.Hour)
+	require.NoError(t, s.CreateEvent(ctx, "alice", storage.Event{
+		ID: "1", CalendarID: "work", OwnerID: "alice", Title: "standup", StartAt: start, EndAt: start.Add(time.Hour),
+		Reminders: []storage.Reminder{
+			{ID: "log", Before: 2 * time.Hour, Channel: storage.ChannelLog},
+			{ID: "email", Before: 2 * time.Hour, Channel: storage.ChannelEmail},
+			{ID: "webhook", Before: 2 * time.Hour, Channel: storage.ChannelWebhook},
+		},
+	}))
+
+	renderer, err := notify.NewRenderer("", "")
+	require.NoError(t, err)
+	messages := NewOutboxChanQueue(10)
+	relay := NewRelay(s, messages)
+	queue := NewChanQueue(10)
+	logger := &testLogger{}
+	sender := NewSender(renderer, s, queue, 2, map[storage.Channel]Sink{
+		storage.ChannelLog:     NewLogSink(logger),
+		storage.ChannelWebhook: failingSink{},
+	})
+	recorder := NewRecorder(s, logger)
+	published, _ := messages.Consume(ctx)
+	relayRun := func() int {
+		require.NoError(t, relay.Run(ctx))
+		return len(published)
+	}
+	send := func() map[string]storage.Delivery {
+		for len(published) > 0 {
+			m := <-published
+			require.NoError(t, sender.Send(ctx, m.Notification))
+		}
+		stopped, cancel := context.WithCancel(ctx)
+		cancel()
+		require.NoError(t, recorder.Run(stopped, queue))
+
+		deliveries, err := s.ListDeliveries(ctx, "alice")
+		require.NoError(t, err)
+		byReminder := make(map[string]storage.Delivery, len(deliveries))
+		for _, d := range deliveries {
+			byReminder[d.ReminderID] = d
+		}
+		return byReminder
+	}
+
+	// Messages are published once while they wait to be sent.
+	require.Equal(t, 3, relayRun())
+	require.Equal(t, 3, relayRun())
+	deliveries := send()
+	require.Equal(t, storage.DeliverySent, deliveries["log"].Status)
+	require.Equal(t, storage.DeliveryDead, deliveries["email"].Status)
+	require.Contains(t, deliveries["email"].Error, ErrNoSink.Error())
+	require.Equal(t, storage.DeliveryFailed, deliveries["webhook"].Status)
+	require.Equal(t, 1, deliveries["webhook"].Attempts)
+
+	// Only the failed notification is sent again, until it runs out of attempts.
+	require.Equal(t, 1, relayRun())
+	deliveries = send()
+	require.Equal(t, 1, deliveries["log"].Attempts)
+	require.Equal(t, storage.DeliveryDead, deliveries["webhook"].Status)
+	require.Equal(t, 2, deliveries["webhook"].Attempts)
+	require.Zero(t, relayRun())
+	outbox, err := s.ListOutbox(ctx)
+	require.NoError(t, err)
+	require.Empty(t, outbox)
+	require.Empty(t, logger.errors)
+
+	// A relay started anew publishes the messages which may not have been sent.
+	require.NoError(t, s.UpdateEvent(ctx, "alice", storage.Event{
+		ID: "1", CalendarID: "work", OwnerID: "alice", Title: "standup", StartAt: start, EndAt: start.Add(time.Hour),
+		Reminders: []storage.Reminder{{ID: "log", Before: 3 * time.Hour, Channel: storage.ChannelLog}},
+	}))
+	require.Equal(t, 1, relayRun())
+	<-published
+	require.NoError(t, NewRelay(s, messages).Run(ctx))
+	require.Len(t, published, 1)
+}
@@ -0,0 +1,94 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const SendJob = "notification delivery"
+
+type Outbox interface {
+	EnqueueNotifications(ctx context.Context, now time.Time) (int, error)
+	ListOutbox(ctx context.Context) ([]storage.OutboxMessage, error)
+}
+
+// OutboxQueue passes outbox messages from the relay to the sender.
+type OutboxQueue interface {
+	Publish(ctx context.Context, m storage.OutboxMessage) error
+	Consume(ctx context.Context) (<-chan storage.OutboxMessage, error)
+}
+
+// OutboxChanQueue is an in-process OutboxQueue with a bounded buffer, Publish blocks while it is full.
+type OutboxChanQueue struct {
+	ch chan storage.OutboxMessage
+}
+
+func NewOutboxChanQueue(size int) *OutboxChanQueue {
+	return &OutboxChanQueue{ch: make(chan storage.OutboxMessage, size)}
+}
+
+func (q *OutboxChanQueue) Publish(ctx context.Context, m storage.OutboxMessage) error {
+	select {
+	case q.ch <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume returns the channel of messages, it is never closed.
+func (q *OutboxChanQueue) Consume(ctx context.Context) (<-chan storage.OutboxMessage, error) {
+	return q.ch, nil
+}
+
+// Relay moves the due notifications to the outbox and publishes the outbox messages to the queue.
+// A message stays in the outbox until the status of its delivery is recorded. The relay publishes
+// it once, so a message is sent again only after a restart, when it may have been sent already.
+type Relay struct {
+	outbox Outbox
+	queue  OutboxQueue
+
+	mu        sync.Mutex
+	published map[string]bool // message ID -> published
+}
+
+func NewRelay(outbox Outbox, queue OutboxQueue) *Relay {
+	return &Relay{outbox: outbox, queue: queue, published: make(map[string]bool)}
+}
+
+// Job returns the job which relays the due notifications every interval.
+func (r *Relay) Job(interval time.Duration) scheduler.Job {
+	return scheduler.Job{Name: SendJob, Interval: interval, Run: r.Run}
+}
+
+// Run queues the notifications due now and publishes the messages not published yet.
+func (r *Relay) Run(ctx context.Context) error {
+	if _, err := r.outbox.EnqueueNotifications(ctx, time.Now().UTC()); err != nil {
+		return err
+	}
+	messages, err := r.outbox.ListOutbox(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	published := make(map[string]bool, len(messages))
+	for _, m := range messages {
+		switch {
+		case r.published[m.ID]:
+			published[m.ID] = true
+		case err == nil:
+			if err = r.queue.Publish(ctx, m); err == nil {
+				published[m.ID] = true
+			}
+		}
+	}
+	r.published = published
+	return err
+}
@@ -0,0 +1,154 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/notify"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// ErrNoSink is the error of notifications of channels nothing sends, they are given up at once.
+var ErrNoSink = errors.New("channel is not configured")
+
+// Sink sends the messages of one channel.
+type Sink interface {
+	Send(ctx context.Context, n storage.Notification, msg notify.Message) error
+}
+
+type Renderer interface {
+	Render(n storage.Notification, lang string, loc *time.Location) (notify.Message, error)
+}
+
+// Preferences are the settings of the users notifications are rendered for.
+type Preferences interface {
+	GetPreferences(ctx context.Context, userID string) (storage.Preferences, error)
+}
+
+// Sender sends the notifications of the outbox messages through the sinks of their channels and
+// publishes the outcome of every attempt to the queue.
+type Sender struct {
+	renderer    Renderer
+	preferences Preferences
+	queue       Queue
+	sinks       map[storage.Channel]Sink
+
+	mu          sync.RWMutex
+	maxAttempts int
+}
+
+func NewSender(renderer Renderer, preferences Preferences, queue Queue, maxAttempts int,
+	sinks map[storage.Channel]Sink) *Sender {
+	s := &Sender{renderer: renderer, preferences: preferences, queue: queue, sinks: sinks}
+	s.SetMaxAttempts(maxAttempts)
+	return s
+}
+
+// SetMaxAttempts changes the number of attempts after which a notification is dead, at least one.
+func (s *Sender) SetMaxAttempts(maxAttempts int) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxAttempts = maxAttempts
+}
+
+// Run sends the notifications of the messages until ctx is done. Messages left in the queue
+// stay in the outbox and are sent after a restart.
+func (s *Sender) Run(ctx context.Context, messages OutboxQueue) error {
+	ch, err := messages.Consume(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case m := <-ch:
+			if err := s.Send(ctx, m.Notification); err != nil && ctx.Err() == nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Send sends the notification and publishes the status of the attempt.
+func (s *Sender) Send(ctx context.Context, n storage.Notification) error {
+	s.mu.RLock()
+	maxAttempts := s.maxAttempts
+	s.mu.RUnlock()
+
+	d := storage.Delivery{
+		TenantID:   n.TenantID,
+		EventID:    n.EventID,
+		ReminderID: n.ReminderID,
+		Channel:    n.Channel,
+		NotifyAt:   n.NotifyAt,
+		SentAt:     time.Now().UTC(),
+		Status:     storage.DeliverySent,
+		Attempts:   n.Attempts + 1,
+	}
+	if err := s.send(ctx, n); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		d.Status, d.Error = storage.DeliveryFailed, err.Error()
+		if d.Attempts >= maxAttempts || errors.Is(err, ErrNoSink) {
+			d.Status = storage.DeliveryDead
+		}
+	}
+	return s.queue.Publish(ctx, d)
+}
+
+func (s *Sender) send(ctx context.Context, n storage.Notification) error {
+	sink, ok := s.sinks[n.Channel]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoSink, n.Channel)
+	}
+	lang, loc, err := s.settings(ctx, n)
+	if err != nil {
+		return err
+	}
+	msg, err := s.renderer.Render(n, lang, loc)
+	if err != nil {
+		return err
+	}
+	return sink.Send(ctx, n, msg)
+}
+
+// settings returns the locale and the time zone of the notification's user, the defaults
+// if the user has no preferences.
+func (s *Sender) settings(ctx context.Context, n storage.Notification) (string, *time.Location, error) {
+	p, err := s.preferences.GetPreferences(storage.WithTenantID(ctx, n.TenantID), n.UserID)
+	switch {
+	case errors.Is(err, storage.ErrPreferencesNotFound):
+		return "", nil, nil
+	case err != nil:
+		return "", nil, err
+	}
+	loc, err := p.Location()
+	if err != nil {
+		loc = nil
+	}
+	return p.Locale, loc, nil
+}
+
+// LogSink writes the text of messages to the log, it serves the log channel.
+type LogSink struct {
+	logger Logger
+}
+
+func NewLogSink(logger Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (s *LogSink) Send(_ context.Context, _ storage.Notification, msg notify.Message) error {
+	s.logger.Info(strings.TrimSpace(msg.Text))
+	return nil
+}
@@ -0,0 +1,269 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// property is a content line: NAME;PARAM=value:value.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode reads the events of a VCALENDAR object. Times with unknown TZID
+// and floating times are taken as UTC, all-day events last whole UTC days.
+func Decode(r io.Reader) ([]storage.Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events  []storage.Event
+		stack   []string
+		event   []property
+		alarm   []property
+		alarms  [][]property
+		started bool
+	)
+	for _, line := range lines {
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.value))
+			started = true
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("%w: unexpected END:%s", ErrInvalid, p.value)
+			}
+			switch strings.Join(stack, "/") {
+			case "VCALENDAR/VEVENT":
+				e, err := decodeEvent(event, alarms)
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, e)
+				event, alarms = nil, nil
+			case "VCALENDAR/VEVENT/VALARM":
+				alarms = append(alarms, alarm)
+				alarm = nil
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		switch strings.Join(stack, "/") {
+		case "VCALENDAR/VEVENT":
+			event = append(event, p)
+		case "VCALENDAR/VEVENT/VALARM":
+			alarm = append(alarm, p)
+		}
+	}
+	if !started || len(stack) != 0 {
+		return nil, fmt.Errorf("%w: incomplete calendar", ErrInvalid)
+	}
+	return events, nil
+}
+
+// unfold joins folded lines, a line starting with a space or a tab continues the previous one.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+		case (line[0] == ' ' || line[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func parseLine(line string) (property, error) {
+	p := property{params: make(map[string]string)}
+	quoted := false
+	start := 0
+	var parts []string
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == ';':
+			parts = append(parts, line[start:i])
+			start = i + 1
+		case r == ':':
+			parts = append(parts, line[start:i])
+			p.value = line[i+1:]
+			p.name = strings.ToUpper(parts[0])
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(param, "=", 2)
+				if len(kv) == 2 {
+					p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+				}
+			}
+			if p.name == "" {
+				return p, fmt.Errorf("%w: line %q", ErrInvalid, line)
+			}
+			return p, nil
+		}
+	}
+	return p, fmt.Errorf("%w: line %q", ErrInvalid, line)
+}
+
+func decodeEvent(props []property, alarms [][]property) (storage.Event, error) {
+	var (
+		e        storage.Event
+		duration *time.Duration
+		allDay   bool
+		err      error
+	)
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			e.UID = unescape(p.value)
+		case "SUMMARY":
+			e.Title = unescape(p.value)
+		case "DESCRIPTION":
+			e.Description = unescape(p.value)
+		case "CATEGORIES":
+			// The property may be repeated, each with a list of categories.
+			for _, tag := range splitList(p.value) {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					e.Tags = append(e.Tags, tag)
+				}
+			}
+		case "DTSTART":
+			allDay = p.params["VALUE"] == "DATE"
+			if e.StartAt, err = parseTime(p); err != nil {
+				return e, err
+			}
+		case "DTEND":
+			if e.EndAt, err = parseTime(p); err != nil {
+				return e, err
+			}
+		case "DURATION":
+			d, err := parseDuration(p.value)
+			if err != nil {
+				return e, err
+			}
+			duration = &d
+		}
+	}
+	if e.StartAt.IsZero() {
+		return e, fmt.Errorf("%w: event %q has no DTSTART", ErrInvalid, e.UID)
+	}
+	// With neither DTEND nor DURATION an event lasts a day if it starts at a date
+	// and takes no time otherwise, as RFC 5545 says.
+	switch {
+	case !e.EndAt.IsZero():
+	case duration != nil:
+		e.EndAt = e.StartAt.Add(*duration)
+	case allDay:
+		e.EndAt = e.StartAt.AddDate(0, 0, 1)
+	default:
+		e.EndAt = e.StartAt
+	}
+
+	for _, alarm := range alarms {
+		r, ok, err := decodeAlarm(alarm, e.StartAt)
+		if err != nil {
+			return e, err
+		}
+		if ok {
+			e.Reminders = append(e.Reminders, r)
+		}
+	}
+	return e, nil
+}
+
+// decodeAlarm returns the reminder of the alarm, alarms after the event start are skipped.
+func decodeAlarm(props []property, start time.Time) (storage.Reminder, bool, error) {
+	var r storage.Reminder
+	hasTrigger := false
+	for _, p := range props {
+		switch p.name {
+		case "UID":
+			r.ID = unescape(p.value)
+		case "ACTION":
+			if r.Channel == "" && strings.EqualFold(p.value, "EMAIL") {
+				r.Channel = storage.ChannelEmail
+			}
+		case channelProperty:
+			r.Channel = storage.Channel(strings.ToLower(p.value))
+		case "TRIGGER":
+			if p.params["RELATED"] == "END" {
+				return r, false, nil
+			}
+			hasTrigger = true
+			if p.params["VALUE"] == "DATE-TIME" {
+				at, err := parseTime(p)
+				if err != nil {
+					return r, false, err
+				}
+				r.Before = start.Sub(at)
+				continue
+			}
+			d, err := parseDuration(p.value)
+			if err != nil {
+				return r, false, err
+			}
+			r.Before = -d
+		}
+	}
+	if !hasTrigger || r.Before < 0 {
+		return r, false, nil
+	}
+	if r.Channel == "" {
+		r.Channel = storage.ChannelLog
+	}
+	return r, true, nil
+}
+
+func parseTime(p property) (time.Time, error) {
+	value := p.value
+	if p.params["VALUE"] == "DATE" {
+		t, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return t, fmt.Errorf("%w: date %q", ErrInvalid, value)
+		}
+		return t, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeLayout, value)
+		if err != nil {
+			return t, fmt.Errorf("%w: time %q", ErrInvalid, value)
+		}
+		return t, nil
+	}
+
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(localLayout, value, loc)
+	if err != nil {
+		return t, fmt.Errorf("%w: time %q", ErrInvalid, value)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,245 @@
+// Package ical encodes events to iCalendar (RFC 5545) and decodes them back.
+// Only VEVENT with VALARM components are supported, recurrence rules are ignored.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	prodID         = "-//fixme_my_friend//calendar//EN"
+	dateTimeLayout = "20060102T150405Z"
+	localLayout    = "20060102T150405"
+	dateLayout     = "20060102"
+	maxLineLength  = 75
+
+	// channelProperty keeps the reminder channel in VALARM.
+	channelProperty = "X-CALENDAR-CHANNEL"
+)
+
+var ErrInvalid = errors.New("invalid iCalendar")
+
+// now is the DTSTAMP of encoded events.
+var now = time.Now
+
+// Encode writes the events as a single VCALENDAR object.
+func Encode(w io.Writer, events []storage.Event) error {
+	enc := &encoder{w: bufio.NewWriter(w)}
+	enc.line("BEGIN", "VCALENDAR")
+	enc.line("VERSION", "2.0")
+	enc.line("PRODID", prodID)
+	stamp := now().UTC().Format(dateTimeLayout)
+	for _, e := range events {
+		enc.event(e, stamp)
+	}
+	enc.line("END", "VCALENDAR")
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (enc *encoder) event(e storage.Event, stamp string) {
+	enc.line("BEGIN", "VEVENT")
+	enc.line("UID", escape(e.ICalUID()))
+	enc.line("DTSTAMP", stamp)
+	enc.line("DTSTART", e.StartAt.UTC().Format(dateTimeLayout))
+	enc.line("DTEND", e.EndAt.UTC().Format(dateTimeLayout))
+	if e.Title != "" {
+		enc.line("SUMMARY", escape(e.Title))
+	}
+	if e.Description != "" {
+		enc.line("DESCRIPTION", escape(e.Description))
+	}
+	if len(e.Tags) > 0 {
+		tags := make([]string, 0, len(e.Tags))
+		for _, tag := range e.Tags {
+			tags = append(tags, escape(tag))
+		}
+		enc.line("CATEGORIES", strings.Join(tags, ","))
+	}
+	for _, r := range e.Reminders {
+		enc.line("BEGIN", "VALARM")
+		enc.line("UID", escape(r.ID))
+		if r.Channel == storage.ChannelEmail {
+			enc.line("ACTION", "EMAIL")
+			enc.line("SUMMARY", escape(e.Title))
+		} else {
+			enc.line("ACTION", "DISPLAY")
+		}
+		enc.line("DESCRIPTION", escape(e.Title))
+		enc.line("TRIGGER", formatDuration(-r.Before))
+		enc.line(channelProperty, string(r.Channel))
+		enc.line("END", "VALARM")
+	}
+	enc.line("END", "VEVENT")
+}
+
+// line writes the content line folded to 75 octets without splitting UTF-8 characters.
+func (enc *encoder) line(name, value string) {
+	if enc.err != nil {
+		return
+	}
+	line := name + ":" + value
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > maxLineLength {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	_, enc.err = enc.w.WriteString(b.String())
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitList splits a multi-valued property on commas which are not escaped.
+func splitList(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, unescape(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, unescape(s[start:]))
+}
+
+// formatDuration formats the duration as RFC 5545 dur-value, e.g. "-PT15M".
+func formatDuration(d time.Duration) string {
+	var b strings.Builder
+	if d < 0 {
+		b.WriteByte('-')
+		d = -d
+	}
+	b.WriteByte('P')
+	if days := d / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+		d -= days * 24 * time.Hour
+	}
+	if d == 0 && b.Len() > 2 {
+		return b.String()
+	}
+	b.WriteByte('T')
+	if h := d / time.Hour; h > 0 {
+		fmt.Fprintf(&b, "%dH", h)
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		fmt.Fprintf(&b, "%dM", m)
+		d -= m * time.Minute
+	}
+	if s := d / time.Second; s > 0 || b.String()[b.Len()-1] == 'T' {
+		fmt.Fprintf(&b, "%dS", s)
+	}
+	return b.String()
+}
+
+// parseDuration parses RFC 5545 dur-value, e.g. "-PT15M" or "P1W".
+func parseDuration(s string) (time.Duration, error) {
+	orig := s
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("%w: duration %q", ErrInvalid, orig)
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	n := -1
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			if n < 0 {
+				n = 0
+			}
+			n = n*10 + int(r-'0')
+			continue
+		case r == 'T' && !inTime && n < 0:
+			inTime = true
+			continue
+		case n < 0:
+			return 0, fmt.Errorf("%w: duration %q", ErrInvalid, orig)
+		}
+
+		unit := durationUnit(r, inTime)
+		if unit == 0 {
+			return 0, fmt.Errorf("%w: duration %q", ErrInvalid, orig)
+		}
+		d += time.Duration(n) * unit
+		n = -1
+	}
+	if n >= 0 {
+		return 0, fmt.Errorf("%w: duration %q", ErrInvalid, orig)
+	}
+	return sign * d, nil
+}
+
+func durationUnit(r rune, inTime bool) time.Duration {
+	switch {
+	case !inTime && r == 'W':
+		return 7 * 24 * time.Hour
+	case !inTime && r == 'D':
+		return 24 * time.Hour
+	case inTime && r == 'H':
+		return time.Hour
+	case inTime && r == 'M':
+		return time.Minute
+	case inTime && r == 'S':
+		return time.Second
+	default:
+		return 0
+	}
+}
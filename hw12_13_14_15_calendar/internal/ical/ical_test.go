@@ -0,0 +1,143 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	events := []storage.Event{
+		{
+			UID:         "1",
+			Title:       "standup; daily, short",
+			StartAt:     start,
+			EndAt:       start.Add(15 * time.Minute),
+			Description: strings.Repeat("очень длинное описание\n", 10),
+			Reminders: []storage.Reminder{
+				{ID: "r1", Before: 15 * time.Minute, Channel: storage.ChannelEmail},
+				{ID: "r2", Before: 24 * time.Hour, Channel: storage.ChannelWebhook},
+				{ID: "r3", Before: 0, Channel: storage.ChannelLog},
+			},
+			Tags: []string{"work", "a, b", `back\slash`},
+		},
+		{UID: "2", StartAt: start, EndAt: start.Add(time.Hour)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, events))
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		require.LessOrEqual(t, len(line), maxLineLength)
+	}
+
+	decoded, err := Decode(&buf)
+	require.NoError(t, err)
+	require.Equal(t, events, decoded)
+}
+
+func TestDecode(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Moscow",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:moscow",
+		`DTSTART;TZID="Europe/Moscow":20210301T100000`,
+		"DURATION:PT1H30M",
+		"SUMMARY:meet",
+		" ing",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"TRIGGER:-P1DT2H",
+		"END:VALARM",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"TRIGGER;RELATED=END:PT0S",
+		"END:VALARM",
+		"BEGIN:VALARM",
+		"ACTION:EMAIL",
+		"TRIGGER;VALUE=DATE-TIME:20210301T063000Z",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday",
+		"DTSTART;VALUE=DATE:20210308",
+		"CATEGORIES:Holiday,Family",
+		"CATEGORIES:Spring",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:reminder",
+		"DTSTART:20210309T090000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\n")
+
+	events, err := Decode(strings.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	e := events[0]
+	require.Equal(t, "moscow", e.UID)
+	require.Equal(t, "meeting", e.Title)
+	require.Equal(t, time.Date(2021, 3, 1, 7, 0, 0, 0, time.UTC), e.StartAt)
+	require.Equal(t, e.StartAt.Add(90*time.Minute), e.EndAt)
+	require.Equal(t, []storage.Reminder{
+		{Before: 26 * time.Hour, Channel: storage.ChannelLog},
+		{Before: 30 * time.Minute, Channel: storage.ChannelEmail},
+	}, e.Reminders)
+
+	e = events[1]
+	require.Equal(t, time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC), e.StartAt)
+	require.Equal(t, time.Date(2021, 3, 9, 0, 0, 0, 0, time.UTC), e.EndAt)
+	require.Equal(t, []string{"Holiday", "Family", "Spring"}, e.Tags)
+
+	e = events[2]
+	require.Equal(t, time.Date(2021, 3, 9, 9, 0, 0, 0, time.UTC), e.StartAt)
+	require.Equal(t, e.StartAt, e.EndAt)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"BEGIN:VCALENDAR",
+		"BEGIN:VCALENDAR\nEND:VEVENT",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nEND:VEVENT\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\nEND:VCALENDAR",
+		"BEGIN:VCALENDAR\nno colon\nEND:VCALENDAR",
+	} {
+		_, err := Decode(strings.NewReader(data))
+		require.True(t, errors.Is(err, ErrInvalid), data)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for s, d := range map[string]time.Duration{
+		"PT0S":     0,
+		"-PT15M":   -15 * time.Minute,
+		"P1D":      24 * time.Hour,
+		"-P1DT2H":  -26 * time.Hour,
+		"PT1H1M1S": time.Hour + time.Minute + time.Second,
+	} {
+		require.Equal(t, s, formatDuration(d))
+		parsed, err := parseDuration(s)
+		require.NoError(t, err)
+		require.Equal(t, d, parsed)
+	}
+
+	parsed, err := parseDuration("P2W")
+	require.NoError(t, err)
+	require.Equal(t, 14*24*time.Hour, parsed)
+
+	for _, s := range []string{"", "P", "PT", "1H", "PT1", "P1H", "PTM"} {
+		_, err := parseDuration(s)
+		require.Error(t, err, s)
+	}
+}
@@ -1,20 +1,91 @@
 package logger
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-type Logger struct { // TODO
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
 }
 
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+type Logger struct {
+	level int32
+	mu    sync.Mutex
+	out   io.Writer
+}
+
+// New creates a logger writing to stdout, an unknown level falls back to INFO.
 func New(level string) *Logger {
-	return &Logger{}
+	l, _ := ParseLevel(level)
+	return &Logger{level: int32(l), out: os.Stdout}
 }
 
-func (l Logger) Info(msg string) {
-	fmt.Println(msg)
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
 }
 
-func (l Logger) Error(msg string) {
-	// TODO
+// SetLevel changes the level, it is safe to call concurrently with logging.
+func (l *Logger) SetLevel(level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&l.level, int32(lvl))
+	return nil
 }
 
-// TODO
+func (l *Logger) log(level Level, msg string) {
+	if level < l.Level() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.out, "%s %s %s\n", time.Now().Format(time.RFC3339), level, msg)
+}
+
+func (l *Logger) Debug(msg string) {
+	l.log(LevelDebug, msg)
+}
+
+func (l *Logger) Info(msg string) {
+	l.log(LevelInfo, msg)
+}
+
+func (l *Logger) Warn(msg string) {
+	l.log(LevelWarn, msg)
+}
+
+func (l *Logger) Error(msg string) {
+	l.log(LevelError, msg)
+}
@@ -1,7 +1,39 @@
 package logger
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestLogger(t *testing.T) {
-	// TODO
+	out := &bytes.Buffer{}
+	l := New("warn")
+	l.out = out
+
+	l.Debug("debug message")
+	l.Info("info message")
+	l.Warn("warn message")
+	l.Error("error message")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], "WARN warn message")
+	require.Contains(t, lines[1], "ERROR error message")
+
+	t.Run("set level", func(t *testing.T) {
+		out.Reset()
+		require.NoError(t, l.SetLevel("DEBUG"))
+		l.Debug("debug message")
+		require.Contains(t, out.String(), "DEBUG debug message")
+
+		require.Error(t, l.SetLevel("verbose"))
+		require.Equal(t, LevelDebug, l.Level())
+	})
+
+	t.Run("unknown level", func(t *testing.T) {
+		require.Equal(t, LevelInfo, New("verbose").Level())
+	})
 }
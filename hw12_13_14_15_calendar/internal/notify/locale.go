@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// locale formats dates, times and durations for a language.
+type locale struct {
+	date  func(t time.Time) string
+	clock func(t time.Time) string
+	// in says when the event starts relative to the notification, e.g. "in 15 minutes".
+	in func(d time.Duration) string
+}
+
+var locales = map[string]locale{
+	"en": {
+		date:  func(t time.Time) string { return t.Format("Monday, January 2, 2006") },
+		clock: func(t time.Time) string { return t.Format("3:04 PM MST") },
+		in: func(d time.Duration) string {
+			n, unit := durationUnit(d)
+			switch {
+			case n == 0:
+				return "now"
+			case n == 1:
+				return "in 1 " + []string{"minute", "hour", "day"}[unit]
+			default:
+				return fmt.Sprintf("in %d %s", n, []string{"minutes", "hours", "days"}[unit])
+			}
+		},
+	},
+	"ru": {
+		date: func(t time.Time) string {
+			return fmt.Sprintf("%s, %d %s %d", ruWeekdays[t.Weekday()], t.Day(), ruMonths[t.Month()-1], t.Year())
+		},
+		clock: func(t time.Time) string { return t.Format("15:04 MST") },
+		in: func(d time.Duration) string {
+			n, unit := durationUnit(d)
+			if n == 0 {
+				return "сейчас"
+			}
+			forms := [][3]string{
+				{"минуту", "минуты", "минут"},
+				{"час", "часа", "часов"},
+				{"день", "дня", "дней"},
+			}[unit]
+			return fmt.Sprintf("через %d %s", n, forms[ruPlural(n)])
+		},
+	},
+}
+
+// numericLocale is the formatting of the locales added with templates, e.g. "2021-03-01",
+// "10:00 UTC" and "+15 min".
+var numericLocale = locale{
+	date:  func(t time.Time) string { return t.Format("2006-01-02") },
+	clock: func(t time.Time) string { return t.Format("15:04 MST") },
+	in: func(d time.Duration) string {
+		n, unit := durationUnit(d)
+		return fmt.Sprintf("+%d %s", n, []string{"min", "h", "d"}[unit])
+	},
+}
+
+var (
+	ruWeekdays = [...]string{"воскресенье", "понедельник", "вторник", "среда", "четверг", "пятница", "суббота"}
+	ruMonths   = [...]string{
+		"января", "февраля", "марта", "апреля", "мая", "июня",
+		"июля", "августа", "сентября", "октября", "ноября", "декабря",
+	}
+)
+
+// ruPlural returns the index of the Russian plural form of n: one, few or many.
+func ruPlural(n int) int {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return 0
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// durationUnit returns the duration in the largest of minutes (0), hours (1) and days (2)
+// it is a whole number of.
+func durationUnit(d time.Duration) (int, int) {
+	minutes := int(d / time.Minute)
+	switch {
+	case minutes == 0:
+		return 0, 0
+	case minutes%(24*60) == 0:
+		return minutes / (24 * 60), 2
+	case minutes%60 == 0:
+		return minutes / 60, 1
+	default:
+		return minutes, 0
+	}
+}
@@ -0,0 +1,243 @@
+// Package notify renders reminder notifications into messages with templates
+// for every channel and locale.
+//
+// Templates are looked up as <locale>/<channel>.<part>.tmpl and then <locale>/<part>.tmpl,
+// where part is "subject", "txt" or "html". Text parts use text/template, HTML parts
+// use html/template. English and Russian templates are built in, a directory with the
+// same layout overrides them and adds locales: every directory in it named with a lower-case
+// language code, e.g. "de", is a locale. Added locales format times with numbers only.
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const DefaultLocale = "en"
+
+var ErrUnknownLocale = errors.New("unknown locale")
+
+//go:embed templates
+var builtin embed.FS
+
+// Message is a rendered notification, HTML is empty if there is no HTML template.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Data is what templates are executed with.
+type Data struct {
+	EventID  string
+	UserID   string
+	Title    string
+	Channel  storage.Channel
+	StartAt  time.Time
+	NotifyAt time.Time
+	// Before is how long before the start the notification is sent.
+	Before time.Duration
+}
+
+type Renderer struct {
+	defaultLocale string
+	locales       map[string]locale
+	// Templates by "<locale>/<file name>".
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// NewRenderer loads the built-in templates and the ones from dir if it isn't empty.
+func NewRenderer(dir, defaultLocale string) (*Renderer, error) {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+	r := &Renderer{
+		defaultLocale: defaultLocale,
+		locales:       make(map[string]locale, len(locales)),
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+	}
+	for lang, l := range locales {
+		r.locales[lang] = l
+	}
+	sub, err := fs.Sub(builtin, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(sub); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		fsys := os.DirFS(dir)
+		if err := r.addLocales(fsys); err != nil {
+			return nil, err
+		}
+		if err := r.load(fsys); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := r.locales[defaultLocale]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownLocale, defaultLocale)
+	}
+	return r, nil
+}
+
+// addLocales adds the locales of the language directories which aren't built in.
+func (r *Renderer) addLocales(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		lang := entry.Name()
+		if _, ok := r.locales[lang]; ok || !entry.IsDir() || !languageCode(lang) {
+			continue
+		}
+		r.locales[lang] = numericLocale
+	}
+	return nil
+}
+
+// languageCode reports whether s is a language as Locale returns it, e.g. "de".
+func languageCode(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// load parses <locale>/*.tmpl of the known locales.
+func (r *Renderer) load(fsys fs.FS) error {
+	for lang, l := range r.locales {
+		names, err := fs.Glob(fsys, lang+"/*.tmpl")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			if strings.HasSuffix(name, "html.tmpl") {
+				t, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(l.funcs())).Parse(string(data))
+				if err != nil {
+					return fmt.Errorf("template %s: %w", name, err)
+				}
+				r.html[name] = t
+				continue
+			}
+			t, err := texttemplate.New(name).Funcs(l.funcs()).Parse(string(data))
+			if err != nil {
+				return fmt.Errorf("template %s: %w", name, err)
+			}
+			r.text[name] = t
+		}
+	}
+	return nil
+}
+
+// Locales returns the supported locales.
+func (r *Renderer) Locales() []string {
+	names := make([]string, 0, len(r.locales))
+	for lang := range r.locales {
+		names = append(names, lang)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locale returns the supported locale for the requested one, e.g. "ru" for "ru-RU",
+// or the default locale.
+func (r *Renderer) Locale(requested string) string {
+	requested = strings.ToLower(requested)
+	if i := strings.IndexAny(requested, "-_"); i >= 0 {
+		requested = requested[:i]
+	}
+	if _, ok := r.locales[requested]; ok {
+		return requested
+	}
+	return r.defaultLocale
+}
+
+// Render renders the notification in the locale with times in loc, UTC if it is nil.
+func (r *Renderer) Render(n storage.Notification, lang string, loc *time.Location) (Message, error) {
+	lang = r.Locale(lang)
+	if loc == nil {
+		loc = time.UTC
+	}
+	data := Data{
+		EventID:  n.EventID,
+		UserID:   n.UserID,
+		Title:    n.Title,
+		Channel:  n.Channel,
+		StartAt:  n.StartAt.In(loc),
+		NotifyAt: n.NotifyAt.In(loc),
+		Before:   n.StartAt.Sub(n.NotifyAt),
+	}
+
+	var (
+		msg Message
+		err error
+	)
+	if msg.Subject, err = r.execute(lang, n.Channel, "subject", data); err != nil {
+		return Message{}, err
+	}
+	msg.Subject = subjectLine(msg.Subject)
+	if msg.Text, err = r.execute(lang, n.Channel, "txt", data); err != nil {
+		return Message{}, err
+	}
+	if msg.HTML, err = r.execute(lang, n.Channel, "html", data); err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+// subjectLine makes the subject a single line, titles with line breaks must not add
+// headers to the e-mail.
+func subjectLine(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+}
+
+// execute renders the part of the channel's message, an empty string if there is no template.
+func (r *Renderer) execute(lang string, channel storage.Channel, part string, data Data) (string, error) {
+	var buf bytes.Buffer
+	for _, name := range []string{lang + "/" + string(channel) + "." + part + ".tmpl", lang + "/" + part + ".tmpl"} {
+		if t, ok := r.html[name]; ok {
+			err := t.Execute(&buf, data)
+			return buf.String(), err
+		}
+		if t, ok := r.text[name]; ok {
+			err := t.Execute(&buf, data)
+			return buf.String(), err
+		}
+	}
+	return "", nil
+}
+
+func (l locale) funcs() texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"date":  l.date,
+		"clock": l.clock,
+		"in":    l.in,
+	}
+}
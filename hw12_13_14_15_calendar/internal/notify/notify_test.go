@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func notification(channel storage.Channel, before time.Duration) storage.Notification {
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	return storage.Notification{
+		EventID:  "1",
+		UserID:   "alice",
+		Title:    "<standup>",
+		Channel:  channel,
+		StartAt:  start,
+		NotifyAt: start.Add(-before),
+	}
+}
+
+func TestRender(t *testing.T) {
+	r, err := NewRenderer("", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"en", "ru"}, r.Locales())
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	msg, err := r.Render(notification(storage.ChannelEmail, 15*time.Minute), "en-GB", moscow)
+	require.NoError(t, err)
+	require.Equal(t, "Reminder: <standup> in 15 minutes", msg.Subject)
+	require.Equal(t, "<standup> starts in 15 minutes.\n\nWhen: Monday, March 1, 2021, 1:00 PM MSK\n", msg.Text)
+	require.Contains(t, msg.HTML, "<strong>&lt;standup&gt;</strong>")
+
+	msg, err = r.Render(notification(storage.ChannelEmail, 2*time.Hour), "ru", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Напоминание: <standup> через 2 часа", msg.Subject)
+	require.Equal(t, "<standup> начнётся через 2 часа.\n\nКогда: понедельник, 1 марта 2021, 10:00 UTC\n", msg.Text)
+
+	n := notification(storage.ChannelEmail, 15*time.Minute)
+	n.Title = "standup\r\nBcc: mallory@example.com"
+	msg, err = r.Render(n, "en", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Reminder: standup Bcc: mallory@example.com in 15 minutes", msg.Subject)
+
+	// The channel's own template takes precedence.
+	msg, err = r.Render(notification(storage.ChannelLog, 24*time.Hour), "fr", nil)
+	require.NoError(t, err)
+	require.Equal(t, `reminder for alice: "<standup>" at Monday, March 1, 2021 10:00 AM UTC`+"\n", msg.Text)
+}
+
+func TestRussianPlural(t *testing.T) {
+	in := locales["ru"].in
+	for d, s := range map[time.Duration]string{
+		0:                   "сейчас",
+		time.Minute:         "через 1 минуту",
+		3 * time.Minute:     "через 3 минуты",
+		11 * time.Minute:    "через 11 минут",
+		21 * time.Hour:      "через 21 час",
+		90 * time.Minute:    "через 90 минут",
+		48 * time.Hour:      "через 2 дня",
+		25 * 24 * time.Hour: "через 25 дней",
+	} {
+		require.Equal(t, s, in(d))
+	}
+}
+
+func TestTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "en"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "webhook.subject.tmpl"), []byte("{{.Title}}!"), 0o600))
+
+	r, err := NewRenderer(dir, "ru")
+	require.NoError(t, err)
+	msg, err := r.Render(notification(storage.ChannelWebhook, time.Minute), "en", nil)
+	require.NoError(t, err)
+	require.Equal(t, "<standup>!", msg.Subject)
+	require.Equal(t, "<standup> starts in 1 minute.\n\nWhen: Monday, March 1, 2021, 10:00 AM UTC\n", msg.Text)
+
+	// The default locale is used for unsupported ones.
+	msg, err = r.Render(notification(storage.ChannelWebhook, time.Minute), "de", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Напоминание: <standup> через 1 минуту", msg.Subject)
+
+	// A directory adds a locale.
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "de"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de", "subject.tmpl"),
+		[]byte("Erinnerung: {{.Title}} {{in .Before}}"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de", "txt.tmpl"),
+		[]byte("{{.Title}} am {{date .StartAt}} um {{clock .StartAt}}"), 0o600))
+	r, err = NewRenderer(dir, "de")
+	require.NoError(t, err)
+	require.Equal(t, []string{"de", "en", "ru"}, r.Locales())
+	msg, err = r.Render(notification(storage.ChannelEmail, 90*time.Minute), "de-AT", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Erinnerung: <standup> +90 min", msg.Subject)
+	require.Equal(t, "<standup> am 2021-03-01 um 10:00 UTC", msg.Text)
+	msg, err = r.Render(notification(storage.ChannelEmail, 90*time.Minute), "fr", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Erinnerung: <standup> +90 min", msg.Subject)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "txt.tmpl"), []byte("{{.Title"), 0o600))
+	_, err = NewRenderer(dir, "")
+	require.Error(t, err)
+
+	_, err = NewRenderer("", "de")
+	require.True(t, errors.Is(err, ErrUnknownLocale))
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+type LeaseStorage interface {
+	AcquireLease(ctx context.Context, lease storage.Lease, now time.Time) (storage.Lease, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Elector makes sure that only one of the replicas sharing the storage runs the jobs.
+// The leader renews its lease every third of the lease period, the others try to take
+// the lease over as often, so a failed leader is replaced within 4/3 of the period.
+type Elector struct {
+	storage LeaseStorage
+	logger  Logger
+	name    string
+	holder  string
+	period  time.Duration
+
+	mu    sync.RWMutex
+	lease storage.Lease
+}
+
+func NewElector(storage LeaseStorage, logger Logger, name, holder string, period time.Duration) *Elector {
+	return &Elector{storage: storage, logger: logger, name: name, holder: holder, period: period}
+}
+
+// Leader returns the last known lease and whether this replica is the leader.
+func (e *Elector) Leader() (storage.Lease, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.lease, e.isLeader(time.Now())
+}
+
+func (e *Elector) isLeader(now time.Time) bool {
+	return e.lease.Holder == e.holder && !e.lease.Expired(now)
+}
+
+// Run calls run while this replica is the leader until the context is done.
+// The context passed to run is canceled when the leadership is lost.
+func (e *Elector) Run(ctx context.Context, run func(ctx context.Context)) {
+	ticker := time.NewTicker(e.period / 3)
+	defer ticker.Stop()
+
+	var stop func()
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+		// The context is done, release the lease with a fresh one.
+		if err := e.storage.ReleaseLease(context.Background(), e.name, e.holder); err != nil {
+			e.logger.Error("failed to release " + e.name + " lease: " + err.Error())
+		}
+		e.mu.Lock()
+		e.lease = storage.Lease{}
+		e.mu.Unlock()
+	}()
+
+	for {
+		leader := e.campaign(ctx)
+		switch {
+		case leader && stop == nil:
+			e.logger.Info(e.holder + " is the " + e.name + " leader")
+			stop = start(ctx, run)
+		case !leader && stop != nil:
+			e.logger.Info(e.holder + " lost the " + e.name + " leadership")
+			stop()
+			stop = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// start runs run in background, stop cancels it and waits for it to return.
+func start(ctx context.Context, run func(ctx context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// campaign takes or renews the lease and reports whether this replica is the leader.
+func (e *Elector) campaign(ctx context.Context) bool {
+	now := time.Now()
+	lease, err := e.storage.AcquireLease(ctx, storage.Lease{
+		Name:      e.name,
+		Holder:    e.holder,
+		ExpiresAt: now.Add(e.period),
+	}, now)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case err == nil, errors.Is(err, storage.ErrLeaseHeld):
+		e.lease = lease
+	case ctx.Err() == nil:
+		// The leader keeps running until its lease expires, it can't be taken over before that.
+		e.logger.Error("failed to acquire " + e.name + " lease: " + err.Error())
+	}
+	return e.isLeader(now)
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElector(t *testing.T) {
+	storage := memorystorage.New()
+	period := 30 * time.Millisecond
+
+	var running int32
+	run := func(ctx context.Context) {
+		atomic.AddInt32(&running, 1)
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+	}
+
+	first := NewElector(storage, nopLogger{}, "scheduler", "first", period)
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(firstCtx, run)
+		close(firstDone)
+	}()
+	require.Eventually(t, func() bool {
+		_, leader := first.Leader()
+		return leader
+	}, time.Second, time.Millisecond)
+
+	second := NewElector(storage, nopLogger{}, "scheduler", "second", period)
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go second.Run(secondCtx, run)
+
+	time.Sleep(2 * period)
+	lease, leader := second.Leader()
+	require.False(t, leader)
+	require.Equal(t, "first", lease.Holder)
+	require.Equal(t, int32(1), atomic.LoadInt32(&running))
+
+	// The stopped leader releases the lease and the other replica takes over.
+	stopFirst()
+	<-firstDone
+	require.Eventually(t, func() bool {
+		_, leader := second.Leader()
+		return leader
+	}, time.Second, time.Millisecond)
+	_, leader = first.Leader()
+	require.False(t, leader)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&running) == 1
+	}, time.Second, time.Millisecond)
+}
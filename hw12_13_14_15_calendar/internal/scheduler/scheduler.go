@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrNotRunning means that the jobs are not run here, e.g. the replica is not the leader.
+	ErrNotRunning = errors.New("scheduler is not running")
+)
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+// Job is run every Interval until the scheduler is stopped.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type Scheduler struct {
+	logger Logger
+	jobs   []Job
+
+	mu        sync.Mutex
+	intervals map[string]time.Duration
+	changed   map[string]chan struct{}
+	triggered map[string]chan struct{}
+	running   bool
+}
+
+func New(logger Logger, jobs ...Job) *Scheduler {
+	s := &Scheduler{
+		logger:    logger,
+		jobs:      jobs,
+		intervals: make(map[string]time.Duration, len(jobs)),
+		changed:   make(map[string]chan struct{}, len(jobs)),
+		triggered: make(map[string]chan struct{}, len(jobs)),
+	}
+	for _, job := range jobs {
+		s.intervals[job.Name] = job.Interval
+		s.changed[job.Name] = make(chan struct{}, 1)
+		s.triggered[job.Name] = make(chan struct{}, 1)
+	}
+	return s
+}
+
+// Interval returns the current interval of the job, zero for an unknown one.
+func (s *Scheduler) Interval(name string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.intervals[name]
+}
+
+// SetInterval changes the interval of the job, running or not. The next run is an interval
+// after the change, a non-positive interval pauses the job. It reports whether the job exists.
+func (s *Scheduler) SetInterval(name string, interval time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed, ok := s.changed[name]
+	if !ok {
+		return false
+	}
+	s.intervals[name] = interval
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Trigger runs the job now, paused or not, its schedule stays the same. A trigger made while
+// the previous one is pending is merged into it.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	triggered, ok := s.triggered[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownJob, name)
+	}
+	if !s.running {
+		return ErrNotRunning
+	}
+	select {
+	case triggered <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = running
+	if running {
+		return
+	}
+	// Drop the pending triggers, they are not run by the next leader.
+	for _, triggered := range s.triggered {
+		select {
+		case <-triggered:
+		default:
+		}
+	}
+}
+
+// Run runs the jobs until the context is done. Jobs with no interval wait until they get one.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.setRunning(true)
+	defer s.setRunning(false)
+
+	wg := sync.WaitGroup{}
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	var ticker *time.Ticker
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	// schedule runs the job now if it gets an interval and starts or resets the ticker.
+	schedule := func() {
+		interval := s.Interval(job.Name)
+		switch {
+		case interval <= 0 && ticker != nil:
+			ticker.Stop()
+			ticker = nil
+		case interval > 0 && ticker == nil:
+			ticker = time.NewTicker(interval)
+			s.run(ctx, job)
+		case interval > 0:
+			ticker.Reset(interval)
+		}
+	}
+	schedule()
+
+	for {
+		var tick <-chan time.Time
+		if ticker != nil {
+			tick = ticker.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed[job.Name]:
+			schedule()
+		case <-s.triggered[job.Name]:
+			s.run(ctx, job)
+		case <-tick:
+			s.run(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+		s.logger.Error(job.Name + " failed: " + err.Error())
+	}
+}
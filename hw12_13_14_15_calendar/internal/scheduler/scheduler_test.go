@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string)  {}
+func (nopLogger) Error(string) {}
+
+func TestScheduler(t *testing.T) {
+	var runs, failures int32
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		New(nopLogger{},
+			Job{Name: "counter", Interval: time.Millisecond, Run: func(context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			}},
+			Job{Name: "failing", Interval: time.Millisecond, Run: func(context.Context) error {
+				atomic.AddInt32(&failures, 1)
+				return errors.New("failed")
+			}},
+			Job{Name: "disabled", Run: func(context.Context) error {
+				panic("must not run")
+			}},
+		).Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) >= 3 && atomic.LoadInt32(&failures) >= 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestTrigger(t *testing.T) {
+	runs := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := New(nopLogger{}, Job{Name: "paused", Run: func(context.Context) error {
+		runs <- struct{}{}
+		return nil
+	}})
+	require.True(t, errors.Is(s.Trigger("paused"), ErrNotRunning))
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return s.Trigger("paused") == nil
+	}, time.Second, time.Millisecond)
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("triggered job has not run")
+	}
+	require.True(t, errors.Is(s.Trigger("unknown"), ErrUnknownJob))
+
+	cancel()
+	<-done
+	require.True(t, errors.Is(s.Trigger("paused"), ErrNotRunning))
+}
+
+func TestSetInterval(t *testing.T) {
+	var runs, paused int32
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := New(nopLogger{},
+		Job{Name: "counter", Interval: time.Hour, Run: func(context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}},
+		Job{Name: "paused", Run: func(context.Context) error {
+			atomic.AddInt32(&paused, 1)
+			return nil
+		}},
+	)
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, time.Second, time.Millisecond)
+	require.True(t, s.SetInterval("counter", time.Millisecond))
+	require.True(t, s.SetInterval("paused", time.Millisecond))
+	require.False(t, s.SetInterval("unknown", time.Millisecond))
+	require.Equal(t, time.Millisecond, s.Interval("counter"))
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) >= 3 && atomic.LoadInt32(&paused) >= 3
+	}, time.Second, time.Millisecond)
+
+	require.True(t, s.SetInterval("counter", 0))
+	time.Sleep(10 * time.Millisecond)
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, stopped, atomic.LoadInt32(&runs))
+
+	cancel()
+	<-done
+}
+
+func TestPurgeTrash(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+
+	now := time.Now()
+	for i, deletedAt := range []time.Time{now.Add(-48 * time.Hour), now.Add(-time.Hour)} {
+		id := string(rune('1' + i))
+		require.NoError(t, s.CreateEvent(ctx, "owner", storage.Event{ID: id, CalendarID: "work", StartAt: now, EndAt: now.Add(time.Hour)}))
+		for _, att := range []storage.Attachment{{ID: "a", Key: id + "/a"}, {ID: "b", URL: "https://example.com"}} {
+			_, err := s.AddAttachment(ctx, "owner", id, att, 2)
+			require.NoError(t, err)
+		}
+		require.NoError(t, s.TrashEvent(ctx, "owner", id, deletedAt))
+	}
+
+	blobs := &deletedBlobs{}
+	require.NoError(t, PurgeTrash(s, blobs, nopLogger{}, 24*time.Hour, time.Hour).Run(ctx))
+	trash, err := s.ListTrash(ctx, "owner")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, "2", trash[0].ID)
+	require.Equal(t, []string{"1/a"}, blobs.keys)
+
+	// The purge is audited in the tenant of the event.
+	acme := storage.WithTenantID(ctx, "acme")
+	require.NoError(t, s.CreateCalendar(acme, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	require.NoError(t, s.CreateEvent(acme, "owner", storage.Event{ID: "3", CalendarID: "work", StartAt: now, EndAt: now.Add(time.Hour)}))
+	require.NoError(t, s.TrashEvent(acme, "owner", "3", now.Add(-48*time.Hour)))
+	require.NoError(t, PurgeTrash(s, nil, nopLogger{}, 24*time.Hour, time.Hour).Run(ctx))
+	for tenantID, eventID := range map[string]string{"": "1", "acme": "3"} {
+		entries, err := s.ListAudit(storage.WithTenantID(ctx, tenantID), "owner", storage.AuditFilter{ActorID: storage.ActorSystem})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, eventID, entries[0].EventID)
+		require.Equal(t, storage.ChangePurged, entries[0].Change)
+		require.Equal(t, storage.TransportScheduler, entries[0].Transport)
+		require.Contains(t, entries[0].Diff, storage.FieldChange{Field: "calendar_id", Before: "work"})
+	}
+}
+
+type deletedBlobs struct {
+	keys []string
+}
+
+func (b *deletedBlobs) Delete(_ context.Context, key string) error {
+	b.keys = append(b.keys, key)
+	return nil
+}
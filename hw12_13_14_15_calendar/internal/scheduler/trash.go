@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/google/uuid"
+)
+
+const PurgeTrashJob = "trash purge"
+
+type TrashStorage interface {
+	PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error)
+	AppendAudit(ctx context.Context, entries ...storage.AuditEntry) error
+}
+
+// BlobStore keeps the files of attachments.
+type BlobStore interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// PurgeTrash returns the job which permanently deletes events kept in the trash longer than retention
+// along with the files of their attachments, blobs may be nil if there are no files. Every purged
+// event is recorded in the audit log of its tenant as purged by ActorSystem.
+func PurgeTrash(s TrashStorage, blobs BlobStore, logger Logger, retention, interval time.Duration) Job {
+	return Job{
+		Name:     PurgeTrashJob,
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			purged, err := s.PurgeTrash(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return err
+			}
+			if len(purged) > 0 {
+				logger.Info(fmt.Sprintf("purged %d events from the trash", len(purged)))
+			}
+			err = auditPurged(ctx, s, purged, time.Now().UTC())
+			if blobs == nil {
+				return err
+			}
+			for _, e := range purged {
+				for _, att := range e.Attachments {
+					if att.Link() {
+						continue
+					}
+					if err := blobs.Delete(ctx, att.Key); err != nil {
+						logger.Error(fmt.Sprintf("failed to delete attachment %s: %v", att.Key, err))
+					}
+				}
+			}
+			return err
+		},
+	}
+}
+
+// auditPurged appends the entries of the purged events to the audit logs of their tenants.
+func auditPurged(ctx context.Context, s TrashStorage, purged []storage.Event, at time.Time) error {
+	var tenants []string
+	entries := make(map[string][]storage.AuditEntry)
+	for _, e := range purged {
+		if _, ok := entries[e.TenantID]; !ok {
+			tenants = append(tenants, e.TenantID)
+		}
+		entries[e.TenantID] = append(entries[e.TenantID], storage.AuditEntry{
+			ID:         uuid.New().String(),
+			EventID:    e.ID,
+			CalendarID: e.CalendarID,
+			ActorID:    storage.ActorSystem,
+			Transport:  storage.TransportScheduler,
+			Change:     storage.ChangePurged,
+			At:         at,
+			Diff:       storage.DiffEvents(e, storage.Event{}),
+		})
+	}
+	for _, tenantID := range tenants {
+		if err := s.AppendAudit(storage.WithTenantID(ctx, tenantID), entries[tenantID]...); err != nil {
+			return fmt.Errorf("audit purged events: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package internalgrpc
+
+import (
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func eventFromPB(e *pb.Event) storage.Event {
+	event := storage.Event{
+		ID:          e.Id,
+		CalendarID:  e.CalendarId,
+		Title:       e.Title,
+		StartAt:     timeFromPB(e.StartAt),
+		EndAt:       timeFromPB(e.EndAt),
+		Description: e.Description,
+		Tags:        e.Tags,
+	}
+	for _, r := range e.Reminders {
+		event.Reminders = append(event.Reminders, storage.Reminder{
+			ID:      r.Id,
+			Before:  r.Before.AsDuration(),
+			Channel: storage.Channel(r.Channel),
+		})
+	}
+	return event
+}
+
+// timeFromPB returns the zero time for a missing timestamp, not the Unix epoch.
+func timeFromPB(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func eventToPB(e storage.Event) *pb.Event {
+	event := &pb.Event{
+		Id:          e.ID,
+		CalendarId:  e.CalendarID,
+		OwnerId:     e.OwnerID,
+		Title:       e.Title,
+		StartAt:     timestamppb.New(e.StartAt),
+		EndAt:       timestamppb.New(e.EndAt),
+		Description: e.Description,
+		Tags:        e.Tags,
+	}
+	for _, r := range e.Reminders {
+		event.Reminders = append(event.Reminders, &pb.Reminder{
+			Id:      r.ID,
+			Before:  durationpb.New(r.Before),
+			Channel: string(r.Channel),
+		})
+	}
+	return event
+}
+
+func eventsToPB(events []storage.Event) []*pb.Event {
+	out := make([]*pb.Event, 0, len(events))
+	for _, e := range events {
+		out = append(out, eventToPB(e))
+	}
+	return out
+}
+
+var changes = map[pb.Change]storage.Change{
+	pb.Change_CHANGE_CREATE: storage.ChangeCreated,
+	pb.Change_CHANGE_UPDATE: storage.ChangeUpdated,
+	pb.Change_CHANGE_DELETE: storage.ChangeDeleted,
+}
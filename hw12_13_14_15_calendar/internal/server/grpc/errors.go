@@ -0,0 +1,83 @@
+// Package internalgrpc is the gRPC API of the calendar, see api/EventService.proto.
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Status converts an error of the application to a gRPC status error, errors which already
+// have a status are returned as is.
+func Status(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := errorCode(err)
+	if code == codes.Internal {
+		return status.Error(code, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
+
+func errorCode(err error) codes.Code {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, app.ErrInvalidEvent),
+		errors.Is(err, app.ErrInvalidCalendar),
+		errors.Is(err, app.ErrInvalidWebhook),
+		errors.Is(err, app.ErrInvalidBatch),
+		errors.Is(err, app.ErrInvalidAuditFilter),
+		errors.Is(err, app.ErrInvalidTag),
+		errors.Is(err, app.ErrInvalidWorkingHours),
+		errors.Is(err, app.ErrInvalidPreferences),
+		errors.Is(err, app.ErrInvalidSlotRequest),
+		errors.Is(err, app.ErrInvalidAttachment),
+		errors.Is(err, app.ErrInvalidNotificationFilter),
+		errors.Is(err, app.ErrUnsupportedContentType),
+		errors.Is(err, storage.ErrInvalidAccess),
+		errors.Is(err, storage.ErrInvalidOperation):
+		code = codes.InvalidArgument
+	case errors.Is(err, auth.ErrUnauthenticated):
+		code = codes.Unauthenticated
+	case errors.Is(err, storage.ErrAccessDenied):
+		code = codes.PermissionDenied
+	case errors.Is(err, storage.ErrEventNotFound),
+		errors.Is(err, storage.ErrCalendarNotFound),
+		errors.Is(err, storage.ErrWebhookNotFound),
+		errors.Is(err, storage.ErrReminderNotFound),
+		errors.Is(err, storage.ErrTagNotFound),
+		errors.Is(err, storage.ErrWorkingHoursNotFound),
+		errors.Is(err, storage.ErrPreferencesNotFound),
+		errors.Is(err, storage.ErrAttachmentNotFound),
+		errors.Is(err, scheduler.ErrUnknownJob):
+		code = codes.NotFound
+	case errors.Is(err, storage.ErrEventExists),
+		errors.Is(err, storage.ErrCalendarExists),
+		errors.Is(err, storage.ErrWebhookExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, app.ErrNotApplied),
+		errors.Is(err, storage.ErrCalendarNotEmpty),
+		errors.Is(err, scheduler.ErrNotRunning):
+		code = codes.FailedPrecondition
+	case errors.Is(err, app.ErrAttachmentTooLarge),
+		errors.Is(err, app.ErrQuotaExceeded):
+		code = codes.ResourceExhausted
+	case errors.Is(err, app.ErrAttachmentsDisabled):
+		code = codes.Unimplemented
+	}
+	return code
+}
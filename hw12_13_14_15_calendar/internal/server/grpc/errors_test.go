@@ -0,0 +1,80 @@
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{err: context.Canceled, code: codes.Canceled},
+		{err: context.DeadlineExceeded, code: codes.DeadlineExceeded},
+		{err: app.ErrInvalidEvent, code: codes.InvalidArgument},
+		{err: app.ErrInvalidCalendar, code: codes.InvalidArgument},
+		{err: app.ErrInvalidWebhook, code: codes.InvalidArgument},
+		{err: app.ErrInvalidBatch, code: codes.InvalidArgument},
+		{err: app.ErrInvalidAuditFilter, code: codes.InvalidArgument},
+		{err: app.ErrInvalidTag, code: codes.InvalidArgument},
+		{err: app.ErrInvalidWorkingHours, code: codes.InvalidArgument},
+		{err: app.ErrInvalidPreferences, code: codes.InvalidArgument},
+		{err: app.ErrInvalidSlotRequest, code: codes.InvalidArgument},
+		{err: app.ErrInvalidAttachment, code: codes.InvalidArgument},
+		{err: app.ErrInvalidNotificationFilter, code: codes.InvalidArgument},
+		{err: app.ErrUnsupportedContentType, code: codes.InvalidArgument},
+		{err: storage.ErrInvalidAccess, code: codes.InvalidArgument},
+		{err: storage.ErrInvalidOperation, code: codes.InvalidArgument},
+		{err: auth.ErrUnauthenticated, code: codes.Unauthenticated},
+		{err: storage.ErrAccessDenied, code: codes.PermissionDenied},
+		{err: storage.ErrEventNotFound, code: codes.NotFound},
+		{err: storage.ErrCalendarNotFound, code: codes.NotFound},
+		{err: storage.ErrWebhookNotFound, code: codes.NotFound},
+		{err: storage.ErrReminderNotFound, code: codes.NotFound},
+		{err: storage.ErrTagNotFound, code: codes.NotFound},
+		{err: storage.ErrWorkingHoursNotFound, code: codes.NotFound},
+		{err: storage.ErrPreferencesNotFound, code: codes.NotFound},
+		{err: storage.ErrAttachmentNotFound, code: codes.NotFound},
+		{err: storage.ErrEventExists, code: codes.AlreadyExists},
+		{err: storage.ErrCalendarExists, code: codes.AlreadyExists},
+		{err: storage.ErrWebhookExists, code: codes.AlreadyExists},
+		{err: app.ErrNotApplied, code: codes.FailedPrecondition},
+		{err: storage.ErrCalendarNotEmpty, code: codes.FailedPrecondition},
+		{err: app.ErrAttachmentTooLarge, code: codes.ResourceExhausted},
+		{err: app.ErrQuotaExceeded, code: codes.ResourceExhausted},
+		{err: app.ErrAttachmentsDisabled, code: codes.Unimplemented},
+		{err: errors.New("disk is full"), code: codes.Internal},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			require.Equal(t, tt.code, errorCode(tt.err))
+			require.Equal(t, tt.code, errorCode(fmt.Errorf("%w: wrapped", tt.err)))
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	require.NoError(t, Status(nil))
+	err := Status(fmt.Errorf("%w: 42", storage.ErrReminderNotFound))
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, "reminder not found: 42", status.Convert(err).Message())
+
+	// Internal errors are not disclosed to clients.
+	err = Status(errors.New("disk is full"))
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.Equal(t, "internal error", status.Convert(err).Message())
+
+	err = status.Error(codes.Unavailable, "try later")
+	require.Equal(t, err, Status(err))
+}
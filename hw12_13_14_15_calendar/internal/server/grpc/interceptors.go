@@ -0,0 +1,224 @@
+package internalgrpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+// validator is implemented by messages with validation rules, e.g. generated by protoc-gen-validate.
+type validator interface {
+	Validate() error
+}
+
+// ServerOptions returns the interceptors for the calendar gRPC server: authentication, access
+// logging, panic recovery, mapping of application errors to status codes and request validation.
+func ServerOptions(logger Logger, authenticator auth.Authenticator) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			UnaryAuth(logger, authenticator),
+			UnaryLogging(logger),
+			UnaryRecovery(logger),
+			UnaryErrors(),
+			UnaryValidation(),
+		),
+		grpc.ChainStreamInterceptor(
+			StreamAuth(logger, authenticator),
+			StreamLogging(logger),
+			StreamRecovery(logger),
+			StreamErrors(),
+			StreamValidation(),
+		),
+	}
+}
+
+// UnaryAuth puts the user ID and the tenant ID of the caller into the context, the credentials
+// are taken from the metadata as from the HTTP headers. Rejected calls are logged here as they
+// don't reach the logging interceptor.
+func UnaryAuth(logger Logger, authenticator auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, err := authenticate(ctx, authenticator)
+		if err != nil {
+			logCall(ctx, logger, info.FullMethod, start, err)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func StreamAuth(logger Logger, authenticator auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, err := authenticate(ss.Context(), authenticator)
+		if err != nil {
+			logCall(ctx, logger, info.FullMethod, start, err)
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, authenticator auth.Authenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	headers := make(http.Header, len(md))
+	for key, values := range md {
+		if !strings.HasPrefix(key, ":") {
+			headers[textproto.CanonicalMIMEHeaderKey(key)] = values
+		}
+	}
+	userID, tenantID, err := auth.Resolve(ctx, authenticator, headers)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	return storage.WithTenantID(auth.WithUserID(ctx, userID), tenantID), nil
+}
+
+// UnaryLogging logs every call with its status code and duration.
+func UnaryLogging(logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func StreamLogging(logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger Logger, method string, start time.Time, err error) {
+	user, ok := auth.UserID(ctx)
+	if !ok {
+		user = "-"
+	}
+	code := status.Code(err)
+	msg := fmt.Sprintf("grpc %s %s user=%s duration=%s", method, code, user, time.Since(start))
+	switch code { //nolint:exhaustive
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		logger.Error(msg + " error=" + err.Error())
+	default:
+		logger.Info(msg)
+	}
+}
+
+// UnaryRecovery turns a panic in the handler into the Internal status.
+func UnaryRecovery(logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(logger, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func StreamRecovery(logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(logger, info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+func recovered(logger Logger, method string, p interface{}) error {
+	logger.Error(fmt.Sprintf("grpc %s panic: %v\n%s", method, p, debug.Stack()))
+	return status.Error(codes.Internal, "internal error")
+}
+
+// UnaryErrors converts errors of the application to status errors and marks the context
+// with the gRPC transport for the audit log.
+func UnaryErrors() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(app.WithTransport(ctx, app.TransportGRPC), req)
+		return resp, Status(err)
+	}
+}
+
+func StreamErrors() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := app.WithTransport(ss.Context(), app.TransportGRPC)
+		return Status(handler(srv, &serverStream{ServerStream: ss, ctx: ctx}))
+	}
+}
+
+// UnaryValidation rejects requests which break their validation rules with InvalidArgument.
+func UnaryValidation() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamValidation validates every message received from the client.
+func StreamValidation() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ss.Context(), validate: true})
+	}
+}
+
+func validate(msg interface{}) error {
+	v, ok := msg.(validator)
+	if !ok {
+		return nil
+	}
+	if err := v.Validate(); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	validate bool
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.validate {
+		return validate(m)
+	}
+	return nil
+}
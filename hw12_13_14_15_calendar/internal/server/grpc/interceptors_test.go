@@ -0,0 +1,132 @@
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) Info(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, "INFO "+msg)
+}
+
+func (l *testLogger) Error(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, "ERROR "+msg)
+}
+
+type request struct {
+	title string
+}
+
+func (r request) Validate() error {
+	if r.title == "" {
+		return errors.New("title is required")
+	}
+	return nil
+}
+
+// chain calls the handler through the interceptors in the order of ServerOptions.
+func chain(logger Logger, handler grpc.UnaryHandler) grpc.UnaryHandler {
+	interceptors := []grpc.UnaryServerInterceptor{
+		UnaryLogging(logger), UnaryRecovery(logger), UnaryErrors(), UnaryValidation(),
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/event.EventService/CreateEvent"}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+	ctx := auth.WithUserID(context.Background(), "alice")
+
+	t.Run("ok", func(t *testing.T) {
+		logger := &testLogger{}
+		resp, err := chain(logger, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "done", nil
+		})(ctx, request{title: "standup"})
+		require.NoError(t, err)
+		require.Equal(t, "done", resp)
+		require.Len(t, logger.msgs, 1)
+		require.True(t, strings.HasPrefix(logger.msgs[0], "INFO grpc /event.EventService/CreateEvent OK user=alice"))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		called := false
+		_, err := chain(&testLogger{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})(ctx, request{})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.False(t, called)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		_, err := chain(&testLogger{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("get event: %w", storage.ErrEventNotFound)
+		})(ctx, request{title: "standup"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		logger := &testLogger{}
+		_, err := chain(logger, func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("boom")
+		})(ctx, request{title: "standup"})
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.Equal(t, "internal error", status.Convert(err).Message())
+		require.Len(t, logger.msgs, 2)
+		require.Contains(t, logger.msgs[0], "panic: boom")
+		require.True(t, strings.HasPrefix(logger.msgs[1], "ERROR grpc /event.EventService/CreateEvent Internal"))
+	})
+}
+
+type recvStream struct {
+	grpc.ServerStream
+	msgs []request
+}
+
+func (s *recvStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recvStream) RecvMsg(m interface{}) error {
+	*m.(*request) = s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func TestStreamValidation(t *testing.T) {
+	ss := &recvStream{msgs: []request{{title: "standup"}, {}}}
+	info := &grpc.StreamServerInfo{FullMethod: "/event.EventService/Import"}
+	err := StreamValidation()(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		var r request
+		if err := stream.RecvMsg(&r); err != nil {
+			return err
+		}
+		return stream.RecvMsg(&r)
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
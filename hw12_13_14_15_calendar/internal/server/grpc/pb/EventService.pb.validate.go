@@ -0,0 +1,3311 @@
+// Code generated by protoc-gen-validate. DO NOT EDIT.
+// source: EventService.proto
+
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ensure the imports are used
+var (
+	_ = bytes.MinRead
+	_ = errors.New("")
+	_ = fmt.Print
+	_ = utf8.UTFMax
+	_ = (*regexp.Regexp)(nil)
+	_ = (*strings.Reader)(nil)
+	_ = net.IPv4len
+	_ = time.Duration(0)
+	_ = (*url.URL)(nil)
+	_ = (*mail.Address)(nil)
+	_ = anypb.Any{}
+	_ = sort.Sort
+)
+
+// Validate checks the field values on Calendar with the rules defined in the
+// proto definition for this message. If any rules are violated, the first
+// error encountered is returned, or nil if there are no violations.
+func (m *Calendar) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on Calendar with the rules defined in
+// the proto definition for this message. If any rules are violated, the
+// result is a list of violation errors wrapped in CalendarMultiError, or nil
+// if none found.
+func (m *Calendar) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *Calendar) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Id
+
+	// no validation rules for OwnerId
+
+	// no validation rules for Name
+
+	if len(errors) > 0 {
+		return CalendarMultiError(errors)
+	}
+	return nil
+}
+
+// CalendarMultiError is an error wrapping multiple validation errors returned
+// by Calendar.ValidateAll() if the designated constraints aren't met.
+type CalendarMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m CalendarMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m CalendarMultiError) AllErrors() []error { return m }
+
+// CalendarValidationError is the validation error returned by
+// Calendar.Validate if the designated constraints aren't met.
+type CalendarValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e CalendarValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e CalendarValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e CalendarValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e CalendarValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e CalendarValidationError) ErrorName() string { return "CalendarValidationError" }
+
+// Error satisfies the builtin error interface
+func (e CalendarValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sCalendar.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = CalendarValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = CalendarValidationError{}
+
+// Validate checks the field values on Reminder with the rules defined in the
+// proto definition for this message. If any rules are violated, the first
+// error encountered is returned, or nil if there are no violations.
+func (m *Reminder) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on Reminder with the rules defined in
+// the proto definition for this message. If any rules are violated, the
+// result is a list of violation errors wrapped in ReminderMultiError, or nil
+// if none found.
+func (m *Reminder) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *Reminder) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Id
+
+	if d := m.GetBefore(); d != nil {
+		dur, err := d.AsDuration(), d.CheckValid()
+		if err != nil {
+			err = ReminderValidationError{
+				field:  "Before",
+				reason: "value is not a valid duration",
+				cause:  err,
+			}
+			if !all {
+				return err
+			}
+			errors = append(errors, err)
+		} else {
+
+			gte := time.Duration(0*time.Second + 0*time.Nanosecond)
+
+			if dur < gte {
+				err := ReminderValidationError{
+					field:  "Before",
+					reason: "value must be greater than or equal to 0s",
+				}
+				if !all {
+					return err
+				}
+				errors = append(errors, err)
+			}
+
+		}
+	}
+
+	if _, ok := _Reminder_Channel_InLookup[m.GetChannel()]; !ok {
+		err := ReminderValidationError{
+			field:  "Channel",
+			reason: "value must be in list [email webhook log]",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		return ReminderMultiError(errors)
+	}
+	return nil
+}
+
+// ReminderMultiError is an error wrapping multiple validation errors returned
+// by Reminder.ValidateAll() if the designated constraints aren't met.
+type ReminderMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ReminderMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ReminderMultiError) AllErrors() []error { return m }
+
+// ReminderValidationError is the validation error returned by
+// Reminder.Validate if the designated constraints aren't met.
+type ReminderValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ReminderValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ReminderValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ReminderValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ReminderValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ReminderValidationError) ErrorName() string { return "ReminderValidationError" }
+
+// Error satisfies the builtin error interface
+func (e ReminderValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sReminder.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ReminderValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ReminderValidationError{}
+
+var _Reminder_Channel_InLookup = map[string]struct{}{
+	"email":   {},
+	"webhook": {},
+	"log":     {},
+}
+
+// Validate checks the field values on Event with the rules defined in the
+// proto definition for this message. If any rules are violated, the first
+// error encountered is returned, or nil if there are no violations.
+func (m *Event) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on Event with the rules defined in the
+// proto definition for this message. If any rules are violated, the result is
+// a list of violation errors wrapped in EventMultiError, or nil if none found.
+func (m *Event) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *Event) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Id
+
+	if utf8.RuneCountInString(m.GetCalendarId()) < 1 {
+		err := EventValidationError{
+			field:  "CalendarId",
+			reason: "value length must be at least 1 runes",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	// no validation rules for OwnerId
+
+	if l := utf8.RuneCountInString(m.GetTitle()); l < 1 || l > 1024 {
+		err := EventValidationError{
+			field:  "Title",
+			reason: "value length must be between 1 and 1024 runes, inclusive",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if m.GetStartAt() == nil {
+		err := EventValidationError{
+			field:  "StartAt",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if m.GetEndAt() == nil {
+		err := EventValidationError{
+			field:  "EndAt",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	// no validation rules for Description
+
+	for idx, item := range m.GetReminders() {
+		_, _ = idx, item
+
+		if all {
+			switch v := interface{}(item).(type) {
+			case interface{ ValidateAll() error }:
+				if err := v.ValidateAll(); err != nil {
+					errors = append(errors, EventValidationError{
+						field:  fmt.Sprintf("Reminders[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			case interface{ Validate() error }:
+				if err := v.Validate(); err != nil {
+					errors = append(errors, EventValidationError{
+						field:  fmt.Sprintf("Reminders[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			}
+		} else if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return EventValidationError{
+					field:  fmt.Sprintf("Reminders[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return EventMultiError(errors)
+	}
+	return nil
+}
+
+// EventMultiError is an error wrapping multiple validation errors returned by
+// Event.ValidateAll() if the designated constraints aren't met.
+type EventMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m EventMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m EventMultiError) AllErrors() []error { return m }
+
+// EventValidationError is the validation error returned by Event.Validate if
+// the designated constraints aren't met.
+type EventValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e EventValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e EventValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e EventValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e EventValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e EventValidationError) ErrorName() string { return "EventValidationError" }
+
+// Error satisfies the builtin error interface
+func (e EventValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sEvent.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = EventValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = EventValidationError{}
+
+// Validate checks the field values on ListCalendarsRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ListCalendarsRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ListCalendarsRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ListCalendarsRequestMultiError, or nil if none found.
+func (m *ListCalendarsRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ListCalendarsRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if len(errors) > 0 {
+		return ListCalendarsRequestMultiError(errors)
+	}
+	return nil
+}
+
+// ListCalendarsRequestMultiError is an error wrapping multiple validation
+// errors returned by ListCalendarsRequest.ValidateAll() if the designated
+// constraints aren't met.
+type ListCalendarsRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ListCalendarsRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ListCalendarsRequestMultiError) AllErrors() []error { return m }
+
+// ListCalendarsRequestValidationError is the validation error returned by
+// ListCalendarsRequest.Validate if the designated constraints aren't met.
+type ListCalendarsRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ListCalendarsRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ListCalendarsRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ListCalendarsRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ListCalendarsRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ListCalendarsRequestValidationError) ErrorName() string {
+	return "ListCalendarsRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ListCalendarsRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sListCalendarsRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ListCalendarsRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ListCalendarsRequestValidationError{}
+
+// Validate checks the field values on ListCalendarsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ListCalendarsResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ListCalendarsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ListCalendarsResponseMultiError, or nil if none found.
+func (m *ListCalendarsResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ListCalendarsResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	for idx, item := range m.GetCalendars() {
+		_, _ = idx, item
+
+		if all {
+			switch v := interface{}(item).(type) {
+			case interface{ ValidateAll() error }:
+				if err := v.ValidateAll(); err != nil {
+					errors = append(errors, ListCalendarsResponseValidationError{
+						field:  fmt.Sprintf("Calendars[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			case interface{ Validate() error }:
+				if err := v.Validate(); err != nil {
+					errors = append(errors, ListCalendarsResponseValidationError{
+						field:  fmt.Sprintf("Calendars[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			}
+		} else if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return ListCalendarsResponseValidationError{
+					field:  fmt.Sprintf("Calendars[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return ListCalendarsResponseMultiError(errors)
+	}
+	return nil
+}
+
+// ListCalendarsResponseMultiError is an error wrapping multiple validation
+// errors returned by ListCalendarsResponse.ValidateAll() if the designated
+// constraints aren't met.
+type ListCalendarsResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ListCalendarsResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ListCalendarsResponseMultiError) AllErrors() []error { return m }
+
+// ListCalendarsResponseValidationError is the validation error returned by
+// ListCalendarsResponse.Validate if the designated constraints aren't met.
+type ListCalendarsResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ListCalendarsResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ListCalendarsResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ListCalendarsResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ListCalendarsResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ListCalendarsResponseValidationError) ErrorName() string {
+	return "ListCalendarsResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ListCalendarsResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sListCalendarsResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ListCalendarsResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ListCalendarsResponseValidationError{}
+
+// Validate checks the field values on CreateEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *CreateEventRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on CreateEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// CreateEventRequestMultiError, or nil if none found.
+func (m *CreateEventRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *CreateEventRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if m.GetEvent() == nil {
+		err := CreateEventRequestValidationError{
+			field:  "Event",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if all {
+		switch v := interface{}(m.GetEvent()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, CreateEventRequestValidationError{
+					field:  "Event",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, CreateEventRequestValidationError{
+					field:  "Event",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetEvent()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return CreateEventRequestValidationError{
+				field:  "Event",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return CreateEventRequestMultiError(errors)
+	}
+	return nil
+}
+
+// CreateEventRequestMultiError is an error wrapping multiple validation errors
+// returned by CreateEventRequest.ValidateAll() if the designated constraints
+// aren't met.
+type CreateEventRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m CreateEventRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m CreateEventRequestMultiError) AllErrors() []error { return m }
+
+// CreateEventRequestValidationError is the validation error returned by
+// CreateEventRequest.Validate if the designated constraints aren't met.
+type CreateEventRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e CreateEventRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e CreateEventRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e CreateEventRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e CreateEventRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e CreateEventRequestValidationError) ErrorName() string {
+	return "CreateEventRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e CreateEventRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sCreateEventRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = CreateEventRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = CreateEventRequestValidationError{}
+
+// Validate checks the field values on UpdateEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *UpdateEventRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on UpdateEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// UpdateEventRequestMultiError, or nil if none found.
+func (m *UpdateEventRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *UpdateEventRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if m.GetEvent() == nil {
+		err := UpdateEventRequestValidationError{
+			field:  "Event",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if all {
+		switch v := interface{}(m.GetEvent()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, UpdateEventRequestValidationError{
+					field:  "Event",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, UpdateEventRequestValidationError{
+					field:  "Event",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetEvent()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return UpdateEventRequestValidationError{
+				field:  "Event",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return UpdateEventRequestMultiError(errors)
+	}
+	return nil
+}
+
+// UpdateEventRequestMultiError is an error wrapping multiple validation errors
+// returned by UpdateEventRequest.ValidateAll() if the designated constraints
+// aren't met.
+type UpdateEventRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m UpdateEventRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m UpdateEventRequestMultiError) AllErrors() []error { return m }
+
+// UpdateEventRequestValidationError is the validation error returned by
+// UpdateEventRequest.Validate if the designated constraints aren't met.
+type UpdateEventRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e UpdateEventRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e UpdateEventRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e UpdateEventRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e UpdateEventRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e UpdateEventRequestValidationError) ErrorName() string {
+	return "UpdateEventRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e UpdateEventRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sUpdateEventRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = UpdateEventRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = UpdateEventRequestValidationError{}
+
+// Validate checks the field values on DeleteEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *DeleteEventRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on DeleteEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// DeleteEventRequestMultiError, or nil if none found.
+func (m *DeleteEventRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *DeleteEventRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if utf8.RuneCountInString(m.GetId()) < 1 {
+		err := DeleteEventRequestValidationError{
+			field:  "Id",
+			reason: "value length must be at least 1 runes",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		return DeleteEventRequestMultiError(errors)
+	}
+	return nil
+}
+
+// DeleteEventRequestMultiError is an error wrapping multiple validation errors
+// returned by DeleteEventRequest.ValidateAll() if the designated constraints
+// aren't met.
+type DeleteEventRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m DeleteEventRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m DeleteEventRequestMultiError) AllErrors() []error { return m }
+
+// DeleteEventRequestValidationError is the validation error returned by
+// DeleteEventRequest.Validate if the designated constraints aren't met.
+type DeleteEventRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e DeleteEventRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e DeleteEventRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e DeleteEventRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e DeleteEventRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e DeleteEventRequestValidationError) ErrorName() string {
+	return "DeleteEventRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e DeleteEventRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sDeleteEventRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = DeleteEventRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = DeleteEventRequestValidationError{}
+
+// Validate checks the field values on DeleteEventResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *DeleteEventResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on DeleteEventResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// DeleteEventResponseMultiError, or nil if none found.
+func (m *DeleteEventResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *DeleteEventResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if len(errors) > 0 {
+		return DeleteEventResponseMultiError(errors)
+	}
+	return nil
+}
+
+// DeleteEventResponseMultiError is an error wrapping multiple validation
+// errors returned by DeleteEventResponse.ValidateAll() if the designated
+// constraints aren't met.
+type DeleteEventResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m DeleteEventResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m DeleteEventResponseMultiError) AllErrors() []error { return m }
+
+// DeleteEventResponseValidationError is the validation error returned by
+// DeleteEventResponse.Validate if the designated constraints aren't met.
+type DeleteEventResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e DeleteEventResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e DeleteEventResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e DeleteEventResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e DeleteEventResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e DeleteEventResponseValidationError) ErrorName() string {
+	return "DeleteEventResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e DeleteEventResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sDeleteEventResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = DeleteEventResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = DeleteEventResponseValidationError{}
+
+// Validate checks the field values on GetEventRequest with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// first error encountered is returned, or nil if there are no violations.
+func (m *GetEventRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on GetEventRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// GetEventRequestMultiError, or nil if none found.
+func (m *GetEventRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *GetEventRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if utf8.RuneCountInString(m.GetId()) < 1 {
+		err := GetEventRequestValidationError{
+			field:  "Id",
+			reason: "value length must be at least 1 runes",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		return GetEventRequestMultiError(errors)
+	}
+	return nil
+}
+
+// GetEventRequestMultiError is an error wrapping multiple validation errors
+// returned by GetEventRequest.ValidateAll() if the designated constraints
+// aren't met.
+type GetEventRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m GetEventRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m GetEventRequestMultiError) AllErrors() []error { return m }
+
+// GetEventRequestValidationError is the validation error returned by
+// GetEventRequest.Validate if the designated constraints aren't met.
+type GetEventRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e GetEventRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e GetEventRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e GetEventRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e GetEventRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e GetEventRequestValidationError) ErrorName() string { return "GetEventRequestValidationError" }
+
+// Error satisfies the builtin error interface
+func (e GetEventRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sGetEventRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = GetEventRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = GetEventRequestValidationError{}
+
+// Validate checks the field values on ListEventsRequest with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// first error encountered is returned, or nil if there are no violations.
+func (m *ListEventsRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ListEventsRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ListEventsRequestMultiError, or nil if none found.
+func (m *ListEventsRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ListEventsRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if _, ok := _ListEventsRequest_Period_NotInLookup[m.GetPeriod()]; ok {
+		err := ListEventsRequestValidationError{
+			field:  "Period",
+			reason: "value must not be in list [0]",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if _, ok := Period_name[int32(m.GetPeriod())]; !ok {
+		err := ListEventsRequestValidationError{
+			field:  "Period",
+			reason: "value must be one of the defined enum values",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if m.GetDate() == nil {
+		err := ListEventsRequestValidationError{
+			field:  "Date",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		return ListEventsRequestMultiError(errors)
+	}
+	return nil
+}
+
+// ListEventsRequestMultiError is an error wrapping multiple validation errors
+// returned by ListEventsRequest.ValidateAll() if the designated constraints
+// aren't met.
+type ListEventsRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ListEventsRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ListEventsRequestMultiError) AllErrors() []error { return m }
+
+// ListEventsRequestValidationError is the validation error returned by
+// ListEventsRequest.Validate if the designated constraints aren't met.
+type ListEventsRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ListEventsRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ListEventsRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ListEventsRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ListEventsRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ListEventsRequestValidationError) ErrorName() string {
+	return "ListEventsRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ListEventsRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sListEventsRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ListEventsRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ListEventsRequestValidationError{}
+
+var _ListEventsRequest_Period_NotInLookup = map[Period]struct{}{
+	0: {},
+}
+
+// Validate checks the field values on ListEventsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ListEventsResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ListEventsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ListEventsResponseMultiError, or nil if none found.
+func (m *ListEventsResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ListEventsResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	for idx, item := range m.GetEvents() {
+		_, _ = idx, item
+
+		if all {
+			switch v := interface{}(item).(type) {
+			case interface{ ValidateAll() error }:
+				if err := v.ValidateAll(); err != nil {
+					errors = append(errors, ListEventsResponseValidationError{
+						field:  fmt.Sprintf("Events[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			case interface{ Validate() error }:
+				if err := v.Validate(); err != nil {
+					errors = append(errors, ListEventsResponseValidationError{
+						field:  fmt.Sprintf("Events[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			}
+		} else if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return ListEventsResponseValidationError{
+					field:  fmt.Sprintf("Events[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return ListEventsResponseMultiError(errors)
+	}
+	return nil
+}
+
+// ListEventsResponseMultiError is an error wrapping multiple validation errors
+// returned by ListEventsResponse.ValidateAll() if the designated constraints
+// aren't met.
+type ListEventsResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ListEventsResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ListEventsResponseMultiError) AllErrors() []error { return m }
+
+// ListEventsResponseValidationError is the validation error returned by
+// ListEventsResponse.Validate if the designated constraints aren't met.
+type ListEventsResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ListEventsResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ListEventsResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ListEventsResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ListEventsResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ListEventsResponseValidationError) ErrorName() string {
+	return "ListEventsResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ListEventsResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sListEventsResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ListEventsResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ListEventsResponseValidationError{}
+
+// Validate checks the field values on ApplyEventsRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ApplyEventsRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ApplyEventsRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ApplyEventsRequestMultiError, or nil if none found.
+func (m *ApplyEventsRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ApplyEventsRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Atomic
+
+	if _, ok := _ApplyEventsRequest_Change_NotInLookup[m.GetChange()]; ok {
+		err := ApplyEventsRequestValidationError{
+			field:  "Change",
+			reason: "value must not be in list [0]",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if _, ok := Change_name[int32(m.GetChange())]; !ok {
+		err := ApplyEventsRequestValidationError{
+			field:  "Change",
+			reason: "value must be one of the defined enum values",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if m.GetEvent() == nil {
+		err := ApplyEventsRequestValidationError{
+			field:  "Event",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	// skipping validation for event
+
+	if len(errors) > 0 {
+		return ApplyEventsRequestMultiError(errors)
+	}
+	return nil
+}
+
+// ApplyEventsRequestMultiError is an error wrapping multiple validation errors
+// returned by ApplyEventsRequest.ValidateAll() if the designated constraints
+// aren't met.
+type ApplyEventsRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ApplyEventsRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ApplyEventsRequestMultiError) AllErrors() []error { return m }
+
+// ApplyEventsRequestValidationError is the validation error returned by
+// ApplyEventsRequest.Validate if the designated constraints aren't met.
+type ApplyEventsRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ApplyEventsRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ApplyEventsRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ApplyEventsRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ApplyEventsRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ApplyEventsRequestValidationError) ErrorName() string {
+	return "ApplyEventsRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ApplyEventsRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sApplyEventsRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ApplyEventsRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ApplyEventsRequestValidationError{}
+
+var _ApplyEventsRequest_Change_NotInLookup = map[Change]struct{}{
+	0: {},
+}
+
+// Validate checks the field values on ApplyEventsResult with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// first error encountered is returned, or nil if there are no violations.
+func (m *ApplyEventsResult) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ApplyEventsResult with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ApplyEventsResultMultiError, or nil if none found.
+func (m *ApplyEventsResult) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ApplyEventsResult) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Code
+
+	// no validation rules for Error
+
+	if all {
+		switch v := interface{}(m.GetEvent()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, ApplyEventsResultValidationError{
+					field:  "Event",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, ApplyEventsResultValidationError{
+					field:  "Event",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetEvent()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return ApplyEventsResultValidationError{
+				field:  "Event",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return ApplyEventsResultMultiError(errors)
+	}
+	return nil
+}
+
+// ApplyEventsResultMultiError is an error wrapping multiple validation errors
+// returned by ApplyEventsResult.ValidateAll() if the designated constraints
+// aren't met.
+type ApplyEventsResultMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ApplyEventsResultMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ApplyEventsResultMultiError) AllErrors() []error { return m }
+
+// ApplyEventsResultValidationError is the validation error returned by
+// ApplyEventsResult.Validate if the designated constraints aren't met.
+type ApplyEventsResultValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ApplyEventsResultValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ApplyEventsResultValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ApplyEventsResultValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ApplyEventsResultValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ApplyEventsResultValidationError) ErrorName() string {
+	return "ApplyEventsResultValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ApplyEventsResultValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sApplyEventsResult.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ApplyEventsResultValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ApplyEventsResultValidationError{}
+
+// Validate checks the field values on ApplyEventsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ApplyEventsResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ApplyEventsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ApplyEventsResponseMultiError, or nil if none found.
+func (m *ApplyEventsResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ApplyEventsResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	for idx, item := range m.GetResults() {
+		_, _ = idx, item
+
+		if all {
+			switch v := interface{}(item).(type) {
+			case interface{ ValidateAll() error }:
+				if err := v.ValidateAll(); err != nil {
+					errors = append(errors, ApplyEventsResponseValidationError{
+						field:  fmt.Sprintf("Results[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			case interface{ Validate() error }:
+				if err := v.Validate(); err != nil {
+					errors = append(errors, ApplyEventsResponseValidationError{
+						field:  fmt.Sprintf("Results[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			}
+		} else if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return ApplyEventsResponseValidationError{
+					field:  fmt.Sprintf("Results[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return ApplyEventsResponseMultiError(errors)
+	}
+	return nil
+}
+
+// ApplyEventsResponseMultiError is an error wrapping multiple validation
+// errors returned by ApplyEventsResponse.ValidateAll() if the designated
+// constraints aren't met.
+type ApplyEventsResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ApplyEventsResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ApplyEventsResponseMultiError) AllErrors() []error { return m }
+
+// ApplyEventsResponseValidationError is the validation error returned by
+// ApplyEventsResponse.Validate if the designated constraints aren't met.
+type ApplyEventsResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ApplyEventsResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ApplyEventsResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ApplyEventsResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ApplyEventsResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ApplyEventsResponseValidationError) ErrorName() string {
+	return "ApplyEventsResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ApplyEventsResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sApplyEventsResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ApplyEventsResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ApplyEventsResponseValidationError{}
+
+// Validate checks the field values on FindSlotsRequest with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// first error encountered is returned, or nil if there are no violations.
+func (m *FindSlotsRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on FindSlotsRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// FindSlotsRequestMultiError, or nil if none found.
+func (m *FindSlotsRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *FindSlotsRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	for idx, item := range m.GetUserIds() {
+		_, _ = idx, item
+
+		if utf8.RuneCountInString(item) < 1 {
+			err := FindSlotsRequestValidationError{
+				field:  fmt.Sprintf("UserIds[%v]", idx),
+				reason: "value length must be at least 1 runes",
+			}
+			if !all {
+				return err
+			}
+			errors = append(errors, err)
+		}
+
+	}
+
+	if m.GetDuration() == nil {
+		err := FindSlotsRequestValidationError{
+			field:  "Duration",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if d := m.GetDuration(); d != nil {
+		dur, err := d.AsDuration(), d.CheckValid()
+		if err != nil {
+			err = FindSlotsRequestValidationError{
+				field:  "Duration",
+				reason: "value is not a valid duration",
+				cause:  err,
+			}
+			if !all {
+				return err
+			}
+			errors = append(errors, err)
+		} else {
+
+			gt := time.Duration(0*time.Second + 0*time.Nanosecond)
+
+			if dur <= gt {
+				err := FindSlotsRequestValidationError{
+					field:  "Duration",
+					reason: "value must be greater than 0s",
+				}
+				if !all {
+					return err
+				}
+				errors = append(errors, err)
+			}
+
+		}
+	}
+
+	if m.GetFrom() == nil {
+		err := FindSlotsRequestValidationError{
+			field:  "From",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if m.GetTo() == nil {
+		err := FindSlotsRequestValidationError{
+			field:  "To",
+			reason: "value is required",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if m.GetLimit() < 0 {
+		err := FindSlotsRequestValidationError{
+			field:  "Limit",
+			reason: "value must be greater than or equal to 0",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		return FindSlotsRequestMultiError(errors)
+	}
+	return nil
+}
+
+// FindSlotsRequestMultiError is an error wrapping multiple validation errors
+// returned by FindSlotsRequest.ValidateAll() if the designated constraints
+// aren't met.
+type FindSlotsRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m FindSlotsRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m FindSlotsRequestMultiError) AllErrors() []error { return m }
+
+// FindSlotsRequestValidationError is the validation error returned by
+// FindSlotsRequest.Validate if the designated constraints aren't met.
+type FindSlotsRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e FindSlotsRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e FindSlotsRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e FindSlotsRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e FindSlotsRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e FindSlotsRequestValidationError) ErrorName() string { return "FindSlotsRequestValidationError" }
+
+// Error satisfies the builtin error interface
+func (e FindSlotsRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sFindSlotsRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = FindSlotsRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = FindSlotsRequestValidationError{}
+
+// Validate checks the field values on Slot with the rules defined in the proto
+// definition for this message. If any rules are violated, the first error
+// encountered is returned, or nil if there are no violations.
+func (m *Slot) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on Slot with the rules defined in the
+// proto definition for this message. If any rules are violated, the result is
+// a list of violation errors wrapped in SlotMultiError, or nil if none found.
+func (m *Slot) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *Slot) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if all {
+		switch v := interface{}(m.GetStart()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, SlotValidationError{
+					field:  "Start",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, SlotValidationError{
+					field:  "Start",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetStart()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return SlotValidationError{
+				field:  "Start",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	if all {
+		switch v := interface{}(m.GetEnd()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, SlotValidationError{
+					field:  "End",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, SlotValidationError{
+					field:  "End",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetEnd()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return SlotValidationError{
+				field:  "End",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	if all {
+		switch v := interface{}(m.GetScore()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, SlotValidationError{
+					field:  "Score",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, SlotValidationError{
+					field:  "Score",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetScore()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return SlotValidationError{
+				field:  "Score",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return SlotMultiError(errors)
+	}
+	return nil
+}
+
+// SlotMultiError is an error wrapping multiple validation errors returned by
+// Slot.ValidateAll() if the designated constraints aren't met.
+type SlotMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m SlotMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m SlotMultiError) AllErrors() []error { return m }
+
+// SlotValidationError is the validation error returned by Slot.Validate if the
+// designated constraints aren't met.
+type SlotValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e SlotValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e SlotValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e SlotValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e SlotValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e SlotValidationError) ErrorName() string { return "SlotValidationError" }
+
+// Error satisfies the builtin error interface
+func (e SlotValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sSlot.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = SlotValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = SlotValidationError{}
+
+// Validate checks the field values on FindSlotsResponse with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// first error encountered is returned, or nil if there are no violations.
+func (m *FindSlotsResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on FindSlotsResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// FindSlotsResponseMultiError, or nil if none found.
+func (m *FindSlotsResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *FindSlotsResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	for idx, item := range m.GetSlots() {
+		_, _ = idx, item
+
+		if all {
+			switch v := interface{}(item).(type) {
+			case interface{ ValidateAll() error }:
+				if err := v.ValidateAll(); err != nil {
+					errors = append(errors, FindSlotsResponseValidationError{
+						field:  fmt.Sprintf("Slots[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			case interface{ Validate() error }:
+				if err := v.Validate(); err != nil {
+					errors = append(errors, FindSlotsResponseValidationError{
+						field:  fmt.Sprintf("Slots[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			}
+		} else if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return FindSlotsResponseValidationError{
+					field:  fmt.Sprintf("Slots[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return FindSlotsResponseMultiError(errors)
+	}
+	return nil
+}
+
+// FindSlotsResponseMultiError is an error wrapping multiple validation errors
+// returned by FindSlotsResponse.ValidateAll() if the designated constraints
+// aren't met.
+type FindSlotsResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m FindSlotsResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m FindSlotsResponseMultiError) AllErrors() []error { return m }
+
+// FindSlotsResponseValidationError is the validation error returned by
+// FindSlotsResponse.Validate if the designated constraints aren't met.
+type FindSlotsResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e FindSlotsResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e FindSlotsResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e FindSlotsResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e FindSlotsResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e FindSlotsResponseValidationError) ErrorName() string {
+	return "FindSlotsResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e FindSlotsResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sFindSlotsResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = FindSlotsResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = FindSlotsResponseValidationError{}
+
+// Validate checks the field values on RunJobRequest with the rules defined in
+// the proto definition for this message. If any rules are violated, the first
+// error encountered is returned, or nil if there are no violations.
+func (m *RunJobRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on RunJobRequest with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// result is a list of violation errors wrapped in RunJobRequestMultiError, or
+// nil if none found.
+func (m *RunJobRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *RunJobRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if utf8.RuneCountInString(m.GetName()) < 1 {
+		err := RunJobRequestValidationError{
+			field:  "Name",
+			reason: "value length must be at least 1 runes",
+		}
+		if !all {
+			return err
+		}
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		return RunJobRequestMultiError(errors)
+	}
+	return nil
+}
+
+// RunJobRequestMultiError is an error wrapping multiple validation errors
+// returned by RunJobRequest.ValidateAll() if the designated constraints
+// aren't met.
+type RunJobRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m RunJobRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m RunJobRequestMultiError) AllErrors() []error { return m }
+
+// RunJobRequestValidationError is the validation error returned by
+// RunJobRequest.Validate if the designated constraints aren't met.
+type RunJobRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e RunJobRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e RunJobRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e RunJobRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e RunJobRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e RunJobRequestValidationError) ErrorName() string { return "RunJobRequestValidationError" }
+
+// Error satisfies the builtin error interface
+func (e RunJobRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sRunJobRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = RunJobRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = RunJobRequestValidationError{}
+
+// Validate checks the field values on RunJobResponse with the rules defined in
+// the proto definition for this message. If any rules are violated, the first
+// error encountered is returned, or nil if there are no violations.
+func (m *RunJobResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on RunJobResponse with the rules defined
+// in the proto definition for this message. If any rules are violated, the
+// result is a list of violation errors wrapped in RunJobResponseMultiError,
+// or nil if none found.
+func (m *RunJobResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *RunJobResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	if len(errors) > 0 {
+		return RunJobResponseMultiError(errors)
+	}
+	return nil
+}
+
+// RunJobResponseMultiError is an error wrapping multiple validation errors
+// returned by RunJobResponse.ValidateAll() if the designated constraints
+// aren't met.
+type RunJobResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m RunJobResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m RunJobResponseMultiError) AllErrors() []error { return m }
+
+// RunJobResponseValidationError is the validation error returned by
+// RunJobResponse.Validate if the designated constraints aren't met.
+type RunJobResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e RunJobResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e RunJobResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e RunJobResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e RunJobResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e RunJobResponseValidationError) ErrorName() string { return "RunJobResponseValidationError" }
+
+// Error satisfies the builtin error interface
+func (e RunJobResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sRunJobResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = RunJobResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = RunJobResponseValidationError{}
+
+// Validate checks the field values on DeadLetter with the rules defined in the
+// proto definition for this message. If any rules are violated, the first
+// error encountered is returned, or nil if there are no violations.
+func (m *DeadLetter) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on DeadLetter with the rules defined in
+// the proto definition for this message. If any rules are violated, the
+// result is a list of violation errors wrapped in DeadLetterMultiError, or
+// nil if none found.
+func (m *DeadLetter) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *DeadLetter) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Id
+
+	// no validation rules for WebhookId
+
+	// no validation rules for Change
+
+	// no validation rules for EventId
+
+	// no validation rules for Attempts
+
+	// no validation rules for Error
+
+	if all {
+		switch v := interface{}(m.GetFailedAt()).(type) {
+		case interface{ ValidateAll() error }:
+			if err := v.ValidateAll(); err != nil {
+				errors = append(errors, DeadLetterValidationError{
+					field:  "FailedAt",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		case interface{ Validate() error }:
+			if err := v.Validate(); err != nil {
+				errors = append(errors, DeadLetterValidationError{
+					field:  "FailedAt",
+					reason: "embedded message failed validation",
+					cause:  err,
+				})
+			}
+		}
+	} else if v, ok := interface{}(m.GetFailedAt()).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return DeadLetterValidationError{
+				field:  "FailedAt",
+				reason: "embedded message failed validation",
+				cause:  err,
+			}
+		}
+	}
+
+	// no validation rules for Payload
+
+	if len(errors) > 0 {
+		return DeadLetterMultiError(errors)
+	}
+	return nil
+}
+
+// DeadLetterMultiError is an error wrapping multiple validation errors
+// returned by DeadLetter.ValidateAll() if the designated constraints aren't met.
+type DeadLetterMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m DeadLetterMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m DeadLetterMultiError) AllErrors() []error { return m }
+
+// DeadLetterValidationError is the validation error returned by
+// DeadLetter.Validate if the designated constraints aren't met.
+type DeadLetterValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e DeadLetterValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e DeadLetterValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e DeadLetterValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e DeadLetterValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e DeadLetterValidationError) ErrorName() string { return "DeadLetterValidationError" }
+
+// Error satisfies the builtin error interface
+func (e DeadLetterValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sDeadLetter.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = DeadLetterValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = DeadLetterValidationError{}
+
+// Validate checks the field values on ListDeadLettersRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ListDeadLettersRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ListDeadLettersRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ListDeadLettersRequestMultiError, or nil if none found.
+func (m *ListDeadLettersRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ListDeadLettersRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for WebhookId
+
+	if len(errors) > 0 {
+		return ListDeadLettersRequestMultiError(errors)
+	}
+	return nil
+}
+
+// ListDeadLettersRequestMultiError is an error wrapping multiple validation
+// errors returned by ListDeadLettersRequest.ValidateAll() if the designated
+// constraints aren't met.
+type ListDeadLettersRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ListDeadLettersRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ListDeadLettersRequestMultiError) AllErrors() []error { return m }
+
+// ListDeadLettersRequestValidationError is the validation error returned by
+// ListDeadLettersRequest.Validate if the designated constraints aren't met.
+type ListDeadLettersRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ListDeadLettersRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ListDeadLettersRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ListDeadLettersRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ListDeadLettersRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ListDeadLettersRequestValidationError) ErrorName() string {
+	return "ListDeadLettersRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ListDeadLettersRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sListDeadLettersRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ListDeadLettersRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ListDeadLettersRequestValidationError{}
+
+// Validate checks the field values on ListDeadLettersResponse with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *ListDeadLettersResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on ListDeadLettersResponse with the
+// rules defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// ListDeadLettersResponseMultiError, or nil if none found.
+func (m *ListDeadLettersResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *ListDeadLettersResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	for idx, item := range m.GetDeadLetters() {
+		_, _ = idx, item
+
+		if all {
+			switch v := interface{}(item).(type) {
+			case interface{ ValidateAll() error }:
+				if err := v.ValidateAll(); err != nil {
+					errors = append(errors, ListDeadLettersResponseValidationError{
+						field:  fmt.Sprintf("DeadLetters[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			case interface{ Validate() error }:
+				if err := v.Validate(); err != nil {
+					errors = append(errors, ListDeadLettersResponseValidationError{
+						field:  fmt.Sprintf("DeadLetters[%v]", idx),
+						reason: "embedded message failed validation",
+						cause:  err,
+					})
+				}
+			}
+		} else if v, ok := interface{}(item).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return ListDeadLettersResponseValidationError{
+					field:  fmt.Sprintf("DeadLetters[%v]", idx),
+					reason: "embedded message failed validation",
+					cause:  err,
+				}
+			}
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return ListDeadLettersResponseMultiError(errors)
+	}
+	return nil
+}
+
+// ListDeadLettersResponseMultiError is an error wrapping multiple validation
+// errors returned by ListDeadLettersResponse.ValidateAll() if the designated
+// constraints aren't met.
+type ListDeadLettersResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m ListDeadLettersResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m ListDeadLettersResponseMultiError) AllErrors() []error { return m }
+
+// ListDeadLettersResponseValidationError is the validation error returned by
+// ListDeadLettersResponse.Validate if the designated constraints aren't met.
+type ListDeadLettersResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e ListDeadLettersResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e ListDeadLettersResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e ListDeadLettersResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e ListDeadLettersResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e ListDeadLettersResponseValidationError) ErrorName() string {
+	return "ListDeadLettersResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e ListDeadLettersResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sListDeadLettersResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = ListDeadLettersResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = ListDeadLettersResponseValidationError{}
+
+// Validate checks the field values on RedriveDeadLettersRequest with the rules
+// defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *RedriveDeadLettersRequest) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on RedriveDeadLettersRequest with the
+// rules defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// RedriveDeadLettersRequestMultiError, or nil if none found.
+func (m *RedriveDeadLettersRequest) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *RedriveDeadLettersRequest) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for WebhookId
+
+	for idx, item := range m.GetIds() {
+		_, _ = idx, item
+
+		if utf8.RuneCountInString(item) < 1 {
+			err := RedriveDeadLettersRequestValidationError{
+				field:  fmt.Sprintf("Ids[%v]", idx),
+				reason: "value length must be at least 1 runes",
+			}
+			if !all {
+				return err
+			}
+			errors = append(errors, err)
+		}
+
+	}
+
+	if len(errors) > 0 {
+		return RedriveDeadLettersRequestMultiError(errors)
+	}
+	return nil
+}
+
+// RedriveDeadLettersRequestMultiError is an error wrapping multiple validation
+// errors returned by RedriveDeadLettersRequest.ValidateAll() if the
+// designated constraints aren't met.
+type RedriveDeadLettersRequestMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m RedriveDeadLettersRequestMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m RedriveDeadLettersRequestMultiError) AllErrors() []error { return m }
+
+// RedriveDeadLettersRequestValidationError is the validation error returned by
+// RedriveDeadLettersRequest.Validate if the designated constraints aren't met.
+type RedriveDeadLettersRequestValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e RedriveDeadLettersRequestValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e RedriveDeadLettersRequestValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e RedriveDeadLettersRequestValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e RedriveDeadLettersRequestValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e RedriveDeadLettersRequestValidationError) ErrorName() string {
+	return "RedriveDeadLettersRequestValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e RedriveDeadLettersRequestValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sRedriveDeadLettersRequest.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = RedriveDeadLettersRequestValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = RedriveDeadLettersRequestValidationError{}
+
+// Validate checks the field values on RedriveDeadLettersResponse with the
+// rules defined in the proto definition for this message. If any rules are
+// violated, the first error encountered is returned, or nil if there are no violations.
+func (m *RedriveDeadLettersResponse) Validate() error {
+	return m.validate(false)
+}
+
+// ValidateAll checks the field values on RedriveDeadLettersResponse with the
+// rules defined in the proto definition for this message. If any rules are
+// violated, the result is a list of violation errors wrapped in
+// RedriveDeadLettersResponseMultiError, or nil if none found.
+func (m *RedriveDeadLettersResponse) ValidateAll() error {
+	return m.validate(true)
+}
+
+func (m *RedriveDeadLettersResponse) validate(all bool) error {
+	if m == nil {
+		return nil
+	}
+
+	var errors []error
+
+	// no validation rules for Redriven
+
+	if len(errors) > 0 {
+		return RedriveDeadLettersResponseMultiError(errors)
+	}
+	return nil
+}
+
+// RedriveDeadLettersResponseMultiError is an error wrapping multiple
+// validation errors returned by RedriveDeadLettersResponse.ValidateAll() if
+// the designated constraints aren't met.
+type RedriveDeadLettersResponseMultiError []error
+
+// Error returns a concatenation of all the error messages it wraps.
+func (m RedriveDeadLettersResponseMultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AllErrors returns a list of validation violation errors.
+func (m RedriveDeadLettersResponseMultiError) AllErrors() []error { return m }
+
+// RedriveDeadLettersResponseValidationError is the validation error returned
+// by RedriveDeadLettersResponse.Validate if the designated constraints aren't met.
+type RedriveDeadLettersResponseValidationError struct {
+	field  string
+	reason string
+	cause  error
+	key    bool
+}
+
+// Field function returns field value.
+func (e RedriveDeadLettersResponseValidationError) Field() string { return e.field }
+
+// Reason function returns reason value.
+func (e RedriveDeadLettersResponseValidationError) Reason() string { return e.reason }
+
+// Cause function returns cause value.
+func (e RedriveDeadLettersResponseValidationError) Cause() error { return e.cause }
+
+// Key function returns key value.
+func (e RedriveDeadLettersResponseValidationError) Key() bool { return e.key }
+
+// ErrorName returns error name.
+func (e RedriveDeadLettersResponseValidationError) ErrorName() string {
+	return "RedriveDeadLettersResponseValidationError"
+}
+
+// Error satisfies the builtin error interface
+func (e RedriveDeadLettersResponseValidationError) Error() string {
+	cause := ""
+	if e.cause != nil {
+		cause = fmt.Sprintf(" | caused by: %v", e.cause)
+	}
+
+	key := ""
+	if e.key {
+		key = "key for "
+	}
+
+	return fmt.Sprintf(
+		"invalid %sRedriveDeadLettersResponse.%s: %s%s",
+		key,
+		e.field,
+		e.reason,
+		cause)
+}
+
+var _ error = RedriveDeadLettersResponseValidationError{}
+
+var _ interface {
+	Field() string
+	Reason() string
+	Key() bool
+	Cause() error
+	ErrorName() string
+} = RedriveDeadLettersResponseValidationError{}
@@ -0,0 +1,240 @@
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Application interface {
+	ListCalendars(ctx context.Context) ([]storage.Calendar, error)
+
+	CreateEvent(ctx context.Context, e storage.Event) (storage.Event, error)
+	UpdateEvent(ctx context.Context, e storage.Event) (storage.Event, error)
+	DeleteEvent(ctx context.Context, eventID string) error
+	GetEvent(ctx context.Context, eventID string) (storage.Event, error)
+	ListDayEvents(ctx context.Context, date time.Time, tags ...string) ([]storage.Event, error)
+	ListWeekEvents(ctx context.Context, date time.Time, tags ...string) ([]storage.Event, error)
+	ListMonthEvents(ctx context.Context, monthStart time.Time, tags ...string) ([]storage.Event, error)
+
+	ApplyEvents(ctx context.Context, ops []storage.EventOp, atomic bool) ([]app.BatchResult, error)
+
+	FindSlots(ctx context.Context, req app.SlotRequest) ([]app.Slot, error)
+
+	RunJob(ctx context.Context, name string) error
+	ListWebhookDeadLetters(ctx context.Context, webhookID string) ([]storage.WebhookMessage, error)
+	RedriveWebhookDeadLetters(ctx context.Context, webhookID string, messageIDs []string) (int, error)
+}
+
+// Server serves the EventService and the AdminService of api/EventService.proto.
+type Server struct {
+	pb.UnimplementedEventServiceServer
+	pb.UnimplementedAdminServiceServer
+
+	app    Application
+	addr   string
+	server *grpc.Server
+}
+
+func NewServer(logger Logger, app Application, authenticator auth.Authenticator, addr string) *Server {
+	s := &Server{app: app, addr: addr, server: grpc.NewServer(ServerOptions(logger, authenticator)...)}
+	pb.RegisterEventServiceServer(s.server, s)
+	pb.RegisterAdminServiceServer(s.server, s)
+	return s
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(lis)
+}
+
+// Stop waits for the calls in flight until the context is done, then closes the connections.
+func (s *Server) Stop(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) ListCalendars(ctx context.Context, _ *pb.ListCalendarsRequest) (*pb.ListCalendarsResponse, error) {
+	calendars, err := s.app.ListCalendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListCalendarsResponse{Calendars: make([]*pb.Calendar, 0, len(calendars))}
+	for _, cal := range calendars {
+		resp.Calendars = append(resp.Calendars, &pb.Calendar{Id: cal.ID, OwnerId: cal.OwnerID, Name: cal.Name})
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateEvent(ctx context.Context, req *pb.CreateEventRequest) (*pb.Event, error) {
+	e, err := s.app.CreateEvent(ctx, eventFromPB(req.Event))
+	if err != nil {
+		return nil, err
+	}
+	return eventToPB(e), nil
+}
+
+func (s *Server) UpdateEvent(ctx context.Context, req *pb.UpdateEventRequest) (*pb.Event, error) {
+	e, err := s.app.UpdateEvent(ctx, eventFromPB(req.Event))
+	if err != nil {
+		return nil, err
+	}
+	return eventToPB(e), nil
+}
+
+func (s *Server) DeleteEvent(ctx context.Context, req *pb.DeleteEventRequest) (*pb.DeleteEventResponse, error) {
+	if err := s.app.DeleteEvent(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteEventResponse{}, nil
+}
+
+func (s *Server) GetEvent(ctx context.Context, req *pb.GetEventRequest) (*pb.Event, error) {
+	e, err := s.app.GetEvent(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return eventToPB(e), nil
+}
+
+func (s *Server) ListEvents(ctx context.Context, req *pb.ListEventsRequest) (*pb.ListEventsResponse, error) {
+	var list func(ctx context.Context, date time.Time, tags ...string) ([]storage.Event, error)
+	switch req.Period {
+	case pb.Period_PERIOD_DAY:
+		list = s.app.ListDayEvents
+	case pb.Period_PERIOD_WEEK:
+		list = s.app.ListWeekEvents
+	case pb.Period_PERIOD_MONTH:
+		list = s.app.ListMonthEvents
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown period %s", req.Period)
+	}
+	events, err := list(ctx, req.Date.AsTime(), req.Tags...)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListEventsResponse{Events: eventsToPB(events)}, nil
+}
+
+func (s *Server) ApplyEvents(stream pb.EventService_ApplyEventsServer) error {
+	var (
+		ops    []storage.EventOp
+		atomic bool
+	)
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(ops) == 0 {
+			atomic = req.Atomic
+		}
+		if len(ops) == app.MaxBatchSize {
+			return status.Errorf(codes.InvalidArgument, "more than %d operations", app.MaxBatchSize)
+		}
+		ops = append(ops, storage.EventOp{Change: changes[req.Change], Event: eventFromPB(req.Event)})
+	}
+
+	results, err := s.app.ApplyEvents(stream.Context(), ops, atomic)
+	if err != nil {
+		return err
+	}
+	resp := &pb.ApplyEventsResponse{Results: make([]*pb.ApplyEventsResult, 0, len(results))}
+	for _, res := range results {
+		if res.Err != nil {
+			st := status.Convert(Status(res.Err))
+			resp.Results = append(resp.Results, &pb.ApplyEventsResult{Code: int32(st.Code()), Error: st.Message()})
+			continue
+		}
+		resp.Results = append(resp.Results, &pb.ApplyEventsResult{Code: int32(codes.OK), Event: eventToPB(res.Event)})
+	}
+	return stream.SendAndClose(resp)
+}
+
+func (s *Server) FindSlots(ctx context.Context, req *pb.FindSlotsRequest) (*pb.FindSlotsResponse, error) {
+	slots, err := s.app.FindSlots(ctx, app.SlotRequest{
+		UserIDs:  req.UserIds,
+		Duration: req.Duration.AsDuration(),
+		From:     req.From.AsTime(),
+		To:       req.To.AsTime(),
+		Limit:    int(req.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.FindSlotsResponse{Slots: make([]*pb.Slot, 0, len(slots))}
+	for _, slot := range slots {
+		resp.Slots = append(resp.Slots, &pb.Slot{
+			Start: timestamppb.New(slot.Start),
+			End:   timestamppb.New(slot.End),
+			Score: durationpb.New(slot.Score),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) RunJob(ctx context.Context, req *pb.RunJobRequest) (*pb.RunJobResponse, error) {
+	if err := s.app.RunJob(ctx, req.Name); err != nil {
+		return nil, err
+	}
+	return &pb.RunJobResponse{}, nil
+}
+
+func (s *Server) ListDeadLetters(ctx context.Context, req *pb.ListDeadLettersRequest) (*pb.ListDeadLettersResponse, error) {
+	dead, err := s.app.ListWebhookDeadLetters(ctx, req.WebhookId)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.ListDeadLettersResponse{DeadLetters: make([]*pb.DeadLetter, 0, len(dead))}
+	for _, m := range dead {
+		resp.DeadLetters = append(resp.DeadLetters, &pb.DeadLetter{
+			Id:        m.ID,
+			WebhookId: m.WebhookID,
+			Change:    string(m.Change),
+			EventId:   m.EventID,
+			Attempts:  int32(m.Attempts),
+			Error:     m.LastError,
+			FailedAt:  timestamppb.New(m.UpdatedAt),
+			Payload:   string(m.Body),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) RedriveDeadLetters(
+	ctx context.Context, req *pb.RedriveDeadLettersRequest,
+) (*pb.RedriveDeadLettersResponse, error) {
+	redriven, err := s.app.RedriveWebhookDeadLetters(ctx, req.WebhookId, req.Ids)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RedriveDeadLettersResponse{Redriven: int32(redriven)}, nil
+}
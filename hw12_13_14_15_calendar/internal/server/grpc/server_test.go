@@ -0,0 +1,293 @@
+package internalgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// serve starts the server on an in-memory listener and returns a client connected to it.
+func serve(t *testing.T, calendar Application) pb.EventServiceClient {
+	t.Helper()
+	return pb.NewEventServiceClient(dial(t, calendar))
+}
+
+func dial(t *testing.T, calendar Application) *grpc.ClientConn {
+	t.Helper()
+
+	s := NewServer(&testLogger{}, calendar, auth.NewTrustedHeader(""), "")
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = s.server.Serve(lis) }()
+	t.Cleanup(func() { require.NoError(t, s.Stop(context.Background())) })
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func asUser(user string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-user-id", user)
+}
+
+func TestServer(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	cal, err := calendar.CreateCalendar(auth.WithUserID(context.Background(), "alice"), "Work")
+	require.NoError(t, err)
+	client := serve(t, calendar)
+	ctx := asUser("alice")
+
+	_, err = client.ListCalendars(context.Background(), &pb.ListCalendarsRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	calendars, err := client.ListCalendars(ctx, &pb.ListCalendarsRequest{})
+	require.NoError(t, err)
+	require.Len(t, calendars.Calendars, 1)
+	require.Equal(t, cal.ID, calendars.Calendars[0].Id)
+
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	standup := &pb.Event{
+		CalendarId: cal.ID,
+		Title:      "standup",
+		StartAt:    timestamppb.New(start),
+		EndAt:      timestamppb.New(start.Add(15 * time.Minute)),
+		Reminders:  []*pb.Reminder{{Before: durationpb.New(10 * time.Minute), Channel: "log"}},
+		Tags:       []string{"team"},
+	}
+	created, err := client.CreateEvent(ctx, &pb.CreateEventRequest{Event: standup})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.Id)
+	require.Equal(t, "alice", created.OwnerId)
+	require.Len(t, created.Reminders, 1)
+	require.NotEmpty(t, created.Reminders[0].Id)
+
+	// The validation rules of the proto are checked before the application is called.
+	_, err = client.CreateEvent(ctx, &pb.CreateEventRequest{Event: &pb.Event{CalendarId: cal.ID, Title: "no time"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.ListEvents(ctx, &pb.ListEventsRequest{Date: timestamppb.New(start)})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	created.Title = "daily standup"
+	updated, err := client.UpdateEvent(ctx, &pb.UpdateEventRequest{Event: created})
+	require.NoError(t, err)
+	require.Equal(t, "daily standup", updated.Title)
+
+	events, err := client.ListEvents(ctx, &pb.ListEventsRequest{Period: pb.Period_PERIOD_WEEK, Date: timestamppb.New(start)})
+	require.NoError(t, err)
+	require.Len(t, events.Events, 1)
+	require.True(t, start.Equal(events.Events[0].StartAt.AsTime()))
+
+	// Other users and tenants don't see the event.
+	_, err = client.GetEvent(asUser("bob"), &pb.GetEventRequest{Id: created.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	acme := metadata.AppendToOutgoingContext(ctx, "x-tenant-id", "acme")
+	_, err = client.GetEvent(acme, &pb.GetEventRequest{Id: created.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.DeleteEvent(ctx, &pb.DeleteEventRequest{Id: created.Id})
+	require.NoError(t, err)
+	_, err = client.GetEvent(ctx, &pb.GetEventRequest{Id: created.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	trash, err := calendar.ListTrash(auth.WithUserID(context.Background(), "alice"))
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	entries, err := calendar.ListAudit(auth.WithUserID(context.Background(), "alice"), storage.AuditFilter{EventID: created.Id})
+	require.NoError(t, err)
+	require.Equal(t, app.TransportGRPC, entries[0].Transport)
+}
+
+func TestFindSlots(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	bob := auth.WithUserID(context.Background(), "bob")
+	cal, err := calendar.CreateCalendar(bob, "Work")
+	require.NoError(t, err)
+	_, err = calendar.SetWorkingHours(bob, storage.WorkingHours{
+		TimeZone: "Europe/Moscow", Start: 12 * time.Hour, End: 14 * time.Hour, Days: []time.Weekday{time.Monday},
+	})
+	require.NoError(t, err)
+	client := serve(t, calendar)
+
+	monday := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	req := &pb.FindSlotsRequest{
+		UserIds:  []string{"bob"},
+		Duration: durationpb.New(time.Hour),
+		From:     timestamppb.New(monday),
+		To:       timestamppb.New(monday.AddDate(0, 0, 1)),
+	}
+	_, err = client.FindSlots(asUser("alice"), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	require.NoError(t, calendar.ShareCalendar(bob, cal.ID, "alice", storage.AccessFreeBusy))
+	resp, err := client.FindSlots(asUser("alice"), req)
+	require.NoError(t, err)
+	// Bob works 09:00-11:00 UTC, the slot in the middle is the best.
+	require.Len(t, resp.Slots, 5)
+	require.Equal(t, monday.Add(9*time.Hour+30*time.Minute), resp.Slots[0].Start.AsTime())
+	require.Equal(t, 30*time.Minute, resp.Slots[0].Score.AsDuration())
+
+	req.Duration = nil
+	_, err = client.FindSlots(asUser("alice"), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestApplyEvents(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	cal, err := calendar.CreateCalendar(auth.WithUserID(context.Background(), "alice"), "Work")
+	require.NoError(t, err)
+	client := serve(t, calendar)
+
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	event := func(title string) *pb.Event {
+		return &pb.Event{CalendarId: cal.ID, Title: title, StartAt: timestamppb.New(start), EndAt: timestamppb.New(start.Add(time.Hour))}
+	}
+	apply := func(atomic bool, reqs ...*pb.ApplyEventsRequest) *pb.ApplyEventsResponse {
+		stream, err := client.ApplyEvents(asUser("alice"))
+		require.NoError(t, err)
+		for i, req := range reqs {
+			req.Atomic = atomic && i == 0
+			require.NoError(t, stream.Send(req))
+		}
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		return resp
+	}
+
+	// The failed operation of an atomic batch fails the others.
+	resp := apply(true,
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_CREATE, Event: event("standup")},
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_DELETE, Event: &pb.Event{Id: "missing"}},
+	)
+	require.Len(t, resp.Results, 2)
+	require.Equal(t, int32(codes.FailedPrecondition), resp.Results[0].Code)
+	require.Equal(t, int32(codes.NotFound), resp.Results[1].Code)
+	events, err := calendar.ListDayEvents(auth.WithUserID(context.Background(), "alice"), start)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// A best-effort batch applies the operations which succeed.
+	resp = apply(false,
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_CREATE, Event: event("standup")},
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_CREATE, Event: &pb.Event{CalendarId: cal.ID, Title: "no time"}},
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_DELETE, Event: &pb.Event{Id: "missing"}},
+	)
+	require.Len(t, resp.Results, 3)
+	require.Equal(t, int32(codes.OK), resp.Results[0].Code)
+	require.Equal(t, "standup", resp.Results[0].Event.Title)
+	require.Equal(t, int32(codes.InvalidArgument), resp.Results[1].Code)
+	require.Equal(t, int32(codes.NotFound), resp.Results[2].Code)
+
+	created := resp.Results[0].Event
+	created.Title = "daily standup"
+	resp = apply(true,
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_UPDATE, Event: created},
+		&pb.ApplyEventsRequest{Change: pb.Change_CHANGE_DELETE, Event: &pb.Event{Id: created.Id}},
+	)
+	require.Equal(t, int32(codes.OK), resp.Results[0].Code)
+	require.Equal(t, int32(codes.OK), resp.Results[1].Code)
+
+	// Every message is validated, an invalid one fails the call.
+	stream, err := client.ApplyEvents(asUser("alice"))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.ApplyEventsRequest{Event: event("standup")}))
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRunJob(t *testing.T) {
+	runs := make(chan struct{}, 1)
+	jobs := scheduler.New(&testLogger{}, scheduler.Job{Name: "webhook retry", Run: func(context.Context) error {
+		runs <- struct{}{}
+		return nil
+	}})
+	calendar := app.New(nil, memorystorage.New(), nil)
+	calendar.SetScheduler(jobs)
+	client := pb.NewAdminServiceClient(dial(t, calendar))
+	ctx := asUser("alice")
+
+	// The jobs run only on the leader.
+	_, err := client.RunJob(ctx, &pb.RunJobRequest{Name: "webhook retry"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	jobsCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.Run(jobsCtx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	require.Eventually(t, func() bool {
+		_, err := client.RunJob(ctx, &pb.RunJobRequest{Name: "webhook retry"})
+		return err == nil
+	}, time.Second, time.Millisecond)
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("job has not run")
+	}
+
+	_, err = client.RunJob(ctx, &pb.RunJobRequest{Name: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.RunJob(ctx, &pb.RunJobRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.RunJob(context.Background(), &pb.RunJobRequest{Name: "webhook retry"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestDeadLetters(t *testing.T) {
+	s := memorystorage.New()
+	calendar := app.New(nil, s, nil)
+	alice := auth.WithUserID(context.Background(), "alice")
+	w, err := calendar.CreateWebhook(alice, "https://example.com/hook")
+	require.NoError(t, err)
+	failedAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.SaveWebhookMessage(alice, storage.WebhookMessage{
+		ID: "d1", WebhookID: w.ID, Change: storage.ChangeCreated, EventID: "e1", Body: []byte(`{"id":"d1"}`),
+		Attempts: 5, LastError: "unexpected status 500", UpdatedAt: failedAt, Dead: true,
+	}))
+	client := pb.NewAdminServiceClient(dial(t, calendar))
+
+	resp, err := client.ListDeadLetters(asUser("alice"), &pb.ListDeadLettersRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.DeadLetters, 1)
+	dead := resp.DeadLetters[0]
+	require.Equal(t, w.ID, dead.WebhookId)
+	require.Equal(t, int32(5), dead.Attempts)
+	require.Equal(t, `{"id":"d1"}`, dead.Payload)
+	require.Equal(t, failedAt, dead.FailedAt.AsTime())
+
+	_, err = client.ListDeadLetters(asUser("bob"), &pb.ListDeadLettersRequest{WebhookId: w.ID})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	redriven, err := client.RedriveDeadLetters(asUser("bob"), &pb.RedriveDeadLettersRequest{})
+	require.NoError(t, err)
+	require.Zero(t, redriven.Redriven)
+
+	redriven, err = client.RedriveDeadLetters(asUser("alice"), &pb.RedriveDeadLettersRequest{WebhookId: w.ID, Ids: []string{"d1"}})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), redriven.Redriven)
+	resp, err = client.ListDeadLetters(asUser("alice"), &pb.ListDeadLettersRequest{})
+	require.NoError(t, err)
+	require.Empty(t, resp.DeadLetters)
+}
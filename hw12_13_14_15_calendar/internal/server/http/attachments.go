@@ -0,0 +1,87 @@
+package internalhttp
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// attachments handles GET /events/{id}/attachments and POST /events/{id}/attachments?name=agenda.pdf
+// with the file as the body and its Content-Type.
+func (h *handler) attachments(w http.ResponseWriter, r *http.Request, eventID string) {
+	switch r.Method {
+	case http.MethodGet:
+		e, err := h.app.GetEvent(r.Context(), eventID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		dtos := newAttachmentDTOs(e.Attachments)
+		if dtos == nil {
+			dtos = []attachmentDTO{}
+		}
+		writeJSON(w, http.StatusOK, dtos)
+	case http.MethodPost:
+		att, err := h.app.AddAttachment(r.Context(), eventID, r.URL.Query().Get("name"), r.Header.Get("Content-Type"), r.Body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newAttachmentDTO(att))
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// attachment handles GET and DELETE /events/{id}/attachments/{attachment id},
+// GET of a link redirects to it.
+func (h *handler) attachment(w http.ResponseWriter, r *http.Request, eventID, attachmentID string) {
+	switch r.Method {
+	case http.MethodGet:
+		att, body, err := h.app.OpenAttachment(r.Context(), eventID, attachmentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if att.Link() {
+			http.Redirect(w, r, att.URL, http.StatusSeeOther)
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", att.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Name}))
+		// Uploaded files must not be rendered as something else, e.g. HTML.
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		_, _ = io.Copy(w, body)
+	case http.MethodDelete:
+		if err := h.app.DeleteAttachment(r.Context(), eventID, attachmentID); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+type linkDTO struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// addLink handles POST /events/{id}/links.
+func (h *handler) addLink(w http.ResponseWriter, r *http.Request, eventID string) {
+	var req linkDTO
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	att, err := h.app.AddLink(r.Context(), eventID, req.Name, req.URL)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newAttachmentDTO(att))
+}
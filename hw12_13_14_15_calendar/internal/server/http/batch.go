@@ -0,0 +1,46 @@
+package internalhttp
+
+import (
+	"net/http"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// batch handles POST /events/batch, the response keeps the order of the operations.
+func (h *handler) batch(w http.ResponseWriter, r *http.Request) {
+	var req batchDTO
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	ops := make([]storage.EventOp, 0, len(req.Operations))
+	for _, o := range req.Operations {
+		ops = append(ops, o.op())
+	}
+
+	results, err := h.app.ApplyEvents(r.Context(), ops, req.Atomic)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dtos := make([]batchResultDTO, 0, len(results))
+	for i, res := range results {
+		if res.Err != nil {
+			status := errorStatus(res.Err)
+			dtos = append(dtos, batchResultDTO{Status: status, Error: errorMessage(status, res.Err)})
+			continue
+		}
+		dto := batchResultDTO{Status: http.StatusOK}
+		switch ops[i].Change {
+		case storage.ChangeCreated:
+			dto.Status = http.StatusCreated
+		case storage.ChangeDeleted:
+			dto.Status = http.StatusNoContent
+		}
+		e := newEventDTO(res.Event)
+		dto.Event = &e
+		dtos = append(dtos, dto)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": dtos})
+}
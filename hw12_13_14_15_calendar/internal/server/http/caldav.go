@@ -0,0 +1,598 @@
+package internalhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ical"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// CalDAV (RFC 4791) subset: the principal and the calendar home are /dav/ and /dav/calendars/,
+// calendars are /dav/calendars/{calendar}/ and events are /dav/calendars/{calendar}/{event}.ics.
+const (
+	davPrefix    = "/dav/"
+	davHome      = "/dav/calendars/"
+	icsExtension = ".ics"
+
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+
+	maxICSSize = 1 << 20
+)
+
+var (
+	davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+	propResourceType       = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName        = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentPrincipal   = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL       = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propETag               = xml.Name{Space: nsDAV, Local: "getetag"}
+	propContentType        = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propCalendarHome       = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propCalendarData       = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propSupportedComponent = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCTag               = xml.Name{Space: nsCS, Local: "getctag"}
+
+	// The whole range of events for listings without a time range.
+	davFrom = time.Time{}
+	davTo   = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// davProps maps property names to their XML values.
+type davProps map[xml.Name]string
+
+type davResponse struct {
+	href     string
+	props    davProps
+	notFound []xml.Name
+	// status is set for a response without properties, e.g. a missing resource of multiget.
+	status int
+}
+
+// propRequest lists the requested properties, all of them if it is empty.
+type propRequest struct {
+	Props []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (r *propRequest) names() []xml.Name {
+	if r == nil {
+		return nil
+	}
+	names := make([]xml.Name, 0, len(r.Props))
+	for _, p := range r.Props {
+		names = append(names, p.XMLName)
+	}
+	return names
+}
+
+type propfindRequest struct {
+	XMLName xml.Name     `xml:"DAV: propfind"`
+	Prop    *propRequest `xml:"DAV: prop"`
+}
+
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *propRequest `xml:"DAV: prop"`
+	Hrefs   []string     `xml:"DAV: href"`
+	Filter  *struct {
+		CompFilter compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	TimeRange   *struct {
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+}
+
+// timeRange returns the time range of the VEVENT filter, the whole range if there is none.
+func (f compFilter) timeRange() (time.Time, time.Time, error) {
+	from, to := davFrom, davTo
+	for _, event := range f.CompFilters {
+		if event.Name != "VEVENT" || event.TimeRange == nil {
+			continue
+		}
+		var err error
+		if event.TimeRange.Start != "" {
+			if from, err = time.Parse("20060102T150405Z", event.TimeRange.Start); err != nil {
+				return from, to, fmt.Errorf("%w: invalid time-range start", errBadRequest)
+			}
+		}
+		if event.TimeRange.End != "" {
+			if to, err = time.Parse("20060102T150405Z", event.TimeRange.End); err != nil {
+				return from, to, fmt.Errorf("%w: invalid time-range end", errBadRequest)
+			}
+		}
+	}
+	return from, to, nil
+}
+
+// davPath splits the path after /dav/calendars/ into the calendar ID and the event UID.
+func davPath(path string) (calendarID, uid string, ok bool) {
+	parts := pathParts(path, strings.TrimSuffix(davHome, "/"))
+	switch {
+	case len(parts) == 1:
+		return parts[0], "", true
+	case len(parts) == 2 && strings.HasSuffix(parts[1], icsExtension):
+		return parts[0], strings.TrimSuffix(parts[1], icsExtension), true
+	default:
+		return "", "", false
+	}
+}
+
+func (h *handler) wellKnownCalDAV(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, davPrefix, http.StatusMovedPermanently)
+}
+
+func (h *handler) dav(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == davPrefix || path == strings.TrimSuffix(davPrefix, "/"):
+		h.davRoot(w, r)
+	case path == davHome || path == strings.TrimSuffix(davHome, "/"):
+		h.davHome(w, r)
+	case strings.HasPrefix(path, davHome):
+		calendarID, uid, ok := davPath(path)
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case uid == "":
+			h.davCalendar(w, r, calendarID)
+		default:
+			h.davEvent(w, r, calendarID, uid)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *handler) davRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" {
+		methodNotAllowed(w)
+		return
+	}
+	requested, err := propfindProps(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	userID, _ := auth.UserID(r.Context())
+	writeMultistatus(w, []davResponse{selectProps(davPrefix, davProps{
+		propResourceType:     `<d:collection/><d:principal/>`,
+		propDisplayName:      xmlEscape(userID),
+		propCurrentPrincipal: xmlHref(davPrefix),
+		propPrincipalURL:     xmlHref(davPrefix),
+		propCalendarHome:     xmlHref(davHome),
+	}, requested)})
+}
+
+func (h *handler) davHome(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" {
+		methodNotAllowed(w)
+		return
+	}
+	requested, err := propfindProps(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	responses := []davResponse{selectProps(davHome, davProps{
+		propResourceType:     `<d:collection/>`,
+		propCurrentPrincipal: xmlHref(davPrefix),
+	}, requested)}
+	if r.Header.Get("Depth") != "0" {
+		calendars, err := h.app.ListCalendars(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, cal := range calendars {
+			props, err := h.calendarProps(r, cal)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			responses = append(responses, selectProps(davHome+cal.ID+"/", props, requested))
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+func (h *handler) findCalendar(r *http.Request, calendarID string) (storage.Calendar, error) {
+	calendars, err := h.app.ListCalendars(r.Context())
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+	for _, cal := range calendars {
+		if cal.ID == calendarID {
+			return cal, nil
+		}
+	}
+	return storage.Calendar{}, storage.ErrCalendarNotFound
+}
+
+func (h *handler) calendarProps(r *http.Request, cal storage.Calendar) (davProps, error) {
+	events, err := h.app.ListCalendarEvents(r.Context(), cal.ID, davFrom, davTo)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(events))
+	for _, e := range events {
+		tags = append(tags, e.ID+eventETag(e))
+	}
+	sort.Strings(tags)
+
+	return davProps{
+		propResourceType:       `<d:collection/><c:calendar/>`,
+		propDisplayName:        xmlEscape(cal.Name),
+		propCurrentPrincipal:   xmlHref(davPrefix),
+		propSupportedComponent: `<c:comp name="VEVENT"/>`,
+		propCTag:               xmlEscape(etag(strings.Join(tags, ","))),
+	}, nil
+}
+
+func (h *handler) davCalendar(w http.ResponseWriter, r *http.Request, calendarID string) {
+	switch r.Method {
+	case "PROPFIND":
+		requested, err := propfindProps(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		cal, err := h.findCalendar(r, calendarID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		props, err := h.calendarProps(r, cal)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		responses := []davResponse{selectProps(davHome+cal.ID+"/", props, requested)}
+		if r.Header.Get("Depth") != "0" {
+			events, err := h.app.ListCalendarEvents(r.Context(), calendarID, davFrom, davTo)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			for _, e := range events {
+				props, err := eventProps(e, false)
+				if err != nil {
+					writeError(w, err)
+					return
+				}
+				responses = append(responses, selectProps(eventHref(e), props, requested))
+			}
+		}
+		writeMultistatus(w, responses)
+	case "REPORT":
+		h.davReport(w, r, calendarID)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *handler) davReport(w http.ResponseWriter, r *http.Request, calendarID string) {
+	var req reportRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errBadRequest, err)) //nolint:errorlint
+		return
+	}
+	requested := req.Prop.names()
+
+	var responses []davResponse
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		from, to := davFrom, davTo
+		if req.Filter != nil {
+			var err error
+			if from, to, err = req.Filter.CompFilter.timeRange(); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		events, err := h.app.ListCalendarEvents(r.Context(), calendarID, from, to)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, e := range events {
+			props, err := eventProps(e, true)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			responses = append(responses, selectProps(eventHref(e), props, requested))
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			hrefCalendar, uid, ok := davPath(href)
+			if !ok || uid == "" || hrefCalendar != calendarID {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			e, err := h.app.GetEventByUID(r.Context(), calendarID, uid)
+			if err != nil {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			props, err := eventProps(e, true)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			responses = append(responses, selectProps(href, props, requested))
+		}
+	default:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "unsupported report"})
+		return
+	}
+	writeMultistatus(w, responses)
+}
+
+// davEvent serves the event resource, it is named after the iCalendar UID of the event.
+func (h *handler) davEvent(w http.ResponseWriter, r *http.Request, calendarID, uid string) {
+	switch r.Method {
+	case http.MethodGet, "PROPFIND":
+		e, err := h.app.GetEventByUID(r.Context(), calendarID, uid)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", ical.ContentType)
+			w.Header().Set("ETag", eventETag(e))
+			_ = ical.Encode(w, []storage.Event{e})
+			return
+		}
+		requested, err := propfindProps(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		props, err := eventProps(e, false)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeMultistatus(w, []davResponse{selectProps(eventHref(e), props, requested)})
+	case http.MethodPut:
+		h.davPut(w, r, calendarID, uid)
+	case http.MethodDelete:
+		e, err := h.app.GetEventByUID(r.Context(), calendarID, uid)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := h.checkPrecondition(r, calendarID, uid); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := h.app.DeleteEvent(r.Context(), e.ID); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+// checkPrecondition compares the event with If-Match and If-None-Match headers.
+func (h *handler) checkPrecondition(r *http.Request, calendarID, uid string) error {
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+	e, err := h.app.GetEventByUID(r.Context(), calendarID, uid)
+	exists := err == nil
+	if err != nil && !errors.Is(err, storage.ErrEventNotFound) {
+		return err
+	}
+	switch {
+	case ifNoneMatch == "*" && exists,
+		ifMatch == "*" && !exists,
+		ifMatch != "" && ifMatch != "*" && (!exists || ifMatch != eventETag(e)):
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+func (h *handler) davPut(w http.ResponseWriter, r *http.Request, calendarID, uid string) {
+	if err := h.checkPrecondition(r, calendarID, uid); err != nil {
+		writeError(w, err)
+		return
+	}
+	events, err := ical.Decode(io.LimitReader(r.Body, maxICSSize))
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errBadRequest, err)) //nolint:errorlint
+		return
+	}
+	if len(events) != 1 {
+		writeError(w, fmt.Errorf("%w: exactly one VEVENT is expected", errBadRequest))
+		return
+	}
+	e := events[0]
+	if e.UID != "" && e.UID != uid {
+		writeError(w, fmt.Errorf("%w: UID must match the resource name", errBadRequest))
+		return
+	}
+	e.UID = uid
+	e.CalendarID = calendarID
+
+	e, created, err := h.app.PutEvent(r.Context(), e)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", eventETag(e))
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func eventHref(e storage.Event) string {
+	return davHome + e.CalendarID + "/" + e.ICalUID() + icsExtension
+}
+
+func eventProps(e storage.Event, withData bool) (davProps, error) {
+	props := davProps{
+		propResourceType: "",
+		propETag:         xmlEscape(eventETag(e)),
+		propContentType:  xmlEscape(ical.ContentType),
+	}
+	if withData {
+		var buf bytes.Buffer
+		if err := ical.Encode(&buf, []storage.Event{e}); err != nil {
+			return nil, err
+		}
+		props[propCalendarData] = xmlEscape(buf.String())
+	}
+	return props, nil
+}
+
+func eventETag(e storage.Event) string {
+	data, _ := json.Marshal(newEventDTO(e))
+	return etag(string(data))
+}
+
+func etag(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// propfindProps returns the requested properties, nil for allprop or an empty body.
+func propfindProps(r *http.Request) ([]xml.Name, error) {
+	var req propfindRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err) //nolint:errorlint
+	}
+	return req.Prop.names(), nil
+}
+
+// selectProps returns the requested properties of the resource, all of them if none are requested.
+func selectProps(href string, props davProps, requested []xml.Name) davResponse {
+	resp := davResponse{href: href, props: davProps{}}
+	if len(requested) == 0 {
+		for name, value := range props {
+			if name != propCalendarData {
+				resp.props[name] = value
+			}
+		}
+		return resp
+	}
+	for _, name := range requested {
+		if value, ok := props[name]; ok {
+			resp.props[name] = value
+		} else {
+			resp.notFound = append(resp.notFound, name)
+		}
+	}
+	return resp
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<d:multistatus xmlns:d="%s" xmlns:c="%s" xmlns:cs="%s">`, nsDAV, nsCalDAV, nsCS)
+	for _, resp := range responses {
+		b.WriteString("<d:response>")
+		b.WriteString(xmlHref(resp.href))
+		if resp.status != 0 {
+			writeStatus(&b, resp.status)
+		}
+		if len(resp.props) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			names := make([]xml.Name, 0, len(resp.props))
+			for name := range resp.props {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool {
+				return names[i].Space+names[i].Local < names[j].Space+names[j].Local
+			})
+			for _, name := range names {
+				writeProp(&b, name, resp.props[name])
+			}
+			b.WriteString("</d:prop>")
+			writeStatus(&b, http.StatusOK)
+			b.WriteString("</d:propstat>")
+		}
+		if len(resp.notFound) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range resp.notFound {
+				writeProp(&b, name, "")
+			}
+			b.WriteString("</d:prop>")
+			writeStatus(&b, http.StatusNotFound)
+			b.WriteString("</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, b.String())
+}
+
+func writeStatus(b *strings.Builder, status int) {
+	fmt.Fprintf(b, "<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+func writeProp(b *strings.Builder, name xml.Name, value string) {
+	tag := ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+		b.WriteString("<" + tag)
+	} else {
+		tag = "x:" + name.Local
+		b.WriteString("<" + tag + ` xmlns:x="` + xmlEscape(name.Space) + `"`)
+	}
+	if value == "" {
+		b.WriteString("/>")
+		return
+	}
+	b.WriteString(">" + value + "</" + tag + ">")
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func xmlHref(href string) string {
+	return "<d:href>" + xmlEscape(href) + "</d:href>"
+}
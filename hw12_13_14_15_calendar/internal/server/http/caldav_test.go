@@ -0,0 +1,173 @@
+package internalhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func davDo(t *testing.T, h http.Handler, method, target, body string, headers map[string]string) (int, http.Header, string) {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set(auth.DefaultUserIDHeader, "alice")
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, resp.Header, string(data)
+}
+
+const standupICS = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:standup\r\n" +
+	"DTSTART:20210104T100000Z\r\nDTEND:20210104T103000Z\r\nSUMMARY:Standup\r\n" +
+	"END:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAV(t *testing.T) {
+	h := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	calendarPath := davHome + cal.ID + "/"
+	eventPath := calendarPath + "standup.ics"
+
+	t.Run("discovery", func(t *testing.T) {
+		status, headers, _ := davDo(t, h, http.MethodGet, "/.well-known/caldav", "", nil)
+		require.Equal(t, http.StatusMovedPermanently, status)
+		require.Equal(t, davPrefix, headers.Get("Location"))
+
+		status, headers, _ = davDo(t, h, http.MethodOptions, davPrefix, "", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Contains(t, headers.Get("DAV"), "calendar-access")
+
+		status, _, body := davDo(t, h, "PROPFIND", davPrefix, `<?xml version="1.0"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:current-user-principal/><c:calendar-home-set/><d:unknown/></d:prop>
+</d:propfind>`, map[string]string{"Depth": "0"})
+		require.Equal(t, http.StatusMultiStatus, status)
+		require.Contains(t, body, "<c:calendar-home-set><d:href>/dav/calendars/</d:href></c:calendar-home-set>")
+		require.Contains(t, body, "<d:unknown/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status>")
+
+		status, _, body = davDo(t, h, "PROPFIND", davHome, "", map[string]string{"Depth": "1"})
+		require.Equal(t, http.StatusMultiStatus, status)
+		require.Contains(t, body, "<d:href>"+calendarPath+"</d:href>")
+		require.Contains(t, body, "<c:calendar/>")
+	})
+
+	var etag string
+	t.Run("put", func(t *testing.T) {
+		status, headers, _ := davDo(t, h, http.MethodPut, eventPath, standupICS, map[string]string{"If-None-Match": "*"})
+		require.Equal(t, http.StatusCreated, status)
+		etag = headers.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		status, _, _ = davDo(t, h, http.MethodPut, eventPath, standupICS, map[string]string{"If-None-Match": "*"})
+		require.Equal(t, http.StatusPreconditionFailed, status)
+
+		status, _, _ = davDo(t, h, http.MethodPut, calendarPath+"other.ics", standupICS, nil)
+		require.Equal(t, http.StatusBadRequest, status)
+
+		updated := strings.Replace(standupICS, "Standup", "Daily standup", 1)
+		status, _, _ = davDo(t, h, http.MethodPut, eventPath, updated, map[string]string{"If-Match": `"stale"`})
+		require.Equal(t, http.StatusPreconditionFailed, status)
+		status, headers, _ = davDo(t, h, http.MethodPut, eventPath, updated, map[string]string{"If-Match": etag})
+		require.Equal(t, http.StatusNoContent, status)
+		require.NotEqual(t, etag, headers.Get("ETag"))
+		etag = headers.Get("ETag")
+
+		// The UID names the resource, the event gets an ID of its own.
+		var events []eventDTO
+		require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?period=day&date=2021-01-04", nil, &events))
+		require.Len(t, events, 1)
+		require.Equal(t, "Daily standup", events[0].Title)
+		require.Equal(t, cal.ID, events[0].CalendarID)
+		require.NotEqual(t, "standup", events[0].ID)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		status, headers, body := davDo(t, h, http.MethodGet, eventPath, "", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, etag, headers.Get("ETag"))
+		require.Contains(t, body, "SUMMARY:Daily standup")
+
+		status, _, body = davDo(t, h, "PROPFIND", calendarPath, "", map[string]string{"Depth": "1"})
+		require.Equal(t, http.StatusMultiStatus, status)
+		require.Contains(t, body, "<d:href>"+eventPath+"</d:href>")
+		require.Contains(t, body, "<cs:getctag>")
+		require.NotContains(t, body, "calendar-data")
+	})
+
+	t.Run("report", func(t *testing.T) {
+		query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+    <c:time-range start="%s" end="%s"/>
+  </c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+		status, _, body := davDo(t, h, "REPORT", calendarPath,
+			strings.NewReplacer("%s", "20210105T000000Z").Replace(strings.Replace(query, "%s", "20210101T000000Z", 1)), nil)
+		require.Equal(t, http.StatusMultiStatus, status)
+		require.Contains(t, body, "SUMMARY:Daily standup")
+
+		status, _, body = davDo(t, h, "REPORT", calendarPath,
+			strings.NewReplacer("%s", "20210201T000000Z").Replace(query), nil)
+		require.Equal(t, http.StatusMultiStatus, status)
+		require.NotContains(t, body, "standup")
+
+		status, _, body = davDo(t, h, "REPORT", calendarPath, `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <d:href>`+eventPath+`</d:href>
+  <d:href>`+calendarPath+`missing.ics</d:href>
+</c:calendar-multiget>`, nil)
+		require.Equal(t, http.StatusMultiStatus, status)
+		require.Contains(t, body, "<d:getetag>"+strings.ReplaceAll(etag, `"`, "&#34;")+"</d:getetag>")
+		require.Contains(t, body, "missing.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		// The event can only be deleted through its own calendar.
+		var other calendarDTO
+		require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Home"}, &other))
+		status, _, _ := davDo(t, h, http.MethodDelete, davHome+other.ID+"/standup.ics", "", nil)
+		require.Equal(t, http.StatusNotFound, status)
+		status, _, _ = davDo(t, h, http.MethodGet, eventPath, "", nil)
+		require.Equal(t, http.StatusOK, status)
+
+		status, _, _ = davDo(t, h, http.MethodDelete, eventPath, "", nil)
+		require.Equal(t, http.StatusNoContent, status)
+		status, _, _ = davDo(t, h, http.MethodGet, eventPath, "", nil)
+		require.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("uid", func(t *testing.T) {
+		// Other users have their own events with the same UID.
+		bob := map[string]string{auth.DefaultUserIDHeader: "bob"}
+		var bobCal calendarDTO
+		require.Equal(t, http.StatusCreated, do(t, h, "bob", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &bobCal))
+		status, _, _ := davDo(t, h, http.MethodPut, davHome+bobCal.ID+"/standup.ics", standupICS, bob)
+		require.Equal(t, http.StatusCreated, status)
+
+		// The deleted event is restored and replaced.
+		status, _, _ = davDo(t, h, http.MethodPut, eventPath, standupICS, map[string]string{"If-None-Match": "*"})
+		require.Equal(t, http.StatusCreated, status)
+		status, _, body := davDo(t, h, http.MethodGet, eventPath, "", nil)
+		require.Equal(t, http.StatusOK, status)
+		require.Contains(t, body, "SUMMARY:Standup")
+
+		var trash []eventDTO
+		require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/trash", nil, &trash))
+		require.Empty(t, trash)
+	})
+}
@@ -0,0 +1,447 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// duration is time.Duration encoded in JSON as a string, e.g. "1h30m".
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+type eventDTO struct {
+	ID          string        `json:"id"`
+	CalendarID  string        `json:"calendar_id"`
+	OwnerID     string        `json:"owner_id"`
+	Title       string        `json:"title,omitempty"`
+	StartAt     time.Time     `json:"start_at"`
+	EndAt       time.Time     `json:"end_at"`
+	Description string        `json:"description,omitempty"`
+	Reminders   []reminderDTO `json:"reminders,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+	// Attachments are ignored on create and update, they have their own endpoints.
+	Attachments []attachmentDTO `json:"attachments,omitempty"`
+	DeletedAt   *time.Time      `json:"deleted_at,omitempty"`
+	DeletedBy   string          `json:"deleted_by,omitempty"`
+}
+
+type reminderDTO struct {
+	ID      string   `json:"id,omitempty"`
+	Before  duration `json:"before"`
+	Channel string   `json:"channel"`
+}
+
+func newEventDTO(e storage.Event) eventDTO {
+	dto := eventDTO{
+		ID:          e.ID,
+		CalendarID:  e.CalendarID,
+		OwnerID:     e.OwnerID,
+		Title:       e.Title,
+		StartAt:     e.StartAt,
+		EndAt:       e.EndAt,
+		Description: e.Description,
+		Reminders:   newReminderDTOs(e.Reminders),
+		Tags:        e.Tags,
+		Attachments: newAttachmentDTOs(e.Attachments),
+	}
+	if e.Deleted() {
+		dto.DeletedAt = &e.DeletedAt
+		dto.DeletedBy = e.DeletedBy
+	}
+	return dto
+}
+
+type attachmentDTO struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   string    `json:"created_by"`
+}
+
+func newAttachmentDTO(a storage.Attachment) attachmentDTO {
+	return attachmentDTO{
+		ID:          a.ID,
+		Name:        a.Name,
+		URL:         a.URL,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		CreatedAt:   a.CreatedAt,
+		CreatedBy:   a.CreatedBy,
+	}
+}
+
+func newAttachmentDTOs(attachments []storage.Attachment) []attachmentDTO {
+	if len(attachments) == 0 {
+		return nil
+	}
+	dtos := make([]attachmentDTO, 0, len(attachments))
+	for _, a := range attachments {
+		dtos = append(dtos, newAttachmentDTO(a))
+	}
+	return dtos
+}
+
+func newReminderDTOs(reminders []storage.Reminder) []reminderDTO {
+	if len(reminders) == 0 {
+		return nil
+	}
+	dtos := make([]reminderDTO, 0, len(reminders))
+	for _, r := range reminders {
+		dtos = append(dtos, reminderDTO{ID: r.ID, Before: duration(r.Before), Channel: string(r.Channel)})
+	}
+	return dtos
+}
+
+func (e eventDTO) event() storage.Event {
+	return storage.Event{
+		ID:          e.ID,
+		CalendarID:  e.CalendarID,
+		Title:       e.Title,
+		StartAt:     e.StartAt,
+		EndAt:       e.EndAt,
+		Description: e.Description,
+		Reminders:   reminders(e.Reminders),
+		Tags:        e.Tags,
+	}
+}
+
+func reminders(dtos []reminderDTO) []storage.Reminder {
+	if len(dtos) == 0 {
+		return nil
+	}
+	reminders := make([]storage.Reminder, 0, len(dtos))
+	for _, r := range dtos {
+		reminders = append(reminders, storage.Reminder{
+			ID:      r.ID,
+			Before:  time.Duration(r.Before),
+			Channel: storage.Channel(r.Channel),
+		})
+	}
+	return reminders
+}
+
+func newEventDTOs(events []storage.Event) []eventDTO {
+	dtos := make([]eventDTO, 0, len(events))
+	for _, e := range events {
+		dtos = append(dtos, newEventDTO(e))
+	}
+	return dtos
+}
+
+type calendarDTO struct {
+	ID      string `json:"id"`
+	OwnerID string `json:"owner_id"`
+	Name    string `json:"name"`
+}
+
+func newCalendarDTO(c storage.Calendar) calendarDTO {
+	return calendarDTO{ID: c.ID, OwnerID: c.OwnerID, Name: c.Name}
+}
+
+type tagDTO struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type grantDTO struct {
+	UserID string `json:"user_id"`
+	Access string `json:"access"`
+}
+
+type webhookDTO struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Failures  int       `json:"failures"`
+	Disabled  bool      `json:"disabled"`
+}
+
+func newWebhookDTO(w storage.Webhook) webhookDTO {
+	return webhookDTO{
+		ID:        w.ID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		CreatedAt: w.CreatedAt,
+		Failures:  w.Failures,
+		Disabled:  w.Disabled,
+	}
+}
+
+type webhookDeliveryDTO struct {
+	ID         string    `json:"id"`
+	Change     string    `json:"change"`
+	EventID    string    `json:"event_id"`
+	Attempt    int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+}
+
+func newWebhookDeliveryDTO(d storage.WebhookDelivery) webhookDeliveryDTO {
+	return webhookDeliveryDTO{
+		ID:         d.ID,
+		Change:     string(d.Change),
+		EventID:    d.EventID,
+		Attempt:    d.Attempt,
+		At:         d.At,
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		Success:    d.Success,
+	}
+}
+
+// deadLetterDTO is a change which could not be delivered to the webhook.
+type deadLetterDTO struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	Change    string          `json:"change"`
+	EventID   string          `json:"event_id"`
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error,omitempty"`
+	FailedAt  time.Time       `json:"failed_at"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+func newDeadLetterDTO(m storage.WebhookMessage) deadLetterDTO {
+	return deadLetterDTO{
+		ID:        m.ID,
+		WebhookID: m.WebhookID,
+		Change:    string(m.Change),
+		EventID:   m.EventID,
+		Attempts:  m.Attempts,
+		Error:     m.LastError,
+		FailedAt:  m.UpdatedAt,
+		Payload:   json.RawMessage(m.Body),
+	}
+}
+
+type redriveDTO struct {
+	// IDs limit the dead letters to redrive, all of them are redriven if it is empty.
+	IDs      []string `json:"ids,omitempty"`
+	Redriven int      `json:"redriven"`
+}
+
+type batchDTO struct {
+	// Atomic batches are applied only if every operation succeeds.
+	Atomic     bool                `json:"atomic"`
+	Operations []batchOperationDTO `json:"operations"`
+}
+
+// batchOperationDTO is "create" with an event, "update" with an event or "delete" with an ID.
+type batchOperationDTO struct {
+	Op    string   `json:"op"`
+	ID    string   `json:"id,omitempty"`
+	Event eventDTO `json:"event"`
+}
+
+var batchChanges = map[string]storage.Change{
+	"create": storage.ChangeCreated,
+	"update": storage.ChangeUpdated,
+	"delete": storage.ChangeDeleted,
+}
+
+func (o batchOperationDTO) op() storage.EventOp {
+	change, ok := batchChanges[o.Op]
+	if !ok {
+		change = storage.Change(o.Op)
+	}
+	e := o.Event.event()
+	if o.ID != "" {
+		e.ID = o.ID
+	}
+	return storage.EventOp{Change: change, Event: e}
+}
+
+type batchResultDTO struct {
+	Status int       `json:"status"`
+	Event  *eventDTO `json:"event,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type auditEntryDTO struct {
+	ID         string           `json:"id"`
+	EventID    string           `json:"event_id"`
+	CalendarID string           `json:"calendar_id"`
+	Actor      string           `json:"actor"`
+	Transport  string           `json:"transport"`
+	Change     string           `json:"change"`
+	At         time.Time        `json:"at"`
+	Diff       []fieldChangeDTO `json:"diff"`
+}
+
+type fieldChangeDTO struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func newAuditEntryDTO(entry storage.AuditEntry) auditEntryDTO {
+	diff := make([]fieldChangeDTO, 0, len(entry.Diff))
+	for _, c := range entry.Diff {
+		diff = append(diff, fieldChangeDTO{Field: c.Field, Before: c.Before, After: c.After})
+	}
+	return auditEntryDTO{
+		ID:         entry.ID,
+		EventID:    entry.EventID,
+		CalendarID: entry.CalendarID,
+		Actor:      entry.ActorID,
+		Transport:  entry.Transport,
+		Change:     string(entry.Change),
+		At:         entry.At,
+		Diff:       diff,
+	}
+}
+
+// workingHoursDTO has hours as "09:00" and days as "monday".
+type workingHoursDTO struct {
+	TimeZone string   `json:"time_zone"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Days     []string `json:"days"`
+}
+
+func newWorkingHoursDTO(w storage.WorkingHours) workingHoursDTO {
+	days := make([]string, 0, len(w.Days))
+	for _, d := range w.Days {
+		days = append(days, strings.ToLower(d.String()))
+	}
+	return workingHoursDTO{
+		TimeZone: w.TimeZone,
+		Start:    clockString(w.Start),
+		End:      clockString(w.End),
+		Days:     days,
+	}
+}
+
+func (w workingHoursDTO) workingHours() (storage.WorkingHours, error) {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return storage.WorkingHours{}, err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return storage.WorkingHours{}, err
+	}
+	days := make([]time.Weekday, 0, len(w.Days))
+	for _, name := range w.Days {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return storage.WorkingHours{}, fmt.Errorf("%w: unknown day %q", errBadRequest, name)
+		}
+		days = append(days, day)
+	}
+	return storage.WorkingHours{TimeZone: w.TimeZone, Start: start, End: end, Days: days}, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func clockString(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// parseClock parses "09:30" as an offset from midnight, "24:00" is the end of the day.
+func parseClock(s string) (time.Duration, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || h > 24 || m < 0 || m > 59 ||
+		h == 24 && m != 0 {
+		return 0, fmt.Errorf("%w: invalid time %q", errBadRequest, s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// preferencesDTO has the week start as "monday", the working hours are optional on update.
+type preferencesDTO struct {
+	TimeZone        string           `json:"time_zone"`
+	Locale          string           `json:"locale,omitempty"`
+	WeekStart       string           `json:"week_start"`
+	DefaultReminder *reminderDTO     `json:"default_reminder,omitempty"`
+	WorkingHours    *workingHoursDTO `json:"working_hours,omitempty"`
+}
+
+func newPreferencesDTO(p storage.Preferences, w storage.WorkingHours) preferencesDTO {
+	dto := preferencesDTO{
+		TimeZone:  p.TimeZone,
+		Locale:    p.Locale,
+		WeekStart: strings.ToLower(p.WeekStart.String()),
+	}
+	if r := p.DefaultReminder; r.Channel != "" {
+		dto.DefaultReminder = &reminderDTO{Before: duration(r.Before), Channel: string(r.Channel)}
+	}
+	hours := newWorkingHoursDTO(w)
+	dto.WorkingHours = &hours
+	return dto
+}
+
+func (p preferencesDTO) preferences() (storage.Preferences, error) {
+	prefs := storage.Preferences{TimeZone: p.TimeZone, Locale: p.Locale, WeekStart: time.Monday}
+	if p.WeekStart != "" {
+		day, ok := weekdays[strings.ToLower(p.WeekStart)]
+		if !ok {
+			return storage.Preferences{}, fmt.Errorf("%w: unknown day %q", errBadRequest, p.WeekStart)
+		}
+		prefs.WeekStart = day
+	}
+	if r := p.DefaultReminder; r != nil {
+		prefs.DefaultReminder = storage.Reminder{Before: time.Duration(r.Before), Channel: storage.Channel(r.Channel)}
+	}
+	return prefs, nil
+}
+
+type slotRequestDTO struct {
+	UserIDs  []string  `json:"user_ids"`
+	Duration duration  `json:"duration"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Limit    int       `json:"limit,omitempty"`
+}
+
+func (s slotRequestDTO) slotRequest() app.SlotRequest {
+	return app.SlotRequest{
+		UserIDs:  s.UserIDs,
+		Duration: time.Duration(s.Duration),
+		From:     s.From,
+		To:       s.To,
+		Limit:    s.Limit,
+	}
+}
+
+// slotDTO has the score in minutes.
+type slotDTO struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Score int       `json:"score"`
+}
@@ -0,0 +1,386 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const dateLayout = "2006-01-02"
+
+var errBadRequest = errors.New("bad request")
+
+type handler struct {
+	app      Application
+	renderer Renderer
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	writeJSON(w, status, map[string]string{"error": errorMessage(status, err)})
+}
+
+func errorStatus(err error) int {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest),
+		errors.Is(err, app.ErrInvalidEvent),
+		errors.Is(err, app.ErrInvalidCalendar),
+		errors.Is(err, app.ErrInvalidWebhook),
+		errors.Is(err, app.ErrInvalidBatch),
+		errors.Is(err, app.ErrInvalidAuditFilter),
+		errors.Is(err, app.ErrInvalidTag),
+		errors.Is(err, app.ErrInvalidWorkingHours),
+		errors.Is(err, app.ErrInvalidPreferences),
+		errors.Is(err, app.ErrInvalidSlotRequest),
+		errors.Is(err, app.ErrInvalidAttachment),
+		errors.Is(err, app.ErrInvalidNotificationFilter),
+		errors.Is(err, storage.ErrInvalidAccess),
+		errors.Is(err, storage.ErrInvalidOperation):
+		status = http.StatusBadRequest
+	case errors.Is(err, auth.ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, storage.ErrAccessDenied),
+		errors.Is(err, app.ErrQuotaExceeded):
+		status = http.StatusForbidden
+	case errors.Is(err, storage.ErrEventNotFound),
+		errors.Is(err, storage.ErrCalendarNotFound),
+		errors.Is(err, storage.ErrWebhookNotFound),
+		errors.Is(err, storage.ErrTagNotFound),
+		errors.Is(err, storage.ErrAttachmentNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, storage.ErrEventExists),
+		errors.Is(err, storage.ErrCalendarExists),
+		errors.Is(err, storage.ErrCalendarNotEmpty),
+		errors.Is(err, storage.ErrWebhookExists),
+		errors.Is(err, app.ErrNotApplied):
+		status = http.StatusConflict
+	case errors.Is(err, errPreconditionFailed):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, app.ErrAttachmentTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, app.ErrUnsupportedContentType):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, app.ErrAttachmentsDisabled):
+		status = http.StatusNotImplemented
+	}
+	return status
+}
+
+// errorMessage hides details of internal errors.
+func errorMessage(status int, err error) string {
+	if status == http.StatusInternalServerError {
+		return http.StatusText(status)
+	}
+	return err.Error()
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err) //nolint:errorlint
+	}
+	return nil
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+}
+
+// pathParts splits the path after the prefix: "/events/1" with prefix "/events" gives ["1"].
+func pathParts(path, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+func (h *handler) calendars(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/calendars")
+	switch {
+	case len(parts) == 0:
+		h.calendarsRoot(w, r)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := h.app.DeleteCalendar(r.Context(), parts[0]); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "shares" && r.Method == http.MethodGet:
+		h.listShares(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "shares":
+		h.share(w, r, parts[0], parts[2])
+	case len(parts) <= 3:
+		methodNotAllowed(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *handler) calendarsRoot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		calendars, err := h.app.ListCalendars(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		dtos := make([]calendarDTO, 0, len(calendars))
+		for _, c := range calendars {
+			dtos = append(dtos, newCalendarDTO(c))
+		}
+		writeJSON(w, http.StatusOK, dtos)
+	case http.MethodPost:
+		var req calendarDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		cal, err := h.app.CreateCalendar(r.Context(), req.Name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newCalendarDTO(cal))
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *handler) listShares(w http.ResponseWriter, r *http.Request, calendarID string) {
+	grants, err := h.app.ListShares(r.Context(), calendarID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dtos := make([]grantDTO, 0, len(grants))
+	for _, g := range grants {
+		dtos = append(dtos, grantDTO{UserID: g.UserID, Access: g.Access.String()})
+	}
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func (h *handler) share(w http.ResponseWriter, r *http.Request, calendarID, granteeID string) {
+	switch r.Method {
+	case http.MethodPut:
+		var req grantDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		access, err := storage.ParseAccess(req.Access)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := h.app.ShareCalendar(r.Context(), calendarID, granteeID, access); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, grantDTO{UserID: granteeID, Access: access.String()})
+	case http.MethodDelete:
+		if err := h.app.RevokeShare(r.Context(), calendarID, granteeID); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *handler) events(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/events")
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		h.listEvents(w, r)
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req eventDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		e, err := h.app.CreateEvent(r.Context(), req.event())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newEventDTO(e))
+	case len(parts) == 1 && parts[0] == "batch" && r.Method == http.MethodPost:
+		h.batch(w, r)
+	case len(parts) == 1:
+		h.event(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "attachments":
+		h.attachments(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "links" && r.Method == http.MethodPost:
+		h.addLink(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "attachments":
+		h.attachment(w, r, parts[0], parts[2])
+	case len(parts) == 0, len(parts) == 2 && parts[1] == "links":
+		methodNotAllowed(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *handler) event(w http.ResponseWriter, r *http.Request, eventID string) {
+	switch r.Method {
+	case http.MethodGet:
+		e, err := h.app.GetEvent(r.Context(), eventID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newEventDTO(e))
+	case http.MethodPut:
+		var req eventDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		req.ID = eventID
+		e, err := h.app.UpdateEvent(r.Context(), req.event())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newEventDTO(e))
+	case http.MethodDelete:
+		if err := h.app.DeleteEvent(r.Context(), eventID); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// audit handles GET /audit?event_id=1&user_id=alice, at least one of them is required.
+func (h *handler) audit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	query := r.URL.Query()
+	entries, err := h.app.ListAudit(r.Context(), storage.AuditFilter{
+		EventID: query.Get("event_id"),
+		ActorID: query.Get("user_id"),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dtos := make([]auditEntryDTO, 0, len(entries))
+	for _, entry := range entries {
+		dtos = append(dtos, newAuditEntryDTO(entry))
+	}
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+// trash handles GET /trash and POST /trash/{id}/restore.
+func (h *handler) trash(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/trash")
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		events, err := h.app.ListTrash(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newEventDTOs(events))
+	case len(parts) == 2 && parts[1] == "restore" && r.Method == http.MethodPost:
+		e, err := h.app.RestoreEvent(r.Context(), parts[0])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newEventDTO(e))
+	case len(parts) == 0, len(parts) == 2 && parts[1] == "restore":
+		methodNotAllowed(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// tags handles GET /tags, PUT /tags/{name} with a colour and DELETE /tags/{name}.
+func (h *handler) tags(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/tags")
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		tags, err := h.app.ListTags(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		dtos := make([]tagDTO, 0, len(tags))
+		for _, tag := range tags {
+			dtos = append(dtos, tagDTO{Name: tag.Name, Color: tag.Color})
+		}
+		writeJSON(w, http.StatusOK, dtos)
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var req tagDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		tag, err := h.app.PutTag(r.Context(), parts[0], req.Color)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tagDTO{Name: tag.Name, Color: tag.Color})
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := h.app.DeleteTag(r.Context(), parts[0]); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) <= 1:
+		methodNotAllowed(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// listEvents handles GET /events?period=day|week|month&date=2021-01-01&tag=work&tag=home,
+// a week is the one containing the date, tags are optional and select events having any of them.
+func (h *handler) listEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	date, err := time.Parse(dateLayout, query.Get("date"))
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: invalid date", errBadRequest))
+		return
+	}
+
+	var events []storage.Event
+	tags := query["tag"]
+	switch query.Get("period") {
+	case "day", "":
+		events, err = h.app.ListDayEvents(r.Context(), date, tags...)
+	case "week":
+		events, err = h.app.ListWeekEvents(r.Context(), date, tags...)
+	case "month":
+		events, err = h.app.ListMonthEvents(r.Context(), date, tags...)
+	default:
+		err = fmt.Errorf("%w: invalid period", errBadRequest)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newEventDTOs(events))
+}
@@ -0,0 +1,648 @@
+package internalhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/blob"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/notify"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func do(t *testing.T, h http.Handler, user, method, target string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	r := httptest.NewRequest(method, target, &buf)
+	r.Header.Set(auth.DefaultUserIDHeader, user)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestHandlers(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+
+	var e eventDTO
+	status := do(t, h, "alice", http.MethodPost, "/events", map[string]interface{}{
+		"calendar_id": cal.ID,
+		"title":       "standup",
+		"start_at":    "2021-03-01T10:00:00Z",
+		"end_at":      "2021-03-01T10:15:00Z",
+		"reminders": []map[string]string{
+			{"before": "10m", "channel": "email"},
+			{"before": "1h", "channel": "log"},
+		},
+	}, &e)
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, "alice", e.OwnerID)
+	require.Len(t, e.Reminders, 2)
+	require.NotEmpty(t, e.Reminders[0].ID)
+	require.Equal(t, duration(time.Hour), e.Reminders[1].Before)
+
+	status = do(t, h, "alice", http.MethodPost, "/events", map[string]interface{}{
+		"calendar_id": cal.ID,
+		"title":       "standup",
+		"start_at":    "2021-03-01T10:00:00Z",
+		"end_at":      "2021-03-01T10:15:00Z",
+		"reminders":   []map[string]string{{"before": "10m", "channel": "pigeon"}},
+	}, nil)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	var events []eventDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?period=week&date=2021-03-01", nil, &events))
+	require.Len(t, events, 1)
+	require.Equal(t, "standup", events[0].Title)
+
+	require.Equal(t, http.StatusNotFound, do(t, h, "bob", http.MethodGet, "/events/"+e.ID, nil, nil))
+
+	grant := grantDTO{Access: "free-busy"}
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPut, "/calendars/"+cal.ID+"/shares/bob", grant, nil))
+
+	events = nil
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodGet, "/events?period=day&date=2021-03-01", nil, &events))
+	require.Len(t, events, 1)
+	require.Empty(t, events[0].Title)
+
+	e.Title = "renamed"
+	require.Equal(t, http.StatusForbidden, do(t, h, "bob", http.MethodPut, "/events/"+e.ID, e, nil))
+	require.Equal(t, http.StatusForbidden, do(t, h, "bob", http.MethodDelete, "/events/"+e.ID, nil, nil))
+
+	grant = grantDTO{Access: "read-write"}
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPut, "/calendars/"+cal.ID+"/shares/bob", grant, nil))
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPut, "/events/"+e.ID, e, nil))
+	require.Equal(t, http.StatusNoContent, do(t, h, "bob", http.MethodDelete, "/events/"+e.ID, nil, nil))
+
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPut, "/calendars/"+cal.ID+"/shares/bob", grantDTO{Access: "owner"}, nil))
+	require.Equal(t, http.StatusForbidden, do(t, h, "bob", http.MethodDelete, "/calendars/"+cal.ID+"/shares/bob", nil, nil))
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	s := memorystorage.New()
+	calendar := app.New(nil, s, nil)
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPost, "/webhooks", webhookDTO{URL: "ftp://example.com"}, nil))
+
+	var created webhookDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/webhooks", webhookDTO{URL: "https://example.com/hook"}, &created))
+	require.NotEmpty(t, created.ID)
+	require.NotEmpty(t, created.Secret)
+
+	var webhooks []webhookDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/webhooks", nil, &webhooks))
+	require.Len(t, webhooks, 1)
+	require.Empty(t, webhooks[0].Secret)
+
+	var deliveries []webhookDeliveryDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/webhooks/"+created.ID+"/deliveries", nil, &deliveries))
+	require.Empty(t, deliveries)
+
+	require.NoError(t, s.SaveWebhookMessage(context.Background(), storage.WebhookMessage{
+		ID: "d1", WebhookID: created.ID, Change: storage.ChangeCreated, Body: []byte(`{"id":"d1"}`), Attempts: 5, Dead: true,
+	}))
+	var dead []deadLetterDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/webhooks/"+created.ID+"/dead-letters", nil, &dead))
+	require.Len(t, dead, 1)
+	require.Equal(t, 5, dead[0].Attempts)
+	require.JSONEq(t, `{"id":"d1"}`, string(dead[0].Payload))
+	require.Equal(t, http.StatusNotFound, do(t, h, "bob", http.MethodGet, "/webhooks/"+created.ID+"/dead-letters", nil, nil))
+
+	var redrive redriveDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPost, "/webhooks/"+created.ID+"/dead-letters/redrive", redriveDTO{IDs: []string{"d2"}}, &redrive))
+	require.Zero(t, redrive.Redriven)
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPost, "/webhooks/"+created.ID+"/dead-letters/redrive", nil, &redrive))
+	require.Equal(t, 1, redrive.Redriven)
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/webhooks/"+created.ID+"/dead-letters", nil, &dead))
+	require.Empty(t, dead)
+
+	require.Equal(t, http.StatusNotFound, do(t, h, "bob", http.MethodDelete, "/webhooks/"+created.ID, nil, nil))
+	require.Equal(t, http.StatusNoContent, do(t, h, "alice", http.MethodPost, "/webhooks/"+created.ID+"/enable", nil, nil))
+	require.Equal(t, http.StatusNoContent, do(t, h, "alice", http.MethodDelete, "/webhooks/"+created.ID, nil, nil))
+	require.Equal(t, http.StatusNotFound, do(t, h, "alice", http.MethodDelete, "/webhooks/"+created.ID, nil, nil))
+}
+
+func TestBatchHandlers(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+
+	newOp := func(title string) map[string]interface{} {
+		return map[string]interface{}{"op": "create", "event": map[string]interface{}{
+			"calendar_id": cal.ID,
+			"title":       title,
+			"start_at":    "2021-03-01T10:00:00Z",
+			"end_at":      "2021-03-01T11:00:00Z",
+		}}
+	}
+	type response struct {
+		Results []batchResultDTO `json:"results"`
+	}
+
+	var resp response
+	status := do(t, h, "alice", http.MethodPost, "/events/batch", map[string]interface{}{
+		"atomic":     true,
+		"operations": []interface{}{newOp("first"), newOp(""), map[string]string{"op": "delete", "id": "missing"}},
+	}, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, resp.Results, 3)
+	require.Equal(t, http.StatusConflict, resp.Results[0].Status)
+	require.Equal(t, http.StatusBadRequest, resp.Results[1].Status)
+	require.Equal(t, http.StatusNotFound, resp.Results[2].Status)
+
+	var events []eventDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?date=2021-03-01", nil, &events))
+	require.Empty(t, events)
+
+	resp = response{}
+	status = do(t, h, "alice", http.MethodPost, "/events/batch", map[string]interface{}{
+		"operations": []interface{}{newOp("first"), newOp(""), newOp("second")},
+	}, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, http.StatusCreated, resp.Results[0].Status)
+	require.Equal(t, http.StatusBadRequest, resp.Results[1].Status)
+	require.Equal(t, http.StatusCreated, resp.Results[2].Status)
+	require.Equal(t, "second", resp.Results[2].Event.Title)
+
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?date=2021-03-01", nil, &events))
+	require.Len(t, events, 2)
+
+	resp = response{}
+	status = do(t, h, "alice", http.MethodPost, "/events/batch", map[string]interface{}{
+		"atomic": true,
+		"operations": []interface{}{
+			map[string]string{"op": "delete", "id": events[0].ID},
+			map[string]string{"op": "delete", "id": events[1].ID},
+		},
+	}, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, http.StatusNoContent, resp.Results[0].Status)
+	require.Equal(t, http.StatusNoContent, resp.Results[1].Status)
+
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPost, "/events/batch", batchDTO{}, nil))
+}
+
+func TestTrashHandlers(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	var e eventDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events", map[string]interface{}{
+		"calendar_id": cal.ID,
+		"title":       "standup",
+		"start_at":    "2021-03-01T10:00:00Z",
+		"end_at":      "2021-03-01T10:15:00Z",
+	}, &e))
+	require.Equal(t, http.StatusNoContent, do(t, h, "alice", http.MethodDelete, "/events/"+e.ID, nil, nil))
+
+	var events []eventDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?date=2021-03-01", nil, &events))
+	require.Empty(t, events)
+	require.Equal(t, http.StatusNotFound, do(t, h, "alice", http.MethodGet, "/events/"+e.ID, nil, nil))
+
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/trash", nil, &events))
+	require.Len(t, events, 1)
+	require.NotNil(t, events[0].DeletedAt)
+	require.Equal(t, "alice", events[0].DeletedBy)
+
+	require.Equal(t, http.StatusNotFound, do(t, h, "bob", http.MethodPost, "/trash/"+e.ID+"/restore", nil, nil))
+	var restored eventDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPost, "/trash/"+e.ID+"/restore", nil, &restored))
+	require.Nil(t, restored.DeletedAt)
+	require.Equal(t, http.StatusNotFound, do(t, h, "alice", http.MethodPost, "/trash/"+e.ID+"/restore", nil, nil))
+
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?date=2021-03-01", nil, &events))
+	require.Len(t, events, 1)
+}
+
+func TestAuditHandlers(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPut, "/calendars/"+cal.ID+"/shares/bob", grantDTO{Access: "read-write"}, nil))
+
+	var e eventDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events", map[string]interface{}{
+		"calendar_id": cal.ID,
+		"title":       "standup",
+		"start_at":    "2021-03-01T10:00:00Z",
+		"end_at":      "2021-03-01T10:15:00Z",
+	}, &e))
+	e.Title = "retro"
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPut, "/events/"+e.ID, e, nil))
+	require.Equal(t, http.StatusNoContent, do(t, h, "bob", http.MethodDelete, "/events/"+e.ID, nil, nil))
+
+	var entries []auditEntryDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/audit?event_id="+e.ID, nil, &entries))
+	require.Len(t, entries, 3)
+	require.Equal(t, "deleted", entries[0].Change)
+	require.Equal(t, "deleted_at", entries[0].Diff[0].Field)
+	require.Equal(t, "updated", entries[1].Change)
+	require.Equal(t, "bob", entries[1].Actor)
+	require.Equal(t, "http", entries[1].Transport)
+	require.Equal(t, []fieldChangeDTO{{Field: "title", Before: "standup", After: "retro"}}, entries[1].Diff)
+	require.Equal(t, "created", entries[2].Change)
+	require.Equal(t, "alice", entries[2].Actor)
+
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/audit?user_id=bob", nil, &entries))
+	require.Len(t, entries, 2)
+
+	require.Equal(t, http.StatusOK, do(t, h, "carol", http.MethodGet, "/audit?event_id="+e.ID, nil, &entries))
+	require.Empty(t, entries)
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodGet, "/audit", nil, nil))
+}
+
+func TestHealth(t *testing.T) {
+	s := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewAPIKeys(nil), "")
+	s.AddHealthCheck("scheduler", func() interface{} {
+		return map[string]string{"leader": "replica-1"}
+	})
+
+	var out map[string]interface{}
+	require.Equal(t, http.StatusOK, do(t, s.server.Handler, "", http.MethodGet, "/health", nil, &out))
+	require.Equal(t, "ok", out["status"])
+	require.Equal(t, map[string]interface{}{"leader": "replica-1"}, out["scheduler"])
+
+	// Everything else still requires authentication.
+	require.Equal(t, http.StatusUnauthorized, do(t, s.server.Handler, "", http.MethodGet, "/calendars", nil, nil))
+}
+
+type accessLog struct {
+	lines []string
+}
+
+func (l *accessLog) Info(msg string) {
+	l.lines = append(l.lines, msg)
+}
+
+func TestAccessLog(t *testing.T) {
+	s := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "")
+	log := &accessLog{}
+	s.SetLogger(log)
+
+	traceID := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{1}, Remote: true})
+	r := httptest.NewRequest(http.MethodGet, "/hello?q=1", nil)
+	r = r.WithContext(trace.ContextWithRemoteSpanContext(r.Context(), sc))
+	r.Header.Set(auth.DefaultUserIDHeader, "alice")
+	r.Header.Set("User-Agent", "test-agent")
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, http.StatusUnauthorized, do(t, s.server.Handler, "", http.MethodGet, "/calendars", nil, nil))
+
+	require.Len(t, log.lines, 2)
+	require.Regexp(t, `^192\.0\.2\.1 \[.+\] GET /hello\?q=1 HTTP/1\.1 200 \d+ "test-agent" trace_id=`+traceID.String()+`$`, log.lines[0])
+	require.Contains(t, log.lines[1], "GET /calendars HTTP/1.1 401 ")
+}
+
+func TestShutdown(t *testing.T) {
+	s := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "")
+	h := s.server.Handler
+
+	require.Equal(t, http.StatusOK, do(t, h, "", http.MethodGet, "/ready", nil, nil))
+	var out map[string]interface{}
+	require.Equal(t, http.StatusOK, do(t, h, "", http.MethodGet, "/health", nil, &out))
+	require.EqualValues(t, 0, out["in_flight"])
+
+	// A draining server is not ready but still serves requests.
+	s.Drain()
+	require.Equal(t, http.StatusServiceUnavailable, do(t, h, "", http.MethodGet, "/ready", nil, nil))
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/calendars", nil, nil))
+
+	require.NoError(t, s.Stop(context.Background()))
+	require.Equal(t, http.StatusServiceUnavailable, do(t, h, "alice", http.MethodGet, "/calendars", nil, nil))
+	require.Equal(t, http.StatusOK, do(t, h, "", http.MethodGet, "/health", nil, nil))
+	require.EqualValues(t, 0, s.InFlight())
+}
+
+func TestMeetingHandlers(t *testing.T) {
+	h := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "").server.Handler
+	monday := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var hours workingHoursDTO
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodGet, "/users/me/working-hours", nil, &hours))
+	require.Equal(t, "09:00", hours.Start)
+	require.Len(t, hours.Days, 5)
+
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPut, "/users/me/working-hours", workingHoursDTO{
+		TimeZone: "Europe/Moscow", Start: "12:00", End: "14:00", Days: []string{"Monday"},
+	}, &hours))
+	require.Equal(t, workingHoursDTO{TimeZone: "Europe/Moscow", Start: "12:00", End: "14:00", Days: []string{"monday"}}, hours)
+	require.Equal(t, http.StatusBadRequest, do(t, h, "bob", http.MethodPut, "/users/me/working-hours", workingHoursDTO{
+		TimeZone: "UTC", Start: "25:00", End: "26:00",
+	}, nil))
+
+	var out struct {
+		Slots []slotDTO `json:"slots"`
+	}
+	slots := map[string]interface{}{
+		"user_ids": []string{"bob"},
+		"duration": "1h",
+		"from":     monday,
+		"to":       monday.AddDate(0, 0, 1),
+	}
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "bob", http.MethodPost, "/calendars", map[string]string{"name": "Work"}, &cal))
+	require.Equal(t, http.StatusForbidden, do(t, h, "alice", http.MethodPost, "/meetings/slots", slots, nil))
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPut, "/calendars/"+cal.ID+"/shares/alice", grantDTO{Access: "free-busy"}, nil))
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPost, "/meetings/slots", slots, &out))
+	// Bob works 09:00-11:00 UTC, the slot in the middle is the best.
+	require.Len(t, out.Slots, 5)
+	require.Equal(t, monday.Add(9*time.Hour+30*time.Minute), out.Slots[0].Start.UTC())
+	require.Equal(t, 30, out.Slots[0].Score)
+
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPost, "/meetings/slots", map[string]interface{}{
+		"duration": "1h",
+		"from":     monday,
+		"to":       monday,
+	}, nil))
+}
+
+func TestTagHandlers(t *testing.T) {
+	h := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "").server.Handler
+
+	var tag tagDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPut, "/tags/work", tagDTO{Color: "#FF0000"}, &tag))
+	require.Equal(t, tagDTO{Name: "work", Color: "#ff0000"}, tag)
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPut, "/tags/home", tagDTO{Color: "#00ff00"}, nil))
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPut, "/tags/bad", tagDTO{Color: "red"}, nil))
+
+	var tags []tagDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/tags", nil, &tags))
+	require.Equal(t, []tagDTO{{Name: "home", Color: "#00ff00"}, {Name: "work", Color: "#ff0000"}}, tags)
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Main"}, &cal))
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, eventTags := range [][]string{{"work"}, {"Home", "urgent"}, nil} {
+		require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events", eventDTO{
+			CalendarID: cal.ID,
+			Title:      "event",
+			StartAt:    start.Add(time.Duration(i) * time.Hour),
+			EndAt:      start.Add(time.Duration(i)*time.Hour + time.Minute),
+			Tags:       eventTags,
+		}, nil))
+	}
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPost, "/events", eventDTO{
+		CalendarID: cal.ID,
+		Title:      "event",
+		StartAt:    start,
+		EndAt:      start.Add(time.Minute),
+		Tags:       []string{"work", "Work"},
+	}, nil))
+
+	var events []eventDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?period=week&date=2021-03-01&tag=home&tag=work", nil, &events))
+	require.Len(t, events, 2)
+	require.Equal(t, []string{"work"}, events[0].Tags)
+	require.Equal(t, []string{"Home", "urgent"}, events[1].Tags)
+
+	require.Equal(t, http.StatusNoContent, do(t, h, "alice", http.MethodDelete, "/tags/work", nil, nil))
+	require.Equal(t, http.StatusNotFound, do(t, h, "alice", http.MethodDelete, "/tags/work", nil, nil))
+}
+
+func TestNotificationPreview(t *testing.T) {
+	s := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "")
+	h := s.server.Handler
+	require.Equal(t, http.StatusNotFound, do(t, h, "bob", http.MethodPost, "/notifications/preview", nil, nil))
+
+	renderer, err := notify.NewRenderer("", "")
+	require.NoError(t, err)
+	s.SetRenderer(renderer)
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPut, "/users/me/preferences", preferencesDTO{
+		TimeZone: "Europe/Moscow", Locale: "ru-RU",
+	}, nil))
+
+	var msg messageDTO
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPost, "/notifications/preview", map[string]interface{}{
+		"channel": "email",
+		"before":  "1h",
+		"event":   map[string]interface{}{"title": "Планёрка", "start_at": time.Date(2021, 3, 1, 7, 0, 0, 0, time.UTC)},
+	}, &msg))
+	require.Equal(t, "Напоминание: Планёрка через 1 час", msg.Subject)
+	require.Contains(t, msg.Text, "понедельник, 1 марта 2021, 10:00 MSK")
+	require.NotEmpty(t, msg.HTML)
+
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodPost, "/notifications/preview", map[string]interface{}{}, &msg))
+	require.Contains(t, msg.Subject, "Team meeting")
+	require.Equal(t, http.StatusBadRequest, do(t, h, "bob", http.MethodPost, "/notifications/preview", map[string]interface{}{
+		"channel": "pigeon",
+	}, nil))
+}
+
+func TestPreferenceHandlers(t *testing.T) {
+	h := NewServer(app.New(nil, memorystorage.New(), nil), auth.NewTrustedHeader(""), "").server.Handler
+
+	var prefs preferencesDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/users/me/preferences", nil, &prefs))
+	require.Equal(t, "monday", prefs.WeekStart)
+	require.Equal(t, "09:00", prefs.WorkingHours.Start)
+
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodPut, "/users/me/preferences", map[string]interface{}{
+		"time_zone":        "Asia/Tokyo",
+		"locale":           "ru",
+		"week_start":       "Sunday",
+		"default_reminder": map[string]string{"before": "10m", "channel": "email"},
+		"working_hours":    map[string]interface{}{"start": "10:00", "end": "19:00", "days": []string{"sunday"}},
+	}, &prefs))
+	require.Equal(t, preferencesDTO{
+		TimeZone:        "Asia/Tokyo",
+		Locale:          "ru",
+		WeekStart:       "sunday",
+		DefaultReminder: &reminderDTO{Before: duration(10 * time.Minute), Channel: "email"},
+		WorkingHours:    &workingHoursDTO{TimeZone: "Asia/Tokyo", Start: "10:00", End: "19:00", Days: []string{"sunday"}},
+	}, prefs)
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	var e eventDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events", eventDTO{
+		CalendarID: cal.ID,
+		Title:      "brunch",
+		StartAt:    time.Date(2021, 2, 28, 10, 0, 0, 0, time.UTC),
+		EndAt:      time.Date(2021, 2, 28, 11, 0, 0, 0, time.UTC),
+	}, &e))
+	require.Len(t, e.Reminders, 1)
+
+	var events []eventDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events?period=week&date=2021-03-03", nil, &events))
+	require.Len(t, events, 1)
+
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPut, "/users/me/preferences", map[string]string{
+		"time_zone": "UTC", "week_start": "someday",
+	}, nil))
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodPut, "/users/me/preferences", map[string]string{
+		"time_zone": "Nowhere/City",
+	}, nil))
+}
+
+func TestAttachmentHandlers(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	calendar.SetBlobStore(blob.NewFS(t.TempDir()), app.AttachmentLimits{MaxSize: 1 << 10, ContentTypes: []string{"text/*"}})
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	var e eventDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events", eventDTO{
+		CalendarID: cal.ID,
+		Title:      "review",
+		StartAt:    time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC),
+		EndAt:      time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC),
+	}, &e))
+
+	upload := func(name, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/events/"+e.ID+"/attachments?name="+name, strings.NewReader(body))
+		r.Header.Set(auth.DefaultUserIDHeader, "alice")
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w := upload("notes.txt", "text/plain", "hello")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var att attachmentDTO
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&att))
+	require.Equal(t, int64(5), att.Size)
+	require.Equal(t, http.StatusRequestEntityTooLarge, upload("big.txt", "text/plain", strings.Repeat("x", 2<<10)).Code)
+	require.Equal(t, http.StatusUnsupportedMediaType, upload("x.pdf", "application/pdf", "%PDF").Code)
+
+	var link attachmentDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events/"+e.ID+"/links", linkDTO{
+		Name: "doc", URL: "https://example.com/doc",
+	}, &link))
+
+	var list []attachmentDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/events/"+e.ID+"/attachments", nil, &list))
+	require.Equal(t, []attachmentDTO{att, link}, list)
+
+	r := httptest.NewRequest(http.MethodGet, "/events/"+e.ID+"/attachments/"+att.ID, nil)
+	r.Header.Set(auth.DefaultUserIDHeader, "alice")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "hello", w.Body.String())
+	require.Equal(t, `attachment; filename=notes.txt`, w.Header().Get("Content-Disposition"))
+	require.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	require.Equal(t, http.StatusSeeOther, do(t, h, "alice", http.MethodGet, "/events/"+e.ID+"/attachments/"+link.ID, nil, nil))
+	require.Equal(t, http.StatusNoContent, do(t, h, "alice", http.MethodDelete, "/events/"+e.ID+"/attachments/"+att.ID, nil, nil))
+	require.Equal(t, http.StatusNotFound, do(t, h, "alice", http.MethodGet, "/events/"+e.ID+"/attachments/"+att.ID, nil, nil))
+}
+
+func TestNotificationHandlers(t *testing.T) {
+	s := memorystorage.New()
+	h := NewServer(app.New(nil, s, nil), auth.NewTrustedHeader(""), "").server.Handler
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	var e eventDTO
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.Equal(t, http.StatusCreated, do(t, h, "alice", http.MethodPost, "/events", eventDTO{
+		CalendarID: cal.ID,
+		Title:      "standup",
+		StartAt:    start,
+		EndAt:      start.Add(time.Hour),
+		Reminders:  []reminderDTO{{Before: duration(time.Hour), Channel: "email"}, {Channel: "log"}},
+	}, &e))
+	require.NoError(t, s.MarkDelivered(context.Background(), storage.Delivery{
+		EventID: e.ID, ReminderID: e.Reminders[0].ID, Channel: storage.ChannelEmail, NotifyAt: start.Add(-time.Hour),
+		SentAt: start.Add(-time.Hour), Status: storage.DeliveryDead, Attempts: 5, Error: "mailbox unavailable",
+	}))
+	require.NoError(t, s.MarkDelivered(context.Background(), storage.Delivery{
+		EventID: e.ID, ReminderID: e.Reminders[1].ID, Channel: storage.ChannelLog, NotifyAt: start, SentAt: start,
+	}))
+
+	var notifications []notificationDTO
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/notifications", nil, &notifications))
+	require.Len(t, notifications, 2)
+	require.Equal(t, "sent", notifications[0].Status)
+
+	require.Equal(t, http.StatusOK, do(t, h, "alice", http.MethodGet, "/notifications?status=dead", nil, &notifications))
+	require.Equal(t, []notificationDTO{{
+		EventID:    e.ID,
+		ReminderID: e.Reminders[0].ID,
+		Channel:    "email",
+		NotifyAt:   start.Add(-time.Hour),
+		At:         start.Add(-time.Hour),
+		Status:     "dead",
+		Attempts:   5,
+		Error:      "mailbox unavailable",
+	}}, notifications)
+
+	require.Equal(t, http.StatusOK, do(t, h, "bob", http.MethodGet, "/notifications", nil, &notifications))
+	require.Empty(t, notifications)
+	require.Equal(t, http.StatusBadRequest, do(t, h, "alice", http.MethodGet, "/notifications?status=lost", nil, nil))
+}
+
+func TestTenantHandlers(t *testing.T) {
+	calendar := app.New(nil, memorystorage.New(), nil)
+	calendar.SetQuotas(app.Quotas{TenantMaxEvents: map[string]int{"acme": 1}})
+	h := NewServer(calendar, auth.NewTrustedHeader(""), "").server.Handler
+
+	send := func(tenant, method, target string, body interface{}, out interface{}) int {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		r := httptest.NewRequest(method, target, &buf)
+		r.Header.Set(auth.DefaultUserIDHeader, "alice")
+		r.Header.Set(auth.DefaultTenantIDHeader, tenant)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if out != nil {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(out))
+		}
+		return w.Code
+	}
+
+	var cal calendarDTO
+	require.Equal(t, http.StatusCreated, send("acme", http.MethodPost, "/calendars", calendarDTO{Name: "Work"}, &cal))
+	event := eventDTO{
+		CalendarID: cal.ID,
+		Title:      "standup",
+		StartAt:    time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC),
+		EndAt:      time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC),
+	}
+	var e eventDTO
+	require.Equal(t, http.StatusCreated, send("acme", http.MethodPost, "/events", event, &e))
+	require.Equal(t, http.StatusForbidden, send("acme", http.MethodPost, "/events", event, nil))
+
+	require.Equal(t, http.StatusOK, send("acme", http.MethodGet, "/events/"+e.ID, nil, nil))
+	require.Equal(t, http.StatusNotFound, send("", http.MethodGet, "/events/"+e.ID, nil, nil))
+	require.Equal(t, http.StatusNotFound, send("globex", http.MethodGet, "/events/"+e.ID, nil, nil))
+	require.Equal(t, http.StatusUnauthorized, send("bad tenant", http.MethodGet, "/events/"+e.ID, nil, nil))
+
+	var cals []calendarDTO
+	require.Equal(t, http.StatusOK, send("globex", http.MethodGet, "/calendars", nil, &cals))
+	require.Empty(t, cals)
+}
@@ -0,0 +1,59 @@
+package internalhttp
+
+import (
+	"net/http"
+)
+
+// workingHours handles GET and PUT /users/me/working-hours.
+func (h *handler) workingHours(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		hours, err := h.app.GetWorkingHours(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newWorkingHoursDTO(hours))
+	case http.MethodPut:
+		var req workingHoursDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		hours, err := req.workingHours()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if hours, err = h.app.SetWorkingHours(r.Context(), hours); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newWorkingHoursDTO(hours))
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// meetingSlots handles POST /meetings/slots, the best slots come first.
+func (h *handler) meetingSlots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	var req slotRequestDTO
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	slots, err := h.app.FindSlots(r.Context(), req.slotRequest())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dtos := make([]slotDTO, 0, len(slots))
+	for _, s := range slots {
+		dtos = append(dtos, slotDTO{Start: s.Start, End: s.End, Score: int(s.Score.Minutes())})
+	}
+	writeJSON(w, http.StatusOK, map[string][]slotDTO{"slots": dtos})
+}
@@ -1,11 +1,80 @@
 package internalhttp
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func loggingMiddleware(next http.Handler) http.Handler {
+type Logger interface {
+	Info(msg string)
+}
+
+// statusRecorder remembers the status of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// loggingMiddleware writes a line per request to the access log of the server, the trace ID
+// links it to the spans of the request.
+func loggingMiddleware(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.logger == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		traceID := "-"
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			traceID = sc.TraceID().String()
+		}
+		s.logger.Info(fmt.Sprintf("%s [%s] %s %s %s %d %d %q trace_id=%s", ip, start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method, r.URL.RequestURI(), r.Proto, rec.status, time.Since(start).Milliseconds(), r.UserAgent(), traceID))
+	})
+}
+
+// authMiddleware rejects unauthenticated requests and puts the user ID, the tenant ID and
+// the transport into the request context.
+func authMiddleware(authenticator auth.Authenticator, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO
+		userID, tenantID, err := auth.Resolve(r.Context(), authenticator, r.Header)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="calendar"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		ctx := storage.WithTenantID(auth.WithUserID(r.Context(), userID), tenantID)
+		next.ServeHTTP(w, r.WithContext(app.WithTransport(ctx, app.TransportHTTP)))
 	})
 }
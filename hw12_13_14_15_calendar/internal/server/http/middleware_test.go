@@ -0,0 +1,40 @@
+package internalhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := authMiddleware(auth.NewAPIKeys(map[string]string{"key": "user1"}), http.HandlerFunc(helloHandler))
+
+	t.Run("authenticated", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		r.Header.Set(auth.APIKeyHeader, "key")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "hello, user1\n", string(body))
+	})
+
+	t.Run("spoofed user header", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		r.Header.Set(auth.DefaultUserIDHeader, "user1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
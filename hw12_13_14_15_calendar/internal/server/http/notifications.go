@@ -0,0 +1,132 @@
+package internalhttp
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/notify"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Renderer renders notifications, see notify.Renderer.
+type Renderer interface {
+	Render(n storage.Notification, lang string, loc *time.Location) (notify.Message, error)
+}
+
+type notificationDTO struct {
+	EventID    string    `json:"event_id"`
+	ReminderID string    `json:"reminder_id"`
+	Channel    string    `json:"channel"`
+	NotifyAt   time.Time `json:"notify_at"`
+	At         time.Time `json:"at"`
+	Status     string    `json:"status"`
+	Attempts   int       `json:"attempts,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// notifications handles GET /notifications?status=sent|failed|dead, the latest first.
+func (h *handler) notifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	deliveries, err := h.app.ListNotifications(r.Context(), storage.DeliveryStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dtos := make([]notificationDTO, 0, len(deliveries))
+	for _, d := range deliveries {
+		dtos = append(dtos, notificationDTO{
+			EventID:    d.EventID,
+			ReminderID: d.ReminderID,
+			Channel:    string(d.Channel),
+			NotifyAt:   d.NotifyAt,
+			At:         d.SentAt,
+			Status:     string(d.State()),
+			Attempts:   d.Attempts,
+			Error:      d.Error,
+		})
+	}
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+type previewRequestDTO struct {
+	Channel string   `json:"channel"`
+	Locale  string   `json:"locale"`
+	Before  duration `json:"before"`
+	Event   struct {
+		Title   string    `json:"title"`
+		StartAt time.Time `json:"start_at"`
+	} `json:"event"`
+}
+
+type messageDTO struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// notificationPreview handles POST /notifications/preview, it renders a notification
+// of a sample event in the user's time zone and locale unless another one is requested.
+func (h *handler) notificationPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	if h.renderer == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req previewRequestDTO
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	channel := storage.Channel(req.Channel)
+	if channel == "" {
+		channel = storage.ChannelEmail
+	}
+	if !channel.Valid() {
+		writeError(w, fmt.Errorf("%w: unknown channel %q", errBadRequest, req.Channel))
+		return
+	}
+	if req.Before < 0 {
+		writeError(w, fmt.Errorf("%w: negative before", errBadRequest))
+		return
+	}
+	if req.Event.Title == "" {
+		req.Event.Title = "Team meeting"
+	}
+	if req.Event.StartAt.IsZero() {
+		req.Event.StartAt = time.Now().Add(time.Hour).Truncate(time.Hour)
+	}
+
+	prefs, err := h.app.GetPreferences(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	loc, err := prefs.Location()
+	if err != nil {
+		loc = time.UTC
+	}
+	if req.Locale == "" {
+		req.Locale = prefs.Locale
+	}
+	userID, _ := auth.UserID(r.Context())
+	msg, err := h.renderer.Render(storage.Notification{
+		Title:    req.Event.Title,
+		Channel:  channel,
+		StartAt:  req.Event.StartAt,
+		NotifyAt: req.Event.StartAt.Add(-time.Duration(req.Before)),
+		UserID:   userID,
+	}, req.Locale, loc)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, messageDTO{Subject: msg.Subject, Text: msg.Text, HTML: msg.HTML})
+}
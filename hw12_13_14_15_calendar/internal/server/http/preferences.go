@@ -0,0 +1,59 @@
+package internalhttp
+
+import (
+	"net/http"
+)
+
+// preferences handles GET and PUT /users/me/preferences, the response includes the working hours.
+func (h *handler) preferences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writePreferences(w, r)
+	case http.MethodPut:
+		var req preferencesDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		prefs, err := req.preferences()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.WorkingHours != nil {
+			if req.WorkingHours.TimeZone == "" {
+				req.WorkingHours.TimeZone = prefs.TimeZone
+			}
+			hours, err := req.WorkingHours.workingHours()
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			if _, err := h.app.SetWorkingHours(r.Context(), hours); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		if _, err := h.app.SetPreferences(r.Context(), prefs); err != nil {
+			writeError(w, err)
+			return
+		}
+		h.writePreferences(w, r)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (h *handler) writePreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.app.GetPreferences(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	hours, err := h.app.GetWorkingHours(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPreferencesDTO(prefs, hours))
+}
@@ -2,27 +2,213 @@ package internalhttp
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/auth"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-type Server struct { // TODO
+type Server struct {
+	server  *http.Server
+	handler *handler
+	checks  map[string]HealthCheck
+	logger  Logger
+
+	// draining is set when the server is going to stop, stopping when it rejects new requests.
+	draining int32
+	stopping int32
+	inFlight int64
+}
+
+// HealthCheck reports the state of a component in GET /health.
+type HealthCheck func() interface{}
+
+type Application interface {
+	CreateCalendar(ctx context.Context, name string) (storage.Calendar, error)
+	ListCalendars(ctx context.Context) ([]storage.Calendar, error)
+	DeleteCalendar(ctx context.Context, calendarID string) error
+	ShareCalendar(ctx context.Context, calendarID, granteeID string, access storage.Access) error
+	RevokeShare(ctx context.Context, calendarID, granteeID string) error
+	ListShares(ctx context.Context, calendarID string) ([]storage.Grant, error)
+
+	CreateEvent(ctx context.Context, e storage.Event) (storage.Event, error)
+	UpdateEvent(ctx context.Context, e storage.Event) (storage.Event, error)
+	DeleteEvent(ctx context.Context, eventID string) error
+	GetEvent(ctx context.Context, eventID string) (storage.Event, error)
+	GetEventByUID(ctx context.Context, calendarID, uid string) (storage.Event, error)
+	PutEvent(ctx context.Context, e storage.Event) (storage.Event, bool, error)
+	ListDayEvents(ctx context.Context, date time.Time, tags ...string) ([]storage.Event, error)
+	ListWeekEvents(ctx context.Context, date time.Time, tags ...string) ([]storage.Event, error)
+	ListMonthEvents(ctx context.Context, monthStart time.Time, tags ...string) ([]storage.Event, error)
+	ListCalendarEvents(ctx context.Context, calendarID string, from, to time.Time) ([]storage.Event, error)
+	ApplyEvents(ctx context.Context, ops []storage.EventOp, atomic bool) ([]app.BatchResult, error)
+	ListTrash(ctx context.Context) ([]storage.Event, error)
+	RestoreEvent(ctx context.Context, eventID string) (storage.Event, error)
+	ListAudit(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEntry, error)
+
+	AddAttachment(ctx context.Context, eventID, name, contentType string, r io.Reader) (storage.Attachment, error)
+	AddLink(ctx context.Context, eventID, name, link string) (storage.Attachment, error)
+	OpenAttachment(ctx context.Context, eventID, attachmentID string) (storage.Attachment, io.ReadCloser, error)
+	DeleteAttachment(ctx context.Context, eventID, attachmentID string) error
+
+	CreateWebhook(ctx context.Context, url string) (storage.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]storage.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID string) error
+	EnableWebhook(ctx context.Context, webhookID string) error
+	ListWebhookDeliveries(ctx context.Context, webhookID string) ([]storage.WebhookDelivery, error)
+	ListWebhookDeadLetters(ctx context.Context, webhookID string) ([]storage.WebhookMessage, error)
+	RedriveWebhookDeadLetters(ctx context.Context, webhookID string, messageIDs []string) (int, error)
+
+	PutTag(ctx context.Context, name, color string) (storage.Tag, error)
+	ListTags(ctx context.Context) ([]storage.Tag, error)
+	DeleteTag(ctx context.Context, name string) error
+
+	SetWorkingHours(ctx context.Context, w storage.WorkingHours) (storage.WorkingHours, error)
+	GetWorkingHours(ctx context.Context) (storage.WorkingHours, error)
+	FindSlots(ctx context.Context, req app.SlotRequest) ([]app.Slot, error)
+
+	ListNotifications(ctx context.Context, status storage.DeliveryStatus) ([]storage.Delivery, error)
+
+	SetPreferences(ctx context.Context, p storage.Preferences) (storage.Preferences, error)
+	GetPreferences(ctx context.Context) (storage.Preferences, error)
+}
+
+func NewServer(app Application, authenticator auth.Authenticator, addr string) *Server {
+	h := &handler{app: app}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", helloHandler)
+	mux.HandleFunc("/calendars", h.calendars)
+	mux.HandleFunc("/calendars/", h.calendars)
+	mux.HandleFunc("/events", h.events)
+	mux.HandleFunc("/events/", h.events)
+	mux.HandleFunc("/audit", h.audit)
+	mux.HandleFunc("/trash", h.trash)
+	mux.HandleFunc("/trash/", h.trash)
+	mux.HandleFunc("/webhooks", h.webhooks)
+	mux.HandleFunc("/webhooks/", h.webhooks)
+	mux.HandleFunc("/tags", h.tags)
+	mux.HandleFunc("/tags/", h.tags)
+	mux.HandleFunc("/users/me/working-hours", h.workingHours)
+	mux.HandleFunc("/users/me/preferences", h.preferences)
+	mux.HandleFunc("/meetings/slots", h.meetingSlots)
+	mux.HandleFunc("/notifications", h.notifications)
+	mux.HandleFunc("/notifications/preview", h.notificationPreview)
+	mux.HandleFunc("/.well-known/caldav", h.wellKnownCalDAV)
+	mux.HandleFunc(davPrefix, h.dav)
+
+	s := &Server{handler: h, checks: make(map[string]HealthCheck)}
+	root := http.NewServeMux()
+	root.HandleFunc("/health", s.health)
+	root.HandleFunc("/ready", s.ready)
+	root.Handle("/", s.track(authMiddleware(authenticator, mux)))
+	s.server = &http.Server{
+		Addr: addr,
+		Handler: otelhttp.NewHandler(loggingMiddleware(s, root), "http",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method + " " + r.URL.Path
+			}),
+		),
+	}
+	return s
+}
+
+// AddHealthCheck adds the component to the health output, it must be called before Start.
+func (s *Server) AddHealthCheck(name string, check HealthCheck) {
+	s.checks[name] = check
+}
+
+// SetLogger enables the access log, it must be called before Start.
+func (s *Server) SetLogger(logger Logger) {
+	s.logger = logger
+}
+
+// SetRenderer enables notification previews, it must be called before Start.
+func (s *Server) SetRenderer(renderer Renderer) {
+	s.handler.renderer = renderer
 }
 
-type Application interface { // TODO
+// health handles GET /health, it doesn't require authentication.
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	out := map[string]interface{}{"status": "ok", "in_flight": atomic.LoadInt64(&s.inFlight)}
+	for name, check := range s.checks {
+		out[name] = check()
+	}
+	writeJSON(w, http.StatusOK, out)
 }
 
-func NewServer(app Application) *Server {
-	return &Server{}
+// ready handles GET /ready, it fails once the server is draining so that load balancers
+// stop sending requests to it.
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	if atomic.LoadInt32(&s.draining) != 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// track counts requests in flight and rejects new ones once the server is stopping.
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&s.stopping) != 0 {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "server is shutting down"})
+			return
+		}
+		atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the number of requests being served.
+func (s *Server) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	// TODO
-	<-ctx.Done()
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
 	return nil
 }
 
+// Drain reports the server as not ready, it keeps serving requests until Stop.
+func (s *Server) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// Stop rejects new requests and waits for the ones in flight until the context is done,
+// then closes the remaining connections.
 func (s *Server) Stop(ctx context.Context) error {
-	// TODO
+	s.Drain()
+	atomic.StoreInt32(&s.stopping, 1)
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		if closeErr := s.server.Close(); closeErr != nil {
+			return closeErr
+		}
+		return fmt.Errorf("%d requests were interrupted: %w", s.InFlight(), err)
+	}
 	return nil
 }
 
-// TODO
+func helloHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserID(r.Context())
+	fmt.Fprintf(w, "hello, %s\n", userID)
+}
@@ -0,0 +1,100 @@
+package internalhttp
+
+import (
+	"net/http"
+)
+
+func (h *handler) webhooks(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/webhooks")
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		webhooks, err := h.app.ListWebhooks(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		dtos := make([]webhookDTO, 0, len(webhooks))
+		for _, wh := range webhooks {
+			dtos = append(dtos, newWebhookDTO(wh))
+		}
+		writeJSON(w, http.StatusOK, dtos)
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req webhookDTO
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		wh, err := h.app.CreateWebhook(r.Context(), req.URL)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newWebhookDTO(wh))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := h.app.DeleteWebhook(r.Context(), parts[0]); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "enable" && r.Method == http.MethodPost:
+		if err := h.app.EnableWebhook(r.Context(), parts[0]); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "deliveries" && r.Method == http.MethodGet:
+		h.listWebhookDeliveries(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "dead-letters" && r.Method == http.MethodGet:
+		h.listDeadLetters(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "dead-letters" && parts[2] == "redrive" && r.Method == http.MethodPost:
+		h.redriveDeadLetters(w, r, parts[0])
+	case len(parts) <= 1:
+		methodNotAllowed(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *handler) listWebhookDeliveries(w http.ResponseWriter, r *http.Request, webhookID string) {
+	deliveries, err := h.app.ListWebhookDeliveries(r.Context(), webhookID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dtos := make([]webhookDeliveryDTO, 0, len(deliveries))
+	for _, d := range deliveries {
+		dtos = append(dtos, newWebhookDeliveryDTO(d))
+	}
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func (h *handler) listDeadLetters(w http.ResponseWriter, r *http.Request, webhookID string) {
+	dead, err := h.app.ListWebhookDeadLetters(r.Context(), webhookID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	dtos := make([]deadLetterDTO, 0, len(dead))
+	for _, m := range dead {
+		dtos = append(dtos, newDeadLetterDTO(m))
+	}
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+// redriveDeadLetters handles POST /webhooks/{id}/dead-letters/redrive, the dead letters are
+// delivered again on the next run of the retry job.
+func (h *handler) redriveDeadLetters(w http.ResponseWriter, r *http.Request, webhookID string) {
+	var req redriveDTO
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	redriven, err := h.app.RedriveWebhookDeadLetters(r.Context(), webhookID, req.IDs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redriveDTO{Redriven: redriven})
+}
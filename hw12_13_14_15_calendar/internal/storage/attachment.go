@@ -0,0 +1,21 @@
+package storage
+
+import "time"
+
+// Attachment is a file of the event kept in the blob store or a link to an external document.
+type Attachment struct {
+	ID   string
+	Name string
+	// Key is the blob key of a file, URL is the address of a link, only one of them is set.
+	Key         string
+	URL         string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+	CreatedBy   string
+}
+
+// Link reports whether the attachment is a link rather than a file.
+func (a Attachment) Link() bool {
+	return a.URL != ""
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+// ActorSystem and TransportScheduler mark the changes the service makes on its own, e.g. when
+// it purges the trash.
+const (
+	ActorSystem        = "system"
+	TransportScheduler = "scheduler"
+)
+
+// AuditEntry records a change of an event made by the actor through the transport, e.g. "http".
+type AuditEntry struct {
+	ID         string
+	TenantID   string
+	EventID    string
+	CalendarID string
+	ActorID    string
+	Transport  string
+	Change     Change
+	At         time.Time
+	Diff       []FieldChange
+}
+
+// FieldChange is a changed event field with its values formatted as strings.
+type FieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// AuditFilter selects entries of the event, of the actor or both.
+type AuditFilter struct {
+	EventID string
+	ActorID string
+}
+
+// DiffEvents returns the changed fields, the zero event stands for no event.
+func DiffEvents(before, after Event) []FieldChange {
+	diff := make([]FieldChange, 0)
+	add := func(field, b, a string) {
+		if b != a {
+			diff = append(diff, FieldChange{Field: field, Before: b, After: a})
+		}
+	}
+	add("calendar_id", before.CalendarID, after.CalendarID)
+	add("title", before.Title, after.Title)
+	add("start_at", formatTime(before.StartAt), formatTime(after.StartAt))
+	add("end_at", formatTime(before.EndAt), formatTime(after.EndAt))
+	add("description", before.Description, after.Description)
+	add("reminders", formatReminders(before.Reminders), formatReminders(after.Reminders))
+	add("tags", strings.Join(before.Tags, ","), strings.Join(after.Tags, ","))
+	add("attachments", formatAttachments(before.Attachments), formatAttachments(after.Attachments))
+	add("deleted_at", formatTime(before.DeletedAt), formatTime(after.DeletedAt))
+	return diff
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatAttachments(attachments []Attachment) string {
+	names := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func formatReminders(reminders []Reminder) string {
+	parts := make([]string, 0, len(reminders))
+	for _, r := range reminders {
+		parts = append(parts, r.Before.String()+":"+string(r.Channel))
+	}
+	return strings.Join(parts, ",")
+}
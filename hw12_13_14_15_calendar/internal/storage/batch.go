@@ -0,0 +1,23 @@
+package storage
+
+import "fmt"
+
+// EventOp is an operation of a batch, only the event ID is used to delete the event.
+type EventOp struct {
+	Change Change
+	Event  Event
+}
+
+// BatchError is returned when the operation at Index fails, no operation of the batch is applied then.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err) //nolint:errorlint
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,54 @@
+package storage
+
+import "fmt"
+
+type Calendar struct {
+	ID       string
+	TenantID string
+	OwnerID  string
+	Name     string
+}
+
+// Access is a level of access to a calendar, each level includes the previous ones.
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessFreeBusy
+	AccessRead
+	AccessReadWrite
+	AccessOwner
+)
+
+var accessNames = map[Access]string{
+	AccessNone:      "none",
+	AccessFreeBusy:  "free-busy",
+	AccessRead:      "read",
+	AccessReadWrite: "read-write",
+	AccessOwner:     "owner",
+}
+
+func (a Access) String() string {
+	if name, ok := accessNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Access(%d)", int(a))
+}
+
+// ParseAccess parses an access level which can be granted to another user.
+func ParseAccess(s string) (Access, error) {
+	for _, a := range []Access{AccessFreeBusy, AccessRead, AccessReadWrite} {
+		if accessNames[a] == s {
+			return a, nil
+		}
+	}
+	return AccessNone, fmt.Errorf("%w: %q", ErrInvalidAccess, s)
+}
+
+// Grant shares the calendar with another user.
+type Grant struct {
+	TenantID   string
+	CalendarID string
+	UserID     string
+	Access     Access
+}
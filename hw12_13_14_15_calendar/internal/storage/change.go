@@ -0,0 +1,12 @@
+package storage
+
+type Change string
+
+const (
+	ChangeCreated  Change = "created"
+	ChangeUpdated  Change = "updated"
+	ChangeDeleted  Change = "deleted"
+	ChangeRestored Change = "restored"
+	// ChangePurged events are deleted from the trash for good.
+	ChangePurged Change = "purged"
+)
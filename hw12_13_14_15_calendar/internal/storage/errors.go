@@ -0,0 +1,23 @@
+package storage
+
+import "errors"
+
+var (
+	ErrEventNotFound        = errors.New("event not found")
+	ErrEventExists          = errors.New("event already exists")
+	ErrCalendarNotFound     = errors.New("calendar not found")
+	ErrCalendarExists       = errors.New("calendar already exists")
+	ErrCalendarNotEmpty     = errors.New("calendar has events")
+	ErrAccessDenied         = errors.New("access denied")
+	ErrInvalidAccess        = errors.New("invalid access level")
+	ErrReminderNotFound     = errors.New("reminder not found")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookExists        = errors.New("webhook already exists")
+	ErrInvalidOperation     = errors.New("invalid operation")
+	ErrTagNotFound          = errors.New("tag not found")
+	ErrWorkingHoursNotFound = errors.New("working hours not found")
+	ErrLeaseHeld            = errors.New("lease is held by another holder")
+	ErrPreferencesNotFound  = errors.New("preferences not found")
+	ErrAttachmentNotFound   = errors.New("attachment not found")
+	ErrTooManyAttachments   = errors.New("too many attachments")
+)
@@ -1,7 +1,90 @@
 package storage
 
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
 type Event struct {
-	ID    string
-	Title string
-	// TODO
+	ID         string
+	CalendarID string
+	// TenantID is the tenant of the calendar, the storage sets it.
+	TenantID string
+	// UID is the iCalendar UID chosen by the client, it is unique within the calendar.
+	// Events created through the API have none and use their ID instead.
+	UID         string
+	OwnerID     string
+	Title       string
+	StartAt     time.Time
+	EndAt       time.Time
+	Description string
+	Reminders   []Reminder
+	// Tags are names of the tags, the colours are kept by each user in Tag.
+	Tags []string
+	// Attachments are managed on their own, updates of the event keep them.
+	Attachments []Attachment
+	// DeletedAt is set when the event is moved to the trash, such events are hidden
+	// from everything but the trash.
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// Deleted reports whether the event is in the trash.
+func (e Event) Deleted() bool {
+	return !e.DeletedAt.IsZero()
+}
+
+// ICalUID returns the iCalendar UID of the event.
+func (e Event) ICalUID() string {
+	if e.UID != "" {
+		return e.UID
+	}
+	return e.ID
+}
+
+// HasAnyTag reports whether the event has at least one of the tags, any event matches no tags.
+func (e Event) HasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, t := range e.Tags {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FreeBusy returns the event without anything but its time slot.
+func (e Event) FreeBusy() Event {
+	return Event{
+		ID:         e.ID,
+		CalendarID: e.CalendarID,
+		UID:        e.UID,
+		OwnerID:    e.OwnerID,
+		StartAt:    e.StartAt,
+		EndAt:      e.EndAt,
+	}
+}
+
+// Overlaps reports whether the event intersects [from, to), an event with no duration
+// does if it starts within the range.
+func (e Event) Overlaps(from, to time.Time) bool {
+	if e.EndAt.Equal(e.StartAt) {
+		return !e.StartAt.Before(from) && e.StartAt.Before(to)
+	}
+	return e.StartAt.Before(to) && e.EndAt.After(from)
+}
+
+// SortEvents sorts events by start time and ID.
+func SortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].StartAt.Equal(events[j].StartAt) {
+			return events[i].StartAt.Before(events[j].StartAt)
+		}
+		return events[i].ID < events[j].ID
+	})
 }
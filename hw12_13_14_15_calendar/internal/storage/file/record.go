@@ -0,0 +1,155 @@
+package filestorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	opCreateCalendar = "create_calendar"
+	opDeleteCalendar = "delete_calendar"
+	opShareCalendar  = "share_calendar"
+	opRevokeShare    = "revoke_share"
+	opCreateEvent    = "create_event"
+	opUpdateEvent    = "update_event"
+	opDeleteEvent    = "delete_event"
+	opMarkDelivered  = "mark_delivered"
+	opEnqueue        = "enqueue_notifications"
+	opApplyEventOps  = "apply_event_ops"
+	opTrashEvent     = "trash_event"
+	opRestoreEvent   = "restore_event"
+	opPurgeTrash     = "purge_trash"
+	opAppendAudit    = "append_audit"
+
+	opAddAttachment    = "add_attachment"
+	opRemoveAttachment = "remove_attachment"
+
+	opSetWorkingHours = "set_working_hours"
+	opPutTag          = "put_tag"
+	opDeleteTag       = "delete_tag"
+	opSetPreferences  = "set_preferences"
+
+	opCreateWebhook       = "create_webhook"
+	opDeleteWebhook       = "delete_webhook"
+	opEnableWebhook       = "enable_webhook"
+	opAddWebhookDelivery  = "add_webhook_delivery"
+	opRecordWebhookResult = "record_webhook_result"
+
+	opSaveWebhookMessage   = "save_webhook_message"
+	opDeleteWebhookMessage = "delete_webhook_message"
+	opClaimWebhookMessages = "claim_webhook_messages"
+	opRedriveDeadLetters   = "redrive_dead_letters"
+)
+
+// record is a log entry, it keeps the arguments of a storage call. Replaying the calls
+// in the same order on the same data gives the same result, access checks included.
+type record struct {
+	Seq       uint64
+	Op        string
+	TenantID  string               `json:",omitempty"`
+	UserID    string               `json:",omitempty"`
+	ID        string               `json:",omitempty"`
+	GranteeID string               `json:",omitempty"`
+	Calendar  *storage.Calendar    `json:",omitempty"`
+	Grant     *storage.Grant       `json:",omitempty"`
+	Event     *storage.Event       `json:",omitempty"`
+	Delivery  *storage.Delivery    `json:",omitempty"`
+	Ops       []storage.EventOp    `json:",omitempty"`
+	At        *time.Time           `json:",omitempty"`
+	Audit     []storage.AuditEntry `json:",omitempty"`
+
+	Attachment     *storage.Attachment `json:",omitempty"`
+	MaxAttachments int                 `json:",omitempty"`
+
+	WorkingHours *storage.WorkingHours `json:",omitempty"`
+	Tag          *storage.Tag          `json:",omitempty"`
+	Preferences  *storage.Preferences  `json:",omitempty"`
+
+	Webhook         *storage.Webhook         `json:",omitempty"`
+	WebhookDelivery *storage.WebhookDelivery `json:",omitempty"`
+	Success         bool                     `json:",omitempty"`
+	MaxFailures     int                      `json:",omitempty"`
+
+	WebhookMessage *storage.WebhookMessage `json:",omitempty"`
+	Until          *time.Time              `json:",omitempty"`
+	Limit          int                     `json:",omitempty"`
+	IDs            []string                `json:",omitempty"`
+}
+
+// exec applies the record to the in-memory data in the tenant of the record.
+func (s *Storage) exec(ctx context.Context, rec record) error {
+	ctx = storage.WithTenantID(ctx, rec.TenantID)
+	mem := s.Storage
+	switch {
+	case rec.Op == opCreateCalendar && rec.Calendar != nil:
+		return mem.CreateCalendar(ctx, *rec.Calendar)
+	case rec.Op == opDeleteCalendar:
+		return mem.DeleteCalendar(ctx, rec.UserID, rec.ID)
+	case rec.Op == opShareCalendar && rec.Grant != nil:
+		return mem.ShareCalendar(ctx, rec.UserID, *rec.Grant)
+	case rec.Op == opRevokeShare:
+		return mem.RevokeShare(ctx, rec.UserID, rec.ID, rec.GranteeID)
+	case rec.Op == opCreateEvent && rec.Event != nil:
+		return mem.CreateEvent(ctx, rec.UserID, *rec.Event)
+	case rec.Op == opUpdateEvent && rec.Event != nil:
+		return mem.UpdateEvent(ctx, rec.UserID, *rec.Event)
+	case rec.Op == opDeleteEvent:
+		return mem.DeleteEvent(ctx, rec.UserID, rec.ID)
+	case rec.Op == opApplyEventOps:
+		return mem.ApplyEventOps(ctx, rec.UserID, rec.Ops)
+	case rec.Op == opTrashEvent && rec.At != nil:
+		return mem.TrashEvent(ctx, rec.UserID, rec.ID, *rec.At)
+	case rec.Op == opRestoreEvent:
+		return mem.RestoreEvent(ctx, rec.UserID, rec.ID)
+	case rec.Op == opPurgeTrash && rec.At != nil:
+		_, err := mem.PurgeTrash(ctx, *rec.At)
+		return err
+	case rec.Op == opAddAttachment && rec.Attachment != nil:
+		_, err := mem.AddAttachment(ctx, rec.UserID, rec.ID, *rec.Attachment, rec.MaxAttachments)
+		return err
+	case rec.Op == opRemoveAttachment && rec.Attachment != nil:
+		_, err := mem.RemoveAttachment(ctx, rec.UserID, rec.ID, rec.Attachment.ID)
+		return err
+	case rec.Op == opAppendAudit:
+		return mem.AppendAudit(ctx, rec.Audit...)
+	case rec.Op == opSetWorkingHours && rec.WorkingHours != nil:
+		return mem.SetWorkingHours(ctx, *rec.WorkingHours)
+	case rec.Op == opSetPreferences && rec.Preferences != nil:
+		return mem.SetPreferences(ctx, *rec.Preferences)
+	case rec.Op == opPutTag && rec.Tag != nil:
+		return mem.PutTag(ctx, *rec.Tag)
+	case rec.Op == opDeleteTag:
+		return mem.DeleteTag(ctx, rec.UserID, rec.ID)
+	case rec.Op == opMarkDelivered && rec.Delivery != nil:
+		return mem.MarkDelivered(ctx, *rec.Delivery)
+	case rec.Op == opEnqueue && rec.At != nil:
+		_, err := mem.EnqueueNotifications(ctx, *rec.At)
+		return err
+	case rec.Op == opCreateWebhook && rec.Webhook != nil:
+		return mem.CreateWebhook(ctx, *rec.Webhook)
+	case rec.Op == opDeleteWebhook:
+		return mem.DeleteWebhook(ctx, rec.UserID, rec.ID)
+	case rec.Op == opEnableWebhook:
+		return mem.EnableWebhook(ctx, rec.UserID, rec.ID)
+	case rec.Op == opAddWebhookDelivery && rec.WebhookDelivery != nil:
+		return mem.AddWebhookDelivery(ctx, *rec.WebhookDelivery)
+	case rec.Op == opRecordWebhookResult:
+		_, err := mem.RecordWebhookResult(ctx, rec.ID, rec.Success, rec.MaxFailures)
+		return err
+	case rec.Op == opSaveWebhookMessage && rec.WebhookMessage != nil:
+		return mem.SaveWebhookMessage(ctx, *rec.WebhookMessage)
+	case rec.Op == opDeleteWebhookMessage:
+		return mem.DeleteWebhookMessage(ctx, rec.ID)
+	case rec.Op == opClaimWebhookMessages && rec.At != nil && rec.Until != nil:
+		_, err := mem.ClaimWebhookMessages(ctx, *rec.At, *rec.Until, rec.Limit)
+		return err
+	case rec.Op == opRedriveDeadLetters && rec.At != nil:
+		_, err := mem.RedriveWebhookDeadLetters(ctx, rec.UserID, rec.ID, rec.IDs, *rec.At)
+		return err
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+}
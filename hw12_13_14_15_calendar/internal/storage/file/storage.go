@@ -0,0 +1,503 @@
+package filestorage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+)
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+)
+
+var (
+	ErrClosed    = errors.New("storage is closed")
+	ErrCorrupted = errors.New("storage files are corrupted")
+
+	// errUnchanged is returned by a change which changed nothing, so there is nothing to log.
+	errUnchanged = errors.New("unchanged")
+)
+
+// Storage keeps the data in memory and persists every change to an append-only
+// write-ahead log in the directory. The log is periodically compacted into a snapshot.
+type Storage struct {
+	*memorystorage.Storage
+
+	dir             string
+	compactInterval time.Duration
+
+	mu      sync.Mutex // serializes changes so the log order matches the memory state
+	wal     *os.File
+	seq     uint64
+	records int
+	err     error // a change is applied in memory but not persisted, the storage is read-only
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates the storage in dir, a non-positive compactInterval disables periodic compaction.
+func New(dir string, compactInterval time.Duration) *Storage {
+	return &Storage{
+		Storage:         memorystorage.New(),
+		dir:             dir,
+		compactInterval: compactInterval,
+	}
+}
+
+type snapshotData struct {
+	Seq  uint64
+	Data storage.Snapshot
+}
+
+// Connect recovers the data from the snapshot and the log and opens the log for writing.
+func (s *Storage) Connect(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	if err := s.loadSnapshot(ctx); err != nil {
+		return err
+	}
+	if err := s.replay(ctx); err != nil {
+		return err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	s.wal = wal
+
+	s.done = make(chan struct{})
+	if s.compactInterval > 0 {
+		s.wg.Add(1)
+		go s.compactLoop()
+	}
+	return nil
+}
+
+// Close compacts the log and closes it.
+func (s *Storage) Close(ctx context.Context) error {
+	if s.done == nil {
+		return nil
+	}
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.err
+	if err == nil {
+		err = s.compact(ctx)
+	}
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	s.wal = nil
+	return err
+}
+
+func (s *Storage) loadSnapshot(ctx context.Context) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshotData
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("%w: decode snapshot: %v", ErrCorrupted, err) //nolint:errorlint
+	}
+	s.seq = snap.Seq
+	return s.Storage.Restore(ctx, snap.Data)
+}
+
+// replay applies the log records written after the snapshot. A partially written
+// last record is left from a crash in the middle of a write and is cut off.
+func (s *Storage) replay(ctx context.Context) error {
+	path := filepath.Join(s.dir, walFile)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				return os.Truncate(path, offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("%w: decode record at offset %d: %v", ErrCorrupted, offset, err) //nolint:errorlint
+		}
+		offset += int64(len(line))
+
+		if rec.Seq <= s.seq {
+			continue
+		}
+		if err := s.exec(ctx, rec); err != nil {
+			return fmt.Errorf("%w: replay record %d: %v", ErrCorrupted, rec.Seq, err) //nolint:errorlint
+		}
+		s.seq = rec.Seq
+		s.records++
+	}
+}
+
+// apply changes the data in memory and appends the change to the log.
+func (s *Storage) apply(ctx context.Context, rec record) error {
+	rec.TenantID = storage.TenantID(ctx)
+	return s.applyFunc(rec, func() error {
+		return s.exec(ctx, rec)
+	})
+}
+
+// applyFunc changes the data in memory with the function, which must do the same as
+// replaying the record, and appends the record to the log.
+func (s *Storage) applyFunc(rec record, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return ErrClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if err := change(); errors.Is(err, errUnchanged) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	rec.Seq = s.seq + 1
+	if err := s.append(rec); err != nil {
+		s.err = fmt.Errorf("write log: %w", err)
+		return s.err
+	}
+	s.seq = rec.Seq
+	s.records++
+	return nil
+}
+
+func (s *Storage) append(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wal.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.wal.Sync()
+}
+
+func (s *Storage) compactLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = s.compact(context.Background())
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// compact writes the snapshot and empties the log, it must be called with s.mu locked.
+func (s *Storage) compact(ctx context.Context) error {
+	if s.records == 0 {
+		return nil
+	}
+	if err := s.writeSnapshot(ctx); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate log: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		return err
+	}
+	s.records = 0
+	return nil
+}
+
+// writeSnapshot atomically replaces the snapshot file.
+func (s *Storage) writeSnapshot(ctx context.Context) error {
+	data, err := s.Storage.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snapshotData{Seq: s.seq, Data: data}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *Storage) CreateCalendar(ctx context.Context, cal storage.Calendar) error {
+	return s.apply(ctx, record{Op: opCreateCalendar, Calendar: &cal})
+}
+
+func (s *Storage) DeleteCalendar(ctx context.Context, userID, calendarID string) error {
+	return s.apply(ctx, record{Op: opDeleteCalendar, UserID: userID, ID: calendarID})
+}
+
+func (s *Storage) ShareCalendar(ctx context.Context, userID string, grant storage.Grant) error {
+	return s.apply(ctx, record{Op: opShareCalendar, UserID: userID, Grant: &grant})
+}
+
+func (s *Storage) RevokeShare(ctx context.Context, userID, calendarID, granteeID string) error {
+	return s.apply(ctx, record{Op: opRevokeShare, UserID: userID, ID: calendarID, GranteeID: granteeID})
+}
+
+func (s *Storage) CreateEvent(ctx context.Context, userID string, e storage.Event) error {
+	return s.apply(ctx, record{Op: opCreateEvent, UserID: userID, Event: &e})
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, userID string, e storage.Event) error {
+	return s.apply(ctx, record{Op: opUpdateEvent, UserID: userID, Event: &e})
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, userID, eventID string) error {
+	return s.apply(ctx, record{Op: opDeleteEvent, UserID: userID, ID: eventID})
+}
+
+func (s *Storage) ApplyEventOps(ctx context.Context, userID string, ops []storage.EventOp) error {
+	return s.apply(ctx, record{Op: opApplyEventOps, UserID: userID, Ops: ops})
+}
+
+func (s *Storage) TrashEvent(ctx context.Context, userID, eventID string, at time.Time) error {
+	return s.apply(ctx, record{Op: opTrashEvent, UserID: userID, ID: eventID, At: &at})
+}
+
+func (s *Storage) RestoreEvent(ctx context.Context, userID, eventID string) error {
+	return s.apply(ctx, record{Op: opRestoreEvent, UserID: userID, ID: eventID})
+}
+
+func (s *Storage) AppendAudit(ctx context.Context, entries ...storage.AuditEntry) error {
+	return s.apply(ctx, record{Op: opAppendAudit, Audit: entries})
+}
+
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error) {
+	var purged []storage.Event
+	err := s.applyFunc(record{Op: opPurgeTrash, At: &before}, func() (err error) {
+		purged, err = s.Storage.PurgeTrash(ctx, before)
+		if err == nil && len(purged) == 0 {
+			return errUnchanged
+		}
+		return err
+	})
+	return purged, err
+}
+
+func (s *Storage) AddAttachment(
+	ctx context.Context, userID, eventID string, att storage.Attachment, max int,
+) (storage.Event, error) {
+	rec := record{
+		Op: opAddAttachment, TenantID: storage.TenantID(ctx), UserID: userID, ID: eventID,
+		Attachment: &att, MaxAttachments: max,
+	}
+	var before storage.Event
+	err := s.applyFunc(rec, func() (err error) {
+		before, err = s.Storage.AddAttachment(ctx, userID, eventID, att, max)
+		return err
+	})
+	return before, err
+}
+
+func (s *Storage) RemoveAttachment(ctx context.Context, userID, eventID, attachmentID string) (storage.Event, error) {
+	rec := record{
+		Op: opRemoveAttachment, TenantID: storage.TenantID(ctx), UserID: userID, ID: eventID,
+		Attachment: &storage.Attachment{ID: attachmentID},
+	}
+	var before storage.Event
+	err := s.applyFunc(rec, func() (err error) {
+		before, err = s.Storage.RemoveAttachment(ctx, userID, eventID, attachmentID)
+		return err
+	})
+	return before, err
+}
+
+func (s *Storage) SetWorkingHours(ctx context.Context, w storage.WorkingHours) error {
+	return s.apply(ctx, record{Op: opSetWorkingHours, WorkingHours: &w})
+}
+
+func (s *Storage) SetPreferences(ctx context.Context, p storage.Preferences) error {
+	return s.apply(ctx, record{Op: opSetPreferences, Preferences: &p})
+}
+
+func (s *Storage) PutTag(ctx context.Context, tag storage.Tag) error {
+	return s.apply(ctx, record{Op: opPutTag, Tag: &tag})
+}
+
+func (s *Storage) DeleteTag(ctx context.Context, userID, name string) error {
+	return s.apply(ctx, record{Op: opDeleteTag, UserID: userID, ID: name})
+}
+
+func (s *Storage) MarkDelivered(ctx context.Context, d storage.Delivery) error {
+	return s.apply(ctx, record{Op: opMarkDelivered, Delivery: &d})
+}
+
+func (s *Storage) EnqueueNotifications(ctx context.Context, now time.Time) (int, error) {
+	var queued int
+	err := s.applyFunc(record{Op: opEnqueue, At: &now}, func() (err error) {
+		queued, err = s.Storage.EnqueueNotifications(ctx, now)
+		if err == nil && queued == 0 {
+			return errUnchanged
+		}
+		return err
+	})
+	return queued, err
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, w storage.Webhook) error {
+	return s.apply(ctx, record{Op: opCreateWebhook, Webhook: &w})
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	return s.apply(ctx, record{Op: opDeleteWebhook, UserID: userID, ID: webhookID})
+}
+
+func (s *Storage) EnableWebhook(ctx context.Context, userID, webhookID string) error {
+	return s.apply(ctx, record{Op: opEnableWebhook, UserID: userID, ID: webhookID})
+}
+
+func (s *Storage) AddWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error {
+	return s.apply(ctx, record{Op: opAddWebhookDelivery, WebhookDelivery: &d})
+}
+
+func (s *Storage) RecordWebhookResult(ctx context.Context, webhookID string, success bool, maxFailures int) (storage.Webhook, error) {
+	rec := record{Op: opRecordWebhookResult, ID: webhookID, Success: success, MaxFailures: maxFailures}
+	var w storage.Webhook
+	err := s.applyFunc(rec, func() (err error) {
+		w, err = s.Storage.RecordWebhookResult(ctx, webhookID, success, maxFailures)
+		return err
+	})
+	return w, err
+}
+
+func (s *Storage) SaveWebhookMessage(ctx context.Context, m storage.WebhookMessage) error {
+	return s.apply(ctx, record{Op: opSaveWebhookMessage, WebhookMessage: &m})
+}
+
+func (s *Storage) DeleteWebhookMessage(ctx context.Context, messageID string) error {
+	return s.apply(ctx, record{Op: opDeleteWebhookMessage, ID: messageID})
+}
+
+func (s *Storage) ClaimWebhookMessages(ctx context.Context, now, until time.Time, limit int) ([]storage.WebhookMessage, error) {
+	var claimed []storage.WebhookMessage
+	rec := record{Op: opClaimWebhookMessages, At: &now, Until: &until, Limit: limit}
+	err := s.applyFunc(rec, func() (err error) {
+		claimed, err = s.Storage.ClaimWebhookMessages(ctx, now, until, limit)
+		if err == nil && len(claimed) == 0 {
+			return errUnchanged
+		}
+		return err
+	})
+	return claimed, err
+}
+
+func (s *Storage) RedriveWebhookDeadLetters(
+	ctx context.Context, userID, webhookID string, messageIDs []string, now time.Time,
+) (int, error) {
+	rec := record{
+		Op: opRedriveDeadLetters, TenantID: storage.TenantID(ctx), UserID: userID, ID: webhookID,
+		IDs: messageIDs, At: &now,
+	}
+	var redriven int
+	err := s.applyFunc(rec, func() (err error) {
+		redriven, err = s.Storage.RedriveWebhookDeadLetters(ctx, userID, webhookID, messageIDs, now)
+		if err == nil && redriven == 0 {
+			return errUnchanged
+		}
+		return err
+	})
+	return redriven, err
+}
+
+// Restore replaces all the data with the snapshot and compacts the log.
+func (s *Storage) Restore(ctx context.Context, snap storage.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return ErrClosed
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.Storage.Restore(ctx, snap); err != nil {
+		return err
+	}
+	s.seq++
+	s.records++
+	if err := s.compact(ctx); err != nil {
+		s.err = err
+		return err
+	}
+	return nil
+}
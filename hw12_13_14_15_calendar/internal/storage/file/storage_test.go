@@ -0,0 +1,201 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+var day = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func open(t *testing.T, dir string, compactInterval time.Duration) *Storage {
+	t.Helper()
+
+	s := New(dir, compactInterval)
+	require.NoError(t, s.Connect(context.Background()))
+	return s
+}
+
+func newEvent(id string) storage.Event {
+	return storage.Event{
+		ID:         id,
+		CalendarID: "work",
+		OwnerID:    "owner",
+		Title:      "event " + id,
+		StartAt:    day,
+		EndAt:      day.Add(time.Hour),
+	}
+}
+
+func fill(t *testing.T, s *Storage, ids ...string) {
+	t.Helper()
+
+	ctx := context.Background()
+	for _, id := range ids {
+		require.NoError(t, s.CreateEvent(ctx, "owner", newEvent(id)))
+	}
+}
+
+func requireEvents(t *testing.T, s *Storage, ids ...string) {
+	t.Helper()
+
+	events, err := s.ListEvents(context.Background(), "owner", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	got := make([]string, 0, len(events))
+	for _, e := range events {
+		got = append(got, e.ID)
+	}
+	require.Equal(t, ids, got)
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s := open(t, t.TempDir(), 0)
+		t.Cleanup(func() { require.NoError(t, s.Close(context.Background())) })
+		return s
+	})
+}
+
+func BenchmarkStorage(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storagetest.Storage {
+		s := New(b.TempDir(), 0)
+		require.NoError(b, s.Connect(context.Background()))
+		b.Cleanup(func() { require.NoError(b, s.Close(context.Background())) })
+		return s
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("log only", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+		fill(t, s, "1", "2", "3")
+		require.NoError(t, s.DeleteEvent(ctx, "owner", "2"))
+
+		// Not closed, as if the process crashed.
+		requireEvents(t, open(t, dir, 0), "1", "3")
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+		fill(t, s, "1")
+		require.NoError(t, s.ApplyEventOps(ctx, "owner", []storage.EventOp{
+			{Change: storage.ChangeCreated, Event: newEvent("2")},
+			{Change: storage.ChangeDeleted, Event: storage.Event{ID: "1", DeletedAt: day}},
+		}))
+		require.Error(t, s.ApplyEventOps(ctx, "owner", []storage.EventOp{
+			{Change: storage.ChangeCreated, Event: newEvent("3")},
+			{Change: storage.ChangeDeleted, Event: storage.Event{ID: "1", DeletedAt: day}},
+		}))
+
+		requireEvents(t, open(t, dir, 0), "2")
+	})
+
+	t.Run("snapshot and log", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+		fill(t, s, "1", "2")
+
+		s.mu.Lock()
+		require.NoError(t, s.compact(ctx))
+		s.mu.Unlock()
+
+		fill(t, s, "3")
+		require.NoError(t, s.DeleteEvent(ctx, "owner", "1"))
+		requireEvents(t, open(t, dir, 0), "2", "3")
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+		fill(t, s, "1")
+		require.NoError(t, s.Close(ctx))
+		require.True(t, errors.Is(s.CreateEvent(ctx, "owner", newEvent("2")), ErrClosed))
+
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		require.NoError(t, err)
+		require.Zero(t, info.Size())
+		requireEvents(t, open(t, dir, 0), "1")
+	})
+
+	t.Run("torn write", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+		fill(t, s, "1")
+
+		f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"Seq":3,"Op":"create_ev`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		s = open(t, dir, 0)
+		requireEvents(t, s, "1")
+		fill(t, s, "2")
+		requireEvents(t, open(t, dir, 0), "1", "2")
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		acme := storage.WithTenantID(ctx, "acme")
+		require.NoError(t, s.CreateCalendar(acme, storage.Calendar{ID: "work", OwnerID: "owner"}))
+		require.NoError(t, s.CreateEvent(acme, "owner", newEvent("1")))
+
+		s = open(t, dir, 0)
+		_, err := s.GetEvent(acme, "owner", "1")
+		require.NoError(t, err)
+		_, err = s.GetEvent(ctx, "owner", "1")
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+	})
+
+	t.Run("corrupted log", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir, 0)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+
+		f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = f.WriteString("garbage\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		fill(t, s, "1")
+
+		err = New(dir, 0).Connect(ctx)
+		require.True(t, errors.Is(err, ErrCorrupted))
+	})
+}
+
+func TestPeriodicCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir, 10*time.Millisecond)
+	defer s.Close(ctx)
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	fill(t, s, "1", "2")
+
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		return err == nil && info.Size() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	_, err := os.Stat(filepath.Join(dir, snapshotFile))
+	require.NoError(t, err)
+	requireEvents(t, open(t, dir, 0), "1", "2")
+}
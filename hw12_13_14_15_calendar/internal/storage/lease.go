@@ -0,0 +1,15 @@
+package storage
+
+import "time"
+
+// Lease gives its holder exclusive rights, e.g. to run scheduled jobs, until it expires.
+type Lease struct {
+	Name      string
+	Holder    string
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the lease can be taken by another holder.
+func (l Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
@@ -0,0 +1,53 @@
+package memorystorage
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AddAttachment adds the attachment to the event unless it has max attachments already,
+// it returns the event before the change.
+func (s *Storage) AddAttachment(
+	ctx context.Context, userID, eventID string, att storage.Attachment, max int,
+) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	before, err := s.writableEvent(tenantID, userID, eventID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if len(before.Attachments) >= max {
+		return storage.Event{}, storage.ErrTooManyAttachments
+	}
+	e := clone(before)
+	e.Attachments = append(e.Attachments, att)
+	s.events[tenantKey(tenantID, eventID)] = e
+	return clone(before), nil
+}
+
+// RemoveAttachment removes the attachment from the event, it returns the event before the change.
+func (s *Storage) RemoveAttachment(ctx context.Context, userID, eventID, attachmentID string) (storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	before, err := s.writableEvent(tenantID, userID, eventID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	e := clone(before)
+	e.Attachments = make([]storage.Attachment, 0, len(before.Attachments))
+	for _, att := range before.Attachments {
+		if att.ID != attachmentID {
+			e.Attachments = append(e.Attachments, att)
+		}
+	}
+	if len(e.Attachments) == len(before.Attachments) {
+		return storage.Event{}, storage.ErrAttachmentNotFound
+	}
+	s.events[tenantKey(tenantID, eventID)] = e
+	return clone(before), nil
+}
@@ -0,0 +1,44 @@
+package memorystorage
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AppendAudit adds the entries to the audit log, they are never changed afterwards.
+func (s *Storage) AppendAudit(ctx context.Context, entries ...storage.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	for _, entry := range entries {
+		entry.TenantID = tenantID
+		entry.Diff = append([]storage.FieldChange(nil), entry.Diff...)
+		s.audit = append(s.audit, entry)
+	}
+	return nil
+}
+
+// ListAudit returns the entries matching the filter of the calendars the user can read, newest first.
+func (s *Storage) ListAudit(ctx context.Context, userID string, filter storage.AuditFilter) ([]storage.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	entries := make([]storage.AuditEntry, 0)
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		entry := s.audit[i]
+		if entry.TenantID != tenantID ||
+			filter.EventID != "" && entry.EventID != filter.EventID ||
+			filter.ActorID != "" && entry.ActorID != filter.ActorID {
+			continue
+		}
+		if a, err := s.access(tenantID, userID, entry.CalendarID); err != nil || a < storage.AccessRead {
+			continue
+		}
+		entry.Diff = append([]storage.FieldChange(nil), entry.Diff...)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,40 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AcquireLease takes the lease if it is free or expired at now, or renews it for the same holder.
+// If another holder has the lease, it is returned with ErrLeaseHeld.
+//
+// Leases are not a part of snapshots and aren't persisted, they expire within a lease period anyway.
+func (s *Storage) AcquireLease(ctx context.Context, lease storage.Lease, now time.Time) (storage.Lease, error) {
+	if lease.Name == "" || lease.Holder == "" || !lease.ExpiresAt.After(now) {
+		return storage.Lease{}, fmt.Errorf("%w: invalid lease", storage.ErrInvalidOperation)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.leases[lease.Name]; ok && current.Holder != lease.Holder && !current.Expired(now) {
+		return current, storage.ErrLeaseHeld
+	}
+	s.leases[lease.Name] = lease
+	return lease, nil
+}
+
+// ReleaseLease gives up the lease so that another holder doesn't have to wait for it to expire.
+// Releasing a lease held by someone else does nothing.
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.leases[name]; ok && current.Holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package memorystorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// EnqueueNotifications marks the notifications due at now as queued and adds them to the outbox
+// at once, so a notification is neither lost nor queued twice. It returns the number of added messages.
+func (s *Storage) EnqueueNotifications(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outbox := make([]storage.OutboxMessage, 0, len(s.outbox))
+	for _, m := range s.outbox {
+		if s.queued(m) {
+			outbox = append(outbox, m)
+		}
+	}
+	due := s.dueNotifications(now)
+	for _, n := range due {
+		key := tenantKey(n.TenantID, n.EventID)
+		if s.deliveries[key] == nil {
+			s.deliveries[key] = make(map[string]storage.Delivery)
+		}
+		s.deliveries[key][n.ReminderID] = storage.Delivery{
+			TenantID:   n.TenantID,
+			EventID:    n.EventID,
+			ReminderID: n.ReminderID,
+			Channel:    n.Channel,
+			NotifyAt:   n.NotifyAt,
+			SentAt:     now,
+			Status:     storage.DeliveryQueued,
+			Attempts:   n.Attempts,
+		}
+		outbox = append(outbox, storage.NewOutboxMessage(n, now))
+	}
+	s.outbox = outbox
+	return len(due), nil
+}
+
+// ListOutbox returns the messages of the outbox, the oldest first. Messages of deleted events and
+// of reminders changed since they were queued are skipped.
+func (s *Storage) ListOutbox(ctx context.Context) ([]storage.OutboxMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	messages := make([]storage.OutboxMessage, 0, len(s.outbox))
+	for _, m := range s.outbox {
+		if s.queued(m) {
+			messages = append(messages, m)
+		}
+	}
+	return messages, nil
+}
+
+// queued reports whether the notification of the message is still waiting to be sent.
+func (s *Storage) queued(m storage.OutboxMessage) bool {
+	n := m.Notification
+	key := tenantKey(n.TenantID, n.EventID)
+	e, ok := s.events[key]
+	if !ok || e.Deleted() {
+		return false
+	}
+	d, ok := s.deliveries[key][n.ReminderID]
+	if !ok || d.State() != storage.DeliveryQueued || !n.Delivered(d) {
+		return false
+	}
+	for _, r := range e.Reminders {
+		if r.ID == n.ReminderID {
+			return r.Channel == n.Channel && e.StartAt.Add(-r.Before).Equal(n.NotifyAt)
+		}
+	}
+	return false
+}
+
+func (s *Storage) removeOutbox(tenantID, eventID, reminderID string) {
+	outbox := s.outbox[:0]
+	for _, m := range s.outbox {
+		n := m.Notification
+		if n.TenantID != tenantID || n.EventID != eventID || n.ReminderID != reminderID {
+			outbox = append(outbox, m)
+		}
+	}
+	s.outbox = outbox
+}
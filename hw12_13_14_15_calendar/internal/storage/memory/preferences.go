@@ -0,0 +1,34 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// SetPreferences replaces the preferences of the user.
+func (s *Storage) SetPreferences(ctx context.Context, p storage.Preferences) error {
+	if p.UserID == "" {
+		return fmt.Errorf("%w: no user", storage.ErrInvalidOperation)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.TenantID = storage.TenantID(ctx)
+	s.preferences[tenantKey(p.TenantID, p.UserID)] = p
+	return nil
+}
+
+// GetPreferences returns the preferences of the user.
+func (s *Storage) GetPreferences(ctx context.Context, userID string) (storage.Preferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.preferences[tenantKey(storage.TenantID(ctx), userID)]
+	if !ok {
+		return storage.Preferences{}, storage.ErrPreferencesNotFound
+	}
+	return p, nil
+}
@@ -1,14 +1,745 @@
 package memorystorage
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Storage keeps the data of all tenants. IDs of calendars, events and webhooks are unique
+// within their tenant only, the maps are keyed by tenantKey of the tenant and the ID.
 type Storage struct {
-	// TODO
-	mu sync.RWMutex
+	mu         sync.RWMutex
+	calendars  map[string]storage.Calendar
+	grants     map[string]map[string]storage.Access // calendar key -> user ID -> access
+	events     map[string]storage.Event
+	deliveries map[string]map[string]storage.Delivery // event key -> reminder ID -> last delivery
+	outbox     []storage.OutboxMessage                // oldest first
+
+	webhooks          map[string]storage.Webhook
+	webhookDeliveries map[string][]storage.WebhookDelivery // webhook key -> deliveries, oldest first
+	webhookMessages   map[string]storage.WebhookMessage    // message key -> message
+
+	audit []storage.AuditEntry // oldest first
+
+	workingHours map[string]storage.WorkingHours   // user key -> working hours
+	tags         map[string]map[string]storage.Tag // user key -> lower-cased name -> tag
+	preferences  map[string]storage.Preferences    // user key -> preferences
+
+	leases map[string]storage.Lease
 }
 
 func New() *Storage {
-	return &Storage{}
+	return &Storage{
+		calendars:  make(map[string]storage.Calendar),
+		grants:     make(map[string]map[string]storage.Access),
+		events:     make(map[string]storage.Event),
+		deliveries: make(map[string]map[string]storage.Delivery),
+
+		webhooks:          make(map[string]storage.Webhook),
+		webhookDeliveries: make(map[string][]storage.WebhookDelivery),
+		webhookMessages:   make(map[string]storage.WebhookMessage),
+
+		workingHours: make(map[string]storage.WorkingHours),
+		tags:         make(map[string]map[string]storage.Tag),
+		preferences:  make(map[string]storage.Preferences),
+		leases:       make(map[string]storage.Lease),
+	}
+}
+
+// clone copies the event so that the caller can't change the stored one.
+func clone(e storage.Event) storage.Event {
+	if e.Reminders != nil {
+		e.Reminders = append([]storage.Reminder(nil), e.Reminders...)
+	}
+	if e.Tags != nil {
+		e.Tags = append([]string(nil), e.Tags...)
+	}
+	if e.Attachments != nil {
+		e.Attachments = append([]storage.Attachment(nil), e.Attachments...)
+	}
+	return e
+}
+
+// tenantKey identifies the user, or the data with the ID, among those of all tenants.
+// Tenant IDs have no control characters, so the key of every tenant is distinct.
+func tenantKey(tenantID, id string) string {
+	return tenantID + "\x00" + id
+}
+
+// access returns the user's access to the calendar. Calendars the user can't see, those of
+// other tenants included, are reported as not found.
+func (s *Storage) access(tenantID, userID, calendarID string) (storage.Access, error) {
+	key := tenantKey(tenantID, calendarID)
+	cal, ok := s.calendars[key]
+	if !ok {
+		return storage.AccessNone, storage.ErrCalendarNotFound
+	}
+	if cal.OwnerID == userID {
+		return storage.AccessOwner, nil
+	}
+	if a, ok := s.grants[key][userID]; ok {
+		return a, nil
+	}
+	return storage.AccessNone, storage.ErrCalendarNotFound
+}
+
+func (s *Storage) require(tenantID, userID, calendarID string, required storage.Access) (storage.Access, error) {
+	a, err := s.access(tenantID, userID, calendarID)
+	if err != nil {
+		return a, err
+	}
+	if a < required {
+		return a, storage.ErrAccessDenied
+	}
+	return a, nil
+}
+
+func (s *Storage) CreateCalendar(ctx context.Context, cal storage.Calendar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cal.TenantID = storage.TenantID(ctx)
+	key := tenantKey(cal.TenantID, cal.ID)
+	if _, ok := s.calendars[key]; ok {
+		return storage.ErrCalendarExists
+	}
+	s.calendars[key] = cal
+	return nil
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, userID, calendarID string) (storage.Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.access(tenantID, userID, calendarID); err != nil {
+		return storage.Calendar{}, err
+	}
+	return s.calendars[tenantKey(tenantID, calendarID)], nil
+}
+
+// CalendarAccess returns the access of the user to the calendar.
+func (s *Storage) CalendarAccess(ctx context.Context, userID, calendarID string) (storage.Access, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.access(storage.TenantID(ctx), userID, calendarID)
+}
+
+// ListCalendars returns calendars owned by the user and shared with them.
+func (s *Storage) ListCalendars(ctx context.Context, userID string) ([]storage.Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	calendars := make([]storage.Calendar, 0)
+	for _, cal := range s.calendars {
+		if cal.TenantID != tenantID {
+			continue
+		}
+		if _, err := s.access(tenantID, userID, cal.ID); err == nil {
+			calendars = append(calendars, cal)
+		}
+	}
+	sort.Slice(calendars, func(i, j int) bool {
+		return calendars[i].ID < calendars[j].ID
+	})
+	return calendars, nil
 }
 
-// TODO
+// DeleteCalendar deletes the calendar with its grants. Events must be moved to the trash first,
+// the ones in the trash are deleted with the calendar as they can't be restored without it.
+func (s *Storage) DeleteCalendar(ctx context.Context, userID, calendarID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.require(tenantID, userID, calendarID, storage.AccessOwner); err != nil {
+		return err
+	}
+	for _, e := range s.events {
+		if e.TenantID == tenantID && e.CalendarID == calendarID && !e.Deleted() {
+			return storage.ErrCalendarNotEmpty
+		}
+	}
+	for key, e := range s.events {
+		if e.TenantID == tenantID && e.CalendarID == calendarID {
+			delete(s.events, key)
+			delete(s.deliveries, key)
+		}
+	}
+	key := tenantKey(tenantID, calendarID)
+	delete(s.grants, key)
+	delete(s.calendars, key)
+	return nil
+}
+
+func (s *Storage) ShareCalendar(ctx context.Context, userID string, grant storage.Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.require(tenantID, userID, grant.CalendarID, storage.AccessOwner); err != nil {
+		return err
+	}
+	if grant.Access <= storage.AccessNone || grant.Access >= storage.AccessOwner {
+		return storage.ErrInvalidAccess
+	}
+	key := tenantKey(tenantID, grant.CalendarID)
+	if s.calendars[key].OwnerID == grant.UserID {
+		return storage.ErrInvalidAccess
+	}
+	if s.grants[key] == nil {
+		s.grants[key] = make(map[string]storage.Access)
+	}
+	s.grants[key][grant.UserID] = grant.Access
+	return nil
+}
+
+func (s *Storage) RevokeShare(ctx context.Context, userID, calendarID, granteeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.require(tenantID, userID, calendarID, storage.AccessOwner); err != nil {
+		return err
+	}
+	delete(s.grants[tenantKey(tenantID, calendarID)], granteeID)
+	return nil
+}
+
+func (s *Storage) ListShares(ctx context.Context, userID, calendarID string) ([]storage.Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.require(tenantID, userID, calendarID, storage.AccessOwner); err != nil {
+		return nil, err
+	}
+	stored := s.grants[tenantKey(tenantID, calendarID)]
+	grants := make([]storage.Grant, 0, len(stored))
+	for granteeID, a := range stored {
+		grants = append(grants, storage.Grant{TenantID: tenantID, CalendarID: calendarID, UserID: granteeID, Access: a})
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].UserID < grants[j].UserID
+	})
+	return grants, nil
+}
+
+func (s *Storage) CreateEvent(ctx context.Context, userID string, e storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createEvent(storage.TenantID(ctx), userID, e)
+}
+
+func (s *Storage) createEvent(tenantID, userID string, e storage.Event) error {
+	if _, err := s.require(tenantID, userID, e.CalendarID, storage.AccessReadWrite); err != nil {
+		return err
+	}
+	key := tenantKey(tenantID, e.ID)
+	if _, ok := s.events[key]; ok {
+		return storage.ErrEventExists
+	}
+	if _, ok := s.findEvent(tenantID, e.CalendarID, e.UID); ok && e.UID != "" {
+		return storage.ErrEventExists
+	}
+	e.TenantID = tenantID
+	s.events[key] = clone(e)
+	return nil
+}
+
+// findEvent returns the event of the calendar with the iCalendar UID, an event in the trash too.
+func (s *Storage) findEvent(tenantID, calendarID, uid string) (storage.Event, bool) {
+	for _, e := range s.events {
+		if e.TenantID == tenantID && e.CalendarID == calendarID && e.ICalUID() == uid {
+			return e, true
+		}
+	}
+	return storage.Event{}, false
+}
+
+// UpdateEvent replaces the event, it may be moved to another calendar if the user can write to both.
+func (s *Storage) UpdateEvent(ctx context.Context, userID string, e storage.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateEvent(storage.TenantID(ctx), userID, e)
+}
+
+func (s *Storage) updateEvent(tenantID, userID string, e storage.Event) error {
+	old, err := s.writableEvent(tenantID, userID, e.ID)
+	if err != nil {
+		return err
+	}
+	if old.CalendarID != e.CalendarID {
+		if _, err := s.require(tenantID, userID, e.CalendarID, storage.AccessReadWrite); err != nil {
+			return err
+		}
+		if _, ok := s.findEvent(tenantID, e.CalendarID, e.ICalUID()); ok {
+			return storage.ErrEventExists
+		}
+	}
+	// Attachments are changed by AddAttachment and RemoveAttachment only.
+	e.Attachments = old.Attachments
+	e.TenantID = tenantID
+	key := tenantKey(tenantID, e.ID)
+	s.events[key] = clone(e)
+
+	// Deliveries of the remaining reminders are kept, so they are not sent again.
+	for reminderID := range s.deliveries[key] {
+		if !hasReminder(e, reminderID) {
+			delete(s.deliveries[key], reminderID)
+		}
+	}
+	return nil
+}
+
+func hasReminder(e storage.Event, reminderID string) bool {
+	for _, r := range e.Reminders {
+		if r.ID == reminderID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, userID, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteEvent(storage.TenantID(ctx), userID, eventID)
+}
+
+func (s *Storage) deleteEvent(tenantID, userID, eventID string) error {
+	if _, err := s.writableEvent(tenantID, userID, eventID); err != nil {
+		return err
+	}
+	key := tenantKey(tenantID, eventID)
+	delete(s.events, key)
+	delete(s.deliveries, key)
+	return nil
+}
+
+// ApplyEventOps applies all the operations or none of them.
+// Deleted events are moved to the trash at their DeletedAt time.
+func (s *Storage) ApplyEventOps(ctx context.Context, userID string, ops []storage.EventOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(map[string]storage.Event, len(s.events))
+	for id, e := range s.events {
+		events[id] = e
+	}
+	deliveries := make(map[string]map[string]storage.Delivery, len(s.deliveries))
+	for id, byReminder := range s.deliveries {
+		deliveries[id] = make(map[string]storage.Delivery, len(byReminder))
+		for reminderID, d := range byReminder {
+			deliveries[id][reminderID] = d
+		}
+	}
+
+	tenantID := storage.TenantID(ctx)
+	for i, op := range ops {
+		var err error
+		switch op.Change {
+		case storage.ChangeCreated:
+			err = s.createEvent(tenantID, userID, op.Event)
+		case storage.ChangeUpdated:
+			err = s.updateEvent(tenantID, userID, op.Event)
+		case storage.ChangeDeleted:
+			err = s.trashEvent(tenantID, userID, op.Event.ID, op.Event.DeletedAt)
+		default:
+			err = fmt.Errorf("%w: %q", storage.ErrInvalidOperation, op.Change)
+		}
+		if err != nil {
+			s.events, s.deliveries = events, deliveries
+			return &storage.BatchError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+func (s *Storage) writableEvent(tenantID, userID, eventID string) (storage.Event, error) {
+	e, ok := s.events[tenantKey(tenantID, eventID)]
+	if !ok || e.Deleted() {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	a, err := s.access(tenantID, userID, e.CalendarID)
+	if err != nil {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if a < storage.AccessReadWrite {
+		return storage.Event{}, storage.ErrAccessDenied
+	}
+	return e, nil
+}
+
+// GetEvent returns the event, with free-busy access only its time slot is returned.
+func (s *Storage) GetEvent(ctx context.Context, userID, eventID string) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	e, ok := s.events[tenantKey(tenantID, eventID)]
+	if !ok || e.Deleted() {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	a, err := s.access(tenantID, userID, e.CalendarID)
+	if err != nil {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if a == storage.AccessFreeBusy {
+		return e.FreeBusy(), nil
+	}
+	return clone(e), nil
+}
+
+// FindEvent returns the event of the calendar with the iCalendar UID. Events in the trash
+// are found too if the user can write to the calendar.
+func (s *Storage) FindEvent(ctx context.Context, userID, calendarID, uid string) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	a, err := s.access(tenantID, userID, calendarID)
+	if err != nil {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	e, ok := s.findEvent(tenantID, calendarID, uid)
+	if !ok || e.Deleted() && a < storage.AccessReadWrite {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if a == storage.AccessFreeBusy {
+		return e.FreeBusy(), nil
+	}
+	return clone(e), nil
+}
+
+// ListEvents returns events intersecting [from, to) from all calendars visible to the user.
+// Events of calendars shared as free-busy contain only their time slots.
+func (s *Storage) ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	events := make([]storage.Event, 0)
+	for _, e := range s.events {
+		if e.TenantID != tenantID || e.Deleted() || !e.Overlaps(from, to) {
+			continue
+		}
+		a, err := s.access(tenantID, userID, e.CalendarID)
+		if err != nil {
+			continue
+		}
+		if a == storage.AccessFreeBusy {
+			e = e.FreeBusy()
+		}
+		events = append(events, clone(e))
+	}
+	storage.SortEvents(events)
+	return events, nil
+}
+
+// CountEvents returns the number of events of the tenant, those in the trash are not counted.
+func (s *Storage) CountEvents(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	count := 0
+	for _, e := range s.events {
+		if e.TenantID == tenantID && !e.Deleted() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Snapshot returns a copy of all the data ignoring access rights.
+func (s *Storage) Snapshot(ctx context.Context) (storage.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := storage.Snapshot{
+		Calendars: make([]storage.Calendar, 0, len(s.calendars)),
+		Grants:    make([]storage.Grant, 0),
+		Events:    make([]storage.Event, 0, len(s.events)),
+
+		Deliveries: make([]storage.Delivery, 0),
+		Outbox:     append(make([]storage.OutboxMessage, 0, len(s.outbox)), s.outbox...),
+
+		Webhooks:          make([]storage.Webhook, 0, len(s.webhooks)),
+		WebhookDeliveries: make([]storage.WebhookDelivery, 0),
+		WebhookMessages:   make([]storage.WebhookMessage, 0, len(s.webhookMessages)),
+
+		Audit: make([]storage.AuditEntry, 0, len(s.audit)),
+
+		WorkingHours: make([]storage.WorkingHours, 0, len(s.workingHours)),
+		Tags:         make([]storage.Tag, 0),
+		Preferences:  make([]storage.Preferences, 0, len(s.preferences)),
+	}
+	for key, cal := range s.calendars {
+		snap.Calendars = append(snap.Calendars, cal)
+		for userID, a := range s.grants[key] {
+			snap.Grants = append(snap.Grants, storage.Grant{
+				TenantID: cal.TenantID, CalendarID: cal.ID, UserID: userID, Access: a,
+			})
+		}
+	}
+	for _, e := range s.events {
+		snap.Events = append(snap.Events, clone(e))
+	}
+	for _, deliveries := range s.deliveries {
+		for _, d := range deliveries {
+			snap.Deliveries = append(snap.Deliveries, d)
+		}
+	}
+	for _, w := range s.webhooks {
+		snap.Webhooks = append(snap.Webhooks, w)
+	}
+	for key, deliveries := range s.webhookDeliveries {
+		for _, d := range deliveries {
+			d.TenantID = s.webhooks[key].TenantID
+			snap.WebhookDeliveries = append(snap.WebhookDeliveries, d)
+		}
+	}
+	for _, m := range s.webhookMessages {
+		snap.WebhookMessages = append(snap.WebhookMessages, cloneWebhookMessage(m))
+	}
+	for _, entry := range s.audit {
+		entry.Diff = append([]storage.FieldChange(nil), entry.Diff...)
+		snap.Audit = append(snap.Audit, entry)
+	}
+	for _, w := range s.workingHours {
+		snap.WorkingHours = append(snap.WorkingHours, cloneWorkingHours(w))
+	}
+	for _, tags := range s.tags {
+		for _, tag := range tags {
+			snap.Tags = append(snap.Tags, tag)
+		}
+	}
+	for _, p := range s.preferences {
+		snap.Preferences = append(snap.Preferences, p)
+	}
+
+	sort.Slice(snap.Calendars, func(i, j int) bool {
+		return tenantKey(snap.Calendars[i].TenantID, snap.Calendars[i].ID) <
+			tenantKey(snap.Calendars[j].TenantID, snap.Calendars[j].ID)
+	})
+	sort.Slice(snap.Grants, func(i, j int) bool {
+		ki := tenantKey(snap.Grants[i].TenantID, snap.Grants[i].CalendarID)
+		kj := tenantKey(snap.Grants[j].TenantID, snap.Grants[j].CalendarID)
+		if ki != kj {
+			return ki < kj
+		}
+		return snap.Grants[i].UserID < snap.Grants[j].UserID
+	})
+	storage.SortEvents(snap.Events)
+	sort.SliceStable(snap.Events, func(i, j int) bool {
+		return snap.Events[i].TenantID < snap.Events[j].TenantID
+	})
+	sort.Slice(snap.Deliveries, func(i, j int) bool {
+		ki := tenantKey(snap.Deliveries[i].TenantID, snap.Deliveries[i].EventID)
+		kj := tenantKey(snap.Deliveries[j].TenantID, snap.Deliveries[j].EventID)
+		if ki != kj {
+			return ki < kj
+		}
+		return snap.Deliveries[i].ReminderID < snap.Deliveries[j].ReminderID
+	})
+	sort.Slice(snap.Webhooks, func(i, j int) bool {
+		return tenantKey(snap.Webhooks[i].TenantID, snap.Webhooks[i].ID) <
+			tenantKey(snap.Webhooks[j].TenantID, snap.Webhooks[j].ID)
+	})
+	sort.SliceStable(snap.WebhookDeliveries, func(i, j int) bool {
+		return tenantKey(snap.WebhookDeliveries[i].TenantID, snap.WebhookDeliveries[i].WebhookID) <
+			tenantKey(snap.WebhookDeliveries[j].TenantID, snap.WebhookDeliveries[j].WebhookID)
+	})
+	sort.Slice(snap.WebhookMessages, func(i, j int) bool {
+		return tenantKey(snap.WebhookMessages[i].TenantID, snap.WebhookMessages[i].ID) <
+			tenantKey(snap.WebhookMessages[j].TenantID, snap.WebhookMessages[j].ID)
+	})
+	sort.Slice(snap.WorkingHours, func(i, j int) bool {
+		return tenantKey(snap.WorkingHours[i].TenantID, snap.WorkingHours[i].UserID) <
+			tenantKey(snap.WorkingHours[j].TenantID, snap.WorkingHours[j].UserID)
+	})
+	sortTags(snap.Tags)
+	sort.Slice(snap.Preferences, func(i, j int) bool {
+		return tenantKey(snap.Preferences[i].TenantID, snap.Preferences[i].UserID) <
+			tenantKey(snap.Preferences[j].TenantID, snap.Preferences[j].UserID)
+	})
+	return snap, nil
+}
+
+// Restore replaces all the data with the snapshot.
+func (s *Storage) Restore(ctx context.Context, snap storage.Snapshot) error {
+	calendars := make(map[string]storage.Calendar, len(snap.Calendars))
+	for _, cal := range snap.Calendars {
+		calendars[tenantKey(cal.TenantID, cal.ID)] = cal
+	}
+	grants := make(map[string]map[string]storage.Access)
+	for _, g := range snap.Grants {
+		key := tenantKey(g.TenantID, g.CalendarID)
+		if grants[key] == nil {
+			grants[key] = make(map[string]storage.Access)
+		}
+		grants[key][g.UserID] = g.Access
+	}
+	events := make(map[string]storage.Event, len(snap.Events))
+	for _, e := range snap.Events {
+		events[tenantKey(e.TenantID, e.ID)] = clone(e)
+	}
+	deliveries := make(map[string]map[string]storage.Delivery)
+	for _, d := range snap.Deliveries {
+		key := tenantKey(d.TenantID, d.EventID)
+		if deliveries[key] == nil {
+			deliveries[key] = make(map[string]storage.Delivery)
+		}
+		deliveries[key][d.ReminderID] = d
+	}
+	outbox := append([]storage.OutboxMessage(nil), snap.Outbox...)
+	webhooks := make(map[string]storage.Webhook, len(snap.Webhooks))
+	for _, w := range snap.Webhooks {
+		webhooks[tenantKey(w.TenantID, w.ID)] = w
+	}
+	webhookDeliveries := make(map[string][]storage.WebhookDelivery)
+	for _, d := range snap.WebhookDeliveries {
+		key := tenantKey(d.TenantID, d.WebhookID)
+		webhookDeliveries[key] = append(webhookDeliveries[key], d)
+	}
+	webhookMessages := make(map[string]storage.WebhookMessage, len(snap.WebhookMessages))
+	for _, m := range snap.WebhookMessages {
+		webhookMessages[tenantKey(m.TenantID, m.ID)] = cloneWebhookMessage(m)
+	}
+	audit := append([]storage.AuditEntry(nil), snap.Audit...)
+	workingHours := make(map[string]storage.WorkingHours, len(snap.WorkingHours))
+	for _, w := range snap.WorkingHours {
+		workingHours[tenantKey(w.TenantID, w.UserID)] = cloneWorkingHours(w)
+	}
+	tags := make(map[string]map[string]storage.Tag)
+	for _, tag := range snap.Tags {
+		key := tenantKey(tag.TenantID, tag.UserID)
+		if tags[key] == nil {
+			tags[key] = make(map[string]storage.Tag)
+		}
+		tags[key][tagKey(tag.Name)] = tag
+	}
+	preferences := make(map[string]storage.Preferences, len(snap.Preferences))
+	for _, p := range snap.Preferences {
+		preferences[tenantKey(p.TenantID, p.UserID)] = p
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calendars = calendars
+	s.grants = grants
+	s.events = events
+	s.deliveries = deliveries
+	s.outbox = outbox
+	s.webhooks = webhooks
+	s.webhookDeliveries = webhookDeliveries
+	s.webhookMessages = webhookMessages
+	s.audit = audit
+	s.workingHours = workingHours
+	s.tags = tags
+	s.preferences = preferences
+	return nil
+}
+
+// DueNotifications returns notifications of all the reminders due at now which have not been delivered yet,
+// with the number of failed attempts to deliver them.
+func (s *Storage) DueNotifications(ctx context.Context, now time.Time) ([]storage.Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.dueNotifications(now), nil
+}
+
+func (s *Storage) dueNotifications(now time.Time) []storage.Notification {
+	notifications := make([]storage.Notification, 0)
+	for _, e := range s.events {
+		if e.Deleted() {
+			continue
+		}
+		for _, n := range e.Notifications(now) {
+			d, ok := s.deliveries[tenantKey(e.TenantID, e.ID)][n.ReminderID]
+			if ok && n.Delivered(d) {
+				continue
+			}
+			if ok && n.Retried(d) {
+				n.Attempts = d.Attempts
+			}
+			notifications = append(notifications, n)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		if !notifications[i].NotifyAt.Equal(notifications[j].NotifyAt) {
+			return notifications[i].NotifyAt.Before(notifications[j].NotifyAt)
+		}
+		ki := tenantKey(notifications[i].TenantID, notifications[i].EventID)
+		kj := tenantKey(notifications[j].TenantID, notifications[j].EventID)
+		if ki != kj {
+			return ki < kj
+		}
+		return notifications[i].ReminderID < notifications[j].ReminderID
+	})
+	return notifications
+}
+
+// MarkDelivered records the delivery of the reminder replacing the previous one, failed deliveries included,
+// and removes the reminder from the outbox.
+func (s *Storage) MarkDelivered(ctx context.Context, d storage.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.TenantID = storage.TenantID(ctx)
+	key := tenantKey(d.TenantID, d.EventID)
+	e, ok := s.events[key]
+	if !ok || e.Deleted() {
+		return storage.ErrEventNotFound
+	}
+	if !hasReminder(e, d.ReminderID) {
+		return storage.ErrReminderNotFound
+	}
+	if s.deliveries[key] == nil {
+		s.deliveries[key] = make(map[string]storage.Delivery)
+	}
+	s.deliveries[key][d.ReminderID] = d
+	s.removeOutbox(d.TenantID, d.EventID, d.ReminderID)
+	return nil
+}
+
+// ListDeliveries returns the last deliveries of reminders of the events the user owns, the latest first.
+func (s *Storage) ListDeliveries(ctx context.Context, userID string) ([]storage.Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	deliveries := make([]storage.Delivery, 0)
+	for key, byReminder := range s.deliveries {
+		e, ok := s.events[key]
+		if !ok || e.TenantID != tenantID || e.OwnerID != userID {
+			continue
+		}
+		for _, d := range byReminder {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].SentAt.Equal(deliveries[j].SentAt) {
+			return deliveries[i].SentAt.After(deliveries[j].SentAt)
+		}
+		if deliveries[i].EventID != deliveries[j].EventID {
+			return deliveries[i].EventID < deliveries[j].EventID
+		}
+		return deliveries[i].ReminderID < deliveries[j].ReminderID
+	})
+	return deliveries, nil
+}
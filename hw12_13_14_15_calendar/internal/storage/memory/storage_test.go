@@ -1,7 +1,19 @@
 package memorystorage
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
 
 func TestStorage(t *testing.T) {
-	// TODO
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return New()
+	})
+}
+
+func BenchmarkStorage(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storagetest.Storage {
+		return New()
+	})
 }
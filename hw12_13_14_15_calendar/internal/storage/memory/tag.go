@@ -0,0 +1,68 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// PutTag creates or replaces the user's tag, names are case-insensitive.
+func (s *Storage) PutTag(ctx context.Context, tag storage.Tag) error {
+	if tag.UserID == "" || tag.Name == "" {
+		return fmt.Errorf("%w: no user or name", storage.ErrInvalidOperation)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag.TenantID = storage.TenantID(ctx)
+	key := tenantKey(tag.TenantID, tag.UserID)
+	if s.tags[key] == nil {
+		s.tags[key] = make(map[string]storage.Tag)
+	}
+	s.tags[key][tagKey(tag.Name)] = tag
+	return nil
+}
+
+// ListTags returns the user's tags sorted by name.
+func (s *Storage) ListTags(ctx context.Context, userID string) ([]storage.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := tenantKey(storage.TenantID(ctx), userID)
+	tags := make([]storage.Tag, 0, len(s.tags[key]))
+	for _, tag := range s.tags[key] {
+		tags = append(tags, tag)
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+// DeleteTag deletes the user's tag, events keep the name but lose the colour.
+func (s *Storage) DeleteTag(ctx context.Context, userID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := tenantKey(storage.TenantID(ctx), userID)
+	if _, ok := s.tags[key][tagKey(name)]; !ok {
+		return storage.ErrTagNotFound
+	}
+	delete(s.tags[key], tagKey(name))
+	return nil
+}
+
+func tagKey(name string) string {
+	return strings.ToLower(name)
+}
+
+func sortTags(tags []storage.Tag) {
+	sort.Slice(tags, func(i, j int) bool {
+		if ki, kj := tenantKey(tags[i].TenantID, tags[i].UserID), tenantKey(tags[j].TenantID, tags[j].UserID); ki != kj {
+			return ki < kj
+		}
+		return tagKey(tags[i].Name) < tagKey(tags[j].Name)
+	})
+}
@@ -0,0 +1,97 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// TrashEvent moves the event to the trash, it can be restored until it is purged.
+func (s *Storage) TrashEvent(ctx context.Context, userID, eventID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.trashEvent(storage.TenantID(ctx), userID, eventID, at)
+}
+
+func (s *Storage) trashEvent(tenantID, userID, eventID string, at time.Time) error {
+	if at.IsZero() {
+		return fmt.Errorf("%w: no deletion time", storage.ErrInvalidOperation)
+	}
+	e, err := s.writableEvent(tenantID, userID, eventID)
+	if err != nil {
+		return err
+	}
+	e.DeletedAt = at
+	e.DeletedBy = userID
+	s.events[tenantKey(tenantID, eventID)] = e
+	return nil
+}
+
+// ListTrash returns the deleted events of the calendars the user can write to, the latest deleted first.
+func (s *Storage) ListTrash(ctx context.Context, userID string) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	events := make([]storage.Event, 0)
+	for _, e := range s.events {
+		if e.TenantID != tenantID || !e.Deleted() {
+			continue
+		}
+		if a, err := s.access(tenantID, userID, e.CalendarID); err == nil && a >= storage.AccessReadWrite {
+			events = append(events, clone(e))
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].DeletedAt.Equal(events[j].DeletedAt) {
+			return events[i].DeletedAt.After(events[j].DeletedAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// RestoreEvent moves the event back from the trash.
+func (s *Storage) RestoreEvent(ctx context.Context, userID, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	key := tenantKey(tenantID, eventID)
+	e, ok := s.events[key]
+	if !ok || !e.Deleted() {
+		return storage.ErrEventNotFound
+	}
+	a, err := s.access(tenantID, userID, e.CalendarID)
+	if err != nil {
+		return storage.ErrEventNotFound
+	}
+	if a < storage.AccessReadWrite {
+		return storage.ErrAccessDenied
+	}
+	e.DeletedAt = time.Time{}
+	e.DeletedBy = ""
+	s.events[key] = e
+	return nil
+}
+
+// PurgeTrash permanently deletes the events moved to the trash before the time and returns them.
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := make([]storage.Event, 0)
+	for key, e := range s.events {
+		if e.Deleted() && e.DeletedAt.Before(before) {
+			delete(s.events, key)
+			delete(s.deliveries, key)
+			purged = append(purged, e)
+		}
+	}
+	storage.SortEvents(purged)
+	return purged, nil
+}
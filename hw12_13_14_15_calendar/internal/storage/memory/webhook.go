@@ -0,0 +1,313 @@
+package memorystorage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// maxWebhookDeliveries is the number of the latest deliveries kept for a webhook.
+const maxWebhookDeliveries = 100
+
+func (s *Storage) CreateWebhook(ctx context.Context, w storage.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.TenantID = storage.TenantID(ctx)
+	key := tenantKey(w.TenantID, w.ID)
+	if _, ok := s.webhooks[key]; ok {
+		return storage.ErrWebhookExists
+	}
+	s.webhooks[key] = w
+	return nil
+}
+
+func (s *Storage) ListWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	webhooks := make([]storage.Webhook, 0)
+	for _, w := range s.webhooks {
+		if w.TenantID == tenantID && w.UserID == userID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func sortWebhooks(webhooks []storage.Webhook) {
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+}
+
+func (s *Storage) ownWebhook(tenantID, userID, webhookID string) (storage.Webhook, error) {
+	w, ok := s.webhooks[tenantKey(tenantID, webhookID)]
+	if !ok || w.UserID != userID {
+		return storage.Webhook{}, storage.ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.ownWebhook(tenantID, userID, webhookID); err != nil {
+		return err
+	}
+	key := tenantKey(tenantID, webhookID)
+	delete(s.webhooks, key)
+	delete(s.webhookDeliveries, key)
+	for messageKey, m := range s.webhookMessages {
+		if m.TenantID == tenantID && m.WebhookID == webhookID {
+			delete(s.webhookMessages, messageKey)
+		}
+	}
+	return nil
+}
+
+// EnableWebhook enables the webhook disabled after failed deliveries.
+func (s *Storage) EnableWebhook(ctx context.Context, userID, webhookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenantID := storage.TenantID(ctx)
+	w, err := s.ownWebhook(tenantID, userID, webhookID)
+	if err != nil {
+		return err
+	}
+	w.Disabled = false
+	w.Failures = 0
+	s.webhooks[tenantKey(tenantID, webhookID)] = w
+	return nil
+}
+
+// GetWebhook returns the webhook of any user of the tenant.
+func (s *Storage) GetWebhook(ctx context.Context, webhookID string) (storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.webhooks[tenantKey(storage.TenantID(ctx), webhookID)]
+	if !ok {
+		return storage.Webhook{}, storage.ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+// WebhooksForCalendar returns enabled webhooks of the users who can read events of the calendar.
+func (s *Storage) WebhooksForCalendar(ctx context.Context, calendarID string) ([]storage.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	webhooks := make([]storage.Webhook, 0)
+	for _, w := range s.webhooks {
+		if w.TenantID != tenantID || w.Disabled {
+			continue
+		}
+		if a, err := s.access(tenantID, w.UserID, calendarID); err == nil && a >= storage.AccessRead {
+			webhooks = append(webhooks, w)
+		}
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (s *Storage) AddWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.TenantID = storage.TenantID(ctx)
+	key := tenantKey(d.TenantID, d.WebhookID)
+	if _, ok := s.webhooks[key]; !ok {
+		return storage.ErrWebhookNotFound
+	}
+	deliveries := append(s.webhookDeliveries[key], d)
+	if len(deliveries) > maxWebhookDeliveries {
+		deliveries = append([]storage.WebhookDelivery(nil), deliveries[len(deliveries)-maxWebhookDeliveries:]...)
+	}
+	s.webhookDeliveries[key] = deliveries
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest first.
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, userID, webhookID string) ([]storage.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenantID := storage.TenantID(ctx)
+	if _, err := s.ownWebhook(tenantID, userID, webhookID); err != nil {
+		return nil, err
+	}
+	stored := s.webhookDeliveries[tenantKey(tenantID, webhookID)]
+	deliveries := make([]storage.WebhookDelivery, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, stored[i])
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookResult counts failed deliveries in a row and disables the webhook
+// when they reach maxFailures. A successful delivery resets the counter.
+func (s *Storage) RecordWebhookResult(ctx context.Context, webhookID string, success bool, maxFailures int) (storage.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := tenantKey(storage.TenantID(ctx), webhookID)
+	w, ok := s.webhooks[key]
+	if !ok {
+		return storage.Webhook{}, storage.ErrWebhookNotFound
+	}
+	if success {
+		w.Failures = 0
+	} else {
+		w.Failures++
+		if maxFailures > 0 && w.Failures >= maxFailures {
+			w.Disabled = true
+		}
+	}
+	s.webhooks[key] = w
+	return w, nil
+}
+
+func cloneWebhookMessage(m storage.WebhookMessage) storage.WebhookMessage {
+	m.Body = append([]byte(nil), m.Body...)
+	return m
+}
+
+// SaveWebhookMessage adds the message or replaces the one with the same ID.
+func (s *Storage) SaveWebhookMessage(ctx context.Context, m storage.WebhookMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.TenantID = storage.TenantID(ctx)
+	if _, ok := s.webhooks[tenantKey(m.TenantID, m.WebhookID)]; !ok {
+		return storage.ErrWebhookNotFound
+	}
+	s.webhookMessages[tenantKey(m.TenantID, m.ID)] = cloneWebhookMessage(m)
+	return nil
+}
+
+// DeleteWebhookMessage removes the message, if any.
+func (s *Storage) DeleteWebhookMessage(ctx context.Context, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.webhookMessages, tenantKey(storage.TenantID(ctx), messageID))
+	return nil
+}
+
+// ClaimWebhookMessages returns up to limit messages of all tenants due at now, the earliest first,
+// and postpones their next attempt until then. Dead messages and those of disabled webhooks wait.
+func (s *Storage) ClaimWebhookMessages(ctx context.Context, now, until time.Time, limit int) ([]storage.WebhookMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := make([]storage.WebhookMessage, 0)
+	for _, m := range s.webhookMessages {
+		if m.Dead || m.NextAttemptAt.After(now) {
+			continue
+		}
+		if w, ok := s.webhooks[tenantKey(m.TenantID, m.WebhookID)]; !ok || w.Disabled {
+			continue
+		}
+		due = append(due, m)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return tenantKey(due[i].TenantID, due[i].ID) < tenantKey(due[j].TenantID, due[j].ID)
+	})
+	if limit >= 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for i, m := range due {
+		m.NextAttemptAt = until
+		s.webhookMessages[tenantKey(m.TenantID, m.ID)] = m
+		due[i] = cloneWebhookMessage(m)
+	}
+	return due, nil
+}
+
+// deadLetters returns the dead messages of the user's webhooks, or of one of them if webhookID is set.
+func (s *Storage) deadLetters(tenantID, userID, webhookID string) ([]storage.WebhookMessage, error) {
+	if webhookID != "" {
+		if _, err := s.ownWebhook(tenantID, userID, webhookID); err != nil {
+			return nil, err
+		}
+	}
+	dead := make([]storage.WebhookMessage, 0)
+	for _, m := range s.webhookMessages {
+		if !m.Dead || m.TenantID != tenantID || (webhookID != "" && m.WebhookID != webhookID) {
+			continue
+		}
+		if _, err := s.ownWebhook(tenantID, userID, m.WebhookID); err == nil {
+			dead = append(dead, m)
+		}
+	}
+	return dead, nil
+}
+
+// ListWebhookDeadLetters returns the dead messages of the user's webhooks, or of one of them
+// if webhookID is set, the latest first.
+func (s *Storage) ListWebhookDeadLetters(ctx context.Context, userID, webhookID string) ([]storage.WebhookMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dead, err := s.deadLetters(storage.TenantID(ctx), userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dead, func(i, j int) bool {
+		if !dead[i].UpdatedAt.Equal(dead[j].UpdatedAt) {
+			return dead[i].UpdatedAt.After(dead[j].UpdatedAt)
+		}
+		return dead[i].ID < dead[j].ID
+	})
+	for i := range dead {
+		dead[i] = cloneWebhookMessage(dead[i])
+	}
+	return dead, nil
+}
+
+// RedriveWebhookDeadLetters makes the dead messages of the user's webhooks due at now with
+// all their attempts. The messages are limited to the webhook if webhookID is set and to
+// messageIDs if there are any. It returns the number of redriven messages.
+func (s *Storage) RedriveWebhookDeadLetters(
+	ctx context.Context, userID, webhookID string, messageIDs []string, now time.Time,
+) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dead, err := s.deadLetters(storage.TenantID(ctx), userID, webhookID)
+	if err != nil {
+		return 0, err
+	}
+	ids := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+	redriven := 0
+	for _, m := range dead {
+		if len(ids) > 0 && !ids[m.ID] {
+			continue
+		}
+		m.Dead = false
+		m.Attempts = 0
+		m.NextAttemptAt = now
+		m.UpdatedAt = now
+		s.webhookMessages[tenantKey(m.TenantID, m.ID)] = m
+		redriven++
+	}
+	return redriven, nil
+}
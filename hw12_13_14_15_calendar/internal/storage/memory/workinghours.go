@@ -0,0 +1,40 @@
+package memorystorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// SetWorkingHours replaces the working hours of the user.
+func (s *Storage) SetWorkingHours(ctx context.Context, w storage.WorkingHours) error {
+	if w.UserID == "" {
+		return fmt.Errorf("%w: no user", storage.ErrInvalidOperation)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.TenantID = storage.TenantID(ctx)
+	s.workingHours[tenantKey(w.TenantID, w.UserID)] = cloneWorkingHours(w)
+	return nil
+}
+
+// GetWorkingHours returns the working hours of the user, anyone in the tenant can read them to plan meetings.
+func (s *Storage) GetWorkingHours(ctx context.Context, userID string) (storage.WorkingHours, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.workingHours[tenantKey(storage.TenantID(ctx), userID)]
+	if !ok {
+		return storage.WorkingHours{}, storage.ErrWorkingHoursNotFound
+	}
+	return cloneWorkingHours(w), nil
+}
+
+func cloneWorkingHours(w storage.WorkingHours) storage.WorkingHours {
+	w.Days = append([]time.Weekday(nil), w.Days...)
+	return w
+}
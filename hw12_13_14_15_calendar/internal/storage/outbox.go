@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// OutboxMessage is a notification waiting to be sent. It is added together with the queued delivery
+// of the notification and removed when the outcome of the delivery is recorded.
+type OutboxMessage struct {
+	ID           string
+	Notification Notification
+	CreatedAt    time.Time
+}
+
+// NewOutboxMessage returns the message of the notification, its ID is the same for the same attempt.
+func NewOutboxMessage(n Notification, now time.Time) OutboxMessage {
+	return OutboxMessage{
+		ID:           fmt.Sprintf("%s/%s/%d/%d", n.EventID, n.ReminderID, n.NotifyAt.Unix(), n.Attempts),
+		Notification: n,
+		CreatedAt:    now,
+	}
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "time"
+
+// Preferences are the user's settings, the working hours are kept separately.
+type Preferences struct {
+	TenantID string
+	UserID   string
+	// TimeZone is an IANA time zone name, e.g. "Europe/Moscow".
+	TimeZone string
+	// Locale is the language of notifications, e.g. "ru", the server default if it is empty.
+	Locale    string
+	WeekStart time.Weekday
+	// DefaultReminder is added to new events created without reminders, unless its channel is empty.
+	DefaultReminder Reminder
+}
+
+// Location returns the time zone of the preferences.
+func (p Preferences) Location() (*time.Location, error) {
+	return time.LoadLocation(p.TimeZone)
+}
@@ -0,0 +1,124 @@
+package storage
+
+import "time"
+
+type Channel string
+
+const (
+	ChannelEmail   Channel = "email"
+	ChannelWebhook Channel = "webhook"
+	ChannelLog     Channel = "log"
+)
+
+func (c Channel) Valid() bool {
+	return c == ChannelEmail || c == ChannelWebhook || c == ChannelLog
+}
+
+// Reminder asks to notify the event owner through the channel some time before the event.
+type Reminder struct {
+	ID      string
+	Before  time.Duration
+	Channel Channel
+}
+
+// DeliveryStatus is the outcome of the last attempt to deliver a notification.
+type DeliveryStatus string
+
+const (
+	// DeliverySent is also the status of deliveries recorded without one.
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryFailed notifications are retried.
+	DeliveryFailed DeliveryStatus = "failed"
+	// DeliveryDead notifications are given up after too many failures.
+	DeliveryDead DeliveryStatus = "dead"
+	// DeliveryQueued notifications are in the outbox waiting to be sent.
+	DeliveryQueued DeliveryStatus = "queued"
+)
+
+func (s DeliveryStatus) Valid() bool {
+	return s == DeliverySent || s == DeliveryFailed || s == DeliveryDead || s == DeliveryQueued
+}
+
+// Delivery is the last attempt to send a reminder notification for the event.
+type Delivery struct {
+	TenantID   string
+	EventID    string
+	ReminderID string
+	Channel    Channel
+	NotifyAt   time.Time
+	// SentAt is the time of the attempt.
+	SentAt   time.Time
+	Status   DeliveryStatus
+	Attempts int
+	Error    string
+}
+
+// State returns the status of the delivery, DeliverySent if it has none.
+func (d Delivery) State() DeliveryStatus {
+	if d.Status == "" {
+		return DeliverySent
+	}
+	return d.Status
+}
+
+// Notification is a reminder which is due to be sent.
+type Notification struct {
+	TenantID   string
+	EventID    string
+	ReminderID string
+	Channel    Channel
+	NotifyAt   time.Time
+	Title      string
+	StartAt    time.Time
+	UserID     string
+	// Attempts is the number of failed attempts to deliver it so far.
+	Attempts int
+}
+
+// Delivered reports whether the delivery was made or given up for the notification. A reminder whose
+// channel or notification time has changed since then, e.g. the event was moved, is due again,
+// as well as a failed one.
+func (n Notification) Delivered(d Delivery) bool {
+	return d.ReminderID == n.ReminderID && d.Channel == n.Channel && d.NotifyAt.Equal(n.NotifyAt) &&
+		d.State() != DeliveryFailed
+}
+
+// Retried reports whether the failed delivery was an attempt to send the notification.
+func (n Notification) Retried(d Delivery) bool {
+	return d.ReminderID == n.ReminderID && d.Channel == n.Channel && d.NotifyAt.Equal(n.NotifyAt) &&
+		d.State() == DeliveryFailed
+}
+
+// InstantEventWindow is how long an event without duration counts as ongoing, so its reminder at
+// the start is still sent by the next relay run.
+const InstantEventWindow = time.Hour
+
+// Notifications returns notifications of the event reminders due at now.
+// Reminders of finished events are not sent.
+func (e Event) Notifications(now time.Time) []Notification {
+	endAt := e.EndAt
+	if !endAt.After(e.StartAt) {
+		endAt = e.StartAt.Add(InstantEventWindow)
+	}
+	if !now.Before(endAt) {
+		return nil
+	}
+	var notifications []Notification
+	for _, r := range e.Reminders {
+		notifyAt := e.StartAt.Add(-r.Before)
+		if notifyAt.After(now) {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			TenantID:   e.TenantID,
+			EventID:    e.ID,
+			ReminderID: r.ID,
+			Channel:    r.Channel,
+			NotifyAt:   notifyAt,
+			Title:      e.Title,
+			StartAt:    e.StartAt,
+			UserID:     e.OwnerID,
+		})
+	}
+	return notifications
+}
@@ -0,0 +1,20 @@
+package storage
+
+// Snapshot is a full copy of the storage data.
+type Snapshot struct {
+	Calendars  []Calendar
+	Grants     []Grant
+	Events     []Event
+	Deliveries []Delivery
+	Outbox     []OutboxMessage
+
+	Webhooks          []Webhook
+	WebhookDeliveries []WebhookDelivery
+	WebhookMessages   []WebhookMessage
+
+	Audit []AuditEntry
+
+	WorkingHours []WorkingHours
+	Tags         []Tag
+	Preferences  []Preferences
+}
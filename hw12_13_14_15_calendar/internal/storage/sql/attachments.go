@@ -0,0 +1,67 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AddAttachment adds the attachment to the event unless it has max attachments already,
+// it returns the event before the change.
+func (s *Storage) AddAttachment(
+	ctx context.Context, userID, eventID string, att storage.Attachment, max int,
+) (before storage.Event, err error) {
+	err = s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		// The event is locked, so concurrent attachments can't exceed max together.
+		if before, err = writableEvent(ctx, tx, tenantID, userID, eventID); err != nil {
+			return err
+		}
+		if len(before.Attachments) >= max {
+			return storage.ErrTooManyAttachments
+		}
+		attachments := append(append([]storage.Attachment(nil), before.Attachments...), att)
+		return setAttachments(ctx, tx, tenantID, eventID, attachments)
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return before, nil
+}
+
+// RemoveAttachment removes the attachment from the event, it returns the event before the change.
+func (s *Storage) RemoveAttachment(
+	ctx context.Context, userID, eventID, attachmentID string,
+) (before storage.Event, err error) {
+	err = s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if before, err = writableEvent(ctx, tx, tenantID, userID, eventID); err != nil {
+			return err
+		}
+		attachments := make([]storage.Attachment, 0, len(before.Attachments))
+		for _, att := range before.Attachments {
+			if att.ID != attachmentID {
+				attachments = append(attachments, att)
+			}
+		}
+		if len(attachments) == len(before.Attachments) {
+			return storage.ErrAttachmentNotFound
+		}
+		return setAttachments(ctx, tx, tenantID, eventID, attachments)
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return before, nil
+}
+
+func setAttachments(ctx context.Context, tx *sql.Tx, tenantID, eventID string, attachments []storage.Attachment) error {
+	data, err := marshal(attachments)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE events SET attachments = $3 WHERE tenant_id = $1 AND id = $2`,
+		tenantID, eventID, data)
+	return err
+}
@@ -0,0 +1,89 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AppendAudit adds the entries to the audit log, they are never changed afterwards.
+func (s *Storage) AppendAudit(ctx context.Context, entries ...storage.AuditEntry) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, entry := range entries {
+			entry.TenantID = storage.TenantID(ctx)
+			if err := insertAudit(ctx, tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertAudit(ctx context.Context, tx *sql.Tx, entry storage.AuditEntry) error {
+	diff, err := marshal(entry.Diff)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO audit (id, tenant_id, event_id, calendar_id, actor_id, transport, change, changed_at, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entry.ID, entry.TenantID, entry.EventID, entry.CalendarID, entry.ActorID, entry.Transport,
+		string(entry.Change), nullTime(entry.At), diff)
+	return err
+}
+
+const auditColumns = `a.id, a.tenant_id, a.event_id, a.calendar_id, a.actor_id, a.transport, a.change, a.changed_at, a.diff`
+
+func scanAudit(row scanner) (storage.AuditEntry, error) {
+	var (
+		entry     storage.AuditEntry
+		changedAt sql.NullTime
+		diff      []byte
+	)
+	if err := row.Scan(&entry.ID, &entry.TenantID, &entry.EventID, &entry.CalendarID, &entry.ActorID,
+		&entry.Transport, &entry.Change, &changedAt, &diff); err != nil {
+		return storage.AuditEntry{}, err
+	}
+	entry.At = timeOf(changedAt)
+	if err := json.Unmarshal(diff, &entry.Diff); err != nil {
+		return storage.AuditEntry{}, err
+	}
+	if len(entry.Diff) == 0 {
+		entry.Diff = nil
+	}
+	return entry, nil
+}
+
+// ListAudit returns the entries matching the filter of the calendars the user can read, newest first.
+func (s *Storage) ListAudit(ctx context.Context, userID string, filter storage.AuditFilter) ([]storage.AuditEntry, error) {
+	entries := make([]storage.AuditEntry, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT `+auditColumns+`
+			FROM audit a
+			JOIN calendars c ON c.tenant_id = a.tenant_id AND c.id = a.calendar_id
+			LEFT JOIN grants g ON g.tenant_id = a.tenant_id AND g.calendar_id = a.calendar_id AND g.user_id = $2
+			WHERE a.tenant_id = $1 AND (c.owner_id = $2 OR g.access >= $3)
+				AND ($4::text = '' OR a.event_id = $4) AND ($5::text = '' OR a.actor_id = $5)
+			ORDER BY a.seq DESC`,
+			storage.TenantID(ctx), userID, int(storage.AccessRead), filter.EventID, filter.ActorID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			entry, err := scanAudit(rows)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// AcquireLease takes the lease if it is free or expired at now, or renews it for the same holder.
+// If another holder has the lease, it is returned with ErrLeaseHeld. The lease is a row shared by
+// all the replicas, the upsert takes and checks it atomically.
+//
+// Leases are not a part of snapshots, they expire within a lease period anyway.
+func (s *Storage) AcquireLease(ctx context.Context, lease storage.Lease, now time.Time) (storage.Lease, error) {
+	if lease.Name == "" || lease.Holder == "" || !lease.ExpiresAt.After(now) {
+		return storage.Lease{}, fmt.Errorf("%w: invalid lease", storage.ErrInvalidOperation)
+	}
+
+	var current storage.Lease
+	err := s.allTx(ctx, func(tx *sql.Tx) error {
+		// The lease may be released between the statements, then it is taken again.
+		for {
+			current = storage.Lease{Name: lease.Name}
+			err := tx.QueryRowContext(ctx, `
+				INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, $3)
+				ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+				WHERE leases.holder = EXCLUDED.holder OR leases.expires_at <= $4
+				RETURNING holder, expires_at`,
+				lease.Name, lease.Holder, lease.ExpiresAt, now).Scan(&current.Holder, &current.ExpiresAt)
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			err = tx.QueryRowContext(ctx, `SELECT holder, expires_at FROM leases WHERE name = $1`, lease.Name).
+				Scan(&current.Holder, &current.ExpiresAt)
+			if err == nil {
+				return storage.ErrLeaseHeld
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+	})
+	if errors.Is(err, storage.ErrLeaseHeld) {
+		current.ExpiresAt = current.ExpiresAt.UTC()
+		return current, err
+	}
+	if err != nil {
+		return storage.Lease{}, err
+	}
+	return lease, nil
+}
+
+// ReleaseLease gives up the lease so that another holder doesn't have to wait for it to expire.
+// Releasing a lease held by someone else does nothing.
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) error {
+	return s.allTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder)
+		return err
+	})
+}
@@ -0,0 +1,178 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// EnqueueNotifications marks the notifications due at now as queued and adds them to the outbox
+// in one transaction, so a notification is neither lost nor queued twice. It returns the number
+// of added messages.
+func (s *Storage) EnqueueNotifications(ctx context.Context, now time.Time) (count int, err error) {
+	err = s.allTx(ctx, func(tx *sql.Tx) error {
+		// Concurrent schedulers wait here, the second one sees the deliveries queued by the first.
+		// MarkDelivered takes the lock of the outbox before the deliveries too.
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE outbox IN EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+		if err := deleteStaleOutbox(ctx, tx); err != nil {
+			return err
+		}
+		due, err := dueNotifications(ctx, tx, now)
+		if err != nil {
+			return err
+		}
+		for _, n := range due {
+			err := saveDelivery(ctx, tx, storage.Delivery{
+				TenantID:   n.TenantID,
+				EventID:    n.EventID,
+				ReminderID: n.ReminderID,
+				Channel:    n.Channel,
+				NotifyAt:   n.NotifyAt,
+				SentAt:     now,
+				Status:     storage.DeliveryQueued,
+				Attempts:   n.Attempts,
+			})
+			if err != nil {
+				return err
+			}
+			if err := insertOutbox(ctx, tx, storage.NewOutboxMessage(n, now)); err != nil {
+				return err
+			}
+		}
+		count = len(due)
+		return nil
+	})
+	return count, err
+}
+
+func insertOutbox(ctx context.Context, tx *sql.Tx, m storage.OutboxMessage) error {
+	n := m.Notification
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox (id, tenant_id, event_id, reminder_id, channel, notify_at, title, start_at, user_id,
+			attempts, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		m.ID, n.TenantID, n.EventID, n.ReminderID, string(n.Channel), nullTime(n.NotifyAt), n.Title,
+		nullTime(n.StartAt), n.UserID, n.Attempts, nullTime(m.CreatedAt))
+	return err
+}
+
+// deleteStaleOutbox deletes the messages which are not queued any more.
+func deleteStaleOutbox(ctx context.Context, tx *sql.Tx) error {
+	messages, seqs, err := listOutbox(ctx, tx)
+	if err != nil {
+		return err
+	}
+	queued, err := queuedOutbox(ctx, tx, messages)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		if queued[i] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE seq = $1`, seqs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListOutbox returns the messages of the outbox, the oldest first. Messages of deleted events and
+// of reminders changed since they were queued are skipped.
+func (s *Storage) ListOutbox(ctx context.Context) ([]storage.OutboxMessage, error) {
+	messages := make([]storage.OutboxMessage, 0)
+	err := s.allReadTx(ctx, func(tx *sql.Tx) error {
+		stored, _, err := listOutbox(ctx, tx)
+		if err != nil {
+			return err
+		}
+		queued, err := queuedOutbox(ctx, tx, stored)
+		if err != nil {
+			return err
+		}
+		for i, m := range stored {
+			if queued[i] {
+				messages = append(messages, m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// listOutbox returns all the messages of the outbox with their sequence numbers, the oldest first.
+func listOutbox(ctx context.Context, tx *sql.Tx) ([]storage.OutboxMessage, []int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT seq, id, tenant_id, event_id, reminder_id, channel, notify_at, title, start_at, user_id,
+			attempts, created_at
+		FROM outbox ORDER BY seq`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		messages []storage.OutboxMessage
+		seqs     []int64
+	)
+	for rows.Next() {
+		var (
+			seq                          int64
+			m                            storage.OutboxMessage
+			notifyAt, startAt, createdAt sql.NullTime
+		)
+		n := &m.Notification
+		if err := rows.Scan(&seq, &m.ID, &n.TenantID, &n.EventID, &n.ReminderID, &n.Channel, &notifyAt, &n.Title,
+			&startAt, &n.UserID, &n.Attempts, &createdAt); err != nil {
+			return nil, nil, err
+		}
+		n.NotifyAt, n.StartAt, m.CreatedAt = timeOf(notifyAt), timeOf(startAt), timeOf(createdAt)
+		messages = append(messages, m)
+		seqs = append(seqs, seq)
+	}
+	return messages, seqs, rows.Err()
+}
+
+// queuedOutbox reports for each message whether its notification is still waiting to be sent:
+// the event is not deleted, the reminder is the same and its delivery is queued for it.
+func queuedOutbox(ctx context.Context, tx *sql.Tx, messages []storage.OutboxMessage) ([]bool, error) {
+	queued := make([]bool, len(messages))
+	for i, m := range messages {
+		n := m.Notification
+		e, err := event(ctx, tx, n.TenantID, n.EventID, false)
+		if errors.Is(err, storage.ErrEventNotFound) || err == nil && e.Deleted() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		d, err := scanDelivery(tx.QueryRowContext(ctx, `
+			SELECT `+deliveryColumns+` FROM deliveries d
+			WHERE d.tenant_id = $1 AND d.event_id = $2 AND d.reminder_id = $3`,
+			n.TenantID, n.EventID, n.ReminderID))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d.State() != storage.DeliveryQueued || !n.Delivered(d) {
+			continue
+		}
+		for _, r := range e.Reminders {
+			if r.ID == n.ReminderID {
+				queued[i] = r.Channel == n.Channel && e.StartAt.Add(-r.Before).Equal(n.NotifyAt)
+				break
+			}
+		}
+	}
+	return queued, nil
+}
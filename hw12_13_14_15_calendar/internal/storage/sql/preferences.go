@@ -0,0 +1,72 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// SetPreferences replaces the preferences of the user.
+func (s *Storage) SetPreferences(ctx context.Context, p storage.Preferences) error {
+	if p.UserID == "" {
+		return fmt.Errorf("%w: no user", storage.ErrInvalidOperation)
+	}
+	p.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return savePreferences(ctx, tx, p)
+	})
+}
+
+func savePreferences(ctx context.Context, tx *sql.Tx, p storage.Preferences) error {
+	reminder, err := marshal(p.DefaultReminder)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO preferences (tenant_id, user_id, time_zone, locale, week_start, default_reminder)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, user_id) DO UPDATE SET time_zone = EXCLUDED.time_zone, locale = EXCLUDED.locale,
+			week_start = EXCLUDED.week_start, default_reminder = EXCLUDED.default_reminder`,
+		p.TenantID, p.UserID, p.TimeZone, p.Locale, int(p.WeekStart), reminder)
+	return err
+}
+
+// GetPreferences returns the preferences of the user.
+func (s *Storage) GetPreferences(ctx context.Context, userID string) (p storage.Preferences, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		p, err = scanPreferences(tx.QueryRowContext(ctx, `
+			SELECT `+preferencesColumns+`
+			FROM preferences WHERE tenant_id = $1 AND user_id = $2`, storage.TenantID(ctx), userID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrPreferencesNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return storage.Preferences{}, err
+	}
+	return p, nil
+}
+
+const preferencesColumns = `tenant_id, user_id, time_zone, locale, week_start, default_reminder`
+
+func scanPreferences(row scanner) (storage.Preferences, error) {
+	var (
+		p         storage.Preferences
+		weekStart int
+		reminder  []byte
+	)
+	if err := row.Scan(&p.TenantID, &p.UserID, &p.TimeZone, &p.Locale, &weekStart, &reminder); err != nil {
+		return storage.Preferences{}, err
+	}
+	p.WeekStart = time.Weekday(weekStart)
+	if err := json.Unmarshal(reminder, &p.DefaultReminder); err != nil {
+		return storage.Preferences{}, err
+	}
+	return p, nil
+}
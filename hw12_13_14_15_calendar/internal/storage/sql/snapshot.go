@@ -0,0 +1,243 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Snapshot returns a copy of all the data ignoring access rights, it is read from one snapshot
+// of the database. The data is ordered as in the snapshots of the memory storage.
+func (s *Storage) Snapshot(ctx context.Context) (storage.Snapshot, error) {
+	snap := storage.Snapshot{
+		Calendars:         make([]storage.Calendar, 0),
+		Grants:            make([]storage.Grant, 0),
+		Events:            make([]storage.Event, 0),
+		Deliveries:        make([]storage.Delivery, 0),
+		Webhooks:          make([]storage.Webhook, 0),
+		WebhookDeliveries: make([]storage.WebhookDelivery, 0),
+		WebhookMessages:   make([]storage.WebhookMessage, 0),
+		Audit:             make([]storage.AuditEntry, 0),
+		WorkingHours:      make([]storage.WorkingHours, 0),
+		Tags:              make([]storage.Tag, 0),
+		Preferences:       make([]storage.Preferences, 0),
+	}
+	err := s.allReadTx(ctx, func(tx *sql.Tx) error {
+		err := each(ctx, tx, `
+			SELECT tenant_id, id, owner_id, name FROM calendars ORDER BY tenant_id COLLATE "C", id COLLATE "C"`,
+			func(row scanner) error {
+				var cal storage.Calendar
+				err := row.Scan(&cal.TenantID, &cal.ID, &cal.OwnerID, &cal.Name)
+				snap.Calendars = append(snap.Calendars, cal)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT tenant_id, calendar_id, user_id, access FROM grants
+			ORDER BY tenant_id COLLATE "C", calendar_id COLLATE "C", user_id COLLATE "C"`,
+			func(row scanner) error {
+				var g storage.Grant
+				err := row.Scan(&g.TenantID, &g.CalendarID, &g.UserID, &g.Access)
+				snap.Grants = append(snap.Grants, g)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT `+eventColumns+` FROM events e
+			ORDER BY e.tenant_id COLLATE "C", e.start_at NULLS FIRST, e.id COLLATE "C"`,
+			func(row scanner) error {
+				e, err := scanEvent(row)
+				snap.Events = append(snap.Events, e)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT `+deliveryColumns+` FROM deliveries d
+			ORDER BY d.tenant_id COLLATE "C", d.event_id COLLATE "C", d.reminder_id COLLATE "C"`,
+			func(row scanner) error {
+				d, err := scanDelivery(row)
+				snap.Deliveries = append(snap.Deliveries, d)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		// The outbox is copied as is, the stale messages are skipped by ListOutbox after a restore.
+		if snap.Outbox, _, err = listOutbox(ctx, tx); err != nil {
+			return err
+		}
+		if snap.Outbox == nil {
+			snap.Outbox = make([]storage.OutboxMessage, 0)
+		}
+		err = each(ctx, tx, `
+			SELECT `+webhookColumns+` FROM webhooks w ORDER BY w.tenant_id COLLATE "C", w.id COLLATE "C"`,
+			func(row scanner) error {
+				w, err := scanWebhook(row)
+				snap.Webhooks = append(snap.Webhooks, w)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries d
+			ORDER BY d.tenant_id COLLATE "C", d.webhook_id COLLATE "C", d.seq`,
+			func(row scanner) error {
+				d, err := scanWebhookDelivery(row)
+				snap.WebhookDeliveries = append(snap.WebhookDeliveries, d)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT `+webhookMessageColumns+` FROM webhook_messages m ORDER BY m.tenant_id COLLATE "C", m.id COLLATE "C"`,
+			func(row scanner) error {
+				m, err := scanWebhookMessage(row)
+				snap.WebhookMessages = append(snap.WebhookMessages, m)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `SELECT `+auditColumns+` FROM audit a ORDER BY a.seq`,
+			func(row scanner) error {
+				entry, err := scanAudit(row)
+				snap.Audit = append(snap.Audit, entry)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT `+workingHoursColumns+` FROM working_hours ORDER BY tenant_id COLLATE "C", user_id COLLATE "C"`,
+			func(row scanner) error {
+				w, err := scanWorkingHours(row)
+				snap.WorkingHours = append(snap.WorkingHours, w)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		err = each(ctx, tx, `
+			SELECT tenant_id, user_id, name, color FROM tags
+			ORDER BY tenant_id COLLATE "C", user_id COLLATE "C", name_key COLLATE "C"`,
+			func(row scanner) error {
+				var tag storage.Tag
+				err := row.Scan(&tag.TenantID, &tag.UserID, &tag.Name, &tag.Color)
+				snap.Tags = append(snap.Tags, tag)
+				return err
+			})
+		if err != nil {
+			return err
+		}
+		return each(ctx, tx, `
+			SELECT `+preferencesColumns+` FROM preferences ORDER BY tenant_id COLLATE "C", user_id COLLATE "C"`,
+			func(row scanner) error {
+				p, err := scanPreferences(row)
+				snap.Preferences = append(snap.Preferences, p)
+				return err
+			})
+	})
+	if err != nil {
+		return storage.Snapshot{}, err
+	}
+	return snap, nil
+}
+
+// each calls fn for every row of the query.
+func each(ctx context.Context, tx *sql.Tx, query string, fn func(row scanner) error) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore replaces all the data with the snapshot in one transaction, the data of all tenants
+// is deleted first.
+func (s *Storage) Restore(ctx context.Context, snap storage.Snapshot) error {
+	return s.allTx(ctx, func(tx *sql.Tx) error {
+		// Grants, events, their deliveries and the data of webhooks are deleted in cascade.
+		for _, table := range []string{"calendars", "outbox", "webhooks", "audit", "working_hours", "tags", "preferences"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+				return err
+			}
+		}
+
+		for _, cal := range snap.Calendars {
+			if err := insertCalendar(ctx, tx, cal); err != nil {
+				return err
+			}
+		}
+		for _, g := range snap.Grants {
+			if err := saveGrant(ctx, tx, g); err != nil {
+				return err
+			}
+		}
+		for _, e := range snap.Events {
+			if err := insertEvent(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		for _, d := range snap.Deliveries {
+			if err := saveDelivery(ctx, tx, d); err != nil {
+				return err
+			}
+		}
+		for _, m := range snap.Outbox {
+			if err := insertOutbox(ctx, tx, m); err != nil {
+				return err
+			}
+		}
+		for _, w := range snap.Webhooks {
+			if err := insertWebhook(ctx, tx, w); err != nil {
+				return err
+			}
+		}
+		for _, d := range snap.WebhookDeliveries {
+			if err := insertWebhookDelivery(ctx, tx, d); err != nil {
+				return err
+			}
+		}
+		for _, m := range snap.WebhookMessages {
+			if err := saveWebhookMessage(ctx, tx, m); err != nil {
+				return err
+			}
+		}
+		for _, entry := range snap.Audit {
+			if err := insertAudit(ctx, tx, entry); err != nil {
+				return err
+			}
+		}
+		for _, w := range snap.WorkingHours {
+			if err := saveWorkingHours(ctx, tx, w); err != nil {
+				return err
+			}
+		}
+		for _, tag := range snap.Tags {
+			if err := saveTag(ctx, tx, tag); err != nil {
+				return err
+			}
+		}
+		for _, p := range snap.Preferences {
+			if err := savePreferences(ctx, tx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,20 +1,869 @@
 package sqlstorage
 
-import "context"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
 
-type Storage struct { // TODO
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/lib/pq"
+)
+
+// Storage keeps the data of all tenants in PostgreSQL. The tenant is a part of the primary key
+// of every table and every query of a tenant is limited to it, so IDs are unique within their
+// tenant only as in the memory storage. Row-level security hides the other tenants from the
+// transactions of a tenant as well, so the role of the DSN must not be a superuser or bypass it.
+type Storage struct {
+	dsn string
+	db  *sql.DB
 }
 
-func New() *Storage {
-	return &Storage{}
+func New(dsn string) *Storage {
+	return &Storage{dsn: dsn}
 }
 
+// Connect opens the database and applies the migrations it has not seen yet.
 func (s *Storage) Connect(ctx context.Context) error {
-	// TODO
+	db, err := sql.Open("postgres", s.dsn)
+	if err != nil {
+		return err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return err
+	}
+	if err := migrate(ctx, db); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("migrate: %w", err)
+	}
+	s.db = db
 	return nil
 }
 
 func (s *Storage) Close(ctx context.Context) error {
-	// TODO
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Scopes of transactions checked by the row-level security policies of the tables.
+const (
+	scopeTenant = "tenant"
+	scopeAll    = "all"
+)
+
+var readOnly = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
+// tx runs fn in a transaction of the tenant of the context, it is committed if fn succeeds
+// and rolled back otherwise.
+func (s *Storage) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.runTx(ctx, nil, scopeTenant, fn)
+}
+
+// readTx runs fn in a read-only transaction of the tenant of the context whose queries see
+// the same snapshot of the data.
+func (s *Storage) readTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.runTx(ctx, readOnly, scopeTenant, fn)
+}
+
+// allTx runs fn in a transaction which sees the data of all tenants, it is for the jobs
+// serving all of them.
+func (s *Storage) allTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.runTx(ctx, nil, scopeAll, fn)
+}
+
+func (s *Storage) allReadTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.runTx(ctx, readOnly, scopeAll, fn)
+}
+
+func (s *Storage) runTx(ctx context.Context, opts *sql.TxOptions, scope string, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	// The settings are local to the transaction, so a connection returned to the pool
+	// sees no rows until the next transaction sets them again.
+	_, err = tx.ExecContext(ctx, `
+		SELECT set_config('calendar.scope', $1, true), set_config('calendar.tenant_id', $2, true)`,
+		scope, storage.TenantID(ctx))
+	if err == nil {
+		err = fn(tx)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// tenantKey identifies the data with the ID among those of all tenants.
+func tenantKey(tenantID, id string) string {
+	return tenantID + "\x00" + id
+}
+
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+	return ""
+}
+
+// uniqueViolation reports whether the statement failed on a unique constraint, e.g. a primary key.
+func uniqueViolation(err error) bool {
+	return pqErrorCode(err) == "23505"
+}
+
+// foreignKeyViolation reports whether the statement refers to a missing row.
+func foreignKeyViolation(err error) bool {
+	return pqErrorCode(err) == "23503"
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// timeOf returns the stored time in UTC, the zero time for NULL.
+func timeOf(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return t.Time.UTC()
+}
+
+func marshal(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// accessOf returns the user's access to the calendar of the owner with the granted access, if any.
+// Calendars the user can't see are reported as not found.
+func accessOf(userID, ownerID string, granted sql.NullInt64) (storage.Access, error) {
+	switch {
+	case ownerID == userID:
+		return storage.AccessOwner, nil
+	case granted.Valid:
+		return storage.Access(granted.Int64), nil
+	default:
+		return storage.AccessNone, storage.ErrCalendarNotFound
+	}
+}
+
+// calendar returns the calendar with the user's access to it, locking it if forUpdate is set.
+func calendar(
+	ctx context.Context, tx *sql.Tx, tenantID, userID, calendarID string, forUpdate bool,
+) (storage.Calendar, storage.Access, error) {
+	query := `
+		SELECT c.tenant_id, c.id, c.owner_id, c.name, g.access
+		FROM calendars c
+		LEFT JOIN grants g ON g.tenant_id = c.tenant_id AND g.calendar_id = c.id AND g.user_id = $3
+		WHERE c.tenant_id = $1 AND c.id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE OF c`
+	}
+	var (
+		cal     storage.Calendar
+		granted sql.NullInt64
+	)
+	err := tx.QueryRowContext(ctx, query, tenantID, calendarID, userID).
+		Scan(&cal.TenantID, &cal.ID, &cal.OwnerID, &cal.Name, &granted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Calendar{}, storage.AccessNone, storage.ErrCalendarNotFound
+	}
+	if err != nil {
+		return storage.Calendar{}, storage.AccessNone, err
+	}
+	a, err := accessOf(userID, cal.OwnerID, granted)
+	if err != nil {
+		return storage.Calendar{}, a, err
+	}
+	return cal, a, nil
+}
+
+func access(ctx context.Context, tx *sql.Tx, tenantID, userID, calendarID string) (storage.Access, error) {
+	_, a, err := calendar(ctx, tx, tenantID, userID, calendarID, false)
+	return a, err
+}
+
+func requireAccess(ctx context.Context, tx *sql.Tx, tenantID, userID, calendarID string, required storage.Access) error {
+	a, err := access(ctx, tx, tenantID, userID, calendarID)
+	if err != nil {
+		return err
+	}
+	if a < required {
+		return storage.ErrAccessDenied
+	}
 	return nil
 }
+
+func (s *Storage) CreateCalendar(ctx context.Context, cal storage.Calendar) error {
+	cal.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return insertCalendar(ctx, tx, cal)
+	})
+}
+
+func insertCalendar(ctx context.Context, tx *sql.Tx, cal storage.Calendar) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO calendars (tenant_id, id, owner_id, name) VALUES ($1, $2, $3, $4)`,
+		cal.TenantID, cal.ID, cal.OwnerID, cal.Name)
+	if uniqueViolation(err) {
+		return storage.ErrCalendarExists
+	}
+	return err
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, userID, calendarID string) (cal storage.Calendar, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		cal, _, err = calendar(ctx, tx, storage.TenantID(ctx), userID, calendarID, false)
+		return err
+	})
+	return cal, err
+}
+
+// CalendarAccess returns the access of the user to the calendar.
+func (s *Storage) CalendarAccess(ctx context.Context, userID, calendarID string) (a storage.Access, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		a, err = access(ctx, tx, storage.TenantID(ctx), userID, calendarID)
+		return err
+	})
+	return a, err
+}
+
+// ListCalendars returns calendars owned by the user and shared with them.
+func (s *Storage) ListCalendars(ctx context.Context, userID string) ([]storage.Calendar, error) {
+	calendars := make([]storage.Calendar, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT c.tenant_id, c.id, c.owner_id, c.name
+			FROM calendars c
+			WHERE c.tenant_id = $1 AND (c.owner_id = $2 OR EXISTS (
+				SELECT 1 FROM grants g WHERE g.tenant_id = c.tenant_id AND g.calendar_id = c.id AND g.user_id = $2
+			))
+			ORDER BY c.id COLLATE "C"`, storage.TenantID(ctx), userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var cal storage.Calendar
+			if err := rows.Scan(&cal.TenantID, &cal.ID, &cal.OwnerID, &cal.Name); err != nil {
+				return err
+			}
+			calendars = append(calendars, cal)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return calendars, nil
+}
+
+// DeleteCalendar deletes the calendar with its grants. Events must be moved to the trash first,
+// the ones in the trash are deleted with the calendar as they can't be restored without it.
+func (s *Storage) DeleteCalendar(ctx context.Context, userID, calendarID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		// The lock keeps events from being added until the calendar is deleted.
+		_, a, err := calendar(ctx, tx, tenantID, userID, calendarID, true)
+		if err != nil {
+			return err
+		}
+		if a < storage.AccessOwner {
+			return storage.ErrAccessDenied
+		}
+		var notEmpty bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM events WHERE tenant_id = $1 AND calendar_id = $2 AND deleted_at IS NULL)`,
+			tenantID, calendarID).Scan(&notEmpty); err != nil {
+			return err
+		}
+		if notEmpty {
+			return storage.ErrCalendarNotEmpty
+		}
+		// Grants, events in the trash and their deliveries are deleted in cascade.
+		_, err = tx.ExecContext(ctx, `DELETE FROM calendars WHERE tenant_id = $1 AND id = $2`, tenantID, calendarID)
+		return err
+	})
+}
+
+func (s *Storage) ShareCalendar(ctx context.Context, userID string, grant storage.Grant) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		cal, a, err := calendar(ctx, tx, tenantID, userID, grant.CalendarID, false)
+		if err != nil {
+			return err
+		}
+		if a < storage.AccessOwner {
+			return storage.ErrAccessDenied
+		}
+		if grant.Access <= storage.AccessNone || grant.Access >= storage.AccessOwner || cal.OwnerID == grant.UserID {
+			return storage.ErrInvalidAccess
+		}
+		grant.TenantID = tenantID
+		return saveGrant(ctx, tx, grant)
+	})
+}
+
+func saveGrant(ctx context.Context, tx *sql.Tx, g storage.Grant) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO grants (tenant_id, calendar_id, user_id, access) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, calendar_id, user_id) DO UPDATE SET access = EXCLUDED.access`,
+		g.TenantID, g.CalendarID, g.UserID, int(g.Access))
+	return err
+}
+
+func (s *Storage) RevokeShare(ctx context.Context, userID, calendarID, granteeID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if err := requireAccess(ctx, tx, tenantID, userID, calendarID, storage.AccessOwner); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM grants WHERE tenant_id = $1 AND calendar_id = $2 AND user_id = $3`,
+			tenantID, calendarID, granteeID)
+		return err
+	})
+}
+
+func (s *Storage) ListShares(ctx context.Context, userID, calendarID string) ([]storage.Grant, error) {
+	grants := make([]storage.Grant, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if err := requireAccess(ctx, tx, tenantID, userID, calendarID, storage.AccessOwner); err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, `
+			SELECT tenant_id, calendar_id, user_id, access FROM grants
+			WHERE tenant_id = $1 AND calendar_id = $2
+			ORDER BY user_id COLLATE "C"`, tenantID, calendarID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var g storage.Grant
+			if err := rows.Scan(&g.TenantID, &g.CalendarID, &g.UserID, &g.Access); err != nil {
+				return err
+			}
+			grants = append(grants, g)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+const eventColumns = `e.tenant_id, e.id, e.calendar_id, e.uid, e.owner_id, e.title, e.start_at, e.end_at,
+	e.description, e.reminders, e.tags, e.attachments, e.deleted_at, e.deleted_by`
+
+// scanEvent scans the eventColumns followed by the extra columns into dest.
+func scanEvent(row scanner, dest ...interface{}) (storage.Event, error) {
+	var (
+		e                            storage.Event
+		startAt, endAt, deletedAt    sql.NullTime
+		reminders, tags, attachments []byte
+	)
+	columns := []interface{}{
+		&e.TenantID, &e.ID, &e.CalendarID, &e.UID, &e.OwnerID, &e.Title, &startAt, &endAt,
+		&e.Description, &reminders, &tags, &attachments, &deletedAt, &e.DeletedBy,
+	}
+	if err := row.Scan(append(columns, dest...)...); err != nil {
+		return storage.Event{}, err
+	}
+	e.StartAt, e.EndAt, e.DeletedAt = timeOf(startAt), timeOf(endAt), timeOf(deletedAt)
+	if err := json.Unmarshal(reminders, &e.Reminders); err != nil {
+		return storage.Event{}, err
+	}
+	if err := json.Unmarshal(tags, &e.Tags); err != nil {
+		return storage.Event{}, err
+	}
+	if err := json.Unmarshal(attachments, &e.Attachments); err != nil {
+		return storage.Event{}, err
+	}
+	return e, nil
+}
+
+// eventJSON returns the JSON columns of the event.
+func eventJSON(e storage.Event) (reminders, tags, attachments string, err error) {
+	if reminders, err = marshal(e.Reminders); err != nil {
+		return "", "", "", err
+	}
+	if tags, err = marshal(e.Tags); err != nil {
+		return "", "", "", err
+	}
+	if attachments, err = marshal(e.Attachments); err != nil {
+		return "", "", "", err
+	}
+	return reminders, tags, attachments, nil
+}
+
+func insertEvent(ctx context.Context, tx *sql.Tx, e storage.Event) error {
+	reminders, tags, attachments, err := eventJSON(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO events (tenant_id, id, calendar_id, uid, ical_uid, owner_id, title, start_at, end_at,
+			description, reminders, tags, attachments, deleted_at, deleted_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		e.TenantID, e.ID, e.CalendarID, e.UID, e.ICalUID(), e.OwnerID, e.Title, nullTime(e.StartAt), nullTime(e.EndAt),
+		e.Description, reminders, tags, attachments, nullTime(e.DeletedAt), e.DeletedBy)
+	if uniqueViolation(err) {
+		return storage.ErrEventExists
+	}
+	return err
+}
+
+// event returns the event, locking it if forUpdate is set. Events in the trash are returned too.
+func event(ctx context.Context, tx *sql.Tx, tenantID, eventID string, forUpdate bool) (storage.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events e WHERE e.tenant_id = $1 AND e.id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	e, err := scanEvent(tx.QueryRowContext(ctx, query, tenantID, eventID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	return e, err
+}
+
+func (s *Storage) CreateEvent(ctx context.Context, userID string, e storage.Event) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return createEvent(ctx, tx, storage.TenantID(ctx), userID, e)
+	})
+}
+
+// createEvent adds the event, its ID and its UID within the calendar must be new.
+func createEvent(ctx context.Context, tx *sql.Tx, tenantID, userID string, e storage.Event) error {
+	if err := requireAccess(ctx, tx, tenantID, userID, e.CalendarID, storage.AccessReadWrite); err != nil {
+		return err
+	}
+	e.TenantID = tenantID
+	return insertEvent(ctx, tx, e)
+}
+
+// UpdateEvent replaces the event, it may be moved to another calendar if the user can write to both.
+func (s *Storage) UpdateEvent(ctx context.Context, userID string, e storage.Event) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return updateEvent(ctx, tx, storage.TenantID(ctx), userID, e)
+	})
+}
+
+func updateEvent(ctx context.Context, tx *sql.Tx, tenantID, userID string, e storage.Event) error {
+	old, err := writableEvent(ctx, tx, tenantID, userID, e.ID)
+	if err != nil {
+		return err
+	}
+	if old.CalendarID != e.CalendarID {
+		if err := requireAccess(ctx, tx, tenantID, userID, e.CalendarID, storage.AccessReadWrite); err != nil {
+			return err
+		}
+	}
+	// Attachments are changed by AddAttachment and RemoveAttachment only.
+	reminders, tags, _, err := eventJSON(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE events SET calendar_id = $3, uid = $4, ical_uid = $5, owner_id = $6, title = $7, start_at = $8,
+			end_at = $9, description = $10, reminders = $11, tags = $12, deleted_at = $13, deleted_by = $14
+		WHERE tenant_id = $1 AND id = $2`,
+		tenantID, e.ID, e.CalendarID, e.UID, e.ICalUID(), e.OwnerID, e.Title, nullTime(e.StartAt),
+		nullTime(e.EndAt), e.Description, reminders, tags, nullTime(e.DeletedAt), e.DeletedBy)
+	if uniqueViolation(err) {
+		return storage.ErrEventExists
+	}
+	if err != nil {
+		return err
+	}
+
+	// Deliveries of the remaining reminders are kept, so they are not sent again.
+	reminderIDs := make([]string, 0, len(e.Reminders))
+	for _, r := range e.Reminders {
+		reminderIDs = append(reminderIDs, r.ID)
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM deliveries WHERE tenant_id = $1 AND event_id = $2 AND NOT reminder_id = ANY ($3::text[])`,
+		tenantID, e.ID, pq.Array(reminderIDs))
+	return err
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, userID, eventID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if _, err := writableEvent(ctx, tx, tenantID, userID, eventID); err != nil {
+			return err
+		}
+		// The deliveries are deleted in cascade.
+		_, err := tx.ExecContext(ctx, `DELETE FROM events WHERE tenant_id = $1 AND id = $2`, tenantID, eventID)
+		return err
+	})
+}
+
+// ApplyEventOps applies all the operations in one transaction, so either all of them or none
+// are committed. Deleted events are moved to the trash at their DeletedAt time.
+func (s *Storage) ApplyEventOps(ctx context.Context, userID string, ops []storage.EventOp) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		for i, op := range ops {
+			var err error
+			switch op.Change {
+			case storage.ChangeCreated:
+				err = createEvent(ctx, tx, tenantID, userID, op.Event)
+			case storage.ChangeUpdated:
+				err = updateEvent(ctx, tx, tenantID, userID, op.Event)
+			case storage.ChangeDeleted:
+				err = trashEvent(ctx, tx, tenantID, userID, op.Event.ID, op.Event.DeletedAt)
+			default:
+				err = fmt.Errorf("%w: %q", storage.ErrInvalidOperation, op.Change)
+			}
+			if err != nil {
+				return &storage.BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// writableEvent returns the event the user can change and locks it until the end of the transaction.
+func writableEvent(ctx context.Context, tx *sql.Tx, tenantID, userID, eventID string) (storage.Event, error) {
+	e, err := event(ctx, tx, tenantID, eventID, true)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if e.Deleted() {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	a, err := access(ctx, tx, tenantID, userID, e.CalendarID)
+	if errors.Is(err, storage.ErrCalendarNotFound) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if a < storage.AccessReadWrite {
+		return storage.Event{}, storage.ErrAccessDenied
+	}
+	return e, nil
+}
+
+// GetEvent returns the event, with free-busy access only its time slot is returned.
+func (s *Storage) GetEvent(ctx context.Context, userID, eventID string) (e storage.Event, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if e, err = event(ctx, tx, tenantID, eventID, false); err != nil {
+			return err
+		}
+		if e.Deleted() {
+			return storage.ErrEventNotFound
+		}
+		a, err := access(ctx, tx, tenantID, userID, e.CalendarID)
+		if errors.Is(err, storage.ErrCalendarNotFound) {
+			return storage.ErrEventNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if a == storage.AccessFreeBusy {
+			e = e.FreeBusy()
+		}
+		return nil
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return e, nil
+}
+
+// FindEvent returns the event of the calendar with the iCalendar UID. Events in the trash
+// are found too if the user can write to the calendar.
+func (s *Storage) FindEvent(ctx context.Context, userID, calendarID, uid string) (e storage.Event, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		a, err := access(ctx, tx, tenantID, userID, calendarID)
+		if errors.Is(err, storage.ErrCalendarNotFound) {
+			return storage.ErrEventNotFound
+		}
+		if err != nil {
+			return err
+		}
+		e, err = scanEvent(tx.QueryRowContext(ctx, `
+			SELECT `+eventColumns+` FROM events e WHERE e.tenant_id = $1 AND e.calendar_id = $2 AND e.ical_uid = $3`,
+			tenantID, calendarID, uid))
+		if errors.Is(err, sql.ErrNoRows) || err == nil && e.Deleted() && a < storage.AccessReadWrite {
+			return storage.ErrEventNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if a == storage.AccessFreeBusy {
+			e = e.FreeBusy()
+		}
+		return nil
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return e, nil
+}
+
+// visibleEvents returns the events matching the condition on the columns of events e of the calendars
+// visible to the user $2 of the tenant $1, with the user's access to them. The arguments follow the user.
+func visibleEvents(
+	ctx context.Context, tx *sql.Tx, tenantID, userID, where, orderBy string, args ...interface{},
+) ([]storage.Event, []storage.Access, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+eventColumns+`, c.owner_id, g.access
+		FROM events e
+		JOIN calendars c ON c.tenant_id = e.tenant_id AND c.id = e.calendar_id
+		LEFT JOIN grants g ON g.tenant_id = e.tenant_id AND g.calendar_id = e.calendar_id AND g.user_id = $2
+		WHERE e.tenant_id = $1 AND (c.owner_id = $2 OR g.access IS NOT NULL) AND `+where+`
+		ORDER BY `+orderBy, append([]interface{}{tenantID, userID}, args...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		events   []storage.Event
+		accesses []storage.Access
+	)
+	for rows.Next() {
+		var (
+			ownerID string
+			granted sql.NullInt64
+		)
+		e, err := scanEvent(rows, &ownerID, &granted)
+		if err != nil {
+			return nil, nil, err
+		}
+		a, err := accessOf(userID, ownerID, granted)
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(events, e)
+		accesses = append(accesses, a)
+	}
+	return events, accesses, rows.Err()
+}
+
+// ListEvents returns events intersecting [from, to) from all calendars visible to the user.
+// Events of calendars shared as free-busy contain only their time slots.
+func (s *Storage) ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	events := make([]storage.Event, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		// Events with no duration intersect the range if they start within it.
+		visible, accesses, err := visibleEvents(ctx, tx, storage.TenantID(ctx), userID, `
+			e.deleted_at IS NULL AND e.start_at < $4 AND (e.end_at > $3 OR e.end_at = e.start_at AND e.start_at >= $3)`,
+			`e.start_at, e.id COLLATE "C"`, from, to)
+		if err != nil {
+			return err
+		}
+		for i, e := range visible {
+			if accesses[i] == storage.AccessFreeBusy {
+				e = e.FreeBusy()
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// CountEvents returns the number of events of the tenant, those in the trash are not counted.
+func (s *Storage) CountEvents(ctx context.Context) (count int, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, `SELECT count(*) FROM events WHERE tenant_id = $1 AND deleted_at IS NULL`,
+			storage.TenantID(ctx)).Scan(&count)
+	})
+	return count, err
+}
+
+const deliveryColumns = `d.tenant_id, d.event_id, d.reminder_id, d.channel, d.notify_at, d.sent_at, d.status,
+	d.attempts, d.error`
+
+func scanDelivery(row scanner) (storage.Delivery, error) {
+	var (
+		d                storage.Delivery
+		notifyAt, sentAt sql.NullTime
+	)
+	err := row.Scan(&d.TenantID, &d.EventID, &d.ReminderID, &d.Channel, &notifyAt, &sentAt, &d.Status,
+		&d.Attempts, &d.Error)
+	d.NotifyAt, d.SentAt = timeOf(notifyAt), timeOf(sentAt)
+	return d, err
+}
+
+// saveDelivery records the delivery of the reminder replacing the previous one.
+func saveDelivery(ctx context.Context, tx *sql.Tx, d storage.Delivery) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO deliveries (tenant_id, event_id, reminder_id, channel, notify_at, sent_at, status, attempts, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (tenant_id, event_id, reminder_id) DO UPDATE SET channel = EXCLUDED.channel,
+			notify_at = EXCLUDED.notify_at, sent_at = EXCLUDED.sent_at, status = EXCLUDED.status,
+			attempts = EXCLUDED.attempts, error = EXCLUDED.error`,
+		d.TenantID, d.EventID, d.ReminderID, string(d.Channel), nullTime(d.NotifyAt), nullTime(d.SentAt),
+		string(d.Status), d.Attempts, d.Error)
+	return err
+}
+
+// DueNotifications returns notifications of all the reminders due at now which have not been delivered yet,
+// with the number of failed attempts to deliver them.
+func (s *Storage) DueNotifications(ctx context.Context, now time.Time) (due []storage.Notification, err error) {
+	err = s.allReadTx(ctx, func(tx *sql.Tx) error {
+		due, err = dueNotifications(ctx, tx, now)
+		return err
+	})
+	return due, err
+}
+
+// dueNotifications returns the notifications due at now of all tenants, the earliest first.
+func dueNotifications(ctx context.Context, tx *sql.Tx, now time.Time) ([]storage.Notification, error) {
+	// The events which are not over yet, Event.Notifications checks the rest.
+	const ongoing = `e.deleted_at IS NULL AND (e.end_at > $1 OR e.start_at > $2)`
+	since := now.Add(-storage.InstantEventWindow)
+
+	deliveries := make(map[string]map[string]storage.Delivery)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM deliveries d
+		JOIN events e ON e.tenant_id = d.tenant_id AND e.id = d.event_id
+		WHERE `+ongoing, now, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		key := tenantKey(d.TenantID, d.EventID)
+		if deliveries[key] == nil {
+			deliveries[key] = make(map[string]storage.Delivery)
+		}
+		deliveries[key][d.ReminderID] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	notifications := make([]storage.Notification, 0)
+	rows, err = tx.QueryContext(ctx, `SELECT `+eventColumns+` FROM events e WHERE `+ongoing, now, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range e.Notifications(now) {
+			d, ok := deliveries[tenantKey(e.TenantID, e.ID)][n.ReminderID]
+			if ok && n.Delivered(d) {
+				continue
+			}
+			if ok && n.Retried(d) {
+				n.Attempts = d.Attempts
+			}
+			notifications = append(notifications, n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		if !notifications[i].NotifyAt.Equal(notifications[j].NotifyAt) {
+			return notifications[i].NotifyAt.Before(notifications[j].NotifyAt)
+		}
+		ki := tenantKey(notifications[i].TenantID, notifications[i].EventID)
+		kj := tenantKey(notifications[j].TenantID, notifications[j].EventID)
+		if ki != kj {
+			return ki < kj
+		}
+		return notifications[i].ReminderID < notifications[j].ReminderID
+	})
+	return notifications, nil
+}
+
+// MarkDelivered records the delivery of the reminder replacing the previous one, failed deliveries included,
+// and removes the reminder from the outbox in the same transaction.
+func (s *Storage) MarkDelivered(ctx context.Context, d storage.Delivery) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		d.TenantID = storage.TenantID(ctx)
+		e, err := event(ctx, tx, d.TenantID, d.EventID, false)
+		if err != nil {
+			return err
+		}
+		if e.Deleted() {
+			return storage.ErrEventNotFound
+		}
+		if !hasReminder(e, d.ReminderID) {
+			return storage.ErrReminderNotFound
+		}
+		// The outbox is changed first, EnqueueNotifications locks it before the deliveries.
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM outbox WHERE tenant_id = $1 AND event_id = $2 AND reminder_id = $3`,
+			d.TenantID, d.EventID, d.ReminderID); err != nil {
+			return err
+		}
+		return saveDelivery(ctx, tx, d)
+	})
+}
+
+func hasReminder(e storage.Event, reminderID string) bool {
+	for _, r := range e.Reminders {
+		if r.ID == reminderID {
+			return true
+		}
+	}
+	return false
+}
+
+// ListDeliveries returns the last deliveries of reminders of the events the user owns, the latest first.
+func (s *Storage) ListDeliveries(ctx context.Context, userID string) ([]storage.Delivery, error) {
+	deliveries := make([]storage.Delivery, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT `+deliveryColumns+`
+			FROM deliveries d
+			JOIN events e ON e.tenant_id = d.tenant_id AND e.id = d.event_id
+			WHERE d.tenant_id = $1 AND e.owner_id = $2
+			ORDER BY d.sent_at DESC NULLS LAST, d.event_id COLLATE "C", d.reminder_id COLLATE "C"`,
+			storage.TenantID(ctx), userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			d, err := scanDelivery(rows)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,253 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// dsnEnv is the variable with the DSN of the database for the tests, they are skipped without it.
+const dsnEnv = "CALENDAR_TEST_DSN"
+
+var day = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// baseDSN returns the DSN of the test database as key=value pairs, the test is skipped without it.
+func baseDSN(tb testing.TB) string {
+	tb.Helper()
+
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", dsnEnv)
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		dsn, err = pq.ParseURL(dsn)
+		require.NoError(tb, err)
+	}
+	return dsn
+}
+
+// testDSN returns the DSN of a new schema of the test database, the schema is dropped after the test.
+func testDSN(tb testing.TB) string {
+	tb.Helper()
+
+	dsn := baseDSN(tb)
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(tb, err)
+	schema := fmt.Sprintf("calendar_test_%d", rand.Int63()) //nolint:gosec
+	_, err = db.Exec(`CREATE SCHEMA ` + schema)
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		_, err := db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		require.NoError(tb, err)
+		require.NoError(tb, db.Close())
+	})
+	return dsn + " search_path=" + schema
+}
+
+func open(tb testing.TB, dsn string) *Storage {
+	tb.Helper()
+
+	s := New(dsn)
+	require.NoError(tb, s.Connect(context.Background()))
+	tb.Cleanup(func() { require.NoError(tb, s.Close(context.Background())) })
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	baseDSN(t)
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return open(t, testDSN(t))
+	})
+}
+
+func BenchmarkStorage(b *testing.B) {
+	baseDSN(b)
+	storagetest.Bench(b, func(b *testing.B) storagetest.Storage {
+		return open(b, testDSN(b))
+	})
+}
+
+func TestMigrateTwice(t *testing.T) {
+	dsn := testDSN(t)
+	open(t, dsn)
+	open(t, dsn)
+}
+
+// Schedulers of several replicas enqueue the same notifications at once, each of them
+// must be queued once.
+func TestConcurrentEnqueue(t *testing.T) {
+	dsn := testDSN(t)
+	ctx := context.Background()
+	s := open(t, dsn)
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.CreateEvent(ctx, "owner", storage.Event{
+			ID:         fmt.Sprint(i),
+			CalendarID: "work",
+			OwnerID:    "owner",
+			StartAt:    day.Add(10 * time.Hour),
+			EndAt:      day.Add(11 * time.Hour),
+			Reminders:  []storage.Reminder{{ID: "r", Before: time.Hour, Channel: storage.ChannelLog}},
+		}))
+	}
+
+	const replicas = 4
+	var wg sync.WaitGroup
+	queued := make([]int, replicas)
+	errs := make([]error, replicas)
+	for i := 0; i < replicas; i++ {
+		replica := open(t, dsn)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			queued[i], errs[i] = replica.EnqueueNotifications(ctx, day.Add(9*time.Hour))
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for i := range queued {
+		require.NoError(t, errs[i])
+		total += queued[i]
+	}
+	require.Equal(t, 10, total)
+
+	messages, err := s.ListOutbox(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 10)
+
+	// The delivery and the removal of the message are committed together.
+	n := messages[0].Notification
+	require.NoError(t, s.MarkDelivered(ctx, storage.Delivery{
+		EventID:    n.EventID,
+		ReminderID: n.ReminderID,
+		Channel:    n.Channel,
+		NotifyAt:   n.NotifyAt,
+		SentAt:     day.Add(9 * time.Hour),
+		Status:     storage.DeliverySent,
+		Attempts:   1,
+	}))
+	messages, err = s.ListOutbox(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 9)
+	var left int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM outbox`).Scan(&left))
+	require.Equal(t, 9, left)
+}
+
+// A batch failing on a constraint of the database rolls back the operations before it.
+func TestApplyEventOpsRollback(t *testing.T) {
+	ctx := context.Background()
+	s := open(t, testDSN(t))
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	newEvent := func(id, uid string) storage.Event {
+		return storage.Event{ID: id, UID: uid, CalendarID: "work", OwnerID: "owner", StartAt: day, EndAt: day}
+	}
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("1", "standup")))
+
+	err := s.ApplyEventOps(ctx, "owner", []storage.EventOp{
+		{Change: storage.ChangeCreated, Event: newEvent("2", "")},
+		{Change: storage.ChangeCreated, Event: newEvent("3", "standup")},
+	})
+	var batchErr *storage.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Equal(t, 1, batchErr.Index)
+	require.True(t, errors.Is(err, storage.ErrEventExists))
+
+	count, err := s.CountEvents(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+// Row-level security hides the rows of other tenants from queries without a tenant condition.
+func TestRowLevelSecurity(t *testing.T) {
+	ctx := context.Background()
+	s := open(t, testDSN(t))
+
+	var bypass bool
+	require.NoError(t, s.db.QueryRow(`
+		SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&bypass))
+	if bypass {
+		t.Skip("the role of the test database bypasses row-level security")
+	}
+
+	tenantA := storage.WithTenantID(ctx, "a")
+	require.NoError(t, s.CreateCalendar(tenantA, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	count := func(ctx context.Context, runTx func(context.Context, func(*sql.Tx) error) error) int {
+		var n int
+		require.NoError(t, runTx(ctx, func(tx *sql.Tx) error {
+			return tx.QueryRowContext(ctx, `SELECT count(*) FROM calendars`).Scan(&n)
+		}))
+		return n
+	}
+	require.Equal(t, 1, count(tenantA, s.readTx))
+	require.Equal(t, 0, count(storage.WithTenantID(ctx, "b"), s.readTx))
+	require.Equal(t, 0, count(ctx, s.readTx))
+	require.Equal(t, 1, count(ctx, s.allReadTx))
+
+	// Outside of the transactions of the storage nothing is visible.
+	var n int
+	require.NoError(t, s.db.QueryRow(`SELECT count(*) FROM calendars`).Scan(&n))
+	require.Zero(t, n)
+
+	// Rows of another tenant can't be written either.
+	err := s.tx(storage.WithTenantID(ctx, "b"), func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO calendars (tenant_id, id, owner_id, name) VALUES ('a', 'home', 'owner', '')`)
+		return err
+	})
+	require.Error(t, err)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	ctx := storage.WithTenantID(context.Background(), "acme")
+	s := open(t, testDSN(t))
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{
+		CalendarID: "work", UserID: "guest", Access: storage.AccessRead,
+	}))
+	require.NoError(t, s.CreateEvent(ctx, "owner", storage.Event{
+		ID:         "1",
+		CalendarID: "work",
+		OwnerID:    "owner",
+		StartAt:    day.Add(10 * time.Hour),
+		EndAt:      day.Add(11 * time.Hour),
+		Reminders:  []storage.Reminder{{ID: "r", Before: time.Hour, Channel: storage.ChannelLog}},
+		Tags:       []string{"Work"},
+	}))
+	_, err := s.EnqueueNotifications(ctx, day.Add(9*time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, s.CreateWebhook(ctx, storage.Webhook{ID: "w", UserID: "owner", URL: "http://example.com"}))
+	require.NoError(t, s.SaveWebhookMessage(ctx, storage.WebhookMessage{
+		ID: "m", WebhookID: "w", Change: storage.ChangeCreated, EventID: "1", Body: []byte("{}"), Dead: true,
+	}))
+	require.NoError(t, s.AppendAudit(ctx, storage.AuditEntry{
+		ID: "a", EventID: "1", CalendarID: "work", ActorID: "owner", Change: storage.ChangeCreated, At: day,
+	}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "owner", Name: "Work", Color: "#ff0000"}))
+
+	snap, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snap.Outbox, 1)
+
+	restored := open(t, testDSN(t))
+	require.NoError(t, restored.CreateCalendar(ctx, storage.Calendar{ID: "stale", OwnerID: "owner"}))
+	require.NoError(t, restored.Restore(ctx, snap))
+	got, err := restored.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, snap, got)
+}
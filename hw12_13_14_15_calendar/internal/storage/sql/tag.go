@@ -0,0 +1,73 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// PutTag creates or replaces the user's tag, names are case-insensitive.
+func (s *Storage) PutTag(ctx context.Context, tag storage.Tag) error {
+	if tag.UserID == "" || tag.Name == "" {
+		return fmt.Errorf("%w: no user or name", storage.ErrInvalidOperation)
+	}
+	tag.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return saveTag(ctx, tx, tag)
+	})
+}
+
+func saveTag(ctx context.Context, tx *sql.Tx, tag storage.Tag) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tags (tenant_id, user_id, name_key, name, color) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, user_id, name_key) DO UPDATE SET name = EXCLUDED.name, color = EXCLUDED.color`,
+		tag.TenantID, tag.UserID, tagKey(tag.Name), tag.Name, tag.Color)
+	return err
+}
+
+// ListTags returns the user's tags sorted by name.
+func (s *Storage) ListTags(ctx context.Context, userID string) ([]storage.Tag, error) {
+	tags := make([]storage.Tag, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT tenant_id, user_id, name, color FROM tags WHERE tenant_id = $1 AND user_id = $2
+			ORDER BY name_key COLLATE "C"`, storage.TenantID(ctx), userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var tag storage.Tag
+			if err := rows.Scan(&tag.TenantID, &tag.UserID, &tag.Name, &tag.Color); err != nil {
+				return err
+			}
+			tags = append(tags, tag)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// DeleteTag deletes the user's tag, events keep the name but lose the colour.
+func (s *Storage) DeleteTag(ctx context.Context, userID, name string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE tenant_id = $1 AND user_id = $2 AND name_key = $3`,
+			storage.TenantID(ctx), userID, tagKey(name))
+		if err != nil {
+			return err
+		}
+		return requireRows(res, storage.ErrTagNotFound)
+	})
+}
+
+// tagKey is the key of the tag among the user's ones, it is lower-cased in Go rather than
+// in the database so that both storages agree on the case of non-ASCII names.
+func tagKey(name string) string {
+	return strings.ToLower(name)
+}
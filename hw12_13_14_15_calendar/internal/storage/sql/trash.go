@@ -0,0 +1,109 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// TrashEvent moves the event to the trash, it can be restored until it is purged.
+func (s *Storage) TrashEvent(ctx context.Context, userID, eventID string, at time.Time) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return trashEvent(ctx, tx, storage.TenantID(ctx), userID, eventID, at)
+	})
+}
+
+func trashEvent(ctx context.Context, tx *sql.Tx, tenantID, userID, eventID string, at time.Time) error {
+	if at.IsZero() {
+		return fmt.Errorf("%w: no deletion time", storage.ErrInvalidOperation)
+	}
+	if _, err := writableEvent(ctx, tx, tenantID, userID, eventID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE events SET deleted_at = $3, deleted_by = $4 WHERE tenant_id = $1 AND id = $2`,
+		tenantID, eventID, at, userID)
+	return err
+}
+
+// ListTrash returns the deleted events of the calendars the user can write to, the latest deleted first.
+func (s *Storage) ListTrash(ctx context.Context, userID string) ([]storage.Event, error) {
+	events := make([]storage.Event, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		deleted, accesses, err := visibleEvents(ctx, tx, storage.TenantID(ctx), userID,
+			`e.deleted_at IS NOT NULL`, `e.deleted_at DESC, e.id COLLATE "C"`)
+		if err != nil {
+			return err
+		}
+		for i, e := range deleted {
+			if accesses[i] >= storage.AccessReadWrite {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// RestoreEvent moves the event back from the trash.
+func (s *Storage) RestoreEvent(ctx context.Context, userID, eventID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		e, err := event(ctx, tx, tenantID, eventID, true)
+		if err != nil {
+			return err
+		}
+		if !e.Deleted() {
+			return storage.ErrEventNotFound
+		}
+		a, err := access(ctx, tx, tenantID, userID, e.CalendarID)
+		if errors.Is(err, storage.ErrCalendarNotFound) {
+			return storage.ErrEventNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if a < storage.AccessReadWrite {
+			return storage.ErrAccessDenied
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE events SET deleted_at = NULL, deleted_by = '' WHERE tenant_id = $1 AND id = $2`,
+			tenantID, eventID)
+		return err
+	})
+}
+
+// PurgeTrash permanently deletes the events moved to the trash before the time and returns them.
+func (s *Storage) PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error) {
+	purged := make([]storage.Event, 0)
+	err := s.allTx(ctx, func(tx *sql.Tx) error {
+		// The deliveries are deleted in cascade.
+		rows, err := tx.QueryContext(ctx, `
+			DELETE FROM events e WHERE e.deleted_at < $1
+			RETURNING `+eventColumns, before)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e, err := scanEvent(rows)
+			if err != nil {
+				return err
+			}
+			purged = append(purged, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	storage.SortEvents(purged)
+	return purged, nil
+}
@@ -0,0 +1,448 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/lib/pq"
+)
+
+// maxWebhookDeliveries is the number of the latest deliveries kept for a webhook.
+const maxWebhookDeliveries = 100
+
+const webhookColumns = `w.tenant_id, w.id, w.user_id, w.url, w.secret, w.created_at, w.failures, w.disabled`
+
+func scanWebhook(row scanner) (storage.Webhook, error) {
+	var (
+		w         storage.Webhook
+		createdAt sql.NullTime
+	)
+	err := row.Scan(&w.TenantID, &w.ID, &w.UserID, &w.URL, &w.Secret, &createdAt, &w.Failures, &w.Disabled)
+	w.CreatedAt = timeOf(createdAt)
+	return w, err
+}
+
+func queryWebhooks(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]storage.Webhook, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := make([]storage.Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, w storage.Webhook) error {
+	w.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return insertWebhook(ctx, tx, w)
+	})
+}
+
+func insertWebhook(ctx context.Context, tx *sql.Tx, w storage.Webhook) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO webhooks (tenant_id, id, user_id, url, secret, created_at, failures, disabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		w.TenantID, w.ID, w.UserID, w.URL, w.Secret, nullTime(w.CreatedAt), w.Failures, w.Disabled)
+	if uniqueViolation(err) {
+		return storage.ErrWebhookExists
+	}
+	return err
+}
+
+func (s *Storage) ListWebhooks(ctx context.Context, userID string) (webhooks []storage.Webhook, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		webhooks, err = queryWebhooks(ctx, tx, `
+			SELECT `+webhookColumns+` FROM webhooks w
+			WHERE w.tenant_id = $1 AND w.user_id = $2
+			ORDER BY w.created_at NULLS FIRST, w.id COLLATE "C"`, storage.TenantID(ctx), userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func ownWebhook(ctx context.Context, tx *sql.Tx, tenantID, userID, webhookID string) error {
+	var own bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM webhooks WHERE tenant_id = $1 AND id = $2 AND user_id = $3)`,
+		tenantID, webhookID, userID).Scan(&own); err != nil {
+		return err
+	}
+	if !own {
+		return storage.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		// The deliveries and messages of the webhook are deleted in cascade.
+		res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE tenant_id = $1 AND id = $2 AND user_id = $3`,
+			storage.TenantID(ctx), webhookID, userID)
+		if err != nil {
+			return err
+		}
+		return requireRows(res, storage.ErrWebhookNotFound)
+	})
+}
+
+// requireRows returns err if the statement has changed no rows.
+func requireRows(res sql.Result, err error) error {
+	n, rowsErr := res.RowsAffected()
+	if rowsErr != nil {
+		return rowsErr
+	}
+	if n == 0 {
+		return err
+	}
+	return nil
+}
+
+// EnableWebhook enables the webhook disabled after failed deliveries.
+func (s *Storage) EnableWebhook(ctx context.Context, userID, webhookID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE webhooks SET disabled = false, failures = 0 WHERE tenant_id = $1 AND id = $2 AND user_id = $3`,
+			storage.TenantID(ctx), webhookID, userID)
+		if err != nil {
+			return err
+		}
+		return requireRows(res, storage.ErrWebhookNotFound)
+	})
+}
+
+// GetWebhook returns the webhook of any user of the tenant.
+func (s *Storage) GetWebhook(ctx context.Context, webhookID string) (w storage.Webhook, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		w, err = scanWebhook(tx.QueryRowContext(ctx, `
+			SELECT `+webhookColumns+` FROM webhooks w WHERE w.tenant_id = $1 AND w.id = $2`,
+			storage.TenantID(ctx), webhookID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrWebhookNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return storage.Webhook{}, err
+	}
+	return w, nil
+}
+
+// WebhooksForCalendar returns enabled webhooks of the users who can read events of the calendar.
+func (s *Storage) WebhooksForCalendar(ctx context.Context, calendarID string) (webhooks []storage.Webhook, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		webhooks, err = queryWebhooks(ctx, tx, `
+			SELECT `+webhookColumns+`
+			FROM webhooks w
+			JOIN calendars c ON c.tenant_id = w.tenant_id AND c.id = $2
+			LEFT JOIN grants g ON g.tenant_id = w.tenant_id AND g.calendar_id = c.id AND g.user_id = w.user_id
+			WHERE w.tenant_id = $1 AND NOT w.disabled AND (c.owner_id = w.user_id OR g.access >= $3)
+			ORDER BY w.created_at NULLS FIRST, w.id COLLATE "C"`,
+			storage.TenantID(ctx), calendarID, int(storage.AccessRead))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *Storage) AddWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error {
+	d.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		if err := insertWebhookDelivery(ctx, tx, d); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM webhook_deliveries WHERE tenant_id = $1 AND webhook_id = $2 AND seq <= (
+				SELECT seq FROM webhook_deliveries WHERE tenant_id = $1 AND webhook_id = $2
+				ORDER BY seq DESC OFFSET $3 LIMIT 1
+			)`, d.TenantID, d.WebhookID, maxWebhookDeliveries)
+		return err
+	})
+}
+
+func insertWebhookDelivery(ctx context.Context, tx *sql.Tx, d storage.WebhookDelivery) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (id, tenant_id, webhook_id, change, event_id, attempt, delivered_at,
+			status_code, error, success)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		d.ID, d.TenantID, d.WebhookID, string(d.Change), d.EventID, d.Attempt, nullTime(d.At),
+		d.StatusCode, d.Error, d.Success)
+	if foreignKeyViolation(err) {
+		return storage.ErrWebhookNotFound
+	}
+	return err
+}
+
+const webhookDeliveryColumns = `d.id, d.tenant_id, d.webhook_id, d.change, d.event_id, d.attempt, d.delivered_at,
+	d.status_code, d.error, d.success`
+
+func scanWebhookDelivery(row scanner) (storage.WebhookDelivery, error) {
+	var (
+		d  storage.WebhookDelivery
+		at sql.NullTime
+	)
+	err := row.Scan(&d.ID, &d.TenantID, &d.WebhookID, &d.Change, &d.EventID, &d.Attempt, &at,
+		&d.StatusCode, &d.Error, &d.Success)
+	d.At = timeOf(at)
+	return d, err
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest first.
+func (s *Storage) ListWebhookDeliveries(
+	ctx context.Context, userID, webhookID string,
+) ([]storage.WebhookDelivery, error) {
+	deliveries := make([]storage.WebhookDelivery, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if err := ownWebhook(ctx, tx, tenantID, userID, webhookID); err != nil {
+			return err
+		}
+		rows, err := tx.QueryContext(ctx, `
+			SELECT `+webhookDeliveryColumns+`
+			FROM webhook_deliveries d WHERE d.tenant_id = $1 AND d.webhook_id = $2
+			ORDER BY d.seq DESC`, tenantID, webhookID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			d, err := scanWebhookDelivery(rows)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookResult counts failed deliveries in a row and disables the webhook
+// when they reach maxFailures. A successful delivery resets the counter.
+func (s *Storage) RecordWebhookResult(
+	ctx context.Context, webhookID string, success bool, maxFailures int,
+) (w storage.Webhook, err error) {
+	err = s.tx(ctx, func(tx *sql.Tx) error {
+		w, err = scanWebhook(tx.QueryRowContext(ctx, `
+			UPDATE webhooks w SET
+				failures = CASE WHEN $3 THEN 0 ELSE w.failures + 1 END,
+				disabled = w.disabled OR (NOT $3 AND $4 > 0 AND w.failures + 1 >= $4)
+			WHERE w.tenant_id = $1 AND w.id = $2
+			RETURNING `+webhookColumns, storage.TenantID(ctx), webhookID, success, maxFailures))
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrWebhookNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return storage.Webhook{}, err
+	}
+	return w, nil
+}
+
+const webhookMessageColumns = `m.tenant_id, m.id, m.webhook_id, m.change, m.event_id, m.body, m.trace_parent,
+	m.attempts, m.next_attempt_at, m.last_error, m.updated_at, m.dead`
+
+// scanWebhookMessage scans the webhookMessageColumns followed by the extra columns into dest.
+func scanWebhookMessage(row scanner, dest ...interface{}) (storage.WebhookMessage, error) {
+	var (
+		m                        storage.WebhookMessage
+		nextAttemptAt, updatedAt sql.NullTime
+	)
+	columns := []interface{}{
+		&m.TenantID, &m.ID, &m.WebhookID, &m.Change, &m.EventID, &m.Body, &m.TraceParent,
+		&m.Attempts, &nextAttemptAt, &m.LastError, &updatedAt, &m.Dead,
+	}
+	if err := row.Scan(append(columns, dest...)...); err != nil {
+		return storage.WebhookMessage{}, err
+	}
+	m.NextAttemptAt, m.UpdatedAt = timeOf(nextAttemptAt), timeOf(updatedAt)
+	if len(m.Body) == 0 {
+		m.Body = nil
+	}
+	return m, nil
+}
+
+// SaveWebhookMessage adds the message or replaces the one with the same ID.
+func (s *Storage) SaveWebhookMessage(ctx context.Context, m storage.WebhookMessage) error {
+	m.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return saveWebhookMessage(ctx, tx, m)
+	})
+}
+
+func saveWebhookMessage(ctx context.Context, tx *sql.Tx, m storage.WebhookMessage) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_messages (tenant_id, id, webhook_id, change, event_id, body, trace_parent, attempts,
+			next_attempt_at, last_error, updated_at, dead)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (tenant_id, id) DO UPDATE SET webhook_id = EXCLUDED.webhook_id, change = EXCLUDED.change,
+			event_id = EXCLUDED.event_id, body = EXCLUDED.body, trace_parent = EXCLUDED.trace_parent,
+			attempts = EXCLUDED.attempts, next_attempt_at = EXCLUDED.next_attempt_at,
+			last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at, dead = EXCLUDED.dead`,
+		m.TenantID, m.ID, m.WebhookID, string(m.Change), m.EventID, m.Body, m.TraceParent, m.Attempts,
+		nullTime(m.NextAttemptAt), m.LastError, nullTime(m.UpdatedAt), m.Dead)
+	if foreignKeyViolation(err) {
+		return storage.ErrWebhookNotFound
+	}
+	return err
+}
+
+// DeleteWebhookMessage removes the message, if any.
+func (s *Storage) DeleteWebhookMessage(ctx context.Context, messageID string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM webhook_messages WHERE tenant_id = $1 AND id = $2`,
+			storage.TenantID(ctx), messageID)
+		return err
+	})
+}
+
+// ClaimWebhookMessages returns up to limit messages of all tenants due at now, the earliest first,
+// and postpones their next attempt until then. Dead messages and those of disabled webhooks wait.
+// Messages claimed by a concurrent transaction are skipped.
+func (s *Storage) ClaimWebhookMessages(
+	ctx context.Context, now, until time.Time, limit int,
+) ([]storage.WebhookMessage, error) {
+	type claimed struct {
+		m     storage.WebhookMessage
+		dueAt time.Time
+	}
+	var due []claimed
+	err := s.allTx(ctx, func(tx *sql.Tx) error {
+		// A NULL limit is no limit.
+		rows, err := tx.QueryContext(ctx, `
+			WITH due AS (
+				SELECT m.tenant_id, m.id, m.next_attempt_at
+				FROM webhook_messages m
+				JOIN webhooks w ON w.tenant_id = m.tenant_id AND w.id = m.webhook_id
+				WHERE NOT m.dead AND (m.next_attempt_at IS NULL OR m.next_attempt_at <= $1) AND NOT w.disabled
+				ORDER BY m.next_attempt_at NULLS FIRST, m.tenant_id COLLATE "C", m.id COLLATE "C"
+				LIMIT $3
+				FOR UPDATE OF m SKIP LOCKED
+			)
+			UPDATE webhook_messages m SET next_attempt_at = $2
+			FROM due WHERE m.tenant_id = due.tenant_id AND m.id = due.id
+			RETURNING `+webhookMessageColumns+`, due.next_attempt_at`,
+			now, nullTime(until), sql.NullInt64{Int64: int64(limit), Valid: limit >= 0})
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var dueAt sql.NullTime
+			m, err := scanWebhookMessage(rows, &dueAt)
+			if err != nil {
+				return err
+			}
+			due = append(due, claimed{m: m, dueAt: timeOf(dueAt)})
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].dueAt.Equal(due[j].dueAt) {
+			return due[i].dueAt.Before(due[j].dueAt)
+		}
+		return tenantKey(due[i].m.TenantID, due[i].m.ID) < tenantKey(due[j].m.TenantID, due[j].m.ID)
+	})
+	messages := make([]storage.WebhookMessage, 0, len(due))
+	for _, c := range due {
+		messages = append(messages, c.m)
+	}
+	return messages, nil
+}
+
+// ListWebhookDeadLetters returns the dead messages of the user's webhooks, or of one of them
+// if webhookID is set, the latest first.
+func (s *Storage) ListWebhookDeadLetters(
+	ctx context.Context, userID, webhookID string,
+) ([]storage.WebhookMessage, error) {
+	dead := make([]storage.WebhookMessage, 0)
+	err := s.readTx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if webhookID != "" {
+			if err := ownWebhook(ctx, tx, tenantID, userID, webhookID); err != nil {
+				return err
+			}
+		}
+		rows, err := tx.QueryContext(ctx, `
+			SELECT `+webhookMessageColumns+`
+			FROM webhook_messages m
+			JOIN webhooks w ON w.tenant_id = m.tenant_id AND w.id = m.webhook_id
+			WHERE m.tenant_id = $1 AND w.user_id = $2 AND ($3::text = '' OR m.webhook_id = $3) AND m.dead
+			ORDER BY m.updated_at DESC NULLS LAST, m.id COLLATE "C"`, tenantID, userID, webhookID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			m, err := scanWebhookMessage(rows)
+			if err != nil {
+				return err
+			}
+			dead = append(dead, m)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dead, nil
+}
+
+// RedriveWebhookDeadLetters makes the dead messages of the user's webhooks due at now with
+// all their attempts. The messages are limited to the webhook if webhookID is set and to
+// messageIDs if there are any. It returns the number of redriven messages.
+func (s *Storage) RedriveWebhookDeadLetters(
+	ctx context.Context, userID, webhookID string, messageIDs []string, now time.Time,
+) (redriven int, err error) {
+	err = s.tx(ctx, func(tx *sql.Tx) error {
+		tenantID := storage.TenantID(ctx)
+		if webhookID != "" {
+			if err := ownWebhook(ctx, tx, tenantID, userID, webhookID); err != nil {
+				return err
+			}
+		}
+		if messageIDs == nil {
+			messageIDs = []string{}
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE webhook_messages m SET dead = false, attempts = 0, next_attempt_at = $5, updated_at = $5
+			FROM webhooks w
+			WHERE w.tenant_id = m.tenant_id AND w.id = m.webhook_id
+				AND m.tenant_id = $1 AND w.user_id = $2 AND ($3::text = '' OR m.webhook_id = $3) AND m.dead
+				AND (cardinality($4::text[]) = 0 OR m.id = ANY ($4::text[]))`,
+			tenantID, userID, webhookID, pq.Array(messageIDs), nullTime(now))
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		redriven = int(n)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return redriven, nil
+}
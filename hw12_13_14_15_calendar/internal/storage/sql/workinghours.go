@@ -0,0 +1,75 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// SetWorkingHours replaces the working hours of the user.
+func (s *Storage) SetWorkingHours(ctx context.Context, w storage.WorkingHours) error {
+	if w.UserID == "" {
+		return fmt.Errorf("%w: no user", storage.ErrInvalidOperation)
+	}
+	w.TenantID = storage.TenantID(ctx)
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		return saveWorkingHours(ctx, tx, w)
+	})
+}
+
+func saveWorkingHours(ctx context.Context, tx *sql.Tx, w storage.WorkingHours) error {
+	days, err := marshal(w.Days)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO working_hours (tenant_id, user_id, time_zone, start_offset, end_offset, days)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, user_id) DO UPDATE SET time_zone = EXCLUDED.time_zone,
+			start_offset = EXCLUDED.start_offset, end_offset = EXCLUDED.end_offset, days = EXCLUDED.days`,
+		w.TenantID, w.UserID, w.TimeZone, int64(w.Start), int64(w.End), days)
+	return err
+}
+
+// GetWorkingHours returns the working hours of the user, anyone in the tenant can read them to plan meetings.
+func (s *Storage) GetWorkingHours(ctx context.Context, userID string) (w storage.WorkingHours, err error) {
+	err = s.readTx(ctx, func(tx *sql.Tx) error {
+		w, err = scanWorkingHours(tx.QueryRowContext(ctx, `
+			SELECT `+workingHoursColumns+`
+			FROM working_hours WHERE tenant_id = $1 AND user_id = $2`, storage.TenantID(ctx), userID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrWorkingHoursNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return storage.WorkingHours{}, err
+	}
+	return w, nil
+}
+
+const workingHoursColumns = `tenant_id, user_id, time_zone, start_offset, end_offset, days`
+
+func scanWorkingHours(row scanner) (storage.WorkingHours, error) {
+	var (
+		w          storage.WorkingHours
+		start, end int64
+		days       []byte
+	)
+	if err := row.Scan(&w.TenantID, &w.UserID, &w.TimeZone, &start, &end, &days); err != nil {
+		return storage.WorkingHours{}, err
+	}
+	w.Start, w.End = time.Duration(start), time.Duration(end)
+	if err := json.Unmarshal(days, &w.Days); err != nil {
+		return storage.WorkingHours{}, err
+	}
+	if len(w.Days) == 0 {
+		w.Days = nil
+	}
+	return w, nil
+}
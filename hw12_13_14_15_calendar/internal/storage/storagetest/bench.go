@@ -0,0 +1,85 @@
+package storagetest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// benchSizes are the numbers of events in the storage, spread over a year.
+var benchSizes = []int{1000, 10000}
+
+// Bench runs the benchmarks of the range queries, newStorage must return an empty storage.
+func Bench(b *testing.B, newStorage func(b *testing.B) Storage) {
+	b.Helper()
+
+	ranges := []struct {
+		name   string
+		period time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+	}
+	for _, size := range benchSizes {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			s := newStorage(b)
+			from := seed(b, s, size)
+			for _, r := range ranges {
+				r := r
+				b.Run(r.name, func(b *testing.B) {
+					benchListEvents(b, s, from, r.period)
+				})
+			}
+		})
+	}
+}
+
+// seed creates the events in the calendars of two users, a half of which is shared with
+// the reader, and returns the start of the year the events are spread over.
+func seed(b *testing.B, s Storage, size int) time.Time {
+	b.Helper()
+	ctx := context.Background()
+
+	owners := []string{"alice", "bob"}
+	for _, owner := range owners {
+		require.NoError(b, s.CreateCalendar(ctx, storage.Calendar{ID: owner, OwnerID: owner, Name: owner}))
+	}
+	require.NoError(b, s.ShareCalendar(ctx, "bob", storage.Grant{
+		CalendarID: "bob", UserID: "alice", Access: storage.AccessRead,
+	}))
+
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := 365 * 24 * time.Hour / time.Duration(size)
+	for i := 0; i < size; i++ {
+		owner := owners[i%len(owners)]
+		start := from.Add(time.Duration(i) * step)
+		require.NoError(b, s.CreateEvent(ctx, owner, storage.Event{
+			ID:         strconv.Itoa(i),
+			CalendarID: owner,
+			OwnerID:    owner,
+			Title:      "event " + strconv.Itoa(i),
+			StartAt:    start,
+			EndAt:      start.Add(time.Hour),
+		}))
+	}
+	return from
+}
+
+// benchListEvents lists the events of the period starting at different days of the year.
+func benchListEvents(b *testing.B, s Storage, from time.Time, period time.Duration) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := from.Add(time.Duration(i%300) * 24 * time.Hour)
+		if _, err := s.ListEvents(ctx, "alice", start, start.Add(period)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
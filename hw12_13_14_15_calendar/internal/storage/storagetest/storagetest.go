@@ -0,0 +1,1460 @@
+// Package storagetest contains tests of the contract every event storage must meet.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type Storage interface {
+	CreateCalendar(ctx context.Context, cal storage.Calendar) error
+	GetCalendar(ctx context.Context, userID, calendarID string) (storage.Calendar, error)
+	CalendarAccess(ctx context.Context, userID, calendarID string) (storage.Access, error)
+	ListCalendars(ctx context.Context, userID string) ([]storage.Calendar, error)
+	DeleteCalendar(ctx context.Context, userID, calendarID string) error
+	ShareCalendar(ctx context.Context, userID string, grant storage.Grant) error
+	RevokeShare(ctx context.Context, userID, calendarID, granteeID string) error
+	ListShares(ctx context.Context, userID, calendarID string) ([]storage.Grant, error)
+
+	CreateEvent(ctx context.Context, userID string, e storage.Event) error
+	UpdateEvent(ctx context.Context, userID string, e storage.Event) error
+	DeleteEvent(ctx context.Context, userID, eventID string) error
+	GetEvent(ctx context.Context, userID, eventID string) (storage.Event, error)
+	FindEvent(ctx context.Context, userID, calendarID, uid string) (storage.Event, error)
+	ListEvents(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error)
+	CountEvents(ctx context.Context) (int, error)
+	ApplyEventOps(ctx context.Context, userID string, ops []storage.EventOp) error
+	TrashEvent(ctx context.Context, userID, eventID string, at time.Time) error
+	ListTrash(ctx context.Context, userID string) ([]storage.Event, error)
+	RestoreEvent(ctx context.Context, userID, eventID string) error
+	PurgeTrash(ctx context.Context, before time.Time) ([]storage.Event, error)
+
+	AddAttachment(ctx context.Context, userID, eventID string, att storage.Attachment, max int) (storage.Event, error)
+	RemoveAttachment(ctx context.Context, userID, eventID, attachmentID string) (storage.Event, error)
+
+	AppendAudit(ctx context.Context, entries ...storage.AuditEntry) error
+	ListAudit(ctx context.Context, userID string, filter storage.AuditFilter) ([]storage.AuditEntry, error)
+
+	DueNotifications(ctx context.Context, now time.Time) ([]storage.Notification, error)
+	MarkDelivered(ctx context.Context, d storage.Delivery) error
+	EnqueueNotifications(ctx context.Context, now time.Time) (int, error)
+	ListOutbox(ctx context.Context) ([]storage.OutboxMessage, error)
+	ListDeliveries(ctx context.Context, userID string) ([]storage.Delivery, error)
+
+	CreateWebhook(ctx context.Context, w storage.Webhook) error
+	ListWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	EnableWebhook(ctx context.Context, userID, webhookID string) error
+	WebhooksForCalendar(ctx context.Context, calendarID string) ([]storage.Webhook, error)
+	AddWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, userID, webhookID string) ([]storage.WebhookDelivery, error)
+	RecordWebhookResult(ctx context.Context, webhookID string, success bool, maxFailures int) (storage.Webhook, error)
+	GetWebhook(ctx context.Context, webhookID string) (storage.Webhook, error)
+	SaveWebhookMessage(ctx context.Context, m storage.WebhookMessage) error
+	DeleteWebhookMessage(ctx context.Context, messageID string) error
+	ClaimWebhookMessages(ctx context.Context, now, until time.Time, limit int) ([]storage.WebhookMessage, error)
+	ListWebhookDeadLetters(ctx context.Context, userID, webhookID string) ([]storage.WebhookMessage, error)
+	RedriveWebhookDeadLetters(ctx context.Context, userID, webhookID string, messageIDs []string, now time.Time) (int, error)
+
+	PutTag(ctx context.Context, tag storage.Tag) error
+	ListTags(ctx context.Context, userID string) ([]storage.Tag, error)
+	DeleteTag(ctx context.Context, userID, name string) error
+
+	SetWorkingHours(ctx context.Context, w storage.WorkingHours) error
+	GetWorkingHours(ctx context.Context, userID string) (storage.WorkingHours, error)
+	SetPreferences(ctx context.Context, p storage.Preferences) error
+	GetPreferences(ctx context.Context, userID string) (storage.Preferences, error)
+
+	AcquireLease(ctx context.Context, lease storage.Lease, now time.Time) (storage.Lease, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+
+	Snapshot(ctx context.Context) (storage.Snapshot, error)
+	Restore(ctx context.Context, snap storage.Snapshot) error
+}
+
+// Run runs the contract tests, newStorage must return an empty storage.
+func Run(t *testing.T, newStorage func(t *testing.T) Storage) {
+	t.Helper()
+
+	t.Run("basic", func(t *testing.T) {
+		testBasic(t, newStorage(t))
+	})
+	t.Run("sharing", func(t *testing.T) {
+		testSharing(t, newStorage(t))
+	})
+	t.Run("uids", func(t *testing.T) {
+		testUIDs(t, newStorage(t))
+	})
+	t.Run("concurrency", func(t *testing.T) {
+		testConcurrency(t, newStorage(t))
+	})
+	t.Run("batch", func(t *testing.T) {
+		testBatch(t, newStorage(t))
+	})
+	t.Run("trash", func(t *testing.T) {
+		testTrash(t, newStorage(t))
+	})
+	t.Run("attachments", func(t *testing.T) {
+		testAttachments(t, newStorage(t))
+	})
+	t.Run("audit", func(t *testing.T) {
+		testAudit(t, newStorage(t))
+	})
+	t.Run("reminders", func(t *testing.T) {
+		testReminders(t, newStorage(t))
+	})
+	t.Run("outbox", func(t *testing.T) {
+		testOutbox(t, newStorage(t), newStorage(t))
+	})
+	t.Run("webhooks", func(t *testing.T) {
+		testWebhooks(t, newStorage(t))
+	})
+	t.Run("tags", func(t *testing.T) {
+		testTags(t, newStorage(t))
+	})
+	t.Run("working hours", func(t *testing.T) {
+		testWorkingHours(t, newStorage(t))
+	})
+	t.Run("preferences", func(t *testing.T) {
+		testPreferences(t, newStorage(t))
+	})
+	t.Run("leases", func(t *testing.T) {
+		testLeases(t, newStorage(t))
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		testSnapshot(t, newStorage(t), newStorage(t))
+	})
+	t.Run("tenants", func(t *testing.T) {
+		testTenants(t, newStorage(t), newStorage(t))
+	})
+}
+
+var day = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func newEvent(id, calendarID string, start time.Time) storage.Event {
+	return storage.Event{
+		ID:          id,
+		CalendarID:  calendarID,
+		OwnerID:     "owner",
+		Title:       "event " + id,
+		StartAt:     start,
+		EndAt:       start.Add(time.Hour),
+		Description: "description " + id,
+	}
+}
+
+func testBasic(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: "Work"}))
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "home", OwnerID: "owner", Name: "Home"}))
+	require.True(t, errors.Is(s.CreateCalendar(ctx, storage.Calendar{ID: "work"}), storage.ErrCalendarExists))
+
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("1", "work", day.Add(9*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("2", "home", day.Add(20*time.Hour))))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("3", "work", day.Add(33*time.Hour))))
+	require.True(t, errors.Is(s.CreateEvent(ctx, "owner", newEvent("1", "work", day)), storage.ErrEventExists))
+
+	t.Run("list", func(t *testing.T) {
+		events, err := s.ListEvents(ctx, "owner", day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, "1", events[0].ID)
+		require.Equal(t, "2", events[1].ID)
+
+		events, err = s.ListEvents(ctx, "owner", day.Add(9*time.Hour+30*time.Minute), day.AddDate(0, 0, 7))
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		e := newEvent("2", "work", day.Add(10*time.Hour))
+		e.Title = "moved"
+		require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+
+		got, err := s.GetEvent(ctx, "owner", "2")
+		require.NoError(t, err)
+		require.Equal(t, e, got)
+
+		require.True(t, errors.Is(s.UpdateEvent(ctx, "owner", newEvent("4", "work", day)), storage.ErrEventNotFound))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, s.DeleteEvent(ctx, "owner", "3"))
+		_, err := s.GetEvent(ctx, "owner", "3")
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+		require.True(t, errors.Is(s.DeleteEvent(ctx, "owner", "3"), storage.ErrEventNotFound))
+	})
+}
+
+func testUIDs(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "home", OwnerID: "owner"}))
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "other", OwnerID: "stranger"}))
+
+	e := newEvent("1", "work", day)
+	e.UID = "standup@example.com"
+	require.NoError(t, s.CreateEvent(ctx, "owner", e))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("2", "work", day)))
+
+	got, err := s.FindEvent(ctx, "owner", "work", e.UID)
+	require.NoError(t, err)
+	require.Equal(t, e, got)
+	// Events without a UID are found by their ID.
+	got, err = s.FindEvent(ctx, "owner", "work", "2")
+	require.NoError(t, err)
+	require.Equal(t, "2", got.ID)
+
+	// UIDs are unique within a calendar only.
+	dup := newEvent("3", "work", day)
+	dup.UID = e.UID
+	require.True(t, errors.Is(s.CreateEvent(ctx, "owner", dup), storage.ErrEventExists))
+	dup.CalendarID = "home"
+	require.NoError(t, s.CreateEvent(ctx, "owner", dup))
+	dup.CalendarID = "work"
+	require.True(t, errors.Is(s.UpdateEvent(ctx, "owner", dup), storage.ErrEventExists))
+	dup.ID, dup.CalendarID = "4", "other"
+	require.NoError(t, s.CreateEvent(ctx, "stranger", dup))
+
+	_, err = s.FindEvent(ctx, "owner", "home", "missing")
+	require.True(t, errors.Is(err, storage.ErrEventNotFound))
+	_, err = s.FindEvent(ctx, "owner", "other", e.UID)
+	require.True(t, errors.Is(err, storage.ErrEventNotFound))
+
+	// Events in the trash keep their UID.
+	require.NoError(t, s.TrashEvent(ctx, "owner", "1", day))
+	got, err = s.FindEvent(ctx, "owner", "work", e.UID)
+	require.NoError(t, err)
+	require.True(t, got.Deleted())
+	dup.ID, dup.CalendarID = "5", "work"
+	require.True(t, errors.Is(s.CreateEvent(ctx, "owner", dup), storage.ErrEventExists))
+}
+
+func testBatch(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: "Work"}))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("1", "work", day)))
+
+	listIDs := func() []string {
+		events, err := s.ListEvents(ctx, "owner", day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		ids := make([]string, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	updated := newEvent("1", "work", day)
+	updated.Title = "updated"
+	err := s.ApplyEventOps(ctx, "owner", []storage.EventOp{
+		{Change: storage.ChangeCreated, Event: newEvent("2", "work", day.Add(time.Hour))},
+		{Change: storage.ChangeUpdated, Event: updated},
+		{Change: storage.ChangeDeleted, Event: storage.Event{ID: "missing", DeletedAt: day}},
+	})
+	var batchErr *storage.BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Equal(t, 2, batchErr.Index)
+	require.True(t, errors.Is(err, storage.ErrEventNotFound))
+
+	// Nothing is applied.
+	require.Equal(t, []string{"1"}, listIDs())
+	got, err := s.GetEvent(ctx, "owner", "1")
+	require.NoError(t, err)
+	require.Equal(t, "event 1", got.Title)
+
+	require.True(t, errors.Is(s.ApplyEventOps(ctx, "stranger", []storage.EventOp{
+		{Change: storage.ChangeCreated, Event: newEvent("3", "work", day)},
+	}), storage.ErrCalendarNotFound))
+	require.True(t, errors.Is(s.ApplyEventOps(ctx, "owner", []storage.EventOp{
+		{Change: "moved", Event: updated},
+	}), storage.ErrInvalidOperation))
+
+	require.NoError(t, s.ApplyEventOps(ctx, "owner", []storage.EventOp{
+		{Change: storage.ChangeCreated, Event: newEvent("2", "work", day.Add(time.Hour))},
+		{Change: storage.ChangeUpdated, Event: updated},
+		{Change: storage.ChangeDeleted, Event: storage.Event{ID: "1", DeletedAt: day}},
+	}))
+	require.Equal(t, []string{"2"}, listIDs())
+}
+
+func testTrash(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: "Work"}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead}))
+	e := newEvent("1", "work", day.Add(10*time.Hour))
+	e.Reminders = []storage.Reminder{{ID: "r", Before: time.Hour, Channel: storage.ChannelLog}}
+	require.NoError(t, s.CreateEvent(ctx, "owner", e))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("2", "work", day.Add(11*time.Hour))))
+
+	deletedAt := day.Add(time.Hour)
+	require.True(t, errors.Is(s.TrashEvent(ctx, "reader", "1", deletedAt), storage.ErrAccessDenied))
+	require.NoError(t, s.TrashEvent(ctx, "owner", "1", deletedAt))
+	require.True(t, errors.Is(s.TrashEvent(ctx, "owner", "1", deletedAt), storage.ErrEventNotFound))
+
+	// The deleted event is hidden from everything but the trash.
+	events, err := s.ListEvents(ctx, "owner", day, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	_, err = s.GetEvent(ctx, "owner", "1")
+	require.True(t, errors.Is(err, storage.ErrEventNotFound))
+	require.True(t, errors.Is(s.UpdateEvent(ctx, "owner", e), storage.ErrEventNotFound))
+	require.Empty(t, dueReminders(t, s, day.Add(10*time.Hour)))
+
+	trash, err := s.ListTrash(ctx, "owner")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, "1", trash[0].ID)
+	require.True(t, trash[0].DeletedAt.Equal(deletedAt))
+	require.Equal(t, "owner", trash[0].DeletedBy)
+
+	trash, err = s.ListTrash(ctx, "reader")
+	require.NoError(t, err)
+	require.Empty(t, trash)
+	require.True(t, errors.Is(s.RestoreEvent(ctx, "reader", "1"), storage.ErrAccessDenied))
+	require.True(t, errors.Is(s.RestoreEvent(ctx, "owner", "2"), storage.ErrEventNotFound))
+
+	require.NoError(t, s.RestoreEvent(ctx, "owner", "1"))
+	got, err := s.GetEvent(ctx, "owner", "1")
+	require.NoError(t, err)
+	require.Equal(t, e, got)
+	require.Equal(t, []string{"1/r"}, dueReminders(t, s, day.Add(10*time.Hour)))
+
+	require.NoError(t, s.TrashEvent(ctx, "owner", "1", deletedAt))
+	require.NoError(t, s.TrashEvent(ctx, "owner", "2", deletedAt.Add(time.Hour)))
+	purged, err := s.PurgeTrash(ctx, deletedAt.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, purged, 1)
+	require.Equal(t, "1", purged[0].ID)
+
+	trash, err = s.ListTrash(ctx, "owner")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	require.Equal(t, "2", trash[0].ID)
+	require.True(t, errors.Is(s.RestoreEvent(ctx, "owner", "1"), storage.ErrEventNotFound))
+}
+
+func testAttachments(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead}))
+	e := newEvent("1", "work", day)
+	require.NoError(t, s.CreateEvent(ctx, "owner", e))
+
+	// Uploads check the access before the file is stored.
+	access, err := s.CalendarAccess(ctx, "owner", "work")
+	require.NoError(t, err)
+	require.Equal(t, storage.AccessOwner, access)
+	access, err = s.CalendarAccess(ctx, "reader", "work")
+	require.NoError(t, err)
+	require.Equal(t, storage.AccessRead, access)
+	_, err = s.CalendarAccess(ctx, "stranger", "work")
+	require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+
+	att := storage.Attachment{ID: "a", Name: "agenda.txt", Key: "1/a", Size: 6, CreatedAt: day, CreatedBy: "owner"}
+	_, err = s.AddAttachment(ctx, "reader", "1", att, 2)
+	require.True(t, errors.Is(err, storage.ErrAccessDenied))
+	before, err := s.AddAttachment(ctx, "owner", "1", att, 2)
+	require.NoError(t, err)
+	require.Empty(t, before.Attachments)
+
+	// Concurrent additions are all kept.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			link := storage.Attachment{ID: "link" + strconv.Itoa(i), Name: "doc", URL: "https://example.com"}
+			_, err := s.AddAttachment(ctx, "owner", "1", link, 3)
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	_, err = s.AddAttachment(ctx, "owner", "1", storage.Attachment{ID: "b"}, 3)
+	require.True(t, errors.Is(err, storage.ErrTooManyAttachments))
+
+	// Updates of the event keep its attachments.
+	e.Title = "updated"
+	require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+	got, err := s.GetEvent(ctx, "owner", "1")
+	require.NoError(t, err)
+	require.Equal(t, "updated", got.Title)
+	require.Len(t, got.Attachments, 3)
+	require.Equal(t, att, got.Attachments[0])
+
+	before, err = s.RemoveAttachment(ctx, "owner", "1", "a")
+	require.NoError(t, err)
+	require.Len(t, before.Attachments, 3)
+	_, err = s.RemoveAttachment(ctx, "owner", "1", "a")
+	require.True(t, errors.Is(err, storage.ErrAttachmentNotFound))
+	got, err = s.GetEvent(ctx, "owner", "1")
+	require.NoError(t, err)
+	require.Len(t, got.Attachments, 2)
+}
+
+func testTags(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "alice", Name: "Work", Color: "#ff0000"}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "alice", Name: "home", Color: "#00ff00"}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "bob", Name: "work", Color: "#0000ff"}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "alice", Name: "work", Color: "#ffff00"}))
+
+	tags, err := s.ListTags(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Tag{
+		{UserID: "alice", Name: "home", Color: "#00ff00"},
+		{UserID: "alice", Name: "work", Color: "#ffff00"},
+	}, tags)
+
+	require.NoError(t, s.DeleteTag(ctx, "alice", "WORK"))
+	require.True(t, errors.Is(s.DeleteTag(ctx, "alice", "work"), storage.ErrTagNotFound))
+	tags, err = s.ListTags(ctx, "bob")
+	require.NoError(t, err)
+	require.Len(t, tags, 1)
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "alice"}))
+	e := newEvent("1", "work", day)
+	e.OwnerID = "alice"
+	e.Tags = []string{"work", "urgent"}
+	require.NoError(t, s.CreateEvent(ctx, "alice", e))
+	got, err := s.GetEvent(ctx, "alice", "1")
+	require.NoError(t, err)
+	require.Equal(t, e, got)
+}
+
+func testWorkingHours(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetWorkingHours(ctx, "alice")
+	require.True(t, errors.Is(err, storage.ErrWorkingHoursNotFound))
+
+	w := storage.WorkingHours{
+		UserID:   "alice",
+		TimeZone: "Europe/Moscow",
+		Start:    10 * time.Hour,
+		End:      19 * time.Hour,
+		Days:     []time.Weekday{time.Monday, time.Tuesday},
+	}
+	require.NoError(t, s.SetWorkingHours(ctx, w))
+	got, err := s.GetWorkingHours(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, w, got)
+
+	w.Days = []time.Weekday{time.Friday}
+	require.NoError(t, s.SetWorkingHours(ctx, w))
+	got, err = s.GetWorkingHours(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, w, got)
+
+	require.True(t, errors.Is(s.SetWorkingHours(ctx, storage.WorkingHours{}), storage.ErrInvalidOperation))
+}
+
+func testPreferences(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetPreferences(ctx, "alice")
+	require.True(t, errors.Is(err, storage.ErrPreferencesNotFound))
+
+	p := storage.Preferences{
+		UserID:          "alice",
+		TimeZone:        "Europe/Moscow",
+		Locale:          "ru",
+		WeekStart:       time.Sunday,
+		DefaultReminder: storage.Reminder{Before: 10 * time.Minute, Channel: storage.ChannelEmail},
+	}
+	require.NoError(t, s.SetPreferences(ctx, p))
+	got, err := s.GetPreferences(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, p, got)
+
+	_, err = s.GetPreferences(ctx, "bob")
+	require.True(t, errors.Is(err, storage.ErrPreferencesNotFound))
+	require.True(t, errors.Is(s.SetPreferences(ctx, storage.Preferences{}), storage.ErrInvalidOperation))
+}
+
+func testLeases(t *testing.T, s Storage) {
+	ctx := context.Background()
+	lease := func(holder string, until time.Time) storage.Lease {
+		return storage.Lease{Name: "scheduler", Holder: holder, ExpiresAt: until}
+	}
+
+	got, err := s.AcquireLease(ctx, lease("a", day.Add(time.Minute)), day)
+	require.NoError(t, err)
+	require.Equal(t, "a", got.Holder)
+
+	got, err = s.AcquireLease(ctx, lease("b", day.Add(2*time.Minute)), day.Add(30*time.Second))
+	require.True(t, errors.Is(err, storage.ErrLeaseHeld))
+	require.Equal(t, lease("a", day.Add(time.Minute)), got)
+
+	// Renewal by the holder.
+	_, err = s.AcquireLease(ctx, lease("a", day.Add(2*time.Minute)), day.Add(time.Minute/2))
+	require.NoError(t, err)
+	_, err = s.AcquireLease(ctx, lease("b", day.Add(3*time.Minute)), day.Add(90*time.Second))
+	require.True(t, errors.Is(err, storage.ErrLeaseHeld))
+
+	// The expired lease is taken over.
+	got, err = s.AcquireLease(ctx, lease("b", day.Add(4*time.Minute)), day.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "b", got.Holder)
+
+	// Only the holder releases the lease.
+	require.NoError(t, s.ReleaseLease(ctx, "scheduler", "a"))
+	_, err = s.AcquireLease(ctx, lease("a", day.Add(5*time.Minute)), day.Add(3*time.Minute))
+	require.True(t, errors.Is(err, storage.ErrLeaseHeld))
+	require.NoError(t, s.ReleaseLease(ctx, "scheduler", "b"))
+	_, err = s.AcquireLease(ctx, lease("a", day.Add(5*time.Minute)), day.Add(3*time.Minute))
+	require.NoError(t, err)
+
+	_, err = s.AcquireLease(ctx, lease("a", day), day)
+	require.True(t, errors.Is(err, storage.ErrInvalidOperation))
+}
+
+func testAudit(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: "Work"}))
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "private", OwnerID: "owner", Name: "Private"}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "writer", Access: storage.AccessReadWrite}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "private", UserID: "viewer", Access: storage.AccessFreeBusy}))
+
+	diff := []storage.FieldChange{{Field: "title", Before: "", After: "standup"}}
+	require.NoError(t, s.AppendAudit(ctx,
+		storage.AuditEntry{ID: "a1", EventID: "1", CalendarID: "work", ActorID: "owner", Change: storage.ChangeCreated, At: day, Diff: diff},
+		storage.AuditEntry{ID: "a2", EventID: "1", CalendarID: "work", ActorID: "writer", Change: storage.ChangeUpdated, At: day.Add(time.Hour)},
+	))
+	require.NoError(t, s.AppendAudit(ctx,
+		storage.AuditEntry{ID: "a3", EventID: "2", CalendarID: "private", ActorID: "owner", Change: storage.ChangeCreated, At: day},
+	))
+	diff[0].After = "changed"
+
+	auditIDs := func(user string, filter storage.AuditFilter) []string {
+		entries, err := s.ListAudit(ctx, user, filter)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	require.Equal(t, []string{"a2", "a1"}, auditIDs("owner", storage.AuditFilter{EventID: "1"}))
+	require.Equal(t, []string{"a3", "a1"}, auditIDs("owner", storage.AuditFilter{ActorID: "owner"}))
+	require.Equal(t, []string{"a1"}, auditIDs("writer", storage.AuditFilter{EventID: "1", ActorID: "owner"}))
+	require.Equal(t, []string{"a1"}, auditIDs("writer", storage.AuditFilter{ActorID: "owner"}))
+	require.Empty(t, auditIDs("viewer", storage.AuditFilter{EventID: "2"}))
+	require.Empty(t, auditIDs("stranger", storage.AuditFilter{EventID: "1"}))
+
+	entries, err := s.ListAudit(ctx, "owner", storage.AuditFilter{EventID: "1", ActorID: "owner"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "standup", entries[0].Diff[0].After)
+}
+
+func testSharing(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: "Work"}))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("1", "work", day)))
+
+	t.Run("not shared", func(t *testing.T) {
+		_, err := s.GetCalendar(ctx, "reader", "work")
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+
+		_, err = s.GetEvent(ctx, "reader", "1")
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+
+		events, err := s.ListEvents(ctx, "reader", day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Empty(t, events)
+
+		err = s.CreateEvent(ctx, "reader", newEvent("2", "work", day))
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+	})
+
+	t.Run("only owner shares", func(t *testing.T) {
+		err := s.ShareCalendar(ctx, "reader", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead})
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+
+		err = s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessOwner})
+		require.True(t, errors.Is(err, storage.ErrInvalidAccess))
+	})
+
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "busy", Access: storage.AccessFreeBusy}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "writer", Access: storage.AccessReadWrite}))
+
+	t.Run("free-busy", func(t *testing.T) {
+		e, err := s.GetEvent(ctx, "busy", "1")
+		require.NoError(t, err)
+		require.Empty(t, e.Title)
+		require.Empty(t, e.Description)
+		require.Equal(t, day, e.StartAt)
+
+		events, err := s.ListEvents(ctx, "busy", day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Empty(t, events[0].Title)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		e, err := s.GetEvent(ctx, "reader", "1")
+		require.NoError(t, err)
+		require.Equal(t, "event 1", e.Title)
+
+		err = s.UpdateEvent(ctx, "reader", newEvent("1", "work", day))
+		require.True(t, errors.Is(err, storage.ErrAccessDenied))
+		require.True(t, errors.Is(s.DeleteEvent(ctx, "reader", "1"), storage.ErrAccessDenied))
+		require.True(t, errors.Is(s.CreateEvent(ctx, "reader", newEvent("2", "work", day)), storage.ErrAccessDenied))
+
+		_, err = s.ListShares(ctx, "reader", "work")
+		require.True(t, errors.Is(err, storage.ErrAccessDenied))
+
+		calendars, err := s.ListCalendars(ctx, "reader")
+		require.NoError(t, err)
+		require.Len(t, calendars, 1)
+	})
+
+	t.Run("read-write", func(t *testing.T) {
+		require.NoError(t, s.CreateEvent(ctx, "writer", newEvent("2", "work", day)))
+		require.NoError(t, s.UpdateEvent(ctx, "writer", newEvent("2", "work", day.Add(time.Hour))))
+		require.NoError(t, s.DeleteEvent(ctx, "writer", "2"))
+
+		require.True(t, errors.Is(s.DeleteCalendar(ctx, "writer", "work"), storage.ErrAccessDenied))
+	})
+
+	t.Run("move to foreign calendar", func(t *testing.T) {
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "private", OwnerID: "writer"}))
+		require.NoError(t, s.CreateEvent(ctx, "writer", newEvent("3", "private", day)))
+
+		err := s.UpdateEvent(ctx, "reader", newEvent("1", "private", day))
+		require.True(t, errors.Is(err, storage.ErrAccessDenied))
+
+		err = s.UpdateEvent(ctx, "owner", newEvent("1", "private", day))
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		grants, err := s.ListShares(ctx, "owner", "work")
+		require.NoError(t, err)
+		require.Len(t, grants, 3)
+
+		require.NoError(t, s.RevokeShare(ctx, "owner", "work", "reader"))
+		_, err = s.GetEvent(ctx, "reader", "1")
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+	})
+
+	t.Run("delete calendar", func(t *testing.T) {
+		require.True(t, errors.Is(s.DeleteCalendar(ctx, "owner", "work"), storage.ErrCalendarNotEmpty))
+		e, err := s.GetEvent(ctx, "owner", "1")
+		require.NoError(t, err)
+		require.Equal(t, "work", e.CalendarID)
+
+		require.NoError(t, s.TrashEvent(ctx, "owner", "1", day))
+		require.NoError(t, s.DeleteCalendar(ctx, "owner", "work"))
+		_, err = s.GetEvent(ctx, "owner", "1")
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+		_, err = s.GetCalendar(ctx, "writer", "work")
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+		trash, err := s.ListTrash(ctx, "owner")
+		require.NoError(t, err)
+		require.Empty(t, trash)
+	})
+}
+
+func testConcurrency(t *testing.T, s Storage) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := strconv.Itoa(i*100 + j)
+				require.NoError(t, s.CreateEvent(ctx, "owner", newEvent(id, "work", day.Add(time.Duration(j)*time.Hour))))
+				_, err := s.ListEvents(ctx, "owner", day, day.AddDate(0, 0, 1))
+				require.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := s.ListEvents(ctx, "owner", day, day.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Len(t, events, 1000)
+}
+
+func testSnapshot(t *testing.T, s, restored Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: "Work"}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead}))
+	e := newEvent("1", "work", day)
+	e.Reminders = []storage.Reminder{{ID: "r1", Before: 15 * time.Minute, Channel: storage.ChannelLog}}
+	require.NoError(t, s.CreateEvent(ctx, "owner", e))
+	require.NoError(t, s.MarkDelivered(ctx, storage.Delivery{
+		EventID:    "1",
+		ReminderID: "r1",
+		Channel:    storage.ChannelLog,
+		NotifyAt:   day.Add(-15 * time.Minute),
+		SentAt:     day.Add(-14 * time.Minute),
+	}))
+	require.NoError(t, s.CreateWebhook(ctx, storage.Webhook{ID: "w1", UserID: "reader", URL: "http://example.com"}))
+	require.NoError(t, s.AddWebhookDelivery(ctx, storage.WebhookDelivery{ID: "d1", WebhookID: "w1", Success: true}))
+	require.NoError(t, s.SaveWebhookMessage(ctx, storage.WebhookMessage{ID: "d2", WebhookID: "w1", Body: []byte(`{}`), Dead: true}))
+	require.NoError(t, s.AppendAudit(ctx, storage.AuditEntry{ID: "a1", EventID: "1", CalendarID: "work", ActorID: "owner"}))
+	require.NoError(t, s.SetWorkingHours(ctx, storage.WorkingHours{UserID: "owner", Start: 9 * time.Hour, End: 18 * time.Hour}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "owner", Name: "work", Color: "#ff0000"}))
+	require.NoError(t, s.SetPreferences(ctx, storage.Preferences{UserID: "owner", TimeZone: "UTC", WeekStart: time.Monday}))
+
+	snap, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Len(t, snap.Calendars, 1)
+	require.Len(t, snap.Grants, 1)
+	require.Len(t, snap.Events, 1)
+	require.Len(t, snap.Deliveries, 1)
+	require.Len(t, snap.Webhooks, 1)
+	require.Len(t, snap.WebhookDeliveries, 1)
+	require.Len(t, snap.WebhookMessages, 1)
+	require.Len(t, snap.Audit, 1)
+	require.Len(t, snap.WorkingHours, 1)
+	require.Len(t, snap.Tags, 1)
+	require.Len(t, snap.Preferences, 1)
+
+	require.NoError(t, restored.CreateCalendar(ctx, storage.Calendar{ID: "old", OwnerID: "owner"}))
+	require.NoError(t, restored.Restore(ctx, snap))
+
+	got, err := restored.GetEvent(ctx, "reader", "1")
+	require.NoError(t, err)
+	require.Equal(t, e, got)
+
+	due, err := restored.DueNotifications(ctx, day)
+	require.NoError(t, err)
+	require.Empty(t, due)
+
+	_, err = restored.GetCalendar(ctx, "owner", "old")
+	require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+
+	restoredSnap, err := restored.Snapshot(ctx)
+	require.NoError(t, err)
+	require.Equal(t, snap, restoredSnap)
+}
+
+func dueReminders(t *testing.T, s Storage, now time.Time) []string {
+	t.Helper()
+
+	due, err := s.DueNotifications(context.Background(), now)
+	require.NoError(t, err)
+	ids := make([]string, 0, len(due))
+	for _, n := range due {
+		ids = append(ids, n.EventID+"/"+n.ReminderID)
+	}
+	return ids
+}
+
+func deliver(t *testing.T, s Storage, now time.Time, reminderIDs ...string) {
+	t.Helper()
+
+	due, err := s.DueNotifications(context.Background(), now)
+	require.NoError(t, err)
+	for _, n := range due {
+		for _, id := range reminderIDs {
+			if n.ReminderID != id {
+				continue
+			}
+			require.NoError(t, s.MarkDelivered(context.Background(), storage.Delivery{
+				EventID:    n.EventID,
+				ReminderID: n.ReminderID,
+				Channel:    n.Channel,
+				NotifyAt:   n.NotifyAt,
+				SentAt:     now,
+			}))
+		}
+	}
+}
+
+func testReminders(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	e := newEvent("1", "work", day.Add(10*time.Hour))
+	e.Reminders = []storage.Reminder{
+		{ID: "r1", Before: time.Hour, Channel: storage.ChannelEmail},
+		{ID: "r2", Before: 15 * time.Minute, Channel: storage.ChannelLog},
+	}
+	require.NoError(t, s.CreateEvent(ctx, "owner", e))
+	require.NoError(t, s.CreateEvent(ctx, "owner", newEvent("2", "work", day.Add(10*time.Hour))))
+
+	require.Empty(t, dueReminders(t, s, day.Add(8*time.Hour)))
+	require.Equal(t, []string{"1/r1"}, dueReminders(t, s, day.Add(9*time.Hour)))
+
+	due, err := s.DueNotifications(ctx, day.Add(9*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, storage.Notification{
+		EventID:    "1",
+		ReminderID: "r1",
+		Channel:    storage.ChannelEmail,
+		NotifyAt:   day.Add(9 * time.Hour),
+		Title:      "event 1",
+		StartAt:    day.Add(10 * time.Hour),
+		UserID:     "owner",
+	}, due[0])
+
+	deliver(t, s, day.Add(9*time.Hour), "r1")
+	require.Empty(t, dueReminders(t, s, day.Add(9*time.Hour)))
+	require.Equal(t, []string{"1/r2"}, dueReminders(t, s, day.Add(9*time.Hour+50*time.Minute)))
+
+	t.Run("changed reminder is due again, others are not", func(t *testing.T) {
+		e.Reminders[1].Before = 30 * time.Minute
+		require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+		require.Equal(t, []string{"1/r2"}, dueReminders(t, s, day.Add(9*time.Hour+50*time.Minute)))
+
+		deliver(t, s, day.Add(9*time.Hour+50*time.Minute), "r2")
+		e.Title = "renamed"
+		e.Reminders[0].Channel = storage.ChannelEmail
+		require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+		require.Empty(t, dueReminders(t, s, day.Add(9*time.Hour+50*time.Minute)))
+	})
+
+	t.Run("moved event", func(t *testing.T) {
+		e.StartAt = day.Add(12 * time.Hour)
+		e.EndAt = day.Add(13 * time.Hour)
+		require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+		require.Equal(t, []string{"1/r1"}, dueReminders(t, s, day.Add(11*time.Hour+5*time.Minute)))
+		require.Equal(t, []string{"1/r1", "1/r2"}, dueReminders(t, s, day.Add(11*time.Hour+35*time.Minute)))
+		require.Empty(t, dueReminders(t, s, day.Add(13*time.Hour)))
+	})
+
+	t.Run("failed delivery is due again until it is dead", func(t *testing.T) {
+		now := day.Add(11*time.Hour + 35*time.Minute)
+		failed := storage.Delivery{
+			EventID:    "1",
+			ReminderID: "r1",
+			Channel:    storage.ChannelEmail,
+			NotifyAt:   day.Add(11 * time.Hour),
+			SentAt:     now,
+			Status:     storage.DeliveryFailed,
+			Attempts:   1,
+			Error:      "connection refused",
+		}
+		require.NoError(t, s.MarkDelivered(ctx, failed))
+		require.Equal(t, []string{"1/r1", "1/r2"}, dueReminders(t, s, now))
+		due, err := s.DueNotifications(ctx, now)
+		require.NoError(t, err)
+		require.Equal(t, 1, due[0].Attempts)
+
+		dead := failed
+		dead.Status = storage.DeliveryDead
+		dead.Attempts = 5
+		require.NoError(t, s.MarkDelivered(ctx, dead))
+		require.Equal(t, []string{"1/r2"}, dueReminders(t, s, now))
+
+		deliveries, err := s.ListDeliveries(ctx, "owner")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		require.Equal(t, dead, deliveries[0])
+		deliveries, err = s.ListDeliveries(ctx, "reader")
+		require.NoError(t, err)
+		require.Empty(t, deliveries)
+	})
+
+	t.Run("removed reminder", func(t *testing.T) {
+		e.Reminders = e.Reminders[1:]
+		require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+		err := s.MarkDelivered(ctx, storage.Delivery{EventID: "1", ReminderID: "r1"})
+		require.True(t, errors.Is(err, storage.ErrReminderNotFound))
+	})
+
+	t.Run("deleted event", func(t *testing.T) {
+		require.NoError(t, s.DeleteEvent(ctx, "owner", "1"))
+		require.Empty(t, dueReminders(t, s, day.Add(11*time.Hour+35*time.Minute)))
+		err := s.MarkDelivered(ctx, storage.Delivery{EventID: "1", ReminderID: "r2"})
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+	})
+
+	t.Run("event without duration", func(t *testing.T) {
+		deadline := newEvent("3", "work", day.Add(14*time.Hour))
+		deadline.EndAt = deadline.StartAt
+		deadline.Reminders = []storage.Reminder{{ID: "r", Channel: storage.ChannelLog}}
+		require.NoError(t, s.CreateEvent(ctx, "owner", deadline))
+		require.Equal(t, []string{"3/r"}, dueReminders(t, s, day.Add(14*time.Hour+time.Minute)))
+		require.Empty(t, dueReminders(t, s, day.Add(14*time.Hour+storage.InstantEventWindow)))
+	})
+
+	t.Run("past event without duration", func(t *testing.T) {
+		imported := newEvent("4", "work", day.Add(-24*time.Hour))
+		imported.EndAt = imported.StartAt
+		imported.Reminders = []storage.Reminder{{ID: "r", Channel: storage.ChannelLog}}
+		require.NoError(t, s.CreateEvent(ctx, "owner", imported))
+		require.NotContains(t, dueReminders(t, s, day), "4/r")
+	})
+}
+
+func outboxIDs(t *testing.T, s Storage) []string {
+	t.Helper()
+
+	messages, err := s.ListOutbox(context.Background())
+	require.NoError(t, err)
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.Notification.EventID+"/"+m.Notification.ReminderID)
+	}
+	return ids
+}
+
+func testOutbox(t *testing.T, s, restored Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	e := newEvent("1", "work", day.Add(10*time.Hour))
+	e.Reminders = []storage.Reminder{
+		{ID: "r1", Before: time.Hour, Channel: storage.ChannelEmail},
+		{ID: "r2", Before: time.Hour, Channel: storage.ChannelLog},
+	}
+	require.NoError(t, s.CreateEvent(ctx, "owner", e))
+	now := day.Add(9 * time.Hour)
+
+	queued, err := s.EnqueueNotifications(ctx, day)
+	require.NoError(t, err)
+	require.Zero(t, queued)
+	queued, err = s.EnqueueNotifications(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, 2, queued)
+
+	// Queued notifications are not due and are not queued again.
+	require.Empty(t, dueReminders(t, s, now))
+	queued, err = s.EnqueueNotifications(ctx, now)
+	require.NoError(t, err)
+	require.Zero(t, queued)
+	messages, err := s.ListOutbox(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, "1/r1", messages[0].Notification.EventID+"/"+messages[0].Notification.ReminderID)
+	require.Equal(t, now, messages[0].CreatedAt)
+	deliveries, err := s.ListDeliveries(ctx, "owner")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, storage.DeliveryQueued, deliveries[0].Status)
+
+	snap, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	require.NoError(t, restored.Restore(ctx, snap))
+	got, err := restored.ListOutbox(ctx)
+	require.NoError(t, err)
+	require.Equal(t, messages, got)
+
+	// The recorded outcome removes the message, a failed notification is queued again.
+	failed := storage.Delivery{
+		EventID:    "1",
+		ReminderID: "r1",
+		Channel:    storage.ChannelEmail,
+		NotifyAt:   now,
+		SentAt:     now,
+		Status:     storage.DeliveryFailed,
+		Attempts:   1,
+		Error:      "connection refused",
+	}
+	require.NoError(t, s.MarkDelivered(ctx, failed))
+	require.Equal(t, []string{"1/r2"}, outboxIDs(t, s))
+	queued, err = s.EnqueueNotifications(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, queued)
+	messages, err = s.ListOutbox(ctx)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, 1, messages[1].Notification.Attempts)
+	require.NotEqual(t, messages[0].ID, messages[1].ID)
+
+	// Messages of changed reminders and deleted events are dropped.
+	e.Reminders[1].Before = 2 * time.Hour
+	require.NoError(t, s.UpdateEvent(ctx, "owner", e))
+	require.Equal(t, []string{"1/r1"}, outboxIDs(t, s))
+	require.NoError(t, s.TrashEvent(ctx, "owner", "1", now))
+	require.Empty(t, outboxIDs(t, s))
+	queued, err = s.EnqueueNotifications(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, queued)
+}
+
+func testWebhooks(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead}))
+	require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "busy", Access: storage.AccessFreeBusy}))
+
+	for _, w := range []storage.Webhook{
+		{ID: "w1", UserID: "owner", URL: "http://example.com/1", CreatedAt: day},
+		{ID: "w2", UserID: "reader", URL: "http://example.com/2", CreatedAt: day},
+		{ID: "w3", UserID: "busy", URL: "http://example.com/3", CreatedAt: day},
+		{ID: "w4", UserID: "stranger", URL: "http://example.com/4", CreatedAt: day},
+		{ID: "w5", UserID: "owner", URL: "http://example.com/5", CreatedAt: day.Add(time.Hour)},
+	} {
+		require.NoError(t, s.CreateWebhook(ctx, w))
+	}
+	require.True(t, errors.Is(s.CreateWebhook(ctx, storage.Webhook{ID: "w1"}), storage.ErrWebhookExists))
+
+	webhookIDs := func(webhooks []storage.Webhook, err error) []string {
+		require.NoError(t, err)
+		ids := make([]string, 0, len(webhooks))
+		for _, w := range webhooks {
+			ids = append(ids, w.ID)
+		}
+		return ids
+	}
+
+	require.Equal(t, []string{"w1", "w5"}, webhookIDs(s.ListWebhooks(ctx, "owner")))
+	require.Equal(t, []string{"w1", "w2", "w5"}, webhookIDs(s.WebhooksForCalendar(ctx, "work")))
+
+	t.Run("deliveries", func(t *testing.T) {
+		require.NoError(t, s.AddWebhookDelivery(ctx, storage.WebhookDelivery{ID: "d1", WebhookID: "w2", Attempt: 1}))
+		require.NoError(t, s.AddWebhookDelivery(ctx, storage.WebhookDelivery{ID: "d1", WebhookID: "w2", Attempt: 2, Success: true}))
+		err := s.AddWebhookDelivery(ctx, storage.WebhookDelivery{ID: "d2", WebhookID: "unknown"})
+		require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+
+		deliveries, err := s.ListWebhookDeliveries(ctx, "reader", "w2")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		require.Equal(t, 2, deliveries[0].Attempt)
+
+		_, err = s.ListWebhookDeliveries(ctx, "owner", "w2")
+		require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+	})
+
+	t.Run("disable after failures", func(t *testing.T) {
+		w, err := s.RecordWebhookResult(ctx, "w2", false, 2)
+		require.NoError(t, err)
+		require.Equal(t, 1, w.Failures)
+		require.False(t, w.Disabled)
+
+		w, err = s.RecordWebhookResult(ctx, "w2", false, 2)
+		require.NoError(t, err)
+		require.True(t, w.Disabled)
+		require.Equal(t, []string{"w1", "w5"}, webhookIDs(s.WebhooksForCalendar(ctx, "work")))
+
+		require.True(t, errors.Is(s.EnableWebhook(ctx, "owner", "w2"), storage.ErrWebhookNotFound))
+		require.NoError(t, s.EnableWebhook(ctx, "reader", "w2"))
+		require.Equal(t, []string{"w1", "w2", "w5"}, webhookIDs(s.WebhooksForCalendar(ctx, "work")))
+
+		w, err = s.RecordWebhookResult(ctx, "w2", false, 2)
+		require.NoError(t, err)
+		require.Equal(t, 1, w.Failures)
+		w, err = s.RecordWebhookResult(ctx, "w2", true, 2)
+		require.NoError(t, err)
+		require.Zero(t, w.Failures)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		w, err := s.GetWebhook(ctx, "w2")
+		require.NoError(t, err)
+		require.Equal(t, "reader", w.UserID)
+		_, err = s.GetWebhook(ctx, "unknown")
+		require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+	})
+
+	t.Run("messages", func(t *testing.T) {
+		testWebhookMessages(t, s)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.True(t, errors.Is(s.DeleteWebhook(ctx, "reader", "w1"), storage.ErrWebhookNotFound))
+		require.NoError(t, s.DeleteWebhook(ctx, "reader", "w2"))
+		require.Empty(t, webhookIDs(s.ListWebhooks(ctx, "reader")))
+		_, err := s.ListWebhookDeliveries(ctx, "reader", "w2")
+		require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+		// The messages of the webhook are deleted with it.
+		claimed, err := s.ClaimWebhookMessages(ctx, day.Add(24*time.Hour), day.Add(25*time.Hour), -1)
+		require.NoError(t, err)
+		for _, m := range claimed {
+			require.NotEqual(t, "w2", m.WebhookID)
+		}
+	})
+}
+
+// testWebhookMessages runs on the webhooks of testWebhooks: w1 and w5 of owner and w2 of reader.
+func testWebhookMessages(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	messageIDs := func(messages []storage.WebhookMessage, err error) []string {
+		require.NoError(t, err)
+		ids := make([]string, 0, len(messages))
+		for _, m := range messages {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	for _, m := range []storage.WebhookMessage{
+		{ID: "m1", WebhookID: "w1", Body: []byte(`{}`), Attempts: 1, NextAttemptAt: day.Add(time.Minute)},
+		{ID: "m2", WebhookID: "w2", Attempts: 1, NextAttemptAt: day},
+		{ID: "m3", WebhookID: "w5", Attempts: 1, NextAttemptAt: day.Add(time.Hour)},
+		{ID: "m4", WebhookID: "w1", Attempts: 5, UpdatedAt: day, Dead: true},
+		{ID: "m5", WebhookID: "w5", Attempts: 5, UpdatedAt: day.Add(time.Minute), Dead: true},
+		{ID: "m6", WebhookID: "w2", Attempts: 5, UpdatedAt: day, Dead: true},
+	} {
+		require.NoError(t, s.SaveWebhookMessage(ctx, m))
+	}
+	err := s.SaveWebhookMessage(ctx, storage.WebhookMessage{ID: "m7", WebhookID: "unknown"})
+	require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+
+	// Due messages are claimed the earliest first and are not due again until the claim expires.
+	claimed, err := s.ClaimWebhookMessages(ctx, day.Add(time.Minute), day.Add(10*time.Minute), 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"m2"}, messageIDs(claimed, nil))
+	require.Equal(t, day.Add(10*time.Minute), claimed[0].NextAttemptAt)
+	claimed, err = s.ClaimWebhookMessages(ctx, day.Add(time.Minute), day.Add(10*time.Minute), 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"m1"}, messageIDs(claimed, nil))
+	require.Equal(t, `{}`, string(claimed[0].Body))
+	require.Empty(t, messageIDs(s.ClaimWebhookMessages(ctx, day.Add(5*time.Minute), day.Add(10*time.Minute), 10)))
+
+	// A delivered message is deleted, a failed one is saved with its next attempt.
+	require.NoError(t, s.DeleteWebhookMessage(ctx, "m1"))
+	require.NoError(t, s.SaveWebhookMessage(ctx, storage.WebhookMessage{ID: "m2", WebhookID: "w2", Attempts: 2, NextAttemptAt: day.Add(20 * time.Minute)}))
+	require.Equal(t, []string{"m2", "m3"}, messageIDs(s.ClaimWebhookMessages(ctx, day.Add(time.Hour), day.Add(2*time.Hour), 10)))
+
+	// Messages of disabled webhooks wait until the webhook is enabled.
+	require.NoError(t, s.SaveWebhookMessage(ctx, storage.WebhookMessage{ID: "m2", WebhookID: "w2", Attempts: 3, NextAttemptAt: day}))
+	_, err = s.RecordWebhookResult(ctx, "w2", false, 1)
+	require.NoError(t, err)
+	require.Empty(t, messageIDs(s.ClaimWebhookMessages(ctx, day.Add(time.Hour), day.Add(2*time.Hour), 10)))
+	require.NoError(t, s.EnableWebhook(ctx, "reader", "w2"))
+	require.Equal(t, []string{"m2"}, messageIDs(s.ClaimWebhookMessages(ctx, day.Add(time.Hour), day.Add(2*time.Hour), 10)))
+	require.NoError(t, s.DeleteWebhookMessage(ctx, "m2"))
+	require.NoError(t, s.DeleteWebhookMessage(ctx, "m3"))
+
+	// Dead letters are listed for the owner of the webhook, the latest first.
+	require.Equal(t, []string{"m5", "m4"}, messageIDs(s.ListWebhookDeadLetters(ctx, "owner", "")))
+	require.Equal(t, []string{"m4"}, messageIDs(s.ListWebhookDeadLetters(ctx, "owner", "w1")))
+	require.Equal(t, []string{"m6"}, messageIDs(s.ListWebhookDeadLetters(ctx, "reader", "")))
+	_, err = s.ListWebhookDeadLetters(ctx, "reader", "w1")
+	require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+
+	// Redriven dead letters are due at once with all their attempts.
+	redriven, err := s.RedriveWebhookDeadLetters(ctx, "reader", "", []string{"m4", "m6"}, day.Add(3*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, redriven)
+	_, err = s.RedriveWebhookDeadLetters(ctx, "reader", "w1", nil, day.Add(3*time.Hour))
+	require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+	redriven, err = s.RedriveWebhookDeadLetters(ctx, "owner", "", nil, day.Add(3*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, redriven)
+	require.Empty(t, messageIDs(s.ListWebhookDeadLetters(ctx, "owner", "")))
+
+	claimed, err = s.ClaimWebhookMessages(ctx, day.Add(3*time.Hour), day.Add(4*time.Hour), 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"m4", "m5", "m6"}, messageIDs(claimed, nil))
+	for _, m := range claimed {
+		require.False(t, m.Dead)
+		require.Zero(t, m.Attempts)
+	}
+}
+
+// fillTenant creates the data of every kind for alice in the tenant.
+func fillTenant(t *testing.T, s Storage, tenantID string) {
+	t.Helper()
+	ctx := storage.WithTenantID(context.Background(), tenantID)
+
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: tenantID, OwnerID: "alice", Name: "Work"}))
+	require.NoError(t, s.ShareCalendar(ctx, "alice", storage.Grant{CalendarID: tenantID, UserID: "bob", Access: storage.AccessRead}))
+	e := newEvent(tenantID+"-1", tenantID, day.Add(10*time.Hour))
+	e.OwnerID = "alice"
+	e.Reminders = []storage.Reminder{{ID: "r1", Before: time.Hour, Channel: storage.ChannelEmail}}
+	require.NoError(t, s.CreateEvent(ctx, "alice", e))
+	require.NoError(t, s.MarkDelivered(ctx, storage.Delivery{
+		EventID: e.ID, ReminderID: "r1", Channel: storage.ChannelEmail, NotifyAt: day.Add(9 * time.Hour), SentAt: day.Add(9 * time.Hour),
+	}))
+	require.NoError(t, s.CreateEvent(ctx, "alice", newEvent(tenantID+"-2", tenantID, day)))
+	require.NoError(t, s.TrashEvent(ctx, "alice", tenantID+"-2", day))
+	require.NoError(t, s.AppendAudit(ctx, storage.AuditEntry{
+		ID: tenantID, EventID: e.ID, CalendarID: tenantID, ActorID: "alice", Change: storage.ChangeCreated, At: day,
+	}))
+	require.NoError(t, s.CreateWebhook(ctx, storage.Webhook{ID: tenantID, UserID: "alice", URL: "https://example.com/" + tenantID}))
+	require.NoError(t, s.AddWebhookDelivery(ctx, storage.WebhookDelivery{ID: tenantID, WebhookID: tenantID, Success: true}))
+	require.NoError(t, s.SaveWebhookMessage(ctx, storage.WebhookMessage{ID: tenantID, WebhookID: tenantID, Dead: true}))
+	require.NoError(t, s.PutTag(ctx, storage.Tag{UserID: "alice", Name: tenantID, Color: "#ff0000"}))
+	require.NoError(t, s.SetWorkingHours(ctx, storage.WorkingHours{UserID: "alice", TimeZone: "UTC", Start: 9 * time.Hour, End: 18 * time.Hour}))
+	require.NoError(t, s.SetPreferences(ctx, storage.Preferences{UserID: "alice", TimeZone: "UTC", Locale: tenantID}))
+}
+
+// requireIsolated checks that users of the tenant see nothing of the other tenant and can't change it.
+func requireIsolated(t *testing.T, s Storage, tenantID, other string) {
+	t.Helper()
+	ctx := storage.WithTenantID(context.Background(), tenantID)
+
+	for _, user := range []string{"alice", "bob"} {
+		_, err := s.GetCalendar(ctx, user, other)
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+		_, err = s.GetEvent(ctx, user, other+"-1")
+		require.True(t, errors.Is(err, storage.ErrEventNotFound))
+
+		calendars, err := s.ListCalendars(ctx, user)
+		require.NoError(t, err)
+		for _, cal := range calendars {
+			require.Equal(t, tenantID, cal.TenantID)
+		}
+		events, err := s.ListEvents(ctx, user, day.AddDate(0, 0, -1), day.AddDate(0, 0, 2))
+		require.NoError(t, err)
+		for _, e := range events {
+			require.NotEqual(t, other, e.CalendarID)
+		}
+		trash, err := s.ListTrash(ctx, user)
+		require.NoError(t, err)
+		for _, e := range trash {
+			require.NotEqual(t, other, e.CalendarID)
+		}
+		entries, err := s.ListAudit(ctx, user, storage.AuditFilter{ActorID: "alice"})
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.Equal(t, tenantID, entry.TenantID)
+		}
+		deliveries, err := s.ListDeliveries(ctx, user)
+		require.NoError(t, err)
+		for _, d := range deliveries {
+			require.NotEqual(t, other+"-1", d.EventID)
+		}
+		webhooks, err := s.ListWebhooks(ctx, user)
+		require.NoError(t, err)
+		for _, w := range webhooks {
+			require.Equal(t, tenantID, w.TenantID)
+		}
+		_, err = s.ListWebhookDeliveries(ctx, user, other)
+		require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+		_, err = s.ListWebhookDeadLetters(ctx, user, other)
+		require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+		tags, err := s.ListTags(ctx, user)
+		require.NoError(t, err)
+		for _, tag := range tags {
+			require.Equal(t, tenantID, tag.TenantID)
+		}
+		_, err = s.ListShares(ctx, user, other)
+		require.True(t, errors.Is(err, storage.ErrCalendarNotFound))
+	}
+
+	require.True(t, errors.Is(s.CreateEvent(ctx, "alice", newEvent(tenantID+"-x", other, day)), storage.ErrCalendarNotFound))
+	require.True(t, errors.Is(s.UpdateEvent(ctx, "alice", newEvent(other+"-1", tenantID, day)), storage.ErrEventNotFound))
+	require.True(t, errors.Is(s.DeleteEvent(ctx, "alice", other+"-1"), storage.ErrEventNotFound))
+	require.True(t, errors.Is(s.TrashEvent(ctx, "alice", other+"-1", day), storage.ErrEventNotFound))
+	require.True(t, errors.Is(s.RestoreEvent(ctx, "alice", other+"-2"), storage.ErrEventNotFound))
+	require.True(t, errors.Is(s.ShareCalendar(ctx, "alice", storage.Grant{
+		CalendarID: other, UserID: "mallory", Access: storage.AccessRead,
+	}), storage.ErrCalendarNotFound))
+	require.True(t, errors.Is(s.RevokeShare(ctx, "alice", other, "bob"), storage.ErrCalendarNotFound))
+	require.True(t, errors.Is(s.DeleteCalendar(ctx, "alice", other), storage.ErrCalendarNotFound))
+	require.True(t, errors.Is(s.DeleteWebhook(ctx, "alice", other), storage.ErrWebhookNotFound))
+	require.True(t, errors.Is(s.EnableWebhook(ctx, "alice", other), storage.ErrWebhookNotFound))
+	_, err := s.RedriveWebhookDeadLetters(ctx, "alice", other, nil, day)
+	require.True(t, errors.Is(err, storage.ErrWebhookNotFound))
+	redriven, err := s.RedriveWebhookDeadLetters(ctx, "alice", "", []string{other}, day)
+	require.NoError(t, err)
+	require.Zero(t, redriven)
+	require.Error(t, s.ApplyEventOps(ctx, "alice", []storage.EventOp{
+		{Change: storage.ChangeDeleted, Event: storage.Event{ID: other + "-1", DeletedAt: day}},
+	}))
+}
+
+// requireTenant checks that alice sees the data of her tenant.
+func requireTenant(t *testing.T, s Storage, tenantID string) {
+	t.Helper()
+	ctx := storage.WithTenantID(context.Background(), tenantID)
+
+	cal, err := s.GetCalendar(ctx, "bob", tenantID)
+	require.NoError(t, err)
+	require.Equal(t, tenantID, cal.TenantID)
+	_, err = s.GetEvent(ctx, "alice", tenantID+"-1")
+	require.NoError(t, err)
+	// The event in the trash is not counted.
+	count, err := s.CountEvents(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	trash, err := s.ListTrash(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	entries, err := s.ListAudit(ctx, "alice", storage.AuditFilter{ActorID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	deliveries, err := s.ListDeliveries(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	webhooks, err := s.ListWebhooks(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	webhookDeliveries, err := s.ListWebhookDeliveries(ctx, "alice", tenantID)
+	require.NoError(t, err)
+	require.Len(t, webhookDeliveries, 1)
+	dead, err := s.ListWebhookDeadLetters(ctx, "alice", "")
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, tenantID, dead[0].TenantID)
+
+	tags, err := s.ListTags(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, tags, 1)
+	require.Equal(t, tenantID, tags[0].Name)
+	_, err = s.GetWorkingHours(ctx, "alice")
+	require.NoError(t, err)
+	p, err := s.GetPreferences(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, tenantID, p.Locale)
+}
+
+func testTenants(t *testing.T, s, restored Storage) {
+	// Users with the same IDs in different tenants are different users.
+	fillTenant(t, s, "acme")
+	fillTenant(t, s, "globex")
+
+	check := func(t *testing.T, s Storage) {
+		t.Helper()
+		requireTenant(t, s, "acme")
+		requireTenant(t, s, "globex")
+		requireIsolated(t, s, "acme", "globex")
+		requireIsolated(t, s, "globex", "acme")
+		requireIsolated(t, s, storage.DefaultTenant, "acme")
+
+		ctx := context.Background()
+		_, err := s.GetWorkingHours(ctx, "alice")
+		require.True(t, errors.Is(err, storage.ErrWorkingHoursNotFound))
+		_, err = s.GetPreferences(ctx, "alice")
+		require.True(t, errors.Is(err, storage.ErrPreferencesNotFound))
+		count, err := s.CountEvents(ctx)
+		require.NoError(t, err)
+		require.Zero(t, count)
+	}
+
+	t.Run("isolated", func(t *testing.T) {
+		check(t, s)
+	})
+
+	t.Run("webhooks for calendar", func(t *testing.T) {
+		// Changes are delivered to the webhooks of the tenant of the calendar only.
+		webhooks, err := s.WebhooksForCalendar(storage.WithTenantID(context.Background(), "acme"), "acme")
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		require.Equal(t, "acme", webhooks[0].TenantID)
+		webhooks, err = s.WebhooksForCalendar(context.Background(), "acme")
+		require.NoError(t, err)
+		require.Empty(t, webhooks)
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		snap, err := s.Snapshot(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, restored.Restore(context.Background(), snap))
+		check(t, restored)
+	})
+
+	t.Run("same ids", func(t *testing.T) {
+		testSameIDs(t, s, restored)
+	})
+}
+
+// testSameIDs checks that IDs of calendars, events and webhooks are unique within their tenant only.
+func testSameIDs(t *testing.T, s, restored Storage) {
+	acme := storage.WithTenantID(context.Background(), "acme")
+	globex := storage.WithTenantID(context.Background(), "globex")
+	now := day.Add(9 * time.Hour)
+
+	for _, ctx := range []context.Context{acme, globex} {
+		tenantID := storage.TenantID(ctx)
+		require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "work", OwnerID: "owner", Name: tenantID}))
+		require.NoError(t, s.ShareCalendar(ctx, "owner", storage.Grant{CalendarID: "work", UserID: "reader", Access: storage.AccessRead}))
+		e := newEvent("1", "work", day.Add(10*time.Hour))
+		e.Title = tenantID
+		e.UID = "standup"
+		e.Reminders = []storage.Reminder{{ID: "r1", Before: time.Hour, Channel: storage.ChannelEmail}}
+		require.NoError(t, s.CreateEvent(ctx, "owner", e))
+		require.NoError(t, s.CreateWebhook(ctx, storage.Webhook{ID: "hook", UserID: "owner", URL: "https://example.com/" + tenantID}))
+		require.NoError(t, s.AddWebhookDelivery(ctx, storage.WebhookDelivery{ID: tenantID, WebhookID: "hook", Success: true}))
+	}
+
+	// Each tenant sees its own data under the shared IDs.
+	for _, ctx := range []context.Context{acme, globex} {
+		tenantID := storage.TenantID(ctx)
+		cal, err := s.GetCalendar(ctx, "reader", "work")
+		require.NoError(t, err)
+		require.Equal(t, tenantID, cal.Name)
+		e, err := s.GetEvent(ctx, "reader", "1")
+		require.NoError(t, err)
+		require.Equal(t, tenantID, e.Title)
+		require.Equal(t, tenantID, e.TenantID)
+		e, err = s.FindEvent(ctx, "reader", "work", "standup")
+		require.NoError(t, err)
+		require.Equal(t, tenantID, e.Title)
+		events, err := s.ListEvents(ctx, "reader", day, day.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		webhooks, err := s.WebhooksForCalendar(ctx, "work")
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		require.Equal(t, "https://example.com/"+tenantID, webhooks[0].URL)
+		deliveries, err := s.ListWebhookDeliveries(ctx, "owner", "hook")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		require.Equal(t, tenantID, deliveries[0].ID)
+	}
+
+	// Notifications of both events are due and are delivered in their own tenants.
+	due, err := s.DueNotifications(context.Background(), now)
+	require.NoError(t, err)
+	var tenants []string
+	for _, n := range due {
+		if n.EventID == "1" {
+			tenants = append(tenants, n.TenantID)
+		}
+	}
+	require.Equal(t, []string{"acme", "globex"}, tenants)
+	require.NoError(t, s.MarkDelivered(acme, storage.Delivery{
+		EventID: "1", ReminderID: "r1", Channel: storage.ChannelEmail, NotifyAt: now, SentAt: now,
+	}))
+	deliveries, err := s.ListDeliveries(acme, "owner")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "acme", deliveries[0].TenantID)
+	deliveries, err = s.ListDeliveries(globex, "owner")
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+
+	// Changes in one tenant leave the other one alone.
+	_, err = s.RecordWebhookResult(acme, "hook", false, 1)
+	require.NoError(t, err)
+	webhooks, err := s.WebhooksForCalendar(globex, "work")
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.NoError(t, s.TrashEvent(acme, "owner", "1", now))
+	require.NoError(t, s.DeleteCalendar(acme, "owner", "work"))
+	require.NoError(t, s.DeleteWebhook(acme, "owner", "hook"))
+	_, err = s.GetEvent(globex, "owner", "1")
+	require.NoError(t, err)
+	_, err = s.GetCalendar(globex, "reader", "work")
+	require.NoError(t, err)
+	webhooks, err = s.ListWebhooks(globex, "owner")
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.NoError(t, s.CreateCalendar(acme, storage.Calendar{ID: "work", OwnerID: "owner"}))
+	require.NoError(t, s.CreateEvent(acme, "owner", newEvent("1", "work", day)))
+
+	snap, err := s.Snapshot(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, restored.Restore(context.Background(), snap))
+	restoredSnap, err := restored.Snapshot(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, snap, restoredSnap)
+	e, err := restored.GetEvent(globex, "reader", "1")
+	require.NoError(t, err)
+	require.Equal(t, "globex", e.Title)
+}
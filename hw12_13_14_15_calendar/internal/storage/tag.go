@@ -0,0 +1,11 @@
+package storage
+
+// Tag is a user's label for events, e.g. a category. Events refer to tags by name,
+// so the same name can have a different colour for every user.
+type Tag struct {
+	TenantID string
+	UserID   string
+	Name     string
+	// Color is "#rrggbb".
+	Color string
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "context"
+
+// DefaultTenant is the tenant of requests without one, e.g. in deployments hosting a single team.
+const DefaultTenant = ""
+
+type tenantKey struct{}
+
+// WithTenantID returns the context of a request of the tenant. Storages keep tenants apart:
+// the data is created in the tenant of the context and only the data of that tenant is read
+// or changed, as if the other tenants did not exist. Users are identified within their tenant.
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantID returns the tenant of the context, DefaultTenant if there is none.
+func TenantID(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey{}).(string)
+	return tenantID
+}
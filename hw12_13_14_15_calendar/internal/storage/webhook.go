@@ -0,0 +1,52 @@
+package storage
+
+import "time"
+
+// Webhook is a user's subscription to changes of the events the user can read.
+type Webhook struct {
+	ID        string
+	TenantID  string
+	UserID    string
+	URL       string
+	Secret    string
+	CreatedAt time.Time
+	// Failures is the number of failed deliveries in a row.
+	Failures int
+	Disabled bool
+}
+
+// WebhookDelivery is an attempt to deliver a change to the webhook.
+type WebhookDelivery struct {
+	ID        string
+	TenantID  string
+	WebhookID string
+	Change    Change
+	EventID   string
+	Attempt   int
+	At        time.Time
+	// StatusCode is the HTTP status of the response, zero if the request failed.
+	StatusCode int
+	Error      string
+	Success    bool
+}
+
+// WebhookMessage is a change waiting for the next attempt to deliver it to the webhook. A message
+// whose attempts are exhausted is dead, it stays in the dead-letter queue until it is redriven.
+type WebhookMessage struct {
+	// ID is the ID of the delivery, the same in every attempt.
+	ID        string
+	TenantID  string
+	WebhookID string
+	Change    Change
+	EventID   string
+	// Body is the JSON payload sent to the webhook.
+	Body []byte
+	// TraceParent is the W3C trace context of the change.
+	TraceParent string
+	// Attempts is the number of failed attempts.
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	UpdatedAt     time.Time
+	Dead          bool
+}
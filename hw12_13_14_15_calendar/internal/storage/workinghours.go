@@ -0,0 +1,37 @@
+package storage
+
+import "time"
+
+// WorkingHours are the user's working days and the hours of each of them in the user's time zone.
+type WorkingHours struct {
+	TenantID string
+	UserID   string
+	// TimeZone is an IANA time zone name, e.g. "Europe/Moscow".
+	TimeZone string
+	// Start and End are offsets from midnight.
+	Start time.Duration
+	End   time.Duration
+	Days  []time.Weekday
+}
+
+// Location returns the time zone of the working hours.
+func (w WorkingHours) Location() (*time.Location, error) {
+	return time.LoadLocation(w.TimeZone)
+}
+
+// Day returns the working hours of the day of t in loc, ok is false for days off.
+func (w WorkingHours) Day(t time.Time, loc *time.Location) (start, end time.Time, ok bool) {
+	t = t.In(loc)
+	for _, d := range w.Days {
+		if d == t.Weekday() {
+			return clock(t, w.Start), clock(t, w.End), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// clock returns the wall clock time of the day of t, so that it stays the same across DST changes.
+func clock(t time.Time, offset time.Duration) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, t.Location())
+}
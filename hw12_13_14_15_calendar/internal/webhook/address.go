@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address is not allowed")
+
+// internalNetworks are private, shared and unique local networks, loopback and link-local
+// addresses are checked separately.
+var internalNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// allowed are the parsed Config.AllowedHosts.
+type allowed struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+func parseAllowed(entries []string) allowed {
+	a := allowed{hosts: make(map[string]bool)}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			a.networks = append(a.networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			a.networks = append(a.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		a.hosts[entry] = true
+	}
+	return a
+}
+
+// internal reports whether the address is not a public one.
+func internal(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) allowedHost(host string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.allowed.hosts[strings.ToLower(host)]
+}
+
+// checkAddress refuses connections to internal addresses which are not allowed. It is called
+// with the resolved address right before connecting, so host names resolving to internal
+// addresses are refused too.
+func (d *Dispatcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	if !internal(ip) {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, network := range d.allowed.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+}
+
+// newClient returns the client checking the addresses it connects to with control, if any.
+// Redirects are not followed, so a receiver can't send the delivery elsewhere.
+func newClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: control}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
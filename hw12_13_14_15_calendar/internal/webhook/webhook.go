@@ -0,0 +1,446 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/webhook")
+
+const (
+	HeaderDelivery  = "X-Calendar-Delivery"
+	HeaderEvent     = "X-Calendar-Event"
+	HeaderTimestamp = "X-Calendar-Timestamp"
+	HeaderSignature = "X-Calendar-Signature"
+
+	RetryJob = "webhook retry"
+
+	queueSize = 1024
+	// claimTimeout is how long a message claimed by the retry job is not due again. If the
+	// process stops before the attempt, the message is retried after that.
+	claimTimeout = 10 * time.Minute
+)
+
+type Storage interface {
+	WebhooksForCalendar(ctx context.Context, calendarID string) ([]storage.Webhook, error)
+	GetWebhook(ctx context.Context, webhookID string) (storage.Webhook, error)
+	AddWebhookDelivery(ctx context.Context, d storage.WebhookDelivery) error
+	RecordWebhookResult(ctx context.Context, webhookID string, success bool, maxFailures int) (storage.Webhook, error)
+
+	SaveWebhookMessage(ctx context.Context, m storage.WebhookMessage) error
+	DeleteWebhookMessage(ctx context.Context, messageID string) error
+	ClaimWebhookMessages(ctx context.Context, now, until time.Time, limit int) ([]storage.WebhookMessage, error)
+}
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+type Config struct {
+	// Workers can't be changed by SetConfig.
+	Workers int
+	// MaxAttempts is the number of attempts to deliver a change before it is dead.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, it doubles for every next one up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxFailures is the number of failed deliveries in a row which disables the webhook.
+	MaxFailures int
+	Timeout     time.Duration
+	// AllowedHosts are host names, IPs and CIDRs of internal receivers. Deliveries to loopback,
+	// link-local and private addresses are refused unless they are allowed here.
+	AllowedHosts []string
+}
+
+// Payload is the JSON body sent to webhooks.
+type Payload struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Event      Event     `json:"event"`
+}
+
+type Event struct {
+	ID          string    `json:"id"`
+	CalendarID  string    `json:"calendar_id"`
+	OwnerID     string    `json:"owner_id"`
+	Title       string    `json:"title"`
+	StartAt     time.Time `json:"start_at"`
+	EndAt       time.Time `json:"end_at"`
+	Description string    `json:"description,omitempty"`
+}
+
+type job struct {
+	webhook storage.Webhook
+	change  storage.Change
+	payload Payload
+	body    []byte
+	attempt int
+	// stored is set if the change is kept in the storage as a message.
+	stored bool
+
+	// The trace and the tenant of the change.
+	trace    trace.SpanContext
+	tenantID string
+}
+
+// context returns the context of the change without its cancellation, the change is delivered
+// after the request which made it is over.
+func (j job) context() context.Context {
+	return trace.ContextWithSpanContext(storage.WithTenantID(context.Background(), j.tenantID), j.trace)
+}
+
+// Dispatcher delivers event changes to webhooks in background. The first attempt is made at once,
+// the failed changes are saved in the storage and retried by the retry job until they are dead.
+type Dispatcher struct {
+	storage Storage
+	logger  Logger
+	client  *http.Client // refuses to connect to internal addresses
+	trusted *http.Client // for allowed hosts
+	jobs    chan job
+	now     func() time.Time
+	workers int
+
+	mu      sync.RWMutex
+	conf    Config
+	allowed allowed
+}
+
+func New(storage Storage, logger Logger, conf Config) *Dispatcher {
+	if conf.Workers <= 0 {
+		conf.Workers = 1
+	}
+	d := &Dispatcher{
+		storage: storage,
+		logger:  logger,
+		jobs:    make(chan job, queueSize),
+		now:     time.Now,
+		workers: conf.Workers,
+	}
+	d.client = newClient(d.checkAddress)
+	d.trusted = newClient(nil)
+	d.SetConfig(conf)
+	return d
+}
+
+// SetConfig changes the delivery settings, deliveries in progress complete with the old ones.
+func (d *Dispatcher) SetConfig(conf Config) {
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 1
+	}
+	conf.Workers = d.workers
+
+	allowed := parseAllowed(conf.AllowedHosts)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conf = conf
+	d.allowed = allowed
+}
+
+func (d *Dispatcher) config() Config {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.conf
+}
+
+// Sign returns the signature of the body sent at the timestamp.
+// Receivers compute HMAC-SHA256 of "<timestamp>.<body>" with the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// EventChanged queues the change for delivery to the webhooks of users who can read the event.
+func (d *Dispatcher) EventChanged(ctx context.Context, change storage.Change, e storage.Event) {
+	webhooks, err := d.storage.WebhooksForCalendar(ctx, e.CalendarID)
+	if err != nil {
+		d.logger.Error("failed to get webhooks: " + err.Error())
+		return
+	}
+
+	for _, w := range webhooks {
+		payload := Payload{
+			ID:         uuid.New().String(),
+			Type:       "event." + string(change),
+			OccurredAt: d.now(),
+			Event: Event{
+				ID:          e.ID,
+				CalendarID:  e.CalendarID,
+				OwnerID:     e.OwnerID,
+				Title:       e.Title,
+				StartAt:     e.StartAt,
+				EndAt:       e.EndAt,
+				Description: e.Description,
+			},
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			d.logger.Error("failed to encode webhook payload: " + err.Error())
+			return
+		}
+		d.enqueue(job{
+			webhook:  w,
+			change:   change,
+			payload:  payload,
+			body:     body,
+			attempt:  1,
+			trace:    trace.SpanContextFromContext(ctx),
+			tenantID: storage.TenantID(ctx),
+		})
+	}
+}
+
+func (d *Dispatcher) enqueue(j job) {
+	select {
+	case d.jobs <- j:
+	default:
+		d.logger.Error(fmt.Sprintf("webhook queue is full, delivery %s to %s is postponed", j.payload.ID, j.webhook.ID))
+		d.postpone(j)
+	}
+}
+
+// postpone leaves the change to the retry job. The stored ones are retried once their claim expires.
+func (d *Dispatcher) postpone(j job) {
+	if j.stored {
+		return
+	}
+	if err := d.storage.SaveWebhookMessage(j.context(), d.message(j, j.attempt-1, d.now())); err != nil {
+		d.logger.Error(fmt.Sprintf("failed to save webhook delivery %s to %s: %v", j.payload.ID, j.webhook.ID, err))
+	}
+}
+
+// Run delivers the queued changes until the context is done. Deliveries in progress are
+// completed, the queued ones are left to the retry job.
+func (d *Dispatcher) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.jobs:
+					d.deliver(j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for {
+		select {
+		case j := <-d.jobs:
+			d.postpone(j)
+		default:
+			return
+		}
+	}
+}
+
+// deliver sends the change and saves it for a retry if it fails. The attempt is bounded by
+// the client timeout, not by the context of the dispatcher.
+func (d *Dispatcher) deliver(j job) {
+	conf := d.config()
+	sendCtx, span := tracer.Start(j.context(), "Webhook.deliver")
+	statusCode, err := d.send(sendCtx, j, conf.Timeout)
+	tracing.End(span, err)
+	delivery := storage.WebhookDelivery{
+		ID:         j.payload.ID,
+		WebhookID:  j.webhook.ID,
+		Change:     j.change,
+		EventID:    j.payload.Event.ID,
+		Attempt:    j.attempt,
+		At:         d.now(),
+		StatusCode: statusCode,
+		Success:    err == nil,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if err := d.storage.AddWebhookDelivery(sendCtx, delivery); err != nil {
+		// The webhook has been deleted.
+		return
+	}
+
+	switch {
+	case delivery.Success:
+		if j.stored {
+			if err := d.storage.DeleteWebhookMessage(sendCtx, j.payload.ID); err != nil {
+				d.logger.Error(fmt.Sprintf("failed to delete webhook delivery %s: %v", j.payload.ID, err))
+			}
+		}
+		d.recordResult(sendCtx, j.webhook.ID, true)
+	case j.attempt < conf.MaxAttempts:
+		m := d.message(j, j.attempt, delivery.At.Add(d.backoff(j.attempt+1)))
+		m.LastError = delivery.Error
+		d.saveMessage(sendCtx, m)
+	default:
+		m := d.message(j, j.attempt, time.Time{})
+		m.LastError = delivery.Error
+		m.Dead = true
+		d.saveMessage(sendCtx, m)
+		d.logger.Info(fmt.Sprintf("webhook delivery %s to %s is dead after %d attempts", j.payload.ID, j.webhook.ID, j.attempt))
+		d.recordResult(sendCtx, j.webhook.ID, false)
+	}
+}
+
+// message returns the message of the change after the failed attempts, due at next.
+func (d *Dispatcher) message(j job, attempts int, next time.Time) storage.WebhookMessage {
+	return storage.WebhookMessage{
+		ID:            j.payload.ID,
+		WebhookID:     j.webhook.ID,
+		Change:        j.change,
+		EventID:       j.payload.Event.ID,
+		Body:          j.body,
+		TraceParent:   traceParent(j.trace),
+		Attempts:      attempts,
+		NextAttemptAt: next,
+		UpdatedAt:     d.now(),
+	}
+}
+
+func (d *Dispatcher) saveMessage(ctx context.Context, m storage.WebhookMessage) {
+	if err := d.storage.SaveWebhookMessage(ctx, m); err != nil && !errors.Is(err, storage.ErrWebhookNotFound) {
+		d.logger.Error(fmt.Sprintf("failed to save webhook delivery %s to %s: %v", m.ID, m.WebhookID, err))
+	}
+}
+
+// RetryJob returns the job which queues the changes due for another attempt every interval.
+func (d *Dispatcher) RetryJob(interval time.Duration) scheduler.Job {
+	return scheduler.Job{Name: RetryJob, Interval: interval, Run: d.Retry}
+}
+
+// Retry claims the changes due for another attempt and queues them, as many as fit in the queue.
+func (d *Dispatcher) Retry(ctx context.Context) error {
+	now := d.now()
+	messages, err := d.storage.ClaimWebhookMessages(ctx, now, now.Add(claimTimeout), cap(d.jobs)-len(d.jobs))
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		j, err := d.retryJob(storage.WithTenantID(ctx, m.TenantID), m)
+		if err != nil {
+			d.logger.Error(fmt.Sprintf("failed to retry webhook delivery %s to %s: %v", m.ID, m.WebhookID, err))
+			continue
+		}
+		d.enqueue(j)
+	}
+	return nil
+}
+
+func (d *Dispatcher) retryJob(ctx context.Context, m storage.WebhookMessage) (job, error) {
+	w, err := d.storage.GetWebhook(ctx, m.WebhookID)
+	if err != nil {
+		return job{}, err
+	}
+	var payload Payload
+	if err := json.Unmarshal(m.Body, &payload); err != nil {
+		return job{}, fmt.Errorf("decode payload: %w", err)
+	}
+	return job{
+		webhook:  w,
+		change:   m.Change,
+		payload:  payload,
+		body:     m.Body,
+		attempt:  m.Attempts + 1,
+		stored:   true,
+		trace:    spanContext(m.TraceParent),
+		tenantID: m.TenantID,
+	}, nil
+}
+
+// traceParent returns the W3C traceparent header of the span context, empty for an invalid one.
+func traceParent(sc trace.SpanContext) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier.Get("traceparent")
+}
+
+func spanContext(traceParent string) trace.SpanContext {
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	return trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+}
+
+func (d *Dispatcher) send(ctx context.Context, j job, timeout time.Duration) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.webhook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, j.payload.ID)
+	req.Header.Set(HeaderEvent, j.payload.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(j.webhook.Secret, timestamp, j.body))
+
+	client := d.client
+	if d.allowedHost(req.URL.Hostname()) {
+		client = d.trusted
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the attempt.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	conf := d.config()
+	delay := conf.Backoff
+	for i := 2; i < attempt; i++ {
+		delay *= 2
+		if conf.MaxBackoff > 0 && delay >= conf.MaxBackoff {
+			return conf.MaxBackoff
+		}
+	}
+	return delay
+}
+
+func (d *Dispatcher) recordResult(ctx context.Context, webhookID string, success bool) {
+	w, err := d.storage.RecordWebhookResult(ctx, webhookID, success, d.config().MaxFailures)
+	if err != nil {
+		return
+	}
+	if !success && w.Disabled {
+		d.logger.Info(fmt.Sprintf("webhook %s is disabled after %d failed deliveries", w.ID, w.Failures))
+	}
+}
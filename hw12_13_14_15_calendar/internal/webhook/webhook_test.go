@@ -0,0 +1,354 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// local allows deliveries to test servers.
+var local = []string{"127.0.0.1"}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string)  {}
+func (nopLogger) Error(string) {}
+
+func setup(t *testing.T, url string) (*memorystorage.Storage, storage.Event) {
+	t.Helper()
+
+	ctx := context.Background()
+	s := memorystorage.New()
+	require.NoError(t, s.CreateCalendar(ctx, storage.Calendar{ID: "cal", OwnerID: "alice", Name: "Work"}))
+	require.NoError(t, s.CreateWebhook(ctx, storage.Webhook{ID: "hook", UserID: "alice", URL: url, Secret: "secret"}))
+
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	e := storage.Event{
+		ID: "event", CalendarID: "cal", OwnerID: "alice", Title: "standup",
+		StartAt: start, EndAt: start.Add(15 * time.Minute),
+	}
+	return s, e
+}
+
+func TestDeliver(t *testing.T) {
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, Sign("secret", timestamp, body), r.Header.Get(HeaderSignature))
+		require.Equal(t, "event.created", r.Header.Get(HeaderEvent))
+
+		var p Payload
+		require.NoError(t, json.Unmarshal(body, &p))
+		require.Equal(t, r.Header.Get(HeaderDelivery), p.ID)
+		received <- p
+	}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(s, nopLogger{}, Config{MaxAttempts: 3, Timeout: time.Second, AllowedHosts: local})
+	go d.Run(ctx)
+	d.EventChanged(ctx, storage.ChangeCreated, e)
+
+	select {
+	case p := <-received:
+		require.Equal(t, "event.created", p.Type)
+		require.Equal(t, "standup", p.Event.Title)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	require.Eventually(t, func() bool {
+		deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+		return err == nil && len(deliveries) == 1 && deliveries[0].Success
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDeliverKeepsTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(s, nopLogger{}, Config{MaxAttempts: 1, Timeout: time.Second, AllowedHosts: local})
+	go d.Run(ctx)
+
+	// The request is over before the change is delivered.
+	reqCtx, span := otel.Tracer("test").Start(context.Background(), "request")
+	reqCtx, cancelReq := context.WithCancel(reqCtx)
+	d.EventChanged(reqCtx, storage.ChangeCreated, e)
+	cancelReq()
+	span.End()
+
+	require.Eventually(t, func() bool {
+		deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+		return err == nil && len(deliveries) == 1 && deliveries[0].Success
+	}, 5*time.Second, 10*time.Millisecond)
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "Webhook.deliver", spans[1].Name())
+	require.Equal(t, span.SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), spans[1].Parent().SpanID())
+}
+
+func TestRetryAndDisable(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(s, nopLogger{}, Config{
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   2 * time.Millisecond,
+		MaxFailures:  2,
+		Timeout:      time.Second,
+		AllowedHosts: local,
+	})
+	go d.Run(ctx)
+
+	d.EventChanged(ctx, storage.ChangeUpdated, e)
+	retryUntil(t, d, func() bool {
+		webhooks, err := s.ListWebhooks(ctx, "alice")
+		return err == nil && webhooks[0].Failures == 1
+	})
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	require.Equal(t, 3, deliveries[0].Attempt)
+	require.Equal(t, http.StatusInternalServerError, deliveries[0].StatusCode)
+
+	dead, err := s.ListWebhookDeadLetters(ctx, "alice", "hook")
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, deliveries[0].ID, dead[0].ID)
+	require.Equal(t, 3, dead[0].Attempts)
+	require.Contains(t, dead[0].LastError, "500")
+
+	d.EventChanged(ctx, storage.ChangeDeleted, e)
+	retryUntil(t, d, func() bool {
+		webhooks, err := s.ListWebhooks(ctx, "alice")
+		return err == nil && webhooks[0].Disabled
+	})
+
+	// Disabled webhooks get no more changes.
+	d.EventChanged(ctx, storage.ChangeDeleted, e)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 6, atomic.LoadInt32(&calls))
+}
+
+// retryUntil runs the retry job until the condition is met.
+func retryUntil(t *testing.T, d *Dispatcher, condition func() bool) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return d.Retry(context.Background()) == nil && condition()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRedrive(t *testing.T) {
+	var fail int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(s, nopLogger{}, Config{MaxAttempts: 1, Timeout: time.Second, AllowedHosts: local})
+	go d.Run(ctx)
+
+	reqCtx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	d.EventChanged(reqCtx, storage.ChangeCreated, e)
+	span.End()
+	var dead []storage.WebhookMessage
+	require.Eventually(t, func() bool {
+		var err error
+		dead, err = s.ListWebhookDeadLetters(ctx, "alice", "")
+		return err == nil && len(dead) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, span.SpanContext().TraceID(), spanContext(dead[0].TraceParent).TraceID())
+
+	// Dead letters are not retried until they are redriven.
+	require.NoError(t, d.Retry(ctx))
+	atomic.StoreInt32(&fail, 0)
+	redriven, err := s.RedriveWebhookDeadLetters(ctx, "alice", "hook", nil, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, redriven)
+
+	retryUntil(t, d, func() bool {
+		deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+		return err == nil && len(deliveries) == 2 && deliveries[0].Success
+	})
+	deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+	require.NoError(t, err)
+	require.Equal(t, dead[0].ID, deliveries[0].ID)
+	require.Equal(t, 1, deliveries[0].Attempt)
+
+	// The delivered message is deleted.
+	claimed, err := s.ClaimWebhookMessages(ctx, time.Now().Add(time.Hour), time.Now().Add(time.Hour), -1)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+	dead, err = s.ListWebhookDeadLetters(ctx, "alice", "")
+	require.NoError(t, err)
+	require.Empty(t, dead)
+}
+
+func TestStopSavesQueued(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New(s, nopLogger{}, Config{MaxAttempts: 3, Timeout: time.Second, AllowedHosts: local})
+	d.EventChanged(ctx, storage.ChangeCreated, e)
+	cancel()
+	d.Run(ctx)
+
+	// The queued change is saved for the retry job, whether its first attempt was made or not.
+	claimed, err := s.ClaimWebhookMessages(context.Background(), time.Now().Add(time.Hour), time.Now().Add(time.Hour), -1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, "event", claimed[0].EventID)
+	require.False(t, claimed[0].Dead)
+}
+
+func TestStopCompletesDelivery(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(s, nopLogger{}, Config{MaxAttempts: 1, Timeout: 5 * time.Second, AllowedHosts: local})
+	stopped := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(stopped)
+	}()
+	d.EventChanged(ctx, storage.ChangeCreated, e)
+
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("dispatcher stopped during a delivery")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-stopped
+
+	deliveries, err := s.ListWebhookDeliveries(context.Background(), "alice", "hook")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.True(t, deliveries[0].Success)
+}
+
+func TestBackoff(t *testing.T) {
+	d := New(nil, nopLogger{}, Config{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	require.Equal(t, time.Second, d.backoff(2))
+	require.Equal(t, 2*time.Second, d.backoff(3))
+	require.Equal(t, 4*time.Second, d.backoff(4))
+	require.Equal(t, 5*time.Second, d.backoff(5))
+}
+
+func TestSetConfig(t *testing.T) {
+	d := New(nil, nopLogger{}, Config{Workers: 2, Backoff: time.Second})
+	d.SetConfig(Config{Workers: 8, Backoff: time.Minute})
+	require.Equal(t, time.Minute, d.backoff(2))
+	require.Equal(t, 1, d.config().MaxAttempts)
+	require.Equal(t, 2, d.config().Workers)
+}
+
+func TestForbiddenAddress(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	s, e := setup(t, server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := New(s, nopLogger{}, Config{MaxAttempts: 1, Timeout: time.Second})
+	go d.Run(ctx)
+	d.EventChanged(ctx, storage.ChangeCreated, e)
+
+	require.Eventually(t, func() bool {
+		deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+		return err == nil && len(deliveries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	deliveries, err := s.ListWebhookDeliveries(ctx, "alice", "hook")
+	require.NoError(t, err)
+	require.False(t, deliveries[0].Success)
+	require.Contains(t, deliveries[0].Error, ErrForbiddenAddress.Error())
+	require.Zero(t, atomic.LoadInt32(&calls))
+}
+
+func TestCheckAddress(t *testing.T) {
+	d := New(nil, nopLogger{}, Config{AllowedHosts: []string{"10.1.0.0/16", "192.168.1.10", "Sink.Internal"}})
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:443":  true,
+		"[2606:4700::1]:443": true,
+		"10.1.2.3:80":        true,
+		"192.168.1.10:80":    true,
+		"127.0.0.1:80":       false,
+		"[::1]:80":           false,
+		"169.254.169.254:80": false,
+		"10.2.0.1:80":        false,
+		"172.16.0.1:80":      false,
+		"192.168.1.11:80":    false,
+		"0.0.0.0:80":         false,
+		"[fd00::1]:80":       false,
+		"[fe80::1]:80":       false,
+		"sink.internal:80":   false,
+	} {
+		err := d.checkAddress("tcp", address, nil)
+		require.Equal(t, allowed, err == nil, address)
+	}
+	require.True(t, d.allowedHost("sink.internal"))
+	require.False(t, d.allowedHost("other.internal"))
+}
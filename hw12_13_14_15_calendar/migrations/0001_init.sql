@@ -0,0 +1,173 @@
+-- Every table is keyed by the tenant: IDs of calendars, events and webhooks are unique within their tenant only.
+-- Zero times are stored as NULL, durations as nanoseconds.
+
+CREATE TABLE calendars (
+    tenant_id text NOT NULL,
+    id        text NOT NULL,
+    owner_id  text NOT NULL,
+    name      text NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+CREATE TABLE grants (
+    tenant_id   text    NOT NULL,
+    calendar_id text    NOT NULL,
+    user_id     text    NOT NULL,
+    access      integer NOT NULL,
+    PRIMARY KEY (tenant_id, calendar_id, user_id),
+    FOREIGN KEY (tenant_id, calendar_id) REFERENCES calendars ON DELETE CASCADE
+);
+
+CREATE TABLE events (
+    tenant_id   text NOT NULL,
+    id          text NOT NULL,
+    calendar_id text NOT NULL,
+    uid         text NOT NULL,
+    -- ical_uid is the UID, or the ID of events without one.
+    ical_uid    text NOT NULL,
+    owner_id    text NOT NULL,
+    title       text NOT NULL,
+    start_at    timestamptz,
+    end_at      timestamptz,
+    description text NOT NULL,
+    reminders   jsonb NOT NULL,
+    tags        jsonb NOT NULL,
+    attachments jsonb NOT NULL,
+    deleted_at  timestamptz,
+    deleted_by  text NOT NULL,
+    PRIMARY KEY (tenant_id, id),
+    UNIQUE (tenant_id, calendar_id, ical_uid),
+    FOREIGN KEY (tenant_id, calendar_id) REFERENCES calendars ON DELETE CASCADE
+);
+
+CREATE INDEX events_start_at ON events (tenant_id, start_at) WHERE deleted_at IS NULL;
+CREATE INDEX events_deleted_at ON events (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- deliveries are the last attempts to send the reminders of events.
+CREATE TABLE deliveries (
+    tenant_id   text    NOT NULL,
+    event_id    text    NOT NULL,
+    reminder_id text    NOT NULL,
+    channel     text    NOT NULL,
+    notify_at   timestamptz,
+    sent_at     timestamptz,
+    status      text    NOT NULL,
+    attempts    integer NOT NULL,
+    error       text    NOT NULL,
+    PRIMARY KEY (tenant_id, event_id, reminder_id),
+    FOREIGN KEY (tenant_id, event_id) REFERENCES events ON DELETE CASCADE
+);
+
+-- outbox keeps the notifications queued in the same transaction as their deliveries, the oldest
+-- first. Messages of deleted events and changed reminders are left behind and skipped.
+CREATE TABLE outbox (
+    seq         bigserial PRIMARY KEY,
+    id          text    NOT NULL,
+    tenant_id   text    NOT NULL,
+    event_id    text    NOT NULL,
+    reminder_id text    NOT NULL,
+    channel     text    NOT NULL,
+    notify_at   timestamptz,
+    title       text    NOT NULL,
+    start_at    timestamptz,
+    user_id     text    NOT NULL,
+    attempts    integer NOT NULL,
+    created_at  timestamptz
+);
+
+CREATE INDEX outbox_reminder ON outbox (tenant_id, event_id, reminder_id);
+
+CREATE TABLE audit (
+    seq         bigserial PRIMARY KEY,
+    id          text  NOT NULL,
+    tenant_id   text  NOT NULL,
+    event_id    text  NOT NULL,
+    calendar_id text  NOT NULL,
+    actor_id    text  NOT NULL,
+    transport   text  NOT NULL,
+    change      text  NOT NULL,
+    changed_at  timestamptz,
+    diff        jsonb NOT NULL
+);
+
+CREATE INDEX audit_event ON audit (tenant_id, event_id);
+CREATE INDEX audit_actor ON audit (tenant_id, actor_id);
+
+CREATE TABLE webhooks (
+    tenant_id  text    NOT NULL,
+    id         text    NOT NULL,
+    user_id    text    NOT NULL,
+    url        text    NOT NULL,
+    secret     text    NOT NULL,
+    created_at timestamptz,
+    failures   integer NOT NULL,
+    disabled   boolean NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+CREATE TABLE webhook_deliveries (
+    seq          bigserial PRIMARY KEY,
+    id           text    NOT NULL,
+    tenant_id    text    NOT NULL,
+    webhook_id   text    NOT NULL,
+    change       text    NOT NULL,
+    event_id     text    NOT NULL,
+    attempt      integer NOT NULL,
+    delivered_at timestamptz,
+    status_code  integer NOT NULL,
+    error        text    NOT NULL,
+    success      boolean NOT NULL,
+    FOREIGN KEY (tenant_id, webhook_id) REFERENCES webhooks ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (tenant_id, webhook_id, seq);
+
+-- webhook_messages are the changes waiting for another attempt and the dead letters.
+CREATE TABLE webhook_messages (
+    tenant_id       text    NOT NULL,
+    id              text    NOT NULL,
+    webhook_id      text    NOT NULL,
+    change          text    NOT NULL,
+    event_id        text    NOT NULL,
+    body            bytea,
+    trace_parent    text    NOT NULL,
+    attempts        integer NOT NULL,
+    next_attempt_at timestamptz,
+    last_error      text    NOT NULL,
+    updated_at      timestamptz,
+    dead            boolean NOT NULL,
+    PRIMARY KEY (tenant_id, id),
+    FOREIGN KEY (tenant_id, webhook_id) REFERENCES webhooks ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_messages_due ON webhook_messages (next_attempt_at) WHERE NOT dead;
+
+CREATE TABLE tags (
+    tenant_id text NOT NULL,
+    user_id   text NOT NULL,
+    -- name_key is the lower-cased name, names are case-insensitive.
+    name_key  text NOT NULL,
+    name      text NOT NULL,
+    color     text NOT NULL,
+    PRIMARY KEY (tenant_id, user_id, name_key)
+);
+
+CREATE TABLE working_hours (
+    tenant_id    text   NOT NULL,
+    user_id      text   NOT NULL,
+    time_zone    text   NOT NULL,
+    start_offset bigint NOT NULL,
+    end_offset   bigint NOT NULL,
+    days         jsonb  NOT NULL,
+    PRIMARY KEY (tenant_id, user_id)
+);
+
+CREATE TABLE preferences (
+    tenant_id        text    NOT NULL,
+    user_id          text    NOT NULL,
+    time_zone        text    NOT NULL,
+    locale           text    NOT NULL,
+    week_start       integer NOT NULL,
+    default_reminder jsonb   NOT NULL,
+    PRIMARY KEY (tenant_id, user_id)
+);
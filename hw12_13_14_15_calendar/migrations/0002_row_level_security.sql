@@ -0,0 +1,59 @@
+-- Row-level security keeps tenants apart even if a query forgets its tenant condition. Every
+-- transaction of the storage sets calendar.scope to 'tenant' with calendar.tenant_id, or to 'all'
+-- for the jobs of all tenants; outside of them no rows are visible. The policies are forced on the
+-- owner of the tables too, but they don't apply to superusers and roles with BYPASSRLS, so the
+-- storage must connect as an ordinary role.
+
+CREATE FUNCTION tenant_visible(tenant_id text) RETURNS boolean LANGUAGE sql STABLE AS $$
+    SELECT current_setting('calendar.scope', true) = 'all'
+        OR current_setting('calendar.scope', true) = 'tenant'
+            AND tenant_id = current_setting('calendar.tenant_id', true)
+$$;
+
+ALTER TABLE calendars ENABLE ROW LEVEL SECURITY;
+ALTER TABLE calendars FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON calendars USING (tenant_visible(tenant_id));
+
+ALTER TABLE grants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE grants FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON grants USING (tenant_visible(tenant_id));
+
+ALTER TABLE events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE events FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON events USING (tenant_visible(tenant_id));
+
+ALTER TABLE deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deliveries FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON deliveries USING (tenant_visible(tenant_id));
+
+ALTER TABLE outbox ENABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON outbox USING (tenant_visible(tenant_id));
+
+ALTER TABLE audit ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON audit USING (tenant_visible(tenant_id));
+
+ALTER TABLE webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON webhooks USING (tenant_visible(tenant_id));
+
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON webhook_deliveries USING (tenant_visible(tenant_id));
+
+ALTER TABLE webhook_messages ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_messages FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON webhook_messages USING (tenant_visible(tenant_id));
+
+ALTER TABLE tags ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tags FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON tags USING (tenant_visible(tenant_id));
+
+ALTER TABLE working_hours ENABLE ROW LEVEL SECURITY;
+ALTER TABLE working_hours FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON working_hours USING (tenant_visible(tenant_id));
+
+ALTER TABLE preferences ENABLE ROW LEVEL SECURITY;
+ALTER TABLE preferences FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON preferences USING (tenant_visible(tenant_id));
@@ -0,0 +1,7 @@
+-- leases elect the leader among the replicas. They belong to no tenant, so they are not a part
+-- of snapshots and row-level security doesn't apply to them.
+CREATE TABLE leases (
+    name       text        PRIMARY KEY,
+    holder     text        NOT NULL,
+    expires_at timestamptz NOT NULL
+);
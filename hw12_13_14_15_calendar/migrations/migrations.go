@@ -0,0 +1,8 @@
+// Package migrations contains the schema of the SQL storage. The files are applied in the order
+// of their names when the storage connects, each of them once.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS